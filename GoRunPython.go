@@ -1,9 +1,7 @@
 package gorunpython
 
 import (
-	"archive/tar"
 	"bytes"
-	"compress/gzip"
 	"errors"
 	"fmt"
 	"io"
@@ -12,10 +10,14 @@ import (
 	"path/filepath"
 	"runtime"
 	"strings"
+	"sync"
+
+	"github.com/ZacTyAdams/go-run-python/v2/internal/pyenv"
 )
 
 var noisy = os.Getenv("GORUNPYTHON_NOISY")
 var keepTemp = os.Getenv("GORUNPYTHON_KEEP_TEMP")
+var repairKept = os.Getenv("GORUNPYTHON_REPAIR")
 
 type pythonInstance struct {
 	ExtractionPath  string
@@ -24,93 +26,101 @@ type pythonInstance struct {
 	ExecutablesPath string
 	Executables     map[string]pythonExecutable
 	PythonVersion   string
+	layout          *pythonLayout
+	source          BundleSource
+	sourceKey       string
+	launcher        string
+	callbacks       *callbackRegistry
+	callbacksMu     sync.Mutex
 }
 
 type pythonExecutable struct {
 	ExecutableName string
+	// ExecutablePath is the generated wrapper in the bin directory, or empty if there is none
 	ExecutablePath string
+	// Module and Function are the console script's entry point, e.g. "black" and "patched_main"
+	Module   string
+	Function string
+	python   string
+	launcher string
 }
 
-// CreatePythonInstance unpacks the appropriate embedded python package for the current OS and architecture
-func CreatePythonInstance() (*pythonInstance, error) {
+// CreatePythonInstance unpacks the appropriate embedded python package for the current OS and architecture,
+// or the bundle file named by GORUNPYTHON_BUNDLE if that is set. WithVersion picks another registered version.
+func CreatePythonInstance(opts ...Option) (*pythonInstance, error) {
+	var o createOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	src, err := selectBundle(o)
+	if err != nil {
+		return nil, err
+	}
+	return CreatePythonInstanceFromBundle(src)
+}
+
+// CreatePythonInstanceFromBundle unpacks the python bundle supplied by src, e.g. BundleFromFile for a bundle
+// shipped next to the binary or BundleFromFS for one inside a sealed payload
+func CreatePythonInstanceFromBundle(src BundleSource) (*pythonInstance, error) {
 	osName := runtime.GOOS
 	arch := runtime.GOARCH
 
 	fmt.Println("Go current runnon on operating system: ", osName)
 	fmt.Println("Go current architecture: ", arch)
-	fmt.Println("Selecting appropriate embedded python package...")
+	fmt.Println("Selecting python package: ", src)
 
 	if keepTemp != "" {
-		if reused, err := reuseKeptInstance(osName); err != nil {
+		if reused, err := reuseKeptInstance(osName, src); err != nil {
 			return nil, err
 		} else if reused != nil {
 			return reused, nil
 		}
 	}
 
-	// select embedded python package for this build (set via build-tag specific file)
-	if len(embeddedPython) == 0 {
-		return nil, fmt.Errorf("no embedded python package for %s-%s; add an embed file with matching //go:build or build for a supported target", osName, arch)
+	python_package, err := src.ReadBundle()
+	if err != nil {
+		return nil, err
 	}
-	python_package := embeddedPython
-	var err error
 	// unpack python
-	var dname string
-	if osName == "linux" {
-		tmpDir, err := os.MkdirTemp("./", "python-tmp")
-		if err != nil {
-			panic(err)
-		}
-		dname, err = filepath.Abs(tmpDir)
-		if err != nil {
-			panic(err)
-		}
-	} else {
-		tmpDir, err := os.MkdirTemp("./", "python-tmp")
-		if err != nil {
-			panic(err)
-		}
-		dname, err = filepath.Abs(tmpDir)
-		if err != nil {
-			panic(err)
-		}
+	tmpDir, err := os.MkdirTemp("./", "python-tmp")
+	if err != nil {
+		return nil, fmt.Errorf("create extraction directory: %w", err)
 	}
-	fmt.Println("Temp dir absolute path: ", dname)
-
-	// old way to unpack
-	err = extractTarGz(python_package, dname)
+	dname, err := filepath.Abs(tmpDir)
 	if err != nil {
-		panic(err)
+		return nil, fmt.Errorf("resolve extraction directory: %w", err)
 	}
+	fmt.Println("Temp dir absolute path: ", dname)
 
-	var python_bin_path string
-	if osName == "darwin" || osName == "android" {
-		python_bin_path, err = filepath.Abs(filepath.Join(dname, "/prefix/bin"))
-		if err != nil {
-			panic(err)
-		}
-	} else {
-		python_bin_path, err = filepath.Abs(filepath.Join(dname, "/python/bin"))
-		if err != nil {
-			panic(err)
-		}
-	}
+	// The bundle is identified while it is being extracted
+	sourceKey := make(chan string, 1)
+	go func() { sourceKey <- bundleKey(python_package) }()
 
-	// Ensure the embedded libpython is discoverable at runtime (Linux/Wolfi containers, Android)
-	if osName == "linux" {
-		patchelfFixup(python_bin_path, filepath.Join(dname, "python", "lib"))
-		patchelfFixup(filepath.Join(dname, "python", "lib"), filepath.Join(dname, "python", "lib"))
-		patchelfFixup(filepath.Join(dname, "python", "lib", "python3.14", "lib-dynload"), filepath.Join(dname, "python", "lib"))
+	rec := newExtractRecord()
+	if err := extractArchiveSelected(python_package, dname, nil, rec); err != nil {
+		os.RemoveAll(dname)
+		return nil, fmt.Errorf("extract %s: %w", src, err)
 	}
-	err = makeAllFilesExecutable(python_bin_path, PythonVersion)
+	extracted, err := rec.manifest(dname)
 	if err != nil {
-		panic(err)
+		os.RemoveAll(dname)
+		return nil, err
 	}
 
-	pythonExecPath, err := resolvePythonExecutable(python_bin_path, PythonVersion)
+	layout, err := extractedLayout(osName, dname)
 	if err != nil {
+		os.RemoveAll(dname)
 		return nil, err
 	}
+	python_bin_path := layout.BinDir
+
+	if err := fixupExtractedTree(osName, dname, layout); err != nil {
+		os.RemoveAll(dname)
+		return nil, fmt.Errorf("prepare extracted python: %w", err)
+	}
+
+	launcher := findLauncher(layout.BinDir)
+	pythonExecPath := pythonCommandPath(layout, launcher)
 	fmt.Println("Resolved python executable path: ", pythonExecPath)
 	if err := ensurePipInstalled(pythonExecPath); err != nil {
 		return nil, err
@@ -126,12 +136,67 @@ func CreatePythonInstance() (*pythonInstance, error) {
 		Python:          pythonExecPath,
 		ExecutablesPath: python_bin_path,
 		Executables:     make(map[string]pythonExecutable),
-		PythonVersion:   PythonVersion,
+		PythonVersion:   layout.Version,
+		layout:          layout,
+		source:          src,
+		sourceKey:       <-sourceKey,
+		launcher:        launcher,
+	}
+	// Files setup rewrote are hashed again, the rest keep the hashes taken during extraction
+	if err := python_instance.writeManifest(extracted); err != nil {
+		return nil, err
 	}
 	return python_instance, nil
 }
 
-func reuseKeptInstance(osName string) (*pythonInstance, error) {
+// fixupExtractedTree adjusts a freshly extracted tree so it runs from its new location. It is
+// safe to run again after files have been re-extracted.
+func fixupExtractedTree(osName string, dname string, layout *pythonLayout) error {
+	// Point the interpreter at the bundled loader and libraries (Linux/Wolfi containers)
+	if osName == "linux" {
+		if err := patchBundledELF(layout.Interpreter, layout.LibDir, layout.Loader); err != nil {
+			return err
+		}
+		if err := patchBundledLibraries(layout.LibDir, layout.LibDir); err != nil {
+			return err
+		}
+		if err := patchBundledLibraries(layout.DynLoad, layout.LibDir); err != nil {
+			return err
+		}
+	}
+	// Rewrite files that embed the prefix the bundle was built with
+	relocated, err := relocateTree(dname)
+	if err != nil {
+		return err
+	}
+	if !relocated {
+		if err := fixLegacyShebangs(layout.BinDir); err != nil {
+			return err
+		}
+	}
+	// Run scripts through the launcher so they work when other processes exec them
+	launcher, err := installLauncher(osName, layout)
+	if err != nil {
+		return err
+	}
+	if launcher != "" {
+		if err := pointScriptsAtLauncher(layout.BinDir, launcher); err != nil {
+			return err
+		}
+	}
+	return makeAllFilesExecutable(layout.BinDir)
+}
+
+// pythonCommandPath is what the instance runs python as: the launcher if the tree has one,
+// otherwise the interpreter itself.
+func pythonCommandPath(layout *pythonLayout, launcher string) string {
+	if launcher != "" {
+		return launcher
+	}
+	return layout.Interpreter
+}
+
+func reuseKeptInstance(osName string, src BundleSource) (*pythonInstance, error) {
 	searchRoots := []string{"."}
 	if osName == "linux" {
 		searchRoots = append(searchRoots, "/tmp/gorunpython")
@@ -142,6 +207,9 @@ func reuseKeptInstance(osName string) (*pythonInstance, error) {
 	for _, root := range searchRoots {
 		walkErr := filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
 			if err != nil {
+				if path == root && errors.Is(err, os.ErrNotExist) {
+					return filepath.SkipDir
+				}
 				return err
 			}
 			if d == nil || d.IsDir() {
@@ -157,15 +225,29 @@ func reuseKeptInstance(osName string) (*pythonInstance, error) {
 				fmt.Println("Failed to resolve absolute extraction path: ", err)
 				return nil
 			}
-			pythonBinPath := filepath.Join(absExtractionPath, "python", "bin")
-			if osName == "darwin" || osName == "android" {
-				pythonBinPath = filepath.Join(absExtractionPath, "prefix", "bin")
-			}
-			pythonExecPath, err := resolvePythonExecutable(pythonBinPath, PythonVersion)
+			layout, err := extractedLayout(osName, absExtractionPath)
 			if err != nil {
 				fmt.Println("Failed to resolve python executable in existing extracted instance: ", err)
 				return nil
 			}
+			pythonBinPath := layout.BinDir
+			candidate := &pythonInstance{
+				ExtractionPath:  absExtractionPath,
+				ExecutablesPath: pythonBinPath,
+				Executables:     make(map[string]pythonExecutable),
+				PythonVersion:   layout.Version,
+				layout:          layout,
+				source:          src,
+			}
+			if err := candidate.checkKept(); err != nil {
+				fmt.Println("Existing extracted instance failed its integrity check: ", err)
+				return nil
+			}
+			launcher := ""
+			if osName == "linux" {
+				launcher = findLauncher(pythonBinPath)
+			}
+			pythonExecPath := pythonCommandPath(layout, launcher)
 			if osName == "linux" || osName == "android" {
 				if osName == "linux" {
 					ensureFixedInterpreterLink(absExtractionPath)
@@ -177,14 +259,10 @@ func reuseKeptInstance(osName string) (*pythonInstance, error) {
 				return nil
 			}
 			fmt.Println("Reusing existing extracted python instance at: ", extractionPath)
-			reused = &pythonInstance{
-				ExtractionPath:  absExtractionPath,
-				Pip:             pythonExecPath + " -m pip",
-				Python:          pythonExecPath,
-				ExecutablesPath: pythonBinPath,
-				Executables:     make(map[string]pythonExecutable),
-				PythonVersion:   PythonVersion,
-			}
+			candidate.Pip = pythonExecPath + " -m pip"
+			candidate.Python = pythonExecPath
+			candidate.launcher = launcher
+			reused = candidate
 			return stopErr
 		})
 		if walkErr != nil && !errors.Is(walkErr, stopErr) {
@@ -199,7 +277,7 @@ func reuseKeptInstance(osName string) (*pythonInstance, error) {
 
 // PythonExec runs a python command using the embedded python instance
 func (p *pythonInstance) PythonExec(command string) error {
-	err := runPythonCommand(p.Python, []string{command}, false)
+	err := runPythonCommandWith(p.Python, []string{command}, false, p.registeredCallbacks())
 	if err != nil {
 		fmt.Println("Failed to execute python command: ")
 		fmt.Println(err)
@@ -209,7 +287,7 @@ func (p *pythonInstance) PythonExec(command string) error {
 
 // PythonExecStream runs a python command using the embedded python instance and streams output
 func (p *pythonInstance) PythonExecStream(command string) error {
-	err := runPythonCommand(p.Python, []string{command}, true)
+	err := runPythonCommandWith(p.Python, []string{command}, true, p.registeredCallbacks())
 	if err != nil {
 		fmt.Println("Failed to execute python command: ")
 	}
@@ -242,32 +320,61 @@ func (p *pythonInstance) PipInstall(packageName string) error {
 		fmt.Println("Python executable: ", p.Python)
 		return err
 	}
+	if p.launcher != "" {
+		if err := pointScriptsAtLauncher(p.ExecutablesPath, p.launcher); err != nil {
+			return err
+		}
+	}
+	// pip may have rewritten files that were part of the extracted tree
+	if err := p.writeManifest(nil); err != nil {
+		return err
+	}
 	fmt.Println("Rescanning executables after pip install...")
 	return p.ListExecutables()
 }
 
-// ListExecutables lists all executables in the embedded python instance's bin directory and stores them in the pythonInstance.Executables map
+// ListExecutables finds the console scripts declared by the distributions installed in the embedded python
+// instance and stores them in the pythonInstance.Executables map
 func (p *pythonInstance) ListExecutables() error {
-	files, err := os.ReadDir(p.ExecutablesPath)
+	siteDir, err := p.sitePackages()
 	if err != nil {
-		panic(err)
+		return err
+	}
+	scripts, err := consoleScripts(siteDir)
+	if err != nil {
+		return err
 	}
 
-	for _, file := range files {
-		execPath := filepath.Join(p.ExecutablesPath, file.Name())
+	for name := range p.Executables {
+		delete(p.Executables, name)
+	}
+	for name, script := range scripts {
+		execPath := filepath.Join(p.ExecutablesPath, name)
+		if _, err := os.Stat(execPath); err != nil {
+			execPath = ""
+		}
 
-		p.Executables[file.Name()] = pythonExecutable{ExecutableName: file.Name(), ExecutablePath: execPath}
+		p.Executables[name] = pythonExecutable{
+			ExecutableName: name,
+			ExecutablePath: execPath,
+			Module:         script.Module,
+			Function:       script.Function,
+			python:         p.Python,
+			launcher:       p.launcher,
+		}
 		if noisy != "" {
-			fmt.Println("Found executable: ", file.Name())
+			fmt.Println("Found executable: ", name, "->", script.Module+":"+script.Function)
 		}
 	}
 
-	return err
+	return nil
 }
 
-// Exec runs a command using the specified pythonExecutable.ExecutablePath
+// Exec runs the console script with args through the instance's python, or runs ExecutablePath for entries
+// without an entry point
 func (e *pythonExecutable) Exec(args []string) error {
-	err := executeCommand(e.ExecutablePath, args)
+	command, args := e.command(args)
+	err := executeCommand(command, args)
 	if err != nil {
 		fmt.Println("Failed to execute python executable command: ")
 	}
@@ -277,13 +384,22 @@ func (e *pythonExecutable) Exec(args []string) error {
 // ExecStream runs a command using the specified pythonExecutable.ExecutablePath and streams output
 func (e *pythonExecutable) ExecStream(args []string) error {
 	// We assume noisy is always true for streaming
-	err := executeCommandStream(e.ExecutablePath, args)
+	command, args := e.command(args)
+	err := executeCommandStream(command, args)
 	if err != nil {
 		fmt.Println("Failed to execute python executable command:")
 	}
 	return err
 }
 
+// command returns how to run e with args.
+func (e *pythonExecutable) command(args []string) (string, []string) {
+	if e.Module != "" && e.python != "" {
+		return e.entryPointCommand(args)
+	}
+	return launcherCommand(e.launcher, e.ExecutablePath, args)
+}
+
 // executeCommand is an internal helper function to execute a command and return its output
 func executeCommand(command string, args []string) error {
 	output, err := runCommand(command, args, false)
@@ -315,69 +431,16 @@ func executeCommandStream(command string, args []string) error {
 	return err
 }
 
-// extractTarGz unpacks the embedded tar.gz data to the specified destination
-func extractTarGz(data []byte, dest string) error {
-	// Create a gzip reader
-	gzr, err := gzip.NewReader(io.NopCloser(bytes.NewReader(data)))
-	if err != nil {
-		return fmt.Errorf("failed to create gzip reader: %w", err)
-	}
-	defer gzr.Close()
-
-	// Create a tar reader
-	tr := tar.NewReader(gzr)
-
-	// Iterate through the files in the archive
-	for {
-		header, err := tr.Next()
-		if err == io.EOF {
-			break // End of archive
-		}
-		if err != nil {
-			return fmt.Errorf("failed to read tar header: %w", err)
-		}
-
-		// Determine the target path
-		target := filepath.Join(dest, header.Name)
-
-		// Check the file type
-		switch header.Typeflag {
-		case tar.TypeDir:
-			if err := os.MkdirAll(target, 0755); err != nil {
-				return fmt.Errorf("failed to create directory: %w", err)
-			}
-		case tar.TypeReg:
-			// Ensure parent directory exists
-			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
-				return fmt.Errorf("failed to create file directory: %w", err)
-			}
-			f, err := os.OpenFile(target, os.O_CREATE|os.O_RDWR, os.FileMode(header.Mode))
-			if err != nil {
-				return fmt.Errorf("failed to create file: %w", err)
-			}
-			if _, err := io.Copy(f, tr); err != nil {
-				f.Close()
-				return fmt.Errorf("failed to write file content: %w", err)
-			}
-			f.Close()
-		}
-	}
-	return nil
-}
-
 // makeAllFilesExecutable makes all files in the specified directory executable
-func makeAllFilesExecutable(directoryPath string, pythonVersion string) error {
-	// Specify the root directory to start walking from (e.g., "." for the current directory)
-
-	// Walk through the directory tree
+func makeAllFilesExecutable(directoryPath string) error {
 	err := filepath.WalkDir(directoryPath, func(path string, d os.DirEntry, err error) error {
 		if err != nil {
 			// Return the error to stop walking if a serious error occurs
 			return err
 		}
 
-		// Skip directories, we only want to make files executable
-		if d.IsDir() {
+		// Skip directories and links, we only want to make files executable
+		if !d.Type().IsRegular() {
 			return nil
 		}
 
@@ -387,28 +450,13 @@ func makeAllFilesExecutable(directoryPath string, pythonVersion string) error {
 			return err
 		}
 
-		// Define the new permission mode (e.g., 0755: rwxr-xr-x)
-		// This adds execute permission for all users (+x)
-		newMode := info.Mode() | 0111 // 0111 is execute permission for user, group, and other
-
-		// Correct the file's shebang and other instances referring to the original build path at #!/Users/zacadams/Development/cpython-android/build-macos/../out/prefix/bin/python3.15
-		// This is necessary because the embedded python may have hardcoded paths that don't match the temp directory structure
-		// We will replace any instance of the original build path with the new temp directory path
-		originalBuildPath := "/Users/zacadams/Development/cpython-android/build-macos/../out/prefix/bin/python" + pythonVersion
-		newPath := filepath.Join(directoryPath, "/python"+pythonVersion)
-		input, err := os.ReadFile(path)
-		if err != nil {
-			fmt.Printf("Error reading file for shebang correction %s: %v\n", path, err)
+		// Add execute permission for user, group and other (+x)
+		if err := os.Chmod(path, info.Mode()|0111); err != nil {
+			fmt.Printf("Error setting permissions on %s: %v\n", path, err)
 			return nil // Continue walking even if one file fails
 		}
-		output := bytes.ReplaceAll(input, []byte(originalBuildPath), []byte(newPath))
-		err = os.WriteFile(path, output, newMode)
 		if noisy != "" {
-			fmt.Printf("Corrected pathes and permissions in file: %s\n", path)
-		}
-		if err != nil {
-			fmt.Printf("Error writing file for shebang correction %s: %v\n", path, err)
-			return nil // Continue walking even if one file fails
+			fmt.Printf("Corrected permissions in file: %s\n", path)
 		}
 		return nil
 	})
@@ -433,14 +481,49 @@ func ensureEmbeddedPythonLibPath(pythonBinPath string) {
 	}
 }
 
-func patchelfFixup(executablePath string, libDir string) error {
-	// TODO: add in logic to handle different architectures and their corresponding loaders
-	fmt.Println("running patchelf fixes")
-	runCommandStream(filepath.Join(executablePath, "patchelf"), []string{
-		"--set-rpath", libDir,
-		"--set-interpreter", filepath.Join(libDir, "ld-linux-x86-64.so.2"),
-		filepath.Join(executablePath, "python3.14"),
-	})
+// patchBundledELF points an ELF executable at loader, or if that is empty at the bundled loader
+// for its architecture and libc when the bundle ships one, and at the bundled libraries. Files
+// that are not ELF are left alone.
+func patchBundledELF(executablePath string, libDir string, loader string) error {
+	// Patch the file itself rather than replacing a python3 -> python3.X symlink with a copy
+	executablePath, err := filepath.EvalSymlinks(executablePath)
+	if err != nil {
+		return err
+	}
+	if !isELF(executablePath) {
+		return nil
+	}
+	if noisy != "" {
+		fmt.Println("Patching interpreter and runpath of: ", executablePath)
+	}
+	if loader == "" {
+		loader, err = resolveLoader(executablePath, libDir)
+		if err != nil {
+			return err
+		}
+	}
+	return patchELF(executablePath, elfPatch{Interpreter: loader, RunPath: libDir})
+}
+
+// patchBundledLibraries points the shared objects in dir that already carry a search path at
+// libDir.
+func patchBundledLibraries(dir string, libDir string) error {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		path := filepath.Join(dir, e.Name())
+		if !e.Type().IsRegular() || !strings.Contains(e.Name(), ".so") || !isELF(path) {
+			continue
+		}
+		if err := patchELF(path, elfPatch{RunPath: libDir, OnlyExistingRunPath: true}); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -463,9 +546,6 @@ func containsPath(list string, path string) bool {
 }
 
 func resolvePythonExecutable(binPath string, pythonVersion string) (string, error) {
-	// if runtime.GOOS == "linux" {
-	// 	return filepath.Join(binPath, "python-launcher"), nil
-	// }
 	candidates := []string{
 		filepath.Join(binPath, "python"+pythonVersion),
 		filepath.Join(binPath, "python3"),
@@ -480,23 +560,19 @@ func resolvePythonExecutable(binPath string, pythonVersion string) (string, erro
 	return "", fmt.Errorf("python executable not found in %s", binPath)
 }
 
+// findBundledLoader returns the loader from the bundle's lib directory that command must be run
+// with, if any.
 func findBundledLoader(command string) (string, bool) {
 	if runtime.GOOS != "linux" {
 		return "", false
 	}
-	binDir := filepath.Dir(command)
-	libDir := filepath.Clean(filepath.Join(binDir, "..", "lib"))
-	candidates := []string{
-		filepath.Join(libDir, "ld-linux-aarch64.so.1"),
-		filepath.Join(libDir, "ld-linux-x86-64.so.2"),
-	}
-	for _, candidate := range candidates {
-		info, err := os.Stat(candidate)
-		if err == nil && !info.IsDir() {
-			return candidate, true
-		}
+	libDir := filepath.Clean(filepath.Join(filepath.Dir(command), "..", "lib"))
+	loader, err := resolveLoader(command, libDir)
+	if err != nil {
+		fmt.Println("Failed to resolve loader: ", err)
+		return "", false
 	}
-	return "", false
+	return loader, loader != ""
 }
 
 func shouldRetryWithLoader(command string, err error) bool {
@@ -518,17 +594,44 @@ func shouldRetryWithLoader(command string, err error) bool {
 }
 
 func runCommand(command string, args []string, stream bool) ([]byte, error) {
+	return runCommandWith(command, args, stream, nil)
+}
+
+// runCommandWith is runCommand serving callbacks, if any are registered, to the python it runs
+func runCommandWith(command string, args []string, stream bool, callbacks *callbackRegistry) ([]byte, error) {
 	cmd := exec.Command(command, args...)
+	cmd.Env = pythonEnv()
+	started, stop, err := callbacks.attach(cmd)
+	if err != nil {
+		return nil, err
+	}
+	defer stop()
 	workingDir, err := os.Getwd()
 	if err == nil {
 		cmd.Dir = workingDir
 	}
+	var output bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &output, &output
 	if stream {
 		cmd.Stdout = os.Stdout
 		cmd.Stderr = os.Stderr
-		return nil, cmd.Run()
 	}
-	return cmd.CombinedOutput()
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	started()
+	err = cmd.Wait()
+	if stream {
+		return nil, err
+	}
+	return output.Bytes(), err
+}
+
+// pythonEnv is the environment python and its tools run with: this process's, under the isolation profile
+// shared with python-launcher unless GORUNPYTHON_ENV_PASSTHROUGH opts variables out
+func pythonEnv() []string {
+	env := os.Environ()
+	return pyenv.Isolate(env, pyenv.Passthrough(env))
 }
 
 func runCommandStream(command string, args []string) error {
@@ -550,6 +653,10 @@ func ensurePipInstalled(pythonExecPath string) error {
 }
 
 func runPythonCommand(pythonExecPath string, args []string, stream bool) error {
+	return runPythonCommandWith(pythonExecPath, args, stream, nil)
+}
+
+func runPythonCommandWith(pythonExecPath string, args []string, stream bool, callbacks *callbackRegistry) error {
 	command := pythonExecPath
 	commandArgs := args
 	if useLoaderFor(pythonExecPath) {
@@ -558,10 +665,10 @@ func runPythonCommand(pythonExecPath string, args []string, stream bool) error {
 			commandArgs = append([]string{pythonExecPath}, args...)
 		}
 	}
+	output, err := runCommandWith(command, commandArgs, stream, callbacks)
 	if stream {
-		return runCommandStream(command, commandArgs)
+		return err
 	}
-	output, err := runCommand(command, commandArgs, false)
 	if noisy != "" {
 		fmt.Println(string(output))
 	}
@@ -0,0 +1,561 @@
+package gorunpython
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"unsafe"
+)
+
+// A Table is a set of named, equally long columns, exchanged with Python in the Apache Arrow
+// IPC stream format. Column values are slices of int8 to int64, uint8 to uint64, float32,
+// float64, bool or string. Nulls, nested types and dictionaries are not supported.
+type Table struct {
+	Columns []Column
+}
+
+// Column is one column of a Table.
+type Column struct {
+	Name   string
+	Values any
+}
+
+// Arrow metadata constants, from Schema.fbs and Message.fbs.
+const (
+	arrowMetadataV5 = 4
+
+	arrowHeaderSchema      = 1
+	arrowHeaderRecordBatch = 3
+
+	arrowTypeInt       = 2
+	arrowTypeFloat     = 3
+	arrowTypeUtf8      = 5
+	arrowTypeBool      = 6
+	arrowTypeLargeUtf8 = 20
+
+	arrowFloatSingle = 1
+	arrowFloatDouble = 2
+
+	arrowContinuation = 0xFFFFFFFF
+)
+
+type arrowType struct {
+	id        uint8
+	bits      int
+	signed    bool
+	precision int16
+}
+
+func (t arrowType) table() fbTable {
+	switch t.id {
+	case arrowTypeInt:
+		return fbTable{fbInt32(int32(t.bits)), fbBool(t.signed)}
+	case arrowTypeFloat:
+		return fbTable{fbInt16(t.precision)}
+	}
+	return fbTable{}
+}
+
+// Len returns the number of rows, checking that every column has the same length.
+func (t *Table) Len() (int, error) {
+	n := -1
+	for _, c := range t.Columns {
+		_, l, err := arrowColumnType(c.Values)
+		if err != nil {
+			return 0, fmt.Errorf("column %q: %w", c.Name, err)
+		}
+		if n >= 0 && l != n {
+			return 0, fmt.Errorf("column %q has %d rows, want %d", c.Name, l, n)
+		}
+		n = l
+	}
+	return max(n, 0), nil
+}
+
+// Column returns the values of the named column, or nil.
+func (t *Table) Column(name string) any {
+	for _, c := range t.Columns {
+		if c.Name == name {
+			return c.Values
+		}
+	}
+	return nil
+}
+
+func arrowColumnType(values any) (arrowType, int, error) {
+	switch v := values.(type) {
+	case []int8:
+		return arrowType{id: arrowTypeInt, bits: 8, signed: true}, len(v), nil
+	case []int16:
+		return arrowType{id: arrowTypeInt, bits: 16, signed: true}, len(v), nil
+	case []int32:
+		return arrowType{id: arrowTypeInt, bits: 32, signed: true}, len(v), nil
+	case []int64:
+		return arrowType{id: arrowTypeInt, bits: 64, signed: true}, len(v), nil
+	case []uint8:
+		return arrowType{id: arrowTypeInt, bits: 8}, len(v), nil
+	case []uint16:
+		return arrowType{id: arrowTypeInt, bits: 16}, len(v), nil
+	case []uint32:
+		return arrowType{id: arrowTypeInt, bits: 32}, len(v), nil
+	case []uint64:
+		return arrowType{id: arrowTypeInt, bits: 64}, len(v), nil
+	case []float32:
+		return arrowType{id: arrowTypeFloat, precision: arrowFloatSingle}, len(v), nil
+	case []float64:
+		return arrowType{id: arrowTypeFloat, precision: arrowFloatDouble}, len(v), nil
+	case []bool:
+		return arrowType{id: arrowTypeBool}, len(v), nil
+	case []string:
+		return arrowType{id: arrowTypeUtf8}, len(v), nil
+	}
+	return arrowType{}, 0, fmt.Errorf("unsupported column type %T", values)
+}
+
+// arrowBytes is the memory of a slice of fixed-size values. All supported platforms are
+// little-endian, as Arrow is by default.
+func arrowBytes[T any](v []T) []byte {
+	if len(v) == 0 {
+		return nil
+	}
+	return unsafe.Slice((*byte)(unsafe.Pointer(&v[0])), len(v)*int(unsafe.Sizeof(v[0])))
+}
+
+// arrowView reads n values from b, sharing b's memory when it is suitably aligned.
+func arrowView[T any](b []byte, n int) ([]T, error) {
+	var zero T
+	size := int(unsafe.Sizeof(zero))
+	if n < 0 || n > len(b)/size {
+		return nil, errors.New("arrow buffer too short")
+	}
+	if n == 0 {
+		return []T{}, nil
+	}
+	if uintptr(unsafe.Pointer(&b[0]))%unsafe.Alignof(zero) == 0 {
+		return unsafe.Slice((*T)(unsafe.Pointer(&b[0])), n), nil
+	}
+	out := make([]T, n)
+	copy(arrowBytes(out), b)
+	return out, nil
+}
+
+// arrowBuffers returns the data buffers of a column, after its (empty) validity buffer.
+func arrowBuffers(values any) ([][]byte, error) {
+	switch v := values.(type) {
+	case []int8:
+		return [][]byte{arrowBytes(v)}, nil
+	case []int16:
+		return [][]byte{arrowBytes(v)}, nil
+	case []int32:
+		return [][]byte{arrowBytes(v)}, nil
+	case []int64:
+		return [][]byte{arrowBytes(v)}, nil
+	case []uint8:
+		return [][]byte{v}, nil
+	case []uint16:
+		return [][]byte{arrowBytes(v)}, nil
+	case []uint32:
+		return [][]byte{arrowBytes(v)}, nil
+	case []uint64:
+		return [][]byte{arrowBytes(v)}, nil
+	case []float32:
+		return [][]byte{arrowBytes(v)}, nil
+	case []float64:
+		return [][]byte{arrowBytes(v)}, nil
+	case []bool:
+		bits := make([]byte, (len(v)+7)/8)
+		for i, b := range v {
+			if b {
+				bits[i/8] |= 1 << (i % 8)
+			}
+		}
+		return [][]byte{bits}, nil
+	case []string:
+		offsets := make([]int32, len(v)+1)
+		var data []byte
+		for i, s := range v {
+			data = append(data, s...)
+			if len(data) > math.MaxInt32 {
+				return nil, errors.New("string column larger than 2 GiB")
+			}
+			offsets[i+1] = int32(len(data))
+		}
+		return [][]byte{arrowBytes(offsets), data}, nil
+	}
+	return nil, fmt.Errorf("unsupported column type %T", values)
+}
+
+func arrowPad(n int64) int64 { return (n + 7) &^ 7 }
+
+// WriteTo writes t to w as an Arrow IPC stream: a schema, one record batch and the
+// end-of-stream marker. Numeric column memory is written to w as is.
+func (t *Table) WriteTo(w io.Writer) (int64, error) {
+	rows, err := t.Len()
+	if err != nil {
+		return 0, err
+	}
+
+	var fields fbTables
+	var nodes, bufferSpecs []byte
+	var body [][]byte
+	var bodyLen int64
+	addBuffer := func(b []byte) {
+		bufferSpecs = binary.LittleEndian.AppendUint64(bufferSpecs, uint64(bodyLen))
+		bufferSpecs = binary.LittleEndian.AppendUint64(bufferSpecs, uint64(len(b)))
+		body = append(body, b)
+		bodyLen += arrowPad(int64(len(b)))
+	}
+	for _, c := range t.Columns {
+		typ, _, _ := arrowColumnType(c.Values)
+		fields = append(fields, fbTable{
+			fbString(c.Name), fbBool(true), fbInt8(typ.id), typ.table(), nil, fbTables{},
+		})
+		nodes = binary.LittleEndian.AppendUint64(nodes, uint64(rows))
+		nodes = binary.LittleEndian.AppendUint64(nodes, 0)
+		buffers, err := arrowBuffers(c.Values)
+		if err != nil {
+			return 0, fmt.Errorf("column %q: %w", c.Name, err)
+		}
+		addBuffer(nil)
+		for _, b := range buffers {
+			addBuffer(b)
+		}
+	}
+
+	cw := &countingWriter{w: w}
+	schema := fbTable{fbInt16(0), fields}
+	if err := writeArrowMessage(cw, arrowHeaderSchema, schema, 0); err != nil {
+		return cw.n, err
+	}
+	batch := fbTable{
+		fbInt64(int64(rows)),
+		fbStructs{size: 16, align: 8, data: nodes},
+		fbStructs{size: 16, align: 8, data: bufferSpecs},
+	}
+	if err := writeArrowMessage(cw, arrowHeaderRecordBatch, batch, bodyLen); err != nil {
+		return cw.n, err
+	}
+	var zeros [8]byte
+	for _, b := range body {
+		if _, err := cw.Write(b); err != nil {
+			return cw.n, err
+		}
+		if _, err := cw.Write(zeros[:arrowPad(int64(len(b)))-int64(len(b))]); err != nil {
+			return cw.n, err
+		}
+	}
+	_, err = cw.Write([]byte{0xFF, 0xFF, 0xFF, 0xFF, 0, 0, 0, 0})
+	return cw.n, err
+}
+
+func writeArrowMessage(w io.Writer, headerType uint8, header fbTable, bodyLen int64) error {
+	meta := fbBuild(fbTable{fbInt16(arrowMetadataV5), fbInt8(headerType), header, fbInt64(bodyLen)})
+	meta = append(meta, make([]byte, arrowPad(int64(len(meta)))-int64(len(meta)))...)
+	prefix := binary.LittleEndian.AppendUint32([]byte{0xFF, 0xFF, 0xFF, 0xFF}, uint32(len(meta)))
+	if _, err := w.Write(prefix); err != nil {
+		return err
+	}
+	_, err := w.Write(meta)
+	return err
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+type arrowField struct {
+	name string
+	typ  arrowType
+}
+
+// ReadTable decodes an Arrow IPC stream. Numeric columns of a single record batch share
+// data's memory, so they are only valid as long as data is; other columns are copies.
+func ReadTable(data []byte) (*Table, error) {
+	var fields []arrowField
+	var t *Table
+	pos := 0
+	for {
+		if pos+4 > len(data) {
+			if pos == len(data) && fields != nil {
+				break // a stream may end without the end-of-stream marker
+			}
+			return nil, errors.New("arrow stream truncated")
+		}
+		size := binary.LittleEndian.Uint32(data[pos:])
+		pos += 4
+		if size == arrowContinuation {
+			if pos+4 > len(data) {
+				return nil, errors.New("arrow stream truncated")
+			}
+			size = binary.LittleEndian.Uint32(data[pos:])
+			pos += 4
+		}
+		if size == 0 {
+			break
+		}
+		if int(size) > len(data)-pos {
+			return nil, errors.New("arrow stream truncated")
+		}
+		meta := data[pos : pos+int(size)]
+		pos += int(size)
+
+		var headerType uint8
+		var bodyLen int64
+		var batch *Table
+		err := fbRead(meta, func(r fbReader, msg int) error {
+			headerType = uint8(r.int(msg, 1, 1, 0))
+			bodyLen = r.int(msg, 3, 8, 0)
+			header := r.ref(msg, 2)
+			if header == 0 {
+				return errors.New("arrow message without header")
+			}
+			if bodyLen < 0 || bodyLen > int64(len(data)-pos) {
+				return errors.New("arrow stream truncated")
+			}
+			switch headerType {
+			case arrowHeaderSchema:
+				if fields != nil {
+					return errors.New("arrow stream with more than one schema")
+				}
+				var err error
+				fields, err = readArrowSchema(r, header)
+				return err
+			case arrowHeaderRecordBatch:
+				if fields == nil {
+					return errors.New("arrow record batch before schema")
+				}
+				var err error
+				batch, err = readArrowBatch(r, header, fields, data[pos:pos+int(bodyLen)])
+				return err
+			}
+			return fmt.Errorf("unsupported arrow message type %d", headerType)
+		})
+		if err != nil {
+			return nil, err
+		}
+		pos += int(bodyLen)
+		if batch != nil {
+			if t == nil {
+				t = batch
+			} else {
+				for i := range t.Columns {
+					t.Columns[i].Values = appendColumn(t.Columns[i].Values, batch.Columns[i].Values)
+				}
+			}
+		}
+	}
+	if t == nil {
+		t = &Table{}
+		for _, f := range fields {
+			values, _ := decodeArrowColumn(f.typ, 0, nil)
+			t.Columns = append(t.Columns, Column{Name: f.name, Values: values})
+		}
+	}
+	return t, nil
+}
+
+func readArrowSchema(r fbReader, schema int) ([]arrowField, error) {
+	n, elems := r.vector(schema, 1)
+	fields := make([]arrowField, 0, n)
+	for i := 0; i < n; i++ {
+		f := r.deref(elems + 4*i)
+		name := r.string(f, 0)
+		if r.field(f, 4) != 0 {
+			return nil, fmt.Errorf("column %q: dictionary columns are not supported", name)
+		}
+		if children, _ := r.vector(f, 5); children != 0 {
+			return nil, fmt.Errorf("column %q: nested columns are not supported", name)
+		}
+		typ := arrowType{id: uint8(r.int(f, 2, 1, 0))}
+		spec := r.ref(f, 3)
+		switch typ.id {
+		case arrowTypeInt:
+			if spec == 0 {
+				return nil, fmt.Errorf("column %q: int type without width", name)
+			}
+			typ.bits = int(r.int(spec, 0, 4, 0))
+			typ.signed = r.int(spec, 1, 1, 0) != 0
+		case arrowTypeFloat:
+			if spec == 0 {
+				return nil, fmt.Errorf("column %q: float type without precision", name)
+			}
+			typ.precision = int16(r.int(spec, 0, 2, 0))
+		case arrowTypeUtf8, arrowTypeLargeUtf8, arrowTypeBool:
+		default:
+			return nil, fmt.Errorf("column %q: unsupported arrow type %d", name, typ.id)
+		}
+		fields = append(fields, arrowField{name, typ})
+	}
+	return fields, nil
+}
+
+func readArrowBatch(r fbReader, batch int, fields []arrowField, body []byte) (*Table, error) {
+	if r.field(batch, 3) != 0 {
+		return nil, errors.New("compressed arrow record batches are not supported")
+	}
+	rows := r.int(batch, 0, 8, 0)
+	if rows < 0 || int64(int(rows)) != rows {
+		return nil, fmt.Errorf("arrow record batch with %d rows", rows)
+	}
+	nNodes, nodes := r.vector(batch, 1)
+	nBuffers, buffers := r.vector(batch, 2)
+	if nNodes != len(fields) {
+		return nil, errors.New("arrow record batch does not match its schema")
+	}
+	t := &Table{}
+	b := 0
+	for i, f := range fields {
+		if r.int64At(nodes+16*i+8) != 0 {
+			return nil, fmt.Errorf("column %q has nulls, which are not supported", f.name)
+		}
+		count := 3
+		if f.typ.id != arrowTypeUtf8 && f.typ.id != arrowTypeLargeUtf8 {
+			count = 2
+		}
+		if b+count > nBuffers {
+			return nil, errors.New("arrow record batch does not match its schema")
+		}
+		var bufs [][]byte
+		for j := 1; j < count; j++ {
+			off, size := r.int64At(buffers+16*(b+j)), r.int64At(buffers+16*(b+j)+8)
+			if off < 0 || size < 0 || off > int64(len(body)) || size > int64(len(body))-off {
+				return nil, fmt.Errorf("column %q: arrow buffer out of range", f.name)
+			}
+			bufs = append(bufs, body[off:off+size])
+		}
+		b += count
+		values, err := decodeArrowColumn(f.typ, int(rows), bufs)
+		if err != nil {
+			return nil, fmt.Errorf("column %q: %w", f.name, err)
+		}
+		t.Columns = append(t.Columns, Column{Name: f.name, Values: values})
+	}
+	return t, nil
+}
+
+func (r fbReader) int64At(pos int) int64 { return int64(r.u64(pos)) }
+
+func decodeArrowColumn(typ arrowType, n int, bufs [][]byte) (any, error) {
+	if n < 0 {
+		return nil, fmt.Errorf("%d rows", n)
+	}
+	data := func() []byte {
+		if len(bufs) == 0 {
+			return nil
+		}
+		return bufs[0]
+	}
+	switch typ.id {
+	case arrowTypeInt:
+		switch {
+		case typ.bits == 8 && typ.signed:
+			return arrowView[int8](data(), n)
+		case typ.bits == 16 && typ.signed:
+			return arrowView[int16](data(), n)
+		case typ.bits == 32 && typ.signed:
+			return arrowView[int32](data(), n)
+		case typ.bits == 64 && typ.signed:
+			return arrowView[int64](data(), n)
+		case typ.bits == 8:
+			return arrowView[uint8](data(), n)
+		case typ.bits == 16:
+			return arrowView[uint16](data(), n)
+		case typ.bits == 32:
+			return arrowView[uint32](data(), n)
+		case typ.bits == 64:
+			return arrowView[uint64](data(), n)
+		}
+		return nil, fmt.Errorf("unsupported int width %d", typ.bits)
+	case arrowTypeFloat:
+		switch typ.precision {
+		case arrowFloatSingle:
+			return arrowView[float32](data(), n)
+		case arrowFloatDouble:
+			return arrowView[float64](data(), n)
+		}
+		return nil, errors.New("half-precision floats are not supported")
+	case arrowTypeBool:
+		bits := data()
+		if n > 8*len(bits) {
+			return nil, errors.New("arrow buffer too short")
+		}
+		out := make([]bool, n)
+		for i := range out {
+			out[i] = bits[i/8]&(1<<(i%8)) != 0
+		}
+		return out, nil
+	case arrowTypeUtf8, arrowTypeLargeUtf8:
+		if n == 0 {
+			return []string{}, nil
+		}
+		if len(bufs) < 2 || n >= len(bufs[0]) {
+			return nil, errors.New("arrow buffer too short")
+		}
+		var offsets []int64
+		if typ.id == arrowTypeUtf8 {
+			o32, err := arrowView[int32](bufs[0], n+1)
+			if err != nil {
+				return nil, err
+			}
+			offsets = make([]int64, n+1)
+			for i, o := range o32 {
+				offsets[i] = int64(o)
+			}
+		} else {
+			var err error
+			if offsets, err = arrowView[int64](bufs[0], n+1); err != nil {
+				return nil, err
+			}
+		}
+		out := make([]string, n)
+		for i := range out {
+			start, end := offsets[i], offsets[i+1]
+			if start < 0 || end < start || end > int64(len(bufs[1])) {
+				return nil, errors.New("arrow string offsets out of range")
+			}
+			out[i] = string(bufs[1][start:end])
+		}
+		return out, nil
+	}
+	return nil, fmt.Errorf("unsupported arrow type %d", typ.id)
+}
+
+// appendColumn joins the values of two record batches, copying them.
+func appendColumn(a, b any) any {
+	switch a := a.(type) {
+	case []int8:
+		return append(a[:len(a):len(a)], b.([]int8)...)
+	case []int16:
+		return append(a[:len(a):len(a)], b.([]int16)...)
+	case []int32:
+		return append(a[:len(a):len(a)], b.([]int32)...)
+	case []int64:
+		return append(a[:len(a):len(a)], b.([]int64)...)
+	case []uint8:
+		return append(a[:len(a):len(a)], b.([]uint8)...)
+	case []uint16:
+		return append(a[:len(a):len(a)], b.([]uint16)...)
+	case []uint32:
+		return append(a[:len(a):len(a)], b.([]uint32)...)
+	case []uint64:
+		return append(a[:len(a):len(a)], b.([]uint64)...)
+	case []float32:
+		return append(a[:len(a):len(a)], b.([]float32)...)
+	case []float64:
+		return append(a[:len(a):len(a)], b.([]float64)...)
+	case []bool:
+		return append(a, b.([]bool)...)
+	case []string:
+		return append(a, b.([]string)...)
+	}
+	return a
+}
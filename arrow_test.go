@@ -0,0 +1,197 @@
+package gorunpython
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTableRoundTrip(t *testing.T) {
+	in := &Table{Columns: []Column{
+		{"i8", []int8{-1, 2, math.MaxInt8}},
+		{"i16", []int16{-1, 2, math.MinInt16}},
+		{"i32", []int32{-1, 2, math.MaxInt32}},
+		{"i64", []int64{-1, 2, math.MinInt64}},
+		{"u8", []uint8{0, 1, math.MaxUint8}},
+		{"u16", []uint16{0, 1, math.MaxUint16}},
+		{"u32", []uint32{0, 1, math.MaxUint32}},
+		{"u64", []uint64{0, 1, math.MaxUint64}},
+		{"f32", []float32{0.5, -1, float32(math.Inf(1))}},
+		{"f64", []float64{0.25, -2, math.MaxFloat64}},
+		{"bool", []bool{true, false, true}},
+		{"str", []string{"", "é", strings.Repeat("x", 100)}},
+	}}
+	var buf bytes.Buffer
+	n, err := in.WriteTo(&buf)
+	if err != nil || n != int64(buf.Len()) {
+		t.Fatalf("WriteTo = %d, %v; wrote %d", n, err, buf.Len())
+	}
+	out, err := ReadTable(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(out, in) {
+		t.Errorf("read back\n%v\nwant\n%v", out, in)
+	}
+	if rows, err := out.Len(); rows != 3 || err != nil {
+		t.Errorf("Len = %d, %v", rows, err)
+	}
+
+	empty := &Table{Columns: []Column{{"a", []int64{}}, {"s", []string{}}}}
+	buf.Reset()
+	if _, err := empty.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if out, err := ReadTable(buf.Bytes()); err != nil || !reflect.DeepEqual(out, empty) {
+		t.Errorf("empty table read back as %v, %v", out, err)
+	}
+}
+
+func TestTableLen(t *testing.T) {
+	if _, err := (&Table{Columns: []Column{{"a", []int8{1}}, {"b", []int8{1, 2}}}}).Len(); err == nil {
+		t.Error("columns of different lengths accepted")
+	}
+	if _, err := (&Table{Columns: []Column{{"a", []int{1}}}}).Len(); err == nil {
+		t.Error("[]int column accepted")
+	}
+}
+
+// arrowTestStream builds an Arrow IPC stream of a schema and one record batch by hand, so
+// its metadata can disagree with its body.
+type arrowTestStream struct {
+	fields  []arrowField
+	rows    int64
+	nulls   int64
+	buffers [][2]int64 // offset and length of each buffer, validity buffers included
+	body    []byte
+}
+
+func (s arrowTestStream) bytes(t *testing.T) []byte {
+	t.Helper()
+	var fields fbTables
+	var nodes, specs []byte
+	for _, f := range s.fields {
+		fields = append(fields, fbTable{fbString(f.name), fbBool(true), fbInt8(f.typ.id), f.typ.table(), nil, fbTables{}})
+		nodes = binary.LittleEndian.AppendUint64(nodes, uint64(s.rows))
+		nodes = binary.LittleEndian.AppendUint64(nodes, uint64(s.nulls))
+	}
+	for _, b := range s.buffers {
+		specs = binary.LittleEndian.AppendUint64(specs, uint64(b[0]))
+		specs = binary.LittleEndian.AppendUint64(specs, uint64(b[1]))
+	}
+	var buf bytes.Buffer
+	if err := writeArrowMessage(&buf, arrowHeaderSchema, fbTable{fbInt16(0), fields}, 0); err != nil {
+		t.Fatal(err)
+	}
+	batch := fbTable{
+		fbInt64(s.rows),
+		fbStructs{size: 16, align: 8, data: nodes},
+		fbStructs{size: 16, align: 8, data: specs},
+	}
+	if err := writeArrowMessage(&buf, arrowHeaderRecordBatch, batch, int64(len(s.body))); err != nil {
+		t.Fatal(err)
+	}
+	buf.Write(s.body)
+	return buf.Bytes()
+}
+
+func TestReadTableMalformed(t *testing.T) {
+	i32 := []arrowField{{"i", arrowType{id: arrowTypeInt, bits: 32, signed: true}}}
+	b := []arrowField{{"b", arrowType{id: arrowTypeBool}}}
+	str := []arrowField{{"s", arrowType{id: arrowTypeUtf8}}}
+	body := make([]byte, 64)
+	offsets := func(o ...int32) []byte {
+		out := make([]byte, 64)
+		for i, v := range o {
+			binary.LittleEndian.PutUint32(out[4*i:], uint32(v))
+		}
+		return out
+	}
+
+	var valid bytes.Buffer
+	(&Table{Columns: []Column{{"s", []string{"a", "bc"}}, {"n", []int64{1, 2}}}}).WriteTo(&valid)
+	schemaOnly := valid.Bytes()[:8+binary.LittleEndian.Uint32(valid.Bytes()[4:])]
+
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"empty", nil, "truncated"},
+		{"short prefix", []byte{0xFF, 0xFF}, "truncated"},
+		{"metadata past the end", []byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0, 0, 0}, "truncated"},
+		{"garbage metadata", append([]byte{0xFF, 0xFF, 0xFF, 0xFF, 8, 0, 0, 0}, 0xF0, 0xFF, 0xFF, 0x7F, 1, 2, 3, 4), "malformed"},
+		{"batch before schema", valid.Bytes()[len(schemaOnly):], "before schema"},
+		{"two schemas", append(append([]byte{}, schemaOnly...), valid.Bytes()...), "more than one schema"},
+		{"negative rows", arrowTestStream{fields: b, rows: -1, buffers: [][2]int64{{0, 0}, {0, 8}}, body: body}.bytes(t), "rows"},
+		{"bool rows past buffer", arrowTestStream{fields: b, rows: 65, buffers: [][2]int64{{0, 0}, {0, 8}}, body: body}.bytes(t), "too short"},
+		{"huge bool rows", arrowTestStream{fields: b, rows: math.MaxInt64, buffers: [][2]int64{{0, 0}, {0, 8}}, body: body}.bytes(t), "too short"},
+		{"int rows overflow", arrowTestStream{fields: i32, rows: math.MaxInt64 / 2, buffers: [][2]int64{{0, 0}, {0, 64}}, body: body}.bytes(t), "too short"},
+		{"int rows past buffer", arrowTestStream{fields: i32, rows: 17, buffers: [][2]int64{{0, 0}, {0, 64}}, body: body}.bytes(t), "too short"},
+		{"huge string rows", arrowTestStream{fields: str, rows: 1 << 40, buffers: [][2]int64{{0, 0}, {0, 64}, {0, 0}}, body: body}.bytes(t), "too short"},
+		{"max string rows", arrowTestStream{fields: str, rows: math.MaxInt64, buffers: [][2]int64{{0, 0}, {0, 64}, {0, 0}}, body: body}.bytes(t), "too short"},
+		{"string offsets past data", arrowTestStream{fields: str, rows: 1, buffers: [][2]int64{{0, 0}, {0, 8}, {8, 4}}, body: offsets(0, 5)}.bytes(t), "offsets out of range"},
+		{"string offsets backwards", arrowTestStream{fields: str, rows: 2, buffers: [][2]int64{{0, 0}, {0, 12}, {12, 4}}, body: offsets(0, 3, 1)}.bytes(t), "offsets out of range"},
+		{"negative string offset", arrowTestStream{fields: str, rows: 1, buffers: [][2]int64{{0, 0}, {0, 8}, {8, 4}}, body: offsets(-4, 1)}.bytes(t), "offsets out of range"},
+		{"buffer past body", arrowTestStream{fields: i32, rows: 1, buffers: [][2]int64{{0, 0}, {60, 8}}, body: body}.bytes(t), "out of range"},
+		{"negative buffer", arrowTestStream{fields: i32, rows: 1, buffers: [][2]int64{{0, 0}, {-8, 8}}, body: body}.bytes(t), "out of range"},
+		{"missing buffers", arrowTestStream{fields: str, rows: 1, buffers: [][2]int64{{0, 0}, {0, 8}}, body: body}.bytes(t), "does not match"},
+		{"nulls", arrowTestStream{fields: i32, rows: 1, nulls: 1, buffers: [][2]int64{{0, 0}, {0, 4}}, body: body}.bytes(t), "nulls"},
+		{"unsupported width", arrowTestStream{fields: []arrowField{{"i", arrowType{id: arrowTypeInt, bits: 24}}}, rows: 1, buffers: [][2]int64{{0, 0}, {0, 4}}, body: body}.bytes(t), "width"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if out, err := ReadTable(tt.data); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("ReadTable = %v, %v; want an error containing %q", out, err, tt.want)
+			}
+		})
+	}
+}
+
+// Damaged streams of any kind fail with an error, never a panic.
+func TestReadTableDamaged(t *testing.T) {
+	var buf bytes.Buffer
+	in := &Table{Columns: []Column{{"s", []string{"a", "bc", "def"}}, {"b", []bool{true, false, true}}, {"n", []int64{1, 2, 3}}}}
+	if _, err := in.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	stream := buf.Bytes()
+	for n := range stream {
+		ReadTable(stream[:n])
+	}
+	damaged := make([]byte, len(stream))
+	for i := range stream {
+		for _, v := range []byte{0x00, 0x7F, 0x80, 0xFF} {
+			copy(damaged, stream)
+			damaged[i] = v
+			ReadTable(damaged)
+		}
+	}
+}
+
+func TestFlatbufferVectorBounds(t *testing.T) {
+	buf := fbBuild(fbTable{fbTables{fbTable{fbInt8(1)}}})
+	err := fbRead(buf, func(r fbReader, root int) error {
+		if n, _ := r.vector(root, 0); n != 1 {
+			t.Errorf("vector has %d elements", n)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A count past the end of the buffer is malformed, not an allocation size.
+	vec := bytes.LastIndex(buf, []byte{1, 0, 0, 0})
+	binary.LittleEndian.PutUint32(buf[vec:], math.MaxUint32)
+	err = fbRead(buf, func(r fbReader, root int) error {
+		n, _ := r.vector(root, 0)
+		t.Errorf("vector has %d elements", n)
+		return nil
+	})
+	if err != errFlatbuffer {
+		t.Errorf("fbRead = %v, want %v", err, errFlatbuffer)
+	}
+}
@@ -0,0 +1,387 @@
+package gorunpython
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// A chunked bundle is a pre-indexed alternative to a tarball that can be extracted in parallel.
+// File contents are grouped into chunks that are compressed independently with zstd, and a
+// compressed JSON index records where every entry lives:
+//
+//	magic | chunk 0 | chunk 1 | ... | index | index offset (u64) | index length (u64) | magic
+//
+// Integers are little-endian. A file never spans chunks; files larger than the chunk size get a
+// chunk of their own.
+const (
+	bundleMagic        = "GRPYBND1"
+	bundleFooterLen    = 8 + 8 + len(bundleMagic)
+	defaultBundleChunk = 4 << 20
+)
+
+// BundleOptions controls ConvertToBundle.
+type BundleOptions struct {
+	// ChunkSize is the target uncompressed size of each chunk. Defaults to 4 MiB.
+	ChunkSize int
+	// Level is the zstd compression level; 0 uses the codec default.
+	Level int
+}
+
+type bundleIndex struct {
+	Chunks  []bundleChunk `json:"chunks"`
+	Entries []bundleEntry `json:"entries"`
+}
+
+type bundleChunk struct {
+	Offset  int64 `json:"offset"`
+	Size    int64 `json:"size"`
+	RawSize int64 `json:"raw_size"`
+}
+
+type bundleEntry struct {
+	Name     string `json:"name"`
+	Typeflag byte   `json:"type"`
+	Mode     int64  `json:"mode"`
+	Size     int64  `json:"size,omitempty"`
+	Linkname string `json:"link,omitempty"`
+	Chunk    int    `json:"chunk,omitempty"`
+	Offset   int64  `json:"offset,omitempty"`
+}
+
+func (e bundleEntry) header() *tar.Header {
+	return &tar.Header{Name: e.Name, Typeflag: e.Typeflag, Mode: e.Mode, Size: e.Size, Linkname: e.Linkname}
+}
+
+func isBundle(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(bundleMagic))
+}
+
+// ConvertToBundle reads a tarball (gzip, zstd or uncompressed) from r and writes it to w as a
+// chunked bundle, which ExtractArchive unpacks using all CPUs. Later duplicates of a path replace
+// earlier ones, as they would when extracting the tarball.
+func ConvertToBundle(w io.Writer, r io.Reader, opts BundleOptions) error {
+	chunkSize := opts.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = defaultBundleChunk
+	}
+	level := zstd.SpeedDefault
+	if opts.Level != 0 {
+		level = zstd.EncoderLevelFromZstd(opts.Level)
+	}
+	enc, err := zstd.NewWriter(nil, zstd.WithEncoderLevel(level))
+	if err != nil {
+		return fmt.Errorf("create zstd writer: %w", err)
+	}
+	defer enc.Close()
+
+	dr, _, err := newDecompressReader(r)
+	if err != nil {
+		return err
+	}
+	defer dr.Close()
+
+	offset := int64(len(bundleMagic))
+	if _, err := io.WriteString(w, bundleMagic); err != nil {
+		return fmt.Errorf("write bundle header: %w", err)
+	}
+
+	var index bundleIndex
+	var chunk []byte
+	flush := func() error {
+		if len(chunk) == 0 {
+			return nil
+		}
+		compressed := enc.EncodeAll(chunk, nil)
+		if _, err := w.Write(compressed); err != nil {
+			return fmt.Errorf("write bundle chunk: %w", err)
+		}
+		index.Chunks = append(index.Chunks, bundleChunk{Offset: offset, Size: int64(len(compressed)), RawSize: int64(len(chunk))})
+		offset += int64(len(compressed))
+		chunk = chunk[:0]
+		return nil
+	}
+
+	positions := map[string]int{}
+	tr := tar.NewReader(dr)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read tar header: %w", err)
+		}
+		if hdr.Typeflag == tar.TypeXGlobalHeader {
+			continue
+		}
+		if err := checkArchiveEntry(hdr); err != nil {
+			return err
+		}
+		name, _ := cleanArchivePath(hdr.Name)
+		if name == "." {
+			continue
+		}
+
+		e := bundleEntry{Name: name, Typeflag: hdr.Typeflag, Mode: hdr.Mode, Linkname: hdr.Linkname}
+		if hdr.Typeflag == tar.TypeLink {
+			e.Linkname, _ = cleanArchivePath(hdr.Linkname)
+		}
+		if hdr.Typeflag == tar.TypeReg && hdr.Size > 0 {
+			if len(chunk) > 0 && len(chunk)+int(hdr.Size) > chunkSize {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+			e.Size = hdr.Size
+			e.Chunk = len(index.Chunks)
+			e.Offset = int64(len(chunk))
+			if chunk, err = appendReader(chunk, tr, hdr.Size); err != nil {
+				return fmt.Errorf("read %s: %w", hdr.Name, err)
+			}
+		}
+
+		if i, ok := positions[name]; ok {
+			index.Entries[i].Name = "" // superseded
+		}
+		positions[name] = len(index.Entries)
+		index.Entries = append(index.Entries, e)
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+
+	live := index.Entries[:0]
+	for _, e := range index.Entries {
+		if e.Name != "" {
+			live = append(live, e)
+		}
+	}
+	index.Entries = live
+
+	raw, err := json.Marshal(index)
+	if err != nil {
+		return fmt.Errorf("encode bundle index: %w", err)
+	}
+	compressed := enc.EncodeAll(raw, nil)
+	footer := make([]byte, 0, len(compressed)+bundleFooterLen)
+	footer = append(footer, compressed...)
+	footer = binary.LittleEndian.AppendUint64(footer, uint64(offset))
+	footer = binary.LittleEndian.AppendUint64(footer, uint64(len(compressed)))
+	footer = append(footer, bundleMagic...)
+	if _, err := w.Write(footer); err != nil {
+		return fmt.Errorf("write bundle index: %w", err)
+	}
+	return nil
+}
+
+func appendReader(buf []byte, r io.Reader, n int64) ([]byte, error) {
+	start := len(buf)
+	buf = append(buf, make([]byte, n)...)
+	if _, err := io.ReadFull(r, buf[start:]); err != nil {
+		return buf[:start], err
+	}
+	return buf, nil
+}
+
+// readBundleIndex parses and validates the index of a chunked bundle.
+func readBundleIndex(data []byte, dec *zstd.Decoder) (*bundleIndex, error) {
+	if len(data) < len(bundleMagic)+bundleFooterLen || string(data[len(data)-len(bundleMagic):]) != bundleMagic {
+		return nil, fmt.Errorf("invalid bundle footer")
+	}
+	footer := data[len(data)-bundleFooterLen:]
+	indexOffset := binary.LittleEndian.Uint64(footer[0:])
+	indexLen := binary.LittleEndian.Uint64(footer[8:])
+	if indexOffset > uint64(len(data)) || indexLen > uint64(len(data))-indexOffset {
+		return nil, fmt.Errorf("invalid bundle index location")
+	}
+	raw, err := dec.DecodeAll(data[indexOffset:indexOffset+indexLen], nil)
+	if err != nil {
+		return nil, fmt.Errorf("decompress bundle index: %w", err)
+	}
+	var index bundleIndex
+	if err := json.Unmarshal(raw, &index); err != nil {
+		return nil, fmt.Errorf("decode bundle index: %w", err)
+	}
+
+	for i, c := range index.Chunks {
+		if c.Offset < 0 || c.Size < 0 || c.Offset > int64(indexOffset) || c.Size > int64(indexOffset)-c.Offset {
+			return nil, fmt.Errorf("bundle chunk %d out of range", i)
+		}
+	}
+	for _, e := range index.Entries {
+		if e.Typeflag != tar.TypeReg || e.Size == 0 {
+			continue
+		}
+		if e.Chunk < 0 || e.Chunk >= len(index.Chunks) || e.Offset < 0 || e.Size < 0 ||
+			e.Offset > index.Chunks[e.Chunk].RawSize || e.Size > index.Chunks[e.Chunk].RawSize-e.Offset {
+			return nil, fmt.Errorf("bundle entry %q out of range", e.Name)
+		}
+	}
+	return &index, nil
+}
+
+// extractBundle unpacks a chunked bundle into dest. Directories, symlinks and empty files are
+// created first, then chunks are decompressed and their files written by a pool of workers, and
+// hard links are created last. It enforces the same checks as extractTar, skips entries
+// rejected by a non-nil keep and records files written in a non-nil rec.
+func extractBundle(data []byte, dest string, limits ExtractLimits, keep func(name string) bool, rec *extractRecord) error {
+	dec, err := zstd.NewReader(nil, zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		return fmt.Errorf("create zstd reader: %w", err)
+	}
+	index, err := readBundleIndex(data, dec)
+	dec.Close()
+	if err != nil {
+		return err
+	}
+
+	if limits.MaxEntries > 0 && len(index.Entries) > limits.MaxEntries {
+		return fmt.Errorf("archive has more than %d entries", limits.MaxEntries)
+	}
+	var total int64
+	filesByChunk := make([][]bundleEntry, len(index.Chunks))
+	entries := index.Entries[:0]
+	for _, e := range index.Entries {
+		if err := checkArchiveEntry(e.header()); err != nil {
+			return err
+		}
+		if keep != nil && !keep(e.Name) {
+			continue
+		}
+		entries = append(entries, e)
+		if e.Typeflag != tar.TypeReg {
+			continue
+		}
+		if limits.MaxFileSize > 0 && e.Size > limits.MaxFileSize {
+			return fmt.Errorf("%s is %d bytes, over the %d byte limit", e.Name, e.Size, limits.MaxFileSize)
+		}
+		total += e.Size
+		if limits.MaxTotalSize > 0 && total > limits.MaxTotalSize {
+			return fmt.Errorf("archive expands to more than %d bytes", limits.MaxTotalSize)
+		}
+		if e.Size > 0 {
+			filesByChunk[e.Chunk] = append(filesByChunk[e.Chunk], e)
+		}
+	}
+
+	root, destReal, err := openExtractRoot(dest)
+	if err != nil {
+		return err
+	}
+	defer root.Close()
+
+	for _, e := range entries {
+		target := filepath.FromSlash(e.Name)
+		switch e.Typeflag {
+		case tar.TypeDir:
+			if err := root.MkdirAll(target, 0o755); err != nil {
+				return fmt.Errorf("failed to create directory: %w", err)
+			}
+		case tar.TypeSymlink:
+			if err := prepareLink(root, target); err != nil {
+				return err
+			}
+			if err := checkSymlinkTarget(destReal, target, e.Linkname); err != nil {
+				return err
+			}
+			if err := root.Symlink(e.Linkname, target); err != nil {
+				return fmt.Errorf("failed to create symlink: %w", err)
+			}
+		case tar.TypeReg:
+			if e.Size == 0 {
+				if err := extractRegular(root, target, e.header(), bytes.NewReader(nil), rec); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	if err := extractBundleChunks(root, data, index.Chunks, filesByChunk, rec); err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		if e.Typeflag != tar.TypeLink {
+			continue
+		}
+		target := filepath.FromSlash(e.Name)
+		if err := prepareLink(root, target); err != nil {
+			return err
+		}
+		if err := root.Link(filepath.FromSlash(e.Linkname), target); err != nil {
+			return fmt.Errorf("failed to create hard link: %w", err)
+		}
+		rec.link(e.Name, e.Linkname)
+	}
+	return nil
+}
+
+// extractBundleChunks decompresses chunks concurrently and writes the files each one holds.
+func extractBundleChunks(root *os.Root, data []byte, chunks []bundleChunk, filesByChunk [][]bundleEntry, rec *extractRecord) error {
+	workers := min(runtime.GOMAXPROCS(0), len(chunks))
+	jobs := make(chan int)
+	errs := make(chan error, workers)
+	var wg sync.WaitGroup
+	var once sync.Once
+	done := make(chan struct{})
+
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			dec, err := zstd.NewReader(nil, zstd.WithDecoderConcurrency(1))
+			if err != nil {
+				errs <- fmt.Errorf("create zstd reader: %w", err)
+				once.Do(func() { close(done) })
+				return
+			}
+			defer dec.Close()
+
+			var buf []byte
+			for i := range jobs {
+				c := chunks[i]
+				buf, err = dec.DecodeAll(data[c.Offset:c.Offset+c.Size], buf[:0])
+				if err == nil && int64(len(buf)) != c.RawSize {
+					err = fmt.Errorf("expected %d bytes, got %d", c.RawSize, len(buf))
+				}
+				if err != nil {
+					errs <- fmt.Errorf("decompress bundle chunk %d: %w", i, err)
+					once.Do(func() { close(done) })
+					return
+				}
+				for _, e := range filesByChunk[i] {
+					content := bytes.NewReader(buf[e.Offset : e.Offset+e.Size])
+					if err := extractRegular(root, filepath.FromSlash(e.Name), e.header(), content, rec); err != nil {
+						errs <- err
+						once.Do(func() { close(done) })
+						return
+					}
+				}
+			}
+		}()
+	}
+
+feed:
+	for i := range chunks {
+		select {
+		case jobs <- i:
+		case <-done:
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	close(errs)
+	return <-errs
+}
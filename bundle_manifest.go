@@ -0,0 +1,394 @@
+package gorunpython
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"debug/elf"
+	"debug/macho"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// BundleManifestName is the metadata file at the root of a Python bundle. Bundle builds should
+// make it the archive's first entry so it can be read without unpacking the rest.
+const BundleManifestName = ".gorunpython-bundle.json"
+
+// errEmptyBundleManifest is returned for a bundle whose manifest file is empty.
+var errEmptyBundleManifest = errors.New("empty bundle manifest")
+
+// bundleManifestScanLimit is how many tar entries ReadBundleManifest looks at before giving up.
+const bundleManifestScanLimit = 16
+
+// BundleManifest describes a Python bundle: what it contains and where things are inside it.
+type BundleManifest struct {
+	// Version is the interpreter's major.minor version, e.g. "3.14" (or "3.14t" if free-threaded).
+	Version string `json:"version"`
+	// Implementation is the Python implementation, normally "cpython".
+	Implementation string `json:"implementation"`
+	// ABITags are the wheel ABI tags the interpreter accepts, e.g. "cp314".
+	ABITags []string `json:"abi_tags,omitempty"`
+	// Platform is the GOOS/GOARCH the bundle runs on, e.g. "linux/amd64".
+	Platform string       `json:"platform"`
+	Layout   BundleLayout `json:"layout"`
+	// Loader is the bundled dynamic loader, relative to the bundle root. Empty means the host's.
+	Loader string `json:"loader,omitempty"`
+	// Libc is the C library the bundle was linked against: "glibc", "musl", "bionic" or "darwin".
+	Libc string `json:"libc,omitempty"`
+	// BuildPrefix is the install prefix the bundle was built with (see RelocationManifest).
+	BuildPrefix string `json:"build_prefix,omitempty"`
+	// Tools lists extra programs shipped in the bundle, relative to the bundle root.
+	Tools     []string  `json:"tools,omitempty"`
+	BuildDate time.Time `json:"build_date,omitzero"`
+	// SHA256 is the digest of the bundle's contents as computed by BundleTreeDigest.
+	SHA256 string `json:"sha256,omitempty"`
+}
+
+// BundleLayout gives slash-separated paths relative to the bundle root.
+type BundleLayout struct {
+	Prefix      string `json:"prefix"`
+	Bin         string `json:"bin"`
+	Lib         string `json:"lib"`
+	Stdlib      string `json:"stdlib"`
+	DynLoad     string `json:"dynload"`
+	Interpreter string `json:"interpreter"`
+}
+
+// ReadBundleManifest returns the manifest of a bundle (tarball or chunked bundle) without
+// unpacking it. It returns an error wrapping os.ErrNotExist if the bundle has none, and
+// errEmptyBundleManifest if the manifest file is empty.
+func ReadBundleManifest(data []byte) (*BundleManifest, error) {
+	raw, err := readArchiveManifest(data)
+	if err != nil {
+		return nil, err
+	}
+	return decodeBundleManifest(raw)
+}
+
+// readBundleManifest returns the manifest in an extracted bundle, or nil if it has none.
+func readBundleManifest(dir string) (*BundleManifest, error) {
+	raw, err := os.ReadFile(filepath.Join(dir, BundleManifestName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read bundle manifest: %w", err)
+	}
+	return decodeBundleManifest(raw)
+}
+
+func decodeBundleManifest(raw []byte) (*BundleManifest, error) {
+	if len(bytes.TrimSpace(raw)) == 0 {
+		return nil, errEmptyBundleManifest
+	}
+	var m BundleManifest
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return nil, fmt.Errorf("decode bundle manifest: %w", err)
+	}
+	if m.Version == "" || m.Layout.Bin == "" || m.Layout.Interpreter == "" {
+		return nil, errors.New("bundle manifest is missing version, bin or interpreter")
+	}
+	return &m, nil
+}
+
+func readArchiveManifest(data []byte) ([]byte, error) {
+	notFound := fmt.Errorf("bundle has no %s: %w", BundleManifestName, os.ErrNotExist)
+	if isBundle(data) {
+		dec, err := zstd.NewReader(nil, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		defer dec.Close()
+		index, err := readBundleIndex(data, dec)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range index.Entries {
+			if name, _ := cleanArchivePath(e.Name); name != BundleManifestName || e.Typeflag != tar.TypeReg {
+				continue
+			}
+			if e.Size == 0 {
+				return nil, errEmptyBundleManifest
+			}
+			c := index.Chunks[e.Chunk]
+			chunk, err := dec.DecodeAll(data[c.Offset:c.Offset+c.Size], nil)
+			if err != nil {
+				return nil, fmt.Errorf("decompress bundle manifest chunk: %w", err)
+			}
+			if int64(len(chunk)) < e.Offset+e.Size {
+				return nil, errors.New("bundle manifest chunk is shorter than its index says")
+			}
+			return chunk[e.Offset : e.Offset+e.Size], nil
+		}
+		return nil, notFound
+	}
+
+	r, _, err := newDecompressReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	tr := tar.NewReader(r)
+	for range bundleManifestScanLimit {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read tar header: %w", err)
+		}
+		if name, _ := cleanArchivePath(hdr.Name); name == BundleManifestName && hdr.Typeflag == tar.TypeReg {
+			return io.ReadAll(io.LimitReader(tr, 1<<20))
+		}
+	}
+	return nil, notFound
+}
+
+// pythonLayout resolves the manifest's layout against the directory the bundle was extracted to.
+func (m *BundleManifest) pythonLayout(root string) (*pythonLayout, error) {
+	resolve := func(p string) (string, error) {
+		clean, err := cleanArchivePath(p)
+		if err != nil {
+			return "", fmt.Errorf("bundle manifest: %w", err)
+		}
+		return filepath.Join(root, filepath.FromSlash(clean)), nil
+	}
+
+	lay := m.Layout
+	prefix := lay.Prefix
+	if prefix == "" {
+		prefix = path.Dir(lay.Bin)
+	}
+	lib := lay.Lib
+	if lib == "" {
+		lib = path.Join(prefix, "lib")
+	}
+	stdlib := lay.Stdlib
+	if stdlib == "" {
+		stdlib = path.Join(lib, "python"+m.Version)
+	}
+	dynload := lay.DynLoad
+	if dynload == "" {
+		dynload = path.Join(stdlib, "lib-dynload")
+	}
+
+	l := &pythonLayout{Version: m.Version}
+	for _, f := range []struct {
+		dst *string
+		src string
+	}{
+		{&l.Prefix, prefix}, {&l.BinDir, lay.Bin}, {&l.LibDir, lib}, {&l.Stdlib, stdlib},
+		{&l.DynLoad, dynload}, {&l.Interpreter, lay.Interpreter},
+	} {
+		p, err := resolve(f.src)
+		if err != nil {
+			return nil, err
+		}
+		*f.dst = p
+	}
+	if m.Loader != "" {
+		loader, err := resolve(m.Loader)
+		if err != nil {
+			return nil, err
+		}
+		l.Loader = loader
+	}
+	return l, nil
+}
+
+// GenerateBundleManifest describes the unpacked bundle in dir. The install prefix is the single
+// top-level directory holding bin and lib; everything else is read from the tree and its
+// interpreter. buildPrefix and tools are recorded as given.
+func GenerateBundleManifest(dir string, buildPrefix string, tools []string) (*BundleManifest, error) {
+	prefix, err := findBundlePrefix(dir)
+	if err != nil {
+		return nil, err
+	}
+	version, ok := newestStdlibVersion(filepath.Join(dir, prefix, "lib"))
+	if !ok {
+		return nil, fmt.Errorf("no lib/pythonX.Y directory under %s", filepath.Join(dir, prefix))
+	}
+	interpreter, err := resolvePythonExecutable(filepath.Join(dir, prefix, "bin"), version)
+	if err != nil {
+		return nil, err
+	}
+	rel := func(p string) string {
+		r, _ := filepath.Rel(dir, p)
+		return filepath.ToSlash(r)
+	}
+
+	stdlib := path.Join(prefix, "lib", "python"+version)
+	m := &BundleManifest{
+		Version:        version,
+		Implementation: "cpython",
+		ABITags:        []string{"cp" + strings.ReplaceAll(version, ".", "")},
+		Layout: BundleLayout{
+			Prefix:      prefix,
+			Bin:         path.Join(prefix, "bin"),
+			Lib:         path.Join(prefix, "lib"),
+			Stdlib:      stdlib,
+			DynLoad:     path.Join(stdlib, "lib-dynload"),
+			Interpreter: rel(interpreter),
+		},
+		BuildPrefix: buildPrefix,
+		Tools:       tools,
+	}
+	if m.BuildPrefix == "" {
+		if reloc, err := readRelocationManifest(dir); err == nil && reloc != nil {
+			m.BuildPrefix = reloc.Prefix
+		}
+	}
+	if err := m.describeInterpreter(dir, interpreter); err != nil {
+		return nil, err
+	}
+
+	m.BuildDate = time.Now().UTC().Truncate(time.Second)
+	if os.Getenv("SOURCE_DATE_EPOCH") != "" {
+		if m.BuildDate, err = sourceDateEpoch(); err != nil {
+			return nil, err
+		}
+		m.BuildDate = m.BuildDate.UTC()
+	}
+	if m.SHA256, err = BundleTreeDigest(dir); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// describeInterpreter fills in the platform, libc and loader from the interpreter binary.
+func (m *BundleManifest) describeInterpreter(dir, interpreter string) error {
+	real, err := filepath.EvalSymlinks(interpreter)
+	if err != nil {
+		return err
+	}
+	if f, err := macho.Open(real); err == nil {
+		defer f.Close()
+		m.Platform, m.Libc = "darwin/"+machoArch(f.Cpu), "darwin"
+		return nil
+	}
+	f, err := elf.Open(real)
+	if err != nil {
+		return fmt.Errorf("interpreter %s is neither ELF nor Mach-O: %w", interpreter, err)
+	}
+	defer f.Close()
+	goarch, ok := elfMachineArch[f.Machine]
+	if !ok {
+		return fmt.Errorf("interpreter %s is built for unsupported machine %v", interpreter, f.Machine)
+	}
+	interp := elfInterpreter(f)
+	goos := "linux"
+	if strings.HasPrefix(interp, "/system/bin/linker") {
+		goos, m.Libc = "android", "bionic"
+	} else {
+		m.Libc = string(libcFromInterpreter(interp))
+	}
+	m.Platform = goos + "/" + goarch
+	if name, ok := loaderTable[loaderKey{goos, goarch, libcFlavor(m.Libc)}]; ok {
+		loader := path.Join(m.Layout.Lib, name)
+		if _, err := os.Stat(filepath.Join(dir, filepath.FromSlash(loader))); err == nil {
+			m.Loader = loader
+		}
+	}
+	return nil
+}
+
+func machoArch(cpu macho.Cpu) string {
+	switch cpu {
+	case macho.CpuArm64:
+		return "arm64"
+	case macho.CpuAmd64:
+		return "amd64"
+	}
+	return cpu.String()
+}
+
+// findBundlePrefix returns the top-level directory of dir that contains both bin and lib.
+func findBundlePrefix(dir string) (string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", err
+	}
+	var found []string
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		bin, binErr := os.Stat(filepath.Join(dir, e.Name(), "bin"))
+		lib, libErr := os.Stat(filepath.Join(dir, e.Name(), "lib"))
+		if binErr == nil && libErr == nil && bin.IsDir() && lib.IsDir() {
+			found = append(found, e.Name())
+		}
+	}
+	if len(found) != 1 {
+		return "", fmt.Errorf("expected one top-level directory with bin and lib in %s, found %d", dir, len(found))
+	}
+	return found[0], nil
+}
+
+// BundleTreeDigest hashes the unpacked bundle in dir: the sha256 of a sorted listing with one
+// "<sha256 of content or link target>  <type> <path>" line per file and symlink, leaving out
+// the bundle manifest itself.
+func BundleTreeDigest(dir string) (string, error) {
+	var lines []string
+	err := filepath.WalkDir(dir, func(p string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel == BundleManifestName {
+			return nil
+		}
+		var sum, kind string
+		switch {
+		case d.Type()&os.ModeSymlink != 0:
+			target, err := os.Readlink(p)
+			if err != nil {
+				return err
+			}
+			h := sha256.Sum256([]byte(target))
+			sum, kind = hex.EncodeToString(h[:]), "l"
+		case d.Type().IsRegular():
+			if sum, err = hashFile(p); err != nil {
+				return err
+			}
+			kind = "f"
+		default:
+			return nil
+		}
+		lines = append(lines, sum+"  "+kind+" "+rel+"\n")
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("hash bundle tree: %w", err)
+	}
+	sort.Strings(lines)
+	h := sha256.New()
+	for _, line := range lines {
+		io.WriteString(h, line)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// WriteBundleManifest stores m at the root of dir.
+func WriteBundleManifest(dir string, m *BundleManifest) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode bundle manifest: %w", err)
+	}
+	return os.WriteFile(filepath.Join(dir, BundleManifestName), append(data, '\n'), 0o644)
+}
@@ -0,0 +1,240 @@
+package gorunpython
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+const testBundleManifest = `{"version":"3.14","implementation":"cpython","platform":"linux/amd64",` +
+	`"layout":{"prefix":"python","bin":"python/bin","interpreter":"python/bin/python3.14"}}`
+
+func TestReadBundleManifest(t *testing.T) {
+	var late []tarEntry
+	for i := range bundleManifestScanLimit {
+		late = append(late, tarFile(fmt.Sprintf("f%02d", i), ""))
+	}
+	tests := []struct {
+		name    string
+		entries []tarEntry
+		want    string // an error substring, or "" for the test manifest
+	}{
+		{"first entry", []tarEntry{tarFile(BundleManifestName, testBundleManifest), tarFile("python/bin/python3", "")}, ""},
+		{"dot slash", []tarEntry{tarFile("./"+BundleManifestName, testBundleManifest)}, ""},
+		{"missing", []tarEntry{tarFile("python/bin/python3", "")}, "no " + BundleManifestName},
+		{"empty", []tarEntry{tarFile(BundleManifestName, "")}, "empty bundle manifest"},
+		{"whitespace", []tarEntry{tarFile(BundleManifestName, " \n")}, "empty bundle manifest"},
+		{"not json", []tarEntry{tarFile(BundleManifestName, "{")}, "decode bundle manifest"},
+		{"no interpreter", []tarEntry{tarFile(BundleManifestName, `{"version":"3.14","layout":{"bin":"python/bin"}}`)}, "missing version, bin or interpreter"},
+		{"directory", []tarEntry{{hdr: tar.Header{Name: BundleManifestName + "/", Mode: 0o755, Typeflag: tar.TypeDir}}}, "no " + BundleManifestName},
+		{"past scan limit", append(late, tarFile(BundleManifestName, testBundleManifest)), "no " + BundleManifestName},
+	}
+
+	for _, tt := range tests {
+		tarball := tarEntries(t, tt.entries...)
+		formats := map[string][]byte{"tar": tarball, "bundle": convertToBundle(t, tarball, BundleOptions{})}
+		for format, data := range formats {
+			if format == "bundle" && tt.name == "past scan limit" {
+				continue // the bundle index is searched in full
+			}
+			t.Run(tt.name+"/"+format, func(t *testing.T) {
+				m, err := ReadBundleManifest(data)
+				if tt.want != "" {
+					if err == nil || !strings.Contains(err.Error(), tt.want) {
+						t.Fatalf("err = %v, want %q", err, tt.want)
+					}
+					if strings.HasPrefix(tt.want, "no ") && !errors.Is(err, os.ErrNotExist) {
+						t.Errorf("err = %v, want it to wrap os.ErrNotExist", err)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				if m.Version != "3.14" || m.Layout.Interpreter != "python/bin/python3.14" {
+					t.Errorf("manifest = %+v", m)
+				}
+			})
+		}
+	}
+}
+
+func TestReadBundleManifestFromDir(t *testing.T) {
+	dir := t.TempDir()
+	if m, err := readBundleManifest(dir); m != nil || err != nil {
+		t.Errorf("readBundleManifest without a manifest = %v, %v; want nil, nil", m, err)
+	}
+	os.WriteFile(filepath.Join(dir, BundleManifestName), nil, 0o644)
+	if _, err := readBundleManifest(dir); !errors.Is(err, errEmptyBundleManifest) {
+		t.Errorf("readBundleManifest of an empty file = %v, want errEmptyBundleManifest", err)
+	}
+}
+
+func TestBundleManifestLayout(t *testing.T) {
+	root := filepath.Join(string(filepath.Separator), "x")
+	tests := []struct {
+		name   string
+		m      BundleManifest
+		want   pythonLayout
+		errMsg string
+	}{
+		{
+			name: "defaults",
+			m:    BundleManifest{Version: "3.14", Layout: BundleLayout{Bin: "python/bin", Interpreter: "python/bin/python3.14"}},
+			want: pythonLayout{
+				Version: "3.14", Prefix: "/x/python", BinDir: "/x/python/bin", LibDir: "/x/python/lib",
+				Stdlib: "/x/python/lib/python3.14", DynLoad: "/x/python/lib/python3.14/lib-dynload",
+				Interpreter: "/x/python/bin/python3.14",
+			},
+		},
+		{
+			name: "explicit",
+			m: BundleManifest{Version: "3.13t", Loader: "p/lib/ld.so", Layout: BundleLayout{
+				Prefix: "p", Bin: "p/bin", Lib: "p/lib64", Stdlib: "p/lib64/py", DynLoad: "p/dyn", Interpreter: "p/bin/python",
+			}},
+			want: pythonLayout{
+				Version: "3.13t", Prefix: "/x/p", BinDir: "/x/p/bin", LibDir: "/x/p/lib64", Stdlib: "/x/p/lib64/py",
+				DynLoad: "/x/p/dyn", Interpreter: "/x/p/bin/python", Loader: "/x/p/lib/ld.so",
+			},
+		},
+		{
+			name:   "escaping path",
+			m:      BundleManifest{Version: "3.14", Layout: BundleLayout{Bin: "../bin", Interpreter: "python/bin/python3"}},
+			errMsg: "invalid path",
+		},
+		{
+			name:   "absolute loader",
+			m:      BundleManifest{Version: "3.14", Loader: "/lib/ld.so", Layout: BundleLayout{Bin: "b", Interpreter: "b/python"}},
+			errMsg: "invalid path",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.m.pythonLayout(root)
+			if tt.errMsg != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errMsg) {
+					t.Fatalf("err = %v, want %q", err, tt.errMsg)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := tt.want
+			for _, p := range []*string{&want.Prefix, &want.BinDir, &want.LibDir, &want.Stdlib, &want.DynLoad, &want.Interpreter, &want.Loader} {
+				*p = filepath.FromSlash(*p)
+			}
+			if *got != want {
+				t.Errorf("layout = %+v\nwant     %+v", *got, want)
+			}
+		})
+	}
+}
+
+func TestBundleTreeDigest(t *testing.T) {
+	files := map[string]string{"python/bin/python3": "bin", "python/lib/os.py": "os"}
+	a := writeTree(t, "a", files)
+	b := writeTree(t, "b", files)
+	if err := os.Symlink("python3", filepath.Join(a, "python/bin/python")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("python3", filepath.Join(b, "python/bin/python")); err != nil {
+		t.Fatal(err)
+	}
+	digestA, err := BundleTreeDigest(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The manifest itself is not part of the digest.
+	os.WriteFile(filepath.Join(b, BundleManifestName), []byte(testBundleManifest), 0o644)
+	if digestB, err := BundleTreeDigest(b); err != nil || digestB != digestA {
+		t.Errorf("identical trees digest to %s and %s (%v)", digestA, digestB, err)
+	}
+	for name, change := range map[string]func(dir string){
+		"content": func(dir string) { os.WriteFile(filepath.Join(dir, "python/lib/os.py"), []byte("OS"), 0o644) },
+		"link target": func(dir string) {
+			os.Remove(filepath.Join(dir, "python/bin/python"))
+			os.Symlink("x", filepath.Join(dir, "python/bin/python"))
+		},
+		"new file": func(dir string) { os.WriteFile(filepath.Join(dir, "python/lib/new.py"), nil, 0o644) },
+		"renamed": func(dir string) {
+			os.Rename(filepath.Join(dir, "python/lib/os.py"), filepath.Join(dir, "python/lib/sys.py"))
+		},
+	} {
+		dir := writeTree(t, "c", files)
+		os.Symlink("python3", filepath.Join(dir, "python/bin/python"))
+		change(dir)
+		if got, _ := BundleTreeDigest(dir); got == digestA {
+			t.Errorf("%s change did not alter the digest", name)
+		}
+	}
+}
+
+func TestGenerateBundleManifest(t *testing.T) {
+	bin, interp := hostELF(t)
+	data, err := os.ReadFile(bin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := writeTree(t, "unpacked", map[string]string{
+		"python/bin/python3.14":        string(data),
+		"python/lib/python3.14/os.py":  "",
+		"python/lib/python3.12/old.py": "",
+	})
+	t.Setenv("SOURCE_DATE_EPOCH", "1700000000")
+	m, err := GenerateBundleManifest(dir, "/opt/py", []string{"python/bin/python-launcher"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Version != "3.14" || m.Layout.Interpreter != "python/bin/python3.14" || m.Layout.DynLoad != "python/lib/python3.14/lib-dynload" {
+		t.Errorf("manifest = %+v", m)
+	}
+	if want := "linux/" + runtime.GOARCH; m.Platform != want {
+		t.Errorf("platform = %q, want %q", m.Platform, want)
+	}
+	if want := string(libcFromInterpreter(interp)); m.Libc != want {
+		t.Errorf("libc = %q, want %q", m.Libc, want)
+	}
+	if m.BuildPrefix != "/opt/py" || m.BuildDate.Unix() != 1700000000 || len(m.ABITags) != 1 || m.ABITags[0] != "cp314" {
+		t.Errorf("manifest = %+v", m)
+	}
+	if digest, _ := BundleTreeDigest(dir); m.SHA256 != digest {
+		t.Errorf("sha256 = %s, want %s", m.SHA256, digest)
+	}
+
+	// Written and packed, it reads back the same.
+	if err := WriteBundleManifest(dir, m); err != nil {
+		t.Fatal(err)
+	}
+	raw, _ := os.ReadFile(filepath.Join(dir, BundleManifestName))
+	back, err := ReadBundleManifest(tarOf(t, map[string]string{BundleManifestName: string(raw)}))
+	if err != nil || back.SHA256 != m.SHA256 || !back.BuildDate.Equal(m.BuildDate) {
+		t.Errorf("read back %+v, %v", back, err)
+	}
+	if !bytes.HasSuffix(raw, []byte("\n")) {
+		t.Error("manifest file does not end in a newline")
+	}
+}
+
+func TestFindBundlePrefix(t *testing.T) {
+	tests := []struct {
+		files map[string]string
+		want  string
+	}{
+		{map[string]string{"python/bin/x": "", "python/lib/x": "", "README": ""}, "python"},
+		{map[string]string{"python/bin/x": ""}, ""},
+		{map[string]string{"a/bin/x": "", "a/lib/x": "", "b/bin/x": "", "b/lib/x": ""}, ""},
+	}
+	for _, tt := range tests {
+		got, err := findBundlePrefix(writeTree(t, "tree", tt.files))
+		if got != tt.want || (err == nil) != (tt.want != "") {
+			t.Errorf("findBundlePrefix(%v) = %q, %v; want %q", tt.files, got, err, tt.want)
+		}
+	}
+}
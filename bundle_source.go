@@ -0,0 +1,129 @@
+package gorunpython
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"runtime"
+)
+
+// A BundleSource supplies a Python bundle (a tarball or chunked bundle) to
+// CreatePythonInstanceFromBundle. The bundle compiled into the binary is one source; a side file,
+// a file in a sealed payload or a shared system location are others.
+type BundleSource interface {
+	// ReadBundle returns the complete bundle. It may be called more than once, for example to
+	// repair a damaged tree.
+	ReadBundle() ([]byte, error)
+	// String describes the source in messages.
+	String() string
+}
+
+// bundleEnvVar names a bundle file that CreatePythonInstance uses instead of the embedded one.
+const bundleEnvVar = "GORUNPYTHON_BUNDLE"
+
+// defaultBundleSource is the bundle CreatePythonInstance uses: the file named by
+// GORUNPYTHON_BUNDLE if set, otherwise the embedded bundle.
+func defaultBundleSource() BundleSource {
+	if path := os.Getenv(bundleEnvVar); path != "" {
+		return BundleFromFile(path)
+	}
+	return EmbeddedBundle()
+}
+
+type embeddedSource struct{}
+
+// EmbeddedBundle returns the bundle compiled into this binary for the current platform.
+func EmbeddedBundle() BundleSource { return embeddedSource{} }
+
+func (embeddedSource) ReadBundle() ([]byte, error) {
+	if len(embeddedPython) == 0 {
+		return nil, fmt.Errorf("no embedded python package for %s-%s; add an embed file with matching //go:build, build for a supported target, or set %s",
+			runtime.GOOS, runtime.GOARCH, bundleEnvVar)
+	}
+	return embeddedPython, nil
+}
+
+func (embeddedSource) String() string { return "embedded bundle" }
+
+type bytesSource []byte
+
+// BundleFromBytes uses a bundle already in memory, such as one embedded by a build-tag specific file.
+func BundleFromBytes(data []byte) BundleSource { return bytesSource(data) }
+
+func (s bytesSource) ReadBundle() ([]byte, error) { return s, nil }
+
+func (s bytesSource) String() string { return fmt.Sprintf("%d byte bundle", len(s)) }
+
+type fileSource string
+
+// BundleFromFile reads the bundle from a file, such as one shipped next to the binary or
+// installed in a shared location.
+func BundleFromFile(path string) BundleSource { return fileSource(path) }
+
+func (s fileSource) ReadBundle() ([]byte, error) {
+	data, err := os.ReadFile(string(s))
+	if err != nil {
+		return nil, fmt.Errorf("read python bundle: %w", err)
+	}
+	return data, nil
+}
+
+func (s fileSource) String() string { return string(s) }
+
+type fsSource struct {
+	fsys fs.FS
+	name string
+}
+
+// BundleFromFS reads the bundle from a file system, such as an embed.FS or the SealedFS of a
+// sealed payload.
+func BundleFromFS(fsys fs.FS, name string) BundleSource { return fsSource{fsys, name} }
+
+func (s fsSource) ReadBundle() ([]byte, error) {
+	data, err := fs.ReadFile(s.fsys, s.name)
+	if err != nil {
+		return nil, fmt.Errorf("read python bundle: %w", err)
+	}
+	return data, nil
+}
+
+func (s fsSource) String() string { return s.name }
+
+type readerAtSource struct {
+	r    io.ReaderAt
+	size int64
+}
+
+// BundleFromReaderAt reads a size-byte bundle from r.
+func BundleFromReaderAt(r io.ReaderAt, size int64) BundleSource { return readerAtSource{r, size} }
+
+func (s readerAtSource) ReadBundle() ([]byte, error) {
+	if s.size < 0 {
+		return nil, fmt.Errorf("read python bundle: negative size %d", s.size)
+	}
+	data := make([]byte, s.size)
+	n, err := s.r.ReadAt(data, 0)
+	if n == len(data) {
+		return data, nil
+	}
+	if err == nil || err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return nil, fmt.Errorf("read python bundle: %w", err)
+}
+
+func (s readerAtSource) String() string { return fmt.Sprintf("%d byte reader", s.size) }
+
+// bundleKey identifies a bundle, so an extracted tree can be matched to its bundle. It is the
+// build-time digest from the bundle manifest when there is one, and otherwise the sha256 of the
+// whole bundle, which CreatePythonInstanceFromBundle computes while it extracts.
+func bundleKey(data []byte) string {
+	if m, err := ReadBundleManifest(data); err == nil && m.SHA256 != "" {
+		return "tree:" + m.SHA256
+	}
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
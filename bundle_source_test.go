@@ -0,0 +1,101 @@
+package gorunpython
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// failingReaderAt returns n bytes of its data and then err.
+type failingReaderAt struct {
+	data []byte
+	err  error
+}
+
+func (r failingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	n := copy(p, r.data[min(int(off), len(r.data)):])
+	return n, r.err
+}
+
+func TestBundleSources(t *testing.T) {
+	bundle := []byte("not really a tarball")
+	path := filepath.Join(t.TempDir(), "python.tar.zst")
+	if err := os.WriteFile(path, bundle, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	fsys := fstest.MapFS{"bundles/python.tar.zst": {Data: bundle}}
+
+	tests := []struct {
+		name    string
+		src     BundleSource
+		wantErr error // nil when the bundle should be read
+	}{
+		{"bytes", BundleFromBytes(bundle), nil},
+		{"file", BundleFromFile(path), nil},
+		{"missing file", BundleFromFile(path + ".missing"), fs.ErrNotExist},
+		{"fs", BundleFromFS(fsys, "bundles/python.tar.zst"), nil},
+		{"missing in fs", BundleFromFS(fsys, "python.tar.zst"), fs.ErrNotExist},
+		{"reader", BundleFromReaderAt(bytes.NewReader(bundle), int64(len(bundle))), nil},
+		{"reader prefix", BundleFromReaderAt(bytes.NewReader(append(bundle, "trailer"...)), int64(len(bundle))), nil},
+		{"short reader", BundleFromReaderAt(bytes.NewReader(bundle), int64(len(bundle))+1), io.ErrUnexpectedEOF},
+		{"reader error", BundleFromReaderAt(failingReaderAt{bundle[:4], io.ErrClosedPipe}, int64(len(bundle))), io.ErrClosedPipe},
+		{"full read with error", BundleFromReaderAt(failingReaderAt{bundle, io.EOF}, int64(len(bundle))), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.src.String() == "" {
+				t.Error("empty description")
+			}
+			// Sources may be read more than once, e.g. by Repair.
+			for range 2 {
+				data, err := tt.src.ReadBundle()
+				if tt.wantErr != nil {
+					if !errors.Is(err, tt.wantErr) {
+						t.Fatalf("err = %v, want %v", err, tt.wantErr)
+					}
+					return
+				}
+				if err != nil || !bytes.Equal(data, bundle) {
+					t.Fatalf("ReadBundle = %q, %v", data, err)
+				}
+			}
+		})
+	}
+}
+
+func TestBundleFromReaderAtNegativeSize(t *testing.T) {
+	if _, err := BundleFromReaderAt(bytes.NewReader(nil), -1).ReadBundle(); err == nil {
+		t.Error("read a bundle of negative size")
+	}
+}
+
+func TestDefaultBundleSource(t *testing.T) {
+	t.Setenv(bundleEnvVar, "")
+	if _, ok := defaultBundleSource().(embeddedSource); !ok {
+		t.Errorf("default source without %s = %v", bundleEnvVar, defaultBundleSource())
+	}
+	path := filepath.Join(t.TempDir(), "python.tar.zst")
+	t.Setenv(bundleEnvVar, path)
+	if src := defaultBundleSource(); src.String() != path {
+		t.Errorf("default source with %s = %v", bundleEnvVar, src)
+	}
+}
+
+func TestEmbeddedBundle(t *testing.T) {
+	data, err := EmbeddedBundle().ReadBundle()
+	if len(embeddedPython) == 0 {
+		if err == nil || !strings.Contains(err.Error(), bundleEnvVar) {
+			t.Errorf("missing embedded bundle: err = %v, want one naming %s", err, bundleEnvVar)
+		}
+		return
+	}
+	if err != nil || len(data) != len(embeddedPython) {
+		t.Errorf("embedded bundle: %d bytes, %v", len(data), err)
+	}
+}
@@ -0,0 +1,304 @@
+package gorunpython
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func convertToBundle(t testing.TB, tarball []byte, opts BundleOptions) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := ConvertToBundle(&buf, bytes.NewReader(tarball), opts); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// readTree returns the files, symlinks and directories under dir, keyed by slash path.
+func readTree(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	tree := map[string]string{}
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || p == dir {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, p)
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		switch {
+		case d.Type()&fs.ModeSymlink != 0:
+			target, err := os.Readlink(p)
+			tree[filepath.ToSlash(rel)] = "-> " + target
+			return err
+		case d.IsDir():
+			tree[filepath.ToSlash(rel)] = "dir"
+		default:
+			data, err := os.ReadFile(p)
+			tree[filepath.ToSlash(rel)] = fmt.Sprintf("%v %s", info.Mode().Perm(), data)
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tree
+}
+
+func TestBundleMatchesTar(t *testing.T) {
+	tarball := tarEntries(t,
+		tarEntry{hdr: tar.Header{Name: "bin/", Mode: 0o755, Typeflag: tar.TypeDir}},
+		tarEntry{tar.Header{Name: "bin/python", Mode: 0o755, Size: 6, Typeflag: tar.TypeReg}, "binary"},
+		tarSymlink("bin/python3", "python"),
+		tarHardlink("bin/python3.14", "bin/python"),
+		tarFile("lib/empty.py", ""),
+		tarFile("lib/big.bin", strings.Repeat("x", 300)),
+		tarFile("lib/a.py", "a"),
+		tarFile("lib/a.py", "replaced"),
+	)
+	want := t.TempDir()
+	if err := ExtractArchive(tarball, want); err != nil {
+		t.Fatal(err)
+	}
+	for _, chunk := range []int{0, 1, 64, 1 << 20} {
+		t.Run(fmt.Sprint("chunk ", chunk), func(t *testing.T) {
+			got := t.TempDir()
+			if err := ExtractArchive(convertToBundle(t, tarball, BundleOptions{ChunkSize: chunk}), got); err != nil {
+				t.Fatal(err)
+			}
+			wantTree, gotTree := readTree(t, want), readTree(t, got)
+			for name, w := range wantTree {
+				if gotTree[name] != w {
+					t.Errorf("%s = %q, want %q", name, gotTree[name], w)
+				}
+			}
+			if len(gotTree) != len(wantTree) {
+				t.Errorf("bundle extracted %d entries, tar %d", len(gotTree), len(wantTree))
+			}
+		})
+	}
+}
+
+func TestConvertToBundleChunks(t *testing.T) {
+	tarball := tarOf(t, map[string]string{"a": strings.Repeat("a", 40), "b": strings.Repeat("b", 40), "c": strings.Repeat("c", 100)})
+	data := convertToBundle(t, tarball, BundleOptions{ChunkSize: 64})
+	dec, err := zstd.NewReader(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dec.Close()
+	index, err := readBundleIndex(data, dec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Files never share a chunk past the chunk size, and an oversized file gets its own.
+	if len(index.Chunks) != 3 {
+		t.Errorf("got %d chunks, want 3", len(index.Chunks))
+	}
+	for _, e := range index.Entries {
+		if c := index.Chunks[e.Chunk]; e.Offset+e.Size > c.RawSize {
+			t.Errorf("%s overflows chunk %d", e.Name, e.Chunk)
+		}
+	}
+}
+
+func TestExtractBundleLimits(t *testing.T) {
+	data := convertToBundle(t, tarOf(t, map[string]string{"a": "0123456789", "b": "0123456789"}), BundleOptions{})
+	tests := []struct {
+		limits ExtractLimits
+		want   string
+	}{
+		{ExtractLimits{MaxEntries: 1}, "more than 1 entries"},
+		{ExtractLimits{MaxFileSize: 5}, "over the 5 byte limit"},
+		{ExtractLimits{MaxTotalSize: 15}, "more than 15 bytes"},
+		{ExtractLimits{MaxEntries: 2, MaxFileSize: 10, MaxTotalSize: 20}, ""},
+	}
+	for _, tt := range tests {
+		err := extractBundle(data, t.TempDir(), tt.limits, nil, nil)
+		if tt.want == "" && err != nil {
+			t.Errorf("%+v: %v", tt.limits, err)
+		}
+		if tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)) {
+			t.Errorf("%+v: err = %v, want %q", tt.limits, err, tt.want)
+		}
+	}
+}
+
+// bundleWithIndex assembles a bundle from raw chunk bytes and an arbitrary index.
+func bundleWithIndex(t *testing.T, chunks []byte, index any) []byte {
+	t.Helper()
+	enc, err := zstd.NewWriter(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer enc.Close()
+	raw, err := json.Marshal(index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compressed := enc.EncodeAll(raw, nil)
+	data := append([]byte(bundleMagic), chunks...)
+	offset := len(data)
+	data = append(data, compressed...)
+	data = binary.LittleEndian.AppendUint64(data, uint64(offset))
+	data = binary.LittleEndian.AppendUint64(data, uint64(len(compressed)))
+	return append(data, bundleMagic...)
+}
+
+func TestReadBundleIndexMalformed(t *testing.T) {
+	enc, err := zstd.NewWriter(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer enc.Close()
+	chunk := enc.EncodeAll([]byte("hello"), nil)
+	good := bundleChunk{Offset: int64(len(bundleMagic)), Size: int64(len(chunk)), RawSize: 5}
+	file := func(e bundleEntry) bundleEntry { e.Name, e.Typeflag, e.Mode = "f", tar.TypeReg, 0o644; return e }
+
+	valid := bundleWithIndex(t, chunk, bundleIndex{Chunks: []bundleChunk{good}, Entries: []bundleEntry{file(bundleEntry{Size: 5})}})
+	corruptChunk := bytes.Clone(valid)
+	corruptChunk[len(bundleMagic)+len(chunk)-1] ^= 0xff
+	badLocation := bytes.Clone(valid)
+	binary.LittleEndian.PutUint64(badLocation[len(valid)-bundleFooterLen:], 8)
+	binary.LittleEndian.PutUint64(badLocation[len(valid)-bundleFooterLen+8:], 1<<64-1)
+
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"valid", valid, ""},
+		{"truncated", []byte(bundleMagic), "invalid bundle footer"},
+		{"no footer magic", valid[:len(valid)-1], "invalid bundle footer"},
+		{"missing index", bundleWithIndexRaw(t, chunk, nil)[:len(bundleMagic)+len(chunk)], "invalid bundle footer"},
+		{"index location overflow", badLocation, "invalid bundle index location"},
+		{"index not zstd", bundleWithIndexRaw(t, chunk, []byte("not zstd")), "decompress bundle index"},
+		{"index not json", bundleWithIndexRaw(t, chunk, enc.EncodeAll([]byte("{"), nil)), "decode bundle index"},
+		{"chunk past index", bundleWithIndex(t, chunk, bundleIndex{Chunks: []bundleChunk{{Offset: 8, Size: 1 << 40}}}), "chunk 0 out of range"},
+		{"chunk overflow", bundleWithIndex(t, chunk, bundleIndex{Chunks: []bundleChunk{{Offset: 8, Size: 1<<63 - 1}}}), "chunk 0 out of range"},
+		{"negative chunk", bundleWithIndex(t, chunk, bundleIndex{Chunks: []bundleChunk{{Offset: -1, Size: 1}}}), "chunk 0 out of range"},
+		{"entry chunk missing", bundleWithIndex(t, chunk, bundleIndex{Chunks: []bundleChunk{good}, Entries: []bundleEntry{file(bundleEntry{Size: 5, Chunk: 1})}}), `entry "f" out of range`},
+		{"entry past chunk", bundleWithIndex(t, chunk, bundleIndex{Chunks: []bundleChunk{good}, Entries: []bundleEntry{file(bundleEntry{Size: 5, Offset: 1})}}), `entry "f" out of range`},
+		{"entry overflow", bundleWithIndex(t, chunk, bundleIndex{Chunks: []bundleChunk{good}, Entries: []bundleEntry{file(bundleEntry{Size: 1<<63 - 1, Offset: 1})}}), `entry "f" out of range`},
+		{"negative entry", bundleWithIndex(t, chunk, bundleIndex{Chunks: []bundleChunk{good}, Entries: []bundleEntry{file(bundleEntry{Size: -1})}}), `entry "f" out of range`},
+		{"corrupt chunk", corruptChunk, "decompress bundle chunk 0"},
+		{"unsafe entry", bundleWithIndex(t, chunk, bundleIndex{Entries: []bundleEntry{{Name: "../x", Typeflag: tar.TypeDir}}}), "invalid path in archive"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ExtractArchive(tt.data, t.TempDir())
+			if tt.want == "" && err != nil {
+				t.Fatal(err)
+			}
+			if tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)) {
+				t.Fatalf("err = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+// bundleWithIndexRaw is bundleWithIndex with the compressed index bytes given as is.
+func bundleWithIndexRaw(t *testing.T, chunks, index []byte) []byte {
+	t.Helper()
+	data := append([]byte(bundleMagic), chunks...)
+	offset := len(data)
+	data = append(data, index...)
+	data = binary.LittleEndian.AppendUint64(data, uint64(offset))
+	data = binary.LittleEndian.AppendUint64(data, uint64(len(index)))
+	return append(data, bundleMagic...)
+}
+
+// benchmarkTarball is a Python-like tree: many small modules and a few large shared objects.
+func benchmarkTarball(b *testing.B) []byte {
+	b.Helper()
+	rng := rand.New(rand.NewSource(1))
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	write := func(name string, size int) {
+		body := make([]byte, size)
+		for i := range body {
+			body[i] = "abcdefgh \n"[rng.Intn(10)] // compressible, like source code
+		}
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(size), Typeflag: tar.TypeReg}); err != nil {
+			b.Fatal(err)
+		}
+		tw.Write(body)
+	}
+	for i := range 2000 {
+		write(fmt.Sprintf("lib/python3/pkg%d/mod%d.py", i/50, i), 1000+rng.Intn(16000))
+	}
+	for i := range 8 {
+		write(fmt.Sprintf("lib/libbig%d.so", i), 4<<20)
+	}
+	if err := tw.Close(); err != nil {
+		b.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func benchmarkExtract(b *testing.B, data []byte) {
+	b.SetBytes(int64(len(data)))
+	for b.Loop() {
+		dest := b.TempDir()
+		if err := ExtractArchive(data, dest); err != nil {
+			b.Fatal(err)
+		}
+		b.StopTimer()
+		os.RemoveAll(dest)
+		b.StartTimer()
+	}
+}
+
+func BenchmarkExtractTarZstd(b *testing.B) {
+	var buf bytes.Buffer
+	w, err := newCompressWriter(&buf, CompressionZstd, 0)
+	if err != nil {
+		b.Fatal(err)
+	}
+	w.Write(benchmarkTarball(b))
+	if err := w.Close(); err != nil {
+		b.Fatal(err)
+	}
+	benchmarkExtract(b, buf.Bytes())
+}
+
+func BenchmarkExtractTarGzip(b *testing.B) {
+	var buf bytes.Buffer
+	w, err := newCompressWriter(&buf, CompressionGzip, 0)
+	if err != nil {
+		b.Fatal(err)
+	}
+	w.Write(benchmarkTarball(b))
+	if err := w.Close(); err != nil {
+		b.Fatal(err)
+	}
+	benchmarkExtract(b, buf.Bytes())
+}
+
+// BenchmarkExtractBundle extracts the embedded linux-x86_64 Python as shipped and as a chunked
+// bundle, converting it first if it is still a tarball.
+func BenchmarkExtractBundle(b *testing.B) {
+	if runtime.GOOS != "linux" || runtime.GOARCH != "amd64" || len(embeddedPython) < 1<<20 {
+		b.Skip("no linux-x86_64 Python embedded; build one into universal-bucket first")
+	}
+	bundle := embeddedPython
+	if !isBundle(bundle) {
+		bundle = convertToBundle(b, embeddedPython, BundleOptions{})
+		b.Run("tarball", func(b *testing.B) { benchmarkExtract(b, embeddedPython) })
+	}
+	b.Run("bundle", func(b *testing.B) { benchmarkExtract(b, bundle) })
+}
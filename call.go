@@ -0,0 +1,135 @@
+package gorunpython
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// callRunner imports and calls a function for Call. It is run as python -c callRunner and reads
+// {"target", "args", "kwargs"} from stdin; the reply, {"result"} or {"error"}, goes to the
+// inherited pipe named by its argument, a descriptor or on Windows a handle, so that whatever
+// the function prints can't get mixed into it.
+const callRunner = `import base64, dataclasses, importlib, json, os, sys, traceback
+if os.name == "nt":
+    import msvcrt
+    reply = os.fdopen(msvcrt.open_osfhandle(int(sys.argv[1]), 0), "w")
+else:
+    reply = os.fdopen(int(sys.argv[1]), "w")
+def default(o):
+    if isinstance(o, (set, frozenset)):
+        return list(o)
+    if isinstance(o, (bytes, bytearray, memoryview)):
+        return base64.b64encode(bytes(o)).decode()
+    if dataclasses.is_dataclass(o) and not isinstance(o, type):
+        return dataclasses.asdict(o)
+    raise TypeError("%s is not JSON serializable" % type(o).__name__)
+try:
+    req = json.load(sys.stdin)
+    sys.path.insert(0, os.getcwd())
+    module, _, attrs = req["target"].partition(":")
+    obj = importlib.import_module(module)
+    for attr in filter(None, attrs.split(".")):
+        obj = getattr(obj, attr)
+    out = json.dumps({"result": obj(*req["args"], **req["kwargs"])}, default=default)
+except BaseException as e:
+    out = json.dumps({"error": {"type": type(e).__name__, "message": str(e), "traceback": traceback.format_exc()}})
+reply.write(out)
+reply.close()`
+
+// PythonError is a Python exception raised by a function called from Go.
+type PythonError struct {
+	Type      string `json:"type"`
+	Message   string `json:"message"`
+	Traceback string `json:"traceback"`
+}
+
+func (e *PythonError) Error() string {
+	if e.Message == "" {
+		return e.Type
+	}
+	return e.Type + ": " + e.Message
+}
+
+// Kwargs passes keyword arguments to Call. It must be the last argument.
+type Kwargs map[string]any
+
+// Call calls the python function target, "module:function" or "module:Class.method", with args
+// and decodes its result into T. Arguments and the result are encoded as JSON; bytes come back
+// as base64 strings, which decode into []byte, and sets as lists. Modules are imported from
+// the instance's site-packages and the working directory. A Python exception is returned as a
+// *PythonError. Each call runs in a fresh interpreter, which ctx can cancel. The function can
+// use registered callbacks.
+func Call[T any](ctx context.Context, p *pythonInstance, target string, args ...any) (T, error) {
+	var result T
+	if !strings.Contains(target, ":") {
+		return result, fmt.Errorf("call %s: target must be module:function", target)
+	}
+	kwargs := Kwargs{}
+	if n := len(args); n > 0 {
+		if kw, ok := args[n-1].(Kwargs); ok {
+			kwargs, args = kw, args[:n-1]
+		}
+	}
+	if args == nil {
+		args = []any{}
+	}
+	req, err := json.Marshal(map[string]any{"target": target, "args": args, "kwargs": kwargs})
+	if err != nil {
+		return result, fmt.Errorf("call %s: encode arguments: %w", target, err)
+	}
+
+	cmd := exec.CommandContext(ctx, p.Python, "-c", callRunner)
+	cmd.Env = pythonEnv()
+	cmd.Stdin = bytes.NewReader(req)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	r, w, err := replyPipe(cmd)
+	if err != nil {
+		return result, fmt.Errorf("call %s: reply pipe: %w", target, err)
+	}
+	defer r.Close()
+	callbacksStarted, stopCallbacks, err := p.registeredCallbacks().attach(cmd)
+	if err != nil {
+		w.Close()
+		return result, fmt.Errorf("call %s: %w", target, err)
+	}
+	defer stopCallbacks()
+	if err := cmd.Start(); err != nil {
+		w.Close()
+		return result, fmt.Errorf("call %s: %w", target, err)
+	}
+	w.Close()
+	callbacksStarted()
+	out, readErr := io.ReadAll(r)
+	waitErr := cmd.Wait()
+	if ctx.Err() != nil {
+		return result, fmt.Errorf("call %s: %w", target, ctx.Err())
+	}
+	if readErr != nil {
+		return result, fmt.Errorf("call %s: %w", target, readErr)
+	}
+
+	var reply struct {
+		Result json.RawMessage `json:"result"`
+		Error  *PythonError    `json:"error"`
+	}
+	if err := json.Unmarshal(out, &reply); err != nil {
+		if waitErr != nil {
+			return result, fmt.Errorf("call %s: python failed: %w", target, waitErr)
+		}
+		return result, fmt.Errorf("call %s: bad reply: %w", target, err)
+	}
+	if reply.Error != nil {
+		return result, reply.Error
+	}
+	if err := json.Unmarshal(reply.Result, &result); err != nil {
+		return result, fmt.Errorf("call %s: decode result into %T: %w", target, result, err)
+	}
+	return result, nil
+}
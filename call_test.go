@@ -0,0 +1,70 @@
+package gorunpython
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCall(t *testing.T) {
+	p := hostPythonInstance(t)
+	t.Chdir(writeTree(t, "src", map[string]string{
+		"funcs.py": `import dataclasses, time
+def add(a, b, scale=1):
+    print("noise on stdout")
+    return (a + b) * scale
+def payload():
+    return {"bytes": b"\x00\x01", "set": {3}, "none": None}
+@dataclasses.dataclass
+class Point:
+    x: int
+    y: int
+    @staticmethod
+    def origin():
+        return Point(0, 0)
+def fail():
+    raise KeyError("missing")
+def slow():
+    time.sleep(30)
+`,
+	}))
+	ctx := context.Background()
+
+	if got, err := Call[int](ctx, p, "funcs:add", 2, 3, Kwargs{"scale": 10}); got != 50 || err != nil {
+		t.Errorf("add = %d, %v", got, err)
+	}
+	payload, err := Call[struct {
+		Bytes []byte
+		Set   []int
+		None  *int
+	}](ctx, p, "funcs:payload")
+	if err != nil || string(payload.Bytes) != "\x00\x01" || !reflect.DeepEqual(payload.Set, []int{3}) || payload.None != nil {
+		t.Errorf("payload = %+v, %v", payload, err)
+	}
+	if got, err := Call[map[string]int](ctx, p, "funcs:Point.origin"); err != nil || !reflect.DeepEqual(got, map[string]int{"x": 0, "y": 0}) {
+		t.Errorf("Point.origin = %v, %v", got, err)
+	}
+
+	var perr *PythonError
+	if _, err := Call[any](ctx, p, "funcs:fail"); !errors.As(err, &perr) || perr.Type != "KeyError" || !strings.Contains(perr.Traceback, "fail") {
+		t.Errorf("fail = %v", err)
+	}
+	if _, err := Call[any](ctx, p, "funcs:nothing"); !errors.As(err, &perr) || perr.Type != "AttributeError" {
+		t.Errorf("missing function = %v", err)
+	}
+	if _, err := Call[int](ctx, p, "funcs:payload"); err == nil || !strings.Contains(err.Error(), "decode result") {
+		t.Errorf("result of the wrong type = %v", err)
+	}
+	if _, err := Call[any](ctx, p, "funcs.add"); err == nil {
+		t.Error("target without a function accepted")
+	}
+
+	short, cancel := context.WithTimeout(ctx, 200*time.Millisecond)
+	defer cancel()
+	if _, err := Call[any](short, p, "funcs:slow"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("slow = %v", err)
+	}
+}
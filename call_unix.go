@@ -0,0 +1,21 @@
+//go:build unix
+
+package gorunpython
+
+import (
+	"os"
+	"os/exec"
+	"strconv"
+)
+
+// replyPipe creates the pipe Call reads its reply from. python inherits the write end as an
+// extra file and gets its descriptor as an argument; the caller closes w once python started.
+func replyPipe(cmd *exec.Cmd) (r, w *os.File, err error) {
+	r, w, err = os.Pipe()
+	if err != nil {
+		return nil, nil, err
+	}
+	cmd.ExtraFiles = append(cmd.ExtraFiles, w)
+	cmd.Args = append(cmd.Args, strconv.Itoa(2+len(cmd.ExtraFiles)))
+	return r, w, nil
+}
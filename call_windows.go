@@ -0,0 +1,30 @@
+package gorunpython
+
+import (
+	"os"
+	"os/exec"
+	"strconv"
+	"syscall"
+)
+
+// replyPipe creates the pipe Call reads its reply from. python inherits the write end's handle,
+// which it gets as an argument; the caller closes w once python started. The handle is marked
+// inheritable, but os/exec passes children an explicit handle list, so only this python gets it.
+func replyPipe(cmd *exec.Cmd) (r, w *os.File, err error) {
+	r, w, err = os.Pipe()
+	if err != nil {
+		return nil, nil, err
+	}
+	h := syscall.Handle(w.Fd())
+	if err := syscall.SetHandleInformation(h, syscall.HANDLE_FLAG_INHERIT, syscall.HANDLE_FLAG_INHERIT); err != nil {
+		r.Close()
+		w.Close()
+		return nil, nil, err
+	}
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.AdditionalInheritedHandles = append(cmd.SysProcAttr.AdditionalInheritedHandles, h)
+	cmd.Args = append(cmd.Args, strconv.FormatUint(uint64(h), 10))
+	return r, w, nil
+}
@@ -0,0 +1,383 @@
+package gorunpython
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+)
+
+// ErrCallbacksUnsupported is returned when callbacks are registered on a platform without Unix
+// sockets.
+var ErrCallbacksUnsupported = errors.New("callbacks are not supported on this platform")
+
+// callbackFDEnvVar tells the gorunpython module which inherited descriptor leads back to Go.
+const callbackFDEnvVar = "GORUNPYTHON_CALLBACK_FD"
+
+// callbackModule is the gorunpython module python scripts import to call back into Go. It is
+// written into the instance's site-packages when the first callback is registered.
+const callbackModule = `"""Calls into the Go program that started this interpreter.
+
+    import gorunpython
+    config = gorunpython.call("config", "db")  # or gorunpython.config("db")
+    for row in gorunpython.call("rows", "SELECT 1"):  # streaming callbacks return an iterator
+        ...
+
+Calls are safe from any thread and may run concurrently. Arguments and results are JSON;
+keyword arguments are passed to Go as one final object.
+"""
+import itertools
+import json
+import os
+import queue
+import socket
+import threading
+
+__all__ = ["call", "CallbackError"]
+
+
+class CallbackError(Exception):
+    """A Go callback returned an error."""
+
+
+_lock = threading.Lock()
+_conn = None
+_pending = {}
+_ids = itertools.count(1)
+
+
+def _connect():
+    global _conn
+    with _lock:
+        if _conn is None:
+            fd = os.environ.get("` + callbackFDEnvVar + `")
+            if fd is None:
+                raise RuntimeError("no Go callbacks: python was not started by a program with callbacks registered")
+            sock = socket.socket(fileno=int(fd))
+            _conn = (sock, threading.Lock())
+            threading.Thread(target=_read, args=(sock.makefile("rb"),), daemon=True).start()
+        return _conn
+
+
+def _read(f):
+    try:
+        for line in f:
+            msg = json.loads(line)
+            q = _pending.get(msg["id"])
+            if q is not None:
+                q.put(msg)
+    finally:
+        for q in list(_pending.values()):
+            q.put({"error": "connection to Go closed"})
+
+
+def _send(msg):
+    sock, lock = _connect()
+    data = (json.dumps(msg) + "\n").encode()
+    with lock:
+        sock.sendall(data)
+
+
+def call(name, /, *args, **kwargs):
+    """Calls the Go callback registered as name and returns its result, or an iterator over
+    its results if it streams them."""
+    if kwargs:
+        args += (kwargs,)
+    _connect()
+    id = next(_ids)
+    q = _pending[id] = queue.Queue()
+    try:
+        _send({"id": id, "name": name, "args": list(args)})
+        msg = q.get()
+    except BaseException:
+        _pending.pop(id, None)
+        raise
+    if msg.get("stream"):
+        return _iterate(id, q)
+    _pending.pop(id, None)
+    if "error" in msg:
+        raise CallbackError(msg["error"])
+    return msg.get("result")
+
+
+def _iterate(id, q):
+    done = False
+    try:
+        while True:
+            msg = q.get()
+            if "error" in msg:
+                done = True
+                raise CallbackError(msg["error"])
+            if msg.get("end"):
+                done = True
+                return
+            yield msg.get("item")
+    finally:
+        _pending.pop(id, None)
+        if not done:
+            try:
+                _send({"id": id, "cancel": True})
+            except OSError:
+                pass
+
+
+def __getattr__(name):
+    if name.startswith("_"):
+        raise AttributeError(name)
+    return lambda *args, **kwargs: call(name, *args, **kwargs)
+`
+
+// callbackRegistry holds the Go functions python may call, by name.
+type callbackRegistry struct {
+	mu    sync.RWMutex
+	funcs map[string]reflect.Value
+}
+
+var (
+	contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// RegisterCallback makes fn callable from python run by PythonExec, PythonExecStream, Run,
+// Call, StartSession and OpenDataChannel, as gorunpython.call(name, ...) or
+// gorunpython.<name>(...). fn is any function whose
+// parameters decode from JSON, optionally preceded by a context.Context that is cancelled
+// when the call is abandoned or the run ends, and which returns a result, an error, or both.
+// A result that is a channel is streamed: python gets an iterator over the values sent on it
+// until it is closed. Callbacks may be called concurrently.
+func (p *pythonInstance) RegisterCallback(name string, fn any) error {
+	v := reflect.ValueOf(fn)
+	if err := checkCallback(v); err != nil {
+		return fmt.Errorf("callback %s: %w", name, err)
+	}
+	p.callbacksMu.Lock()
+	defer p.callbacksMu.Unlock()
+	if p.callbacks == nil {
+		siteDir, err := p.sitePackages()
+		if err != nil {
+			return fmt.Errorf("install gorunpython module: %w", err)
+		}
+		if err := os.WriteFile(filepath.Join(siteDir, "gorunpython.py"), []byte(callbackModule), 0o644); err != nil {
+			return fmt.Errorf("install gorunpython module: %w", err)
+		}
+		p.callbacks = &callbackRegistry{funcs: map[string]reflect.Value{}}
+	}
+	p.callbacks.mu.Lock()
+	p.callbacks.funcs[name] = v
+	p.callbacks.mu.Unlock()
+	return nil
+}
+
+// UnregisterCallback removes the callback registered as name.
+func (p *pythonInstance) UnregisterCallback(name string) {
+	if r := p.registeredCallbacks(); r != nil {
+		r.mu.Lock()
+		delete(r.funcs, name)
+		r.mu.Unlock()
+	}
+}
+
+// registeredCallbacks returns the callbacks to serve to a python about to start, or nil if
+// none were ever registered.
+func (p *pythonInstance) registeredCallbacks() *callbackRegistry {
+	p.callbacksMu.Lock()
+	defer p.callbacksMu.Unlock()
+	return p.callbacks
+}
+
+func checkCallback(v reflect.Value) error {
+	if v.Kind() != reflect.Func || v.IsNil() {
+		return errors.New("not a function")
+	}
+	t := v.Type()
+	switch {
+	case t.NumOut() > 2:
+		return errors.New("returns more than a result and an error")
+	case t.NumOut() == 2 && t.Out(1) != errorType:
+		return errors.New("second result is not an error")
+	}
+	return nil
+}
+
+type callbackRequest struct {
+	ID     int64             `json:"id"`
+	Name   string            `json:"name"`
+	Args   []json.RawMessage `json:"args"`
+	Cancel bool              `json:"cancel"`
+}
+
+type callbackReply struct {
+	ID     int64  `json:"id"`
+	Result any    `json:"result"`
+	Error  string `json:"error,omitempty"`
+	Stream bool   `json:"stream,omitempty"`
+	Item   any    `json:"item"`
+	End    bool   `json:"end,omitempty"`
+}
+
+// serve answers calls arriving on conn until it is closed or ctx ends. Each call runs in its
+// own goroutine.
+func (r *callbackRegistry) serve(ctx context.Context, conn io.ReadWriter) {
+	var writeMu sync.Mutex
+	reply := func(msg callbackReply) {
+		data, err := json.Marshal(msg)
+		if err != nil {
+			data, _ = json.Marshal(callbackReply{ID: msg.ID, Error: "encode result: " + err.Error()})
+		}
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		if _, err := conn.Write(append(data, '\n')); err != nil && noisy != "" {
+			fmt.Println("Failed to answer python callback: ", err)
+		}
+	}
+
+	var mu sync.Mutex
+	inFlight := map[int64]context.CancelFunc{}
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	dec := json.NewDecoder(conn)
+	for {
+		var req callbackRequest
+		if err := dec.Decode(&req); err != nil {
+			return
+		}
+		if req.Cancel {
+			mu.Lock()
+			if cancel, ok := inFlight[req.ID]; ok {
+				cancel()
+			}
+			mu.Unlock()
+			continue
+		}
+		callCtx, cancel := context.WithCancel(ctx)
+		mu.Lock()
+		inFlight[req.ID] = cancel
+		mu.Unlock()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() {
+				mu.Lock()
+				delete(inFlight, req.ID)
+				mu.Unlock()
+				cancel()
+			}()
+			r.call(callCtx, req, reply)
+		}()
+	}
+}
+
+// call runs one callback and sends its reply, or its stream of replies.
+func (r *callbackRegistry) call(ctx context.Context, req callbackRequest, reply func(callbackReply)) {
+	fail := func(err error) { reply(callbackReply{ID: req.ID, Error: err.Error()}) }
+	defer func() {
+		if e := recover(); e != nil {
+			fail(fmt.Errorf("callback %s panicked: %v", req.Name, e))
+		}
+	}()
+
+	r.mu.RLock()
+	fn, ok := r.funcs[req.Name]
+	r.mu.RUnlock()
+	if !ok {
+		fail(fmt.Errorf("no callback named %q", req.Name))
+		return
+	}
+	in, err := callbackArgs(ctx, fn.Type(), req.Args)
+	if err != nil {
+		fail(fmt.Errorf("callback %s: %w", req.Name, err))
+		return
+	}
+	var out []reflect.Value
+	if fn.Type().IsVariadic() {
+		out = fn.CallSlice(in)
+	} else {
+		out = fn.Call(in)
+	}
+
+	var result reflect.Value
+	for _, v := range out {
+		if v.Type() == errorType {
+			if !v.IsNil() {
+				fail(v.Interface().(error))
+				return
+			}
+		} else {
+			result = v
+		}
+	}
+	if !result.IsValid() {
+		reply(callbackReply{ID: req.ID})
+		return
+	}
+	if result.Kind() != reflect.Chan || result.Type().ChanDir()&reflect.RecvDir == 0 {
+		reply(callbackReply{ID: req.ID, Result: result.Interface()})
+		return
+	}
+
+	reply(callbackReply{ID: req.ID, Stream: true})
+	cases := []reflect.SelectCase{
+		{Dir: reflect.SelectRecv, Chan: result},
+		{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ctx.Done())},
+	}
+	for {
+		chosen, item, ok := reflect.Select(cases)
+		if chosen == 1 {
+			return // python stopped iterating or the run ended
+		}
+		if !ok {
+			reply(callbackReply{ID: req.ID, End: true})
+			return
+		}
+		reply(callbackReply{ID: req.ID, Item: item.Interface()})
+	}
+}
+
+// callbackArgs decodes the JSON arguments of a call into fn's parameter types.
+func callbackArgs(ctx context.Context, t reflect.Type, args []json.RawMessage) ([]reflect.Value, error) {
+	var in []reflect.Value
+	params := make([]reflect.Type, 0, t.NumIn())
+	for i := 0; i < t.NumIn(); i++ {
+		if i == 0 && t.In(0) == contextType {
+			in = append(in, reflect.ValueOf(ctx))
+			continue
+		}
+		params = append(params, t.In(i))
+	}
+
+	fixed := len(params)
+	var variadic reflect.Value
+	if t.IsVariadic() {
+		fixed--
+		if len(args) < fixed {
+			return nil, fmt.Errorf("takes at least %d arguments, got %d", fixed, len(args))
+		}
+		variadic = reflect.MakeSlice(params[fixed], 0, len(args)-fixed)
+	} else if len(args) != fixed {
+		return nil, fmt.Errorf("takes %d arguments, got %d", fixed, len(args))
+	}
+	for i, raw := range args {
+		pt := params[min(i, len(params)-1)]
+		if i >= fixed {
+			pt = pt.Elem()
+		}
+		v := reflect.New(pt)
+		if err := json.Unmarshal(raw, v.Interface()); err != nil {
+			return nil, fmt.Errorf("argument %d: %w", i+1, err)
+		}
+		if i >= fixed {
+			variadic = reflect.Append(variadic, v.Elem())
+		} else {
+			in = append(in, v.Elem())
+		}
+	}
+	if t.IsVariadic() {
+		in = append(in, variadic)
+	}
+	return in, nil
+}
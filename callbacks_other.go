@@ -0,0 +1,12 @@
+//go:build !unix
+
+package gorunpython
+
+import "os/exec"
+
+func (r *callbackRegistry) attach(cmd *exec.Cmd) (started, stop func(), err error) {
+	if r == nil {
+		return func() {}, func() {}, nil
+	}
+	return nil, nil, ErrCallbacksUnsupported
+}
@@ -0,0 +1,39 @@
+//go:build unix
+
+package gorunpython
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strconv"
+)
+
+// attach serves the registered callbacks to the python cmd is about to start, over a socket it
+// inherits. Call started once cmd has started, which closes this process's copy of python's
+// end so that serving ends when python does, and stop once python has exited.
+func (r *callbackRegistry) attach(cmd *exec.Cmd) (started, stop func(), err error) {
+	if r == nil {
+		return func() {}, func() {}, nil
+	}
+	conn, remote, err := unixSocketPair()
+	if err != nil {
+		return nil, nil, fmt.Errorf("callback socket: %w", err)
+	}
+	fd := 3 + len(cmd.ExtraFiles)
+	cmd.ExtraFiles = append(cmd.ExtraFiles, remote)
+	cmd.Env = append(cmd.Env, callbackFDEnvVar+"="+strconv.Itoa(fd))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		r.serve(ctx, conn)
+		close(done)
+	}()
+	return func() { remote.Close() }, func() {
+		remote.Close()
+		cancel()
+		conn.Close()
+		<-done
+	}, nil
+}
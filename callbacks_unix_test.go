@@ -0,0 +1,135 @@
+//go:build unix
+
+package gorunpython
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// withCallbacks registers fns on p, concurrently, as a program registering them from several
+// goroutines would. p's site-packages is a temporary directory, which becomes the working
+// directory so that python imports the gorunpython module written there.
+func withCallbacks(t *testing.T, p *pythonInstance, files map[string]string, fns map[string]any) string {
+	t.Helper()
+	dir := writeTree(t, "site-packages", files)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	p.layout = &pythonLayout{Stdlib: filepath.Dir(dir)}
+	t.Chdir(dir)
+	errs := make(chan error, len(fns))
+	for name, fn := range fns {
+		go func() { errs <- p.RegisterCallback(name, fn) }()
+	}
+	for range fns {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "gorunpython.py")); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestCallWithCallbacks(t *testing.T) {
+	p := hostPythonInstance(t)
+	withCallbacks(t, p, map[string]string{
+		"usecb.py": `import gorunpython
+def total(n):
+    return gorunpython.scale(n) + sum(gorunpython.call("count", 3))
+def fail():
+    try:
+        gorunpython.broken()
+    except gorunpython.CallbackError as e:
+        return str(e)
+`,
+	}, map[string]any{
+		"scale": func(n int) int { return n * 100 },
+		"count": func(ctx context.Context, n int) <-chan int {
+			ch := make(chan int)
+			go func() {
+				defer close(ch)
+				for i := 1; i <= n; i++ {
+					select {
+					case ch <- i:
+					case <-ctx.Done():
+						return
+					}
+				}
+			}()
+			return ch
+		},
+		"broken": func() error { return errors.New("broken on purpose") },
+	})
+
+	if got, err := Call[int](context.Background(), p, "usecb:total", 2); got != 206 || err != nil {
+		t.Errorf("total = %d, %v", got, err)
+	}
+	if got, err := Call[string](context.Background(), p, "usecb:fail"); got != "broken on purpose" || err != nil {
+		t.Errorf("fail = %q, %v", got, err)
+	}
+}
+
+func TestSessionWithCallbacks(t *testing.T) {
+	p := hostPythonInstance(t)
+	dir := withCallbacks(t, p, nil, map[string]any{"greet": func(name string) string { return "hello " + name }})
+	s, err := p.StartSession(SessionDir(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Kill()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if out, err := s.Eval(ctx, "import sys; sys.path.insert(0, '.'); import gorunpython; print(gorunpython.greet('go'))"); out != "hello go\n" || err != nil {
+		t.Errorf("Eval = %q, %v", out, err)
+	}
+	if err := s.Close(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDataChannelWithCallbacks(t *testing.T) {
+	p := hostPythonInstance(t)
+	dir := withCallbacks(t, p, map[string]string{
+		"scaled.py": "import gorunpython\ndef scale(t):\n    f = gorunpython.factor()\n    return {k: [v * f for v in c] for k, c in t.items()}\n",
+	}, map[string]any{"factor": func() int { return 3 }})
+	c, err := p.OpenDataChannel(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	out, err := c.CallTable("scaled:scale", &Table{Columns: []Column{{"n", []int64{1, 2}}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := out.Column("n"); !reflect.DeepEqual(got, []int64{3, 6}) {
+		t.Errorf("n = %v", got)
+	}
+}
+
+func TestAttachClosesChildEnd(t *testing.T) {
+	r := &callbackRegistry{funcs: map[string]reflect.Value{}}
+	cmd := exec.Command("true")
+	started, stop, err := r.attach(cmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stop()
+	remote := cmd.ExtraFiles[len(cmd.ExtraFiles)-1]
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	started()
+	if remote.Fd() != ^uintptr(0) {
+		t.Error("python's end of the callback socket is still open here after it started")
+	}
+	cmd.Wait()
+}
@@ -0,0 +1,222 @@
+// Command gorunpython-bundle prepares Python trees for embedding: it writes bundle and relocation
+// manifests, converts tarballs into chunked bundles and measures how fast each format extracts.
+//
+// Usage:
+//
+//	gorunpython-bundle convert [-chunk bytes] [-level N] -o out.bundle in.tar.gz
+//	gorunpython-bundle bench [-n runs] in.tar.gz
+//	gorunpython-bundle relocations -prefix /build/prefix -root python dir
+//	gorunpython-bundle manifest [-build-prefix /build/prefix] [-tool path]... [-check] dir
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	gorunpython "github.com/ZacTyAdams/go-run-python/v2"
+)
+
+const usage = `usage: gorunpython-bundle <command> [flags] <path>
+
+commands:
+  convert      write a chunked bundle for parallel extraction
+  bench        compare extraction time of a tarball and its chunked bundle
+  relocations  write the relocation manifest for an unpacked Python tree
+  manifest     write or check the bundle manifest of an unpacked Python tree
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	cmd, args := os.Args[1], os.Args[2:]
+	var err error
+	switch cmd {
+	case "convert":
+		err = runConvert(args)
+	case "bench":
+		err = runBench(args)
+	case "relocations":
+		err = runRelocations(args)
+	case "manifest":
+		err = runManifest(args)
+	case "help", "-h", "-help", "--help":
+		fmt.Fprint(os.Stdout, usage)
+		return
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", cmd, usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "gorunpython-bundle %s: %v\n", cmd, err)
+		os.Exit(1)
+	}
+}
+
+func runConvert(args []string) error {
+	fs := flag.NewFlagSet("convert", flag.ExitOnError)
+	out := fs.String("o", "", "output path (required)")
+	chunk := fs.Int("chunk", 0, "target uncompressed chunk size in bytes (default 4 MiB)")
+	level := fs.Int("level", 0, "zstd compression level (0 uses the codec default)")
+	fs.Parse(args)
+	if fs.NArg() != 1 || *out == "" {
+		return errors.New("expected -o <out> <tarball>")
+	}
+
+	in, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	tmp := *out + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+	if err := gorunpython.ConvertToBundle(f, in, gorunpython.BundleOptions{ChunkSize: *chunk, Level: *level}); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, *out)
+}
+
+func runBench(args []string) error {
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	runs := fs.Int("n", 3, "number of extractions per format")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return errors.New("expected <tarball>")
+	}
+
+	tarball, err := os.ReadFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	var bundle bytes.Buffer
+	if err := gorunpython.ConvertToBundle(&bundle, bytes.NewReader(tarball), gorunpython.BundleOptions{}); err != nil {
+		return err
+	}
+
+	fmt.Printf("%s: tarball %d bytes, bundle %d bytes, GOMAXPROCS=%d\n",
+		fs.Arg(0), len(tarball), bundle.Len(), runtime.GOMAXPROCS(0))
+	tarTime, err := benchExtract("tarball", tarball, *runs)
+	if err != nil {
+		return err
+	}
+	bundleTime, err := benchExtract("bundle", bundle.Bytes(), *runs)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("speedup: %.2fx\n", float64(tarTime)/float64(bundleTime))
+	return nil
+}
+
+func runRelocations(args []string) error {
+	fs := flag.NewFlagSet("relocations", flag.ExitOnError)
+	prefix := fs.String("prefix", "", "absolute install prefix the tree was built with (required)")
+	root := fs.String("root", "python", "directory inside the tree that the prefix was installed to")
+	fs.Parse(args)
+	if fs.NArg() != 1 || *prefix == "" {
+		return errors.New("expected -prefix <prefix> <dir>")
+	}
+
+	m, err := gorunpython.GenerateRelocationManifest(fs.Arg(0), *prefix, *root)
+	if err != nil {
+		return err
+	}
+	for _, f := range m.Files {
+		fmt.Printf("%-8s %s\n", f.Kind, f.Path)
+	}
+	return gorunpython.WriteRelocationManifest(fs.Arg(0), m)
+}
+
+func runManifest(args []string) error {
+	fs := flag.NewFlagSet("manifest", flag.ExitOnError)
+	buildPrefix := fs.String("build-prefix", "", "install prefix the tree was built with (default from the relocation manifest)")
+	check := fs.Bool("check", false, "verify the existing manifest's sha256 against the tree instead of writing one")
+	var tools stringList
+	fs.Var(&tools, "tool", "bundled tool, relative to the tree root (repeatable)")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return errors.New("expected <dir>")
+	}
+	dir := fs.Arg(0)
+
+	if *check {
+		data, err := os.ReadFile(filepath.Join(dir, gorunpython.BundleManifestName))
+		if err != nil {
+			return err
+		}
+		var m gorunpython.BundleManifest
+		if err := json.Unmarshal(data, &m); err != nil {
+			return err
+		}
+		sum, err := gorunpython.BundleTreeDigest(dir)
+		if err != nil {
+			return err
+		}
+		if sum != m.SHA256 {
+			return fmt.Errorf("tree digest %s does not match manifest %s", sum, m.SHA256)
+		}
+		fmt.Printf("%s: ok (Python %s, %s)\n", dir, m.Version, m.Platform)
+		return nil
+	}
+
+	m, err := gorunpython.GenerateBundleManifest(dir, *buildPrefix, tools)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Python %s %s for %s (libc %s, loader %q)\n", m.Implementation, m.Version, m.Platform, m.Libc, m.Loader)
+	return gorunpython.WriteBundleManifest(dir, m)
+}
+
+// stringList is a repeatable string flag.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// benchExtract extracts data into fresh temp directories and returns the best time of runs.
+func benchExtract(label string, data []byte, runs int) (time.Duration, error) {
+	var best time.Duration
+	for i := 0; i < runs; i++ {
+		dir, err := os.MkdirTemp("", "gorunpython-bench-")
+		if err != nil {
+			return 0, err
+		}
+		start := time.Now()
+		err = gorunpython.ExtractArchive(data, dir)
+		elapsed := time.Since(start)
+		_ = os.RemoveAll(dir)
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", label, err)
+		}
+		if best == 0 || elapsed < best {
+			best = elapsed
+		}
+		fmt.Printf("%-8s run %d: %v\n", label, i+1, elapsed.Round(time.Millisecond))
+	}
+	fmt.Printf("%-8s best:  %v\n", label, best.Round(time.Millisecond))
+	return best, nil
+}
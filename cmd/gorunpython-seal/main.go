@@ -0,0 +1,240 @@
+// Command gorunpython-seal creates and inspects binaries carrying a sealed directory payload.
+//
+// Usage:
+//
+//	gorunpython-seal seal [-compression gzip|zstd|zstd-seekable|none] [-level N] [-exclude pat]... [-include pat]... [-deterministic] [-n] <binary> <dir>
+//	gorunpython-seal unseal [-C dest] <binary>
+//	gorunpython-seal list [-l] <binary>
+//	gorunpython-seal verify <binary>
+//	gorunpython-seal strip [-o out] <binary>
+//	gorunpython-seal cat <binary> <path>
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	gorunpython "github.com/ZacTyAdams/go-run-python/v2"
+)
+
+const usage = `usage: gorunpython-seal <command> [flags] <binary> [args]
+
+commands:
+  seal    append a directory to a binary as a sealed payload
+  unseal  extract the sealed payload of a binary
+  list    list the entries of the sealed payload
+  verify  check that the sealed payload is intact and safe to extract
+  strip   remove the sealed payload from a binary
+  cat     print one file from the sealed payload
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	cmd, args := os.Args[1], os.Args[2:]
+	var err error
+	switch cmd {
+	case "seal":
+		err = runSeal(args)
+	case "unseal":
+		err = runUnseal(args)
+	case "list", "ls":
+		err = runList(args)
+	case "verify":
+		err = runVerify(args)
+	case "strip":
+		err = runStrip(args)
+	case "cat":
+		err = runCat(args)
+	case "help", "-h", "-help", "--help":
+		fmt.Fprint(os.Stdout, usage)
+		return
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", cmd, usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "gorunpython-seal %s: %v\n", cmd, err)
+		os.Exit(1)
+	}
+}
+
+func runSeal(args []string) error {
+	fs := flag.NewFlagSet("seal", flag.ExitOnError)
+	compression := fs.String("compression", "gzip", "payload compression: gzip, zstd, zstd-seekable or none")
+	level := fs.Int("level", 0, "compression level (0 uses the codec default)")
+	var excludes, includes stringList
+	fs.Var(&excludes, "exclude", "gitignore-style pattern to leave out (repeatable)")
+	fs.Var(&includes, "include", "gitignore-style pattern to restrict the payload to (repeatable)")
+	defaultExcludes := fs.Bool("default-excludes", false, "also exclude VCS metadata, __pycache__, *.pyc and editor files")
+	noIgnoreFile := fs.Bool("no-ignore-file", false, "do not read "+gorunpython.SealIgnoreFile+" from the directory root")
+	deterministic := fs.Bool("deterministic", false, "reproducible output: sorted entries, zeroed ownership, fixed mtime from SOURCE_DATE_EPOCH")
+	dryRun := fs.Bool("n", false, "dry run: list what would be sealed with sizes and exit")
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		return errors.New("expected <binary> <dir>")
+	}
+
+	c, err := gorunpython.ParseCompression(*compression)
+	if err != nil {
+		return err
+	}
+	opts := gorunpython.SealOptions{
+		Compression:   c,
+		Level:         *level,
+		Exclude:       excludes,
+		Include:       includes,
+		NoIgnoreFile:  *noIgnoreFile,
+		Deterministic: *deterministic,
+	}
+	if *defaultExcludes {
+		opts.Exclude = append(append([]string(nil), gorunpython.DefaultSealExcludes...), opts.Exclude...)
+	}
+
+	if *dryRun {
+		entries, err := gorunpython.PreviewSeal(fs.Arg(1), opts)
+		if err != nil {
+			return err
+		}
+		var total int64
+		var files int
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		for _, e := range entries {
+			if !e.IsDir() {
+				total += e.Size
+				files++
+			}
+			fmt.Fprintf(tw, "%d\t%s\n", e.Size, e.Name)
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+		fmt.Printf("%d files, %d bytes before compression\n", files, total)
+		return nil
+	}
+
+	sealedPath, err := gorunpython.SealDirectoryIntoBinaryWithOptions(fs.Arg(0), fs.Arg(1), opts)
+	if err != nil {
+		return err
+	}
+	fmt.Println(sealedPath)
+	return nil
+}
+
+func runUnseal(args []string) error {
+	fs := flag.NewFlagSet("unseal", flag.ExitOnError)
+	dest := fs.String("C", "", "destination directory (default: the binary's directory)")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return errors.New("expected <binary>")
+	}
+
+	binaryPath := fs.Arg(0)
+	destDir := *dest
+	if destDir == "" {
+		destDir = filepath.Dir(binaryPath)
+	}
+	extracted, err := gorunpython.UnsealBinaryInto(binaryPath, destDir)
+	if err != nil {
+		return err
+	}
+	if !extracted {
+		return gorunpython.ErrNotSealed
+	}
+	fmt.Println("Extracted into", destDir)
+	return nil
+}
+
+func runList(args []string) error {
+	fs := flag.NewFlagSet("list", flag.ExitOnError)
+	long := fs.Bool("l", false, "show mode, size and modification time")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return errors.New("expected <binary>")
+	}
+
+	entries, err := gorunpython.ListSealedEntries(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if !*long {
+		for _, e := range entries {
+			fmt.Println(e.Name)
+		}
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for _, e := range entries {
+		mode := e.Mode
+		if e.IsDir() {
+			mode |= os.ModeDir
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\n", mode, e.Size, e.ModTime.UTC().Format("2006-01-02 15:04"), e.Name)
+	}
+	return tw.Flush()
+}
+
+func runVerify(args []string) error {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return errors.New("expected <binary>")
+	}
+
+	binaryPath := fs.Arg(0)
+	payload, err := gorunpython.InspectSealedBinary(binaryPath)
+	if err != nil {
+		return err
+	}
+	if err := gorunpython.VerifySealedBinary(binaryPath); err != nil {
+		return err
+	}
+	fmt.Printf("OK: %d byte %s payload at offset %d\n", payload.Size, payload.Compression, payload.Offset)
+	return nil
+}
+
+func runStrip(args []string) error {
+	fs := flag.NewFlagSet("strip", flag.ExitOnError)
+	out := fs.String("o", "", "output path (default: strip in place)")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return errors.New("expected <binary>")
+	}
+
+	binaryPath := fs.Arg(0)
+	outPath := *out
+	if outPath == "" {
+		outPath = binaryPath
+	}
+	return gorunpython.StripSealedBinary(binaryPath, outPath)
+}
+
+func runCat(args []string) error {
+	fs := flag.NewFlagSet("cat", flag.ExitOnError)
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		return errors.New("expected <binary> <path>")
+	}
+	return gorunpython.CopySealedFile(os.Stdout, fs.Arg(0), fs.Arg(1))
+}
+
+// stringList is a repeatable string flag.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
@@ -124,13 +124,24 @@ cp /lib64/libcrypto.so.3 python/lib/
 cp /lib64/libz.so.1 python/lib/
 cp "$REPO_ROOT/python-launcher/python-launcher-linux-amd64" python/bin/python-launcher
 chmod +x python/bin/python-launcher
-cp "$REPO_ROOT/patchelf" python/bin/patchelf
-chmod +x python/bin/patchelf
 
 # Create tarball
 echo "Creating tarball..."
 mkdir -p "$REPO_ROOT/universal-bucket"
-GZIP=-9 tar -czf "$REPO_ROOT/universal-bucket/linux-x86_64.tar.gz" python
+# Describe the bundle; the manifest goes first so it can be read without unpacking
+if command -v go >/dev/null 2>&1; then
+  (cd "$REPO_ROOT" && go run ./cmd/gorunpython-bundle manifest -tool python/bin/python-launcher "$STAGE_DIR")
+else
+  echo "go not found; bundle will have no $STAGE_DIR/.gorunpython-bundle.json"
+fi
+GZIP=-9 tar -czf "$REPO_ROOT/universal-bucket/linux-x86_64.tar.gz" $(ls -A .gorunpython-bundle.json 2>/dev/null) python
+# Ship it as a chunked bundle, which extracts in parallel; the embed file name stays the same
+if command -v go >/dev/null 2>&1; then
+  (cd "$REPO_ROOT" && go run ./cmd/gorunpython-bundle convert -o universal-bucket/linux-x86_64.tar.gz.bundle universal-bucket/linux-x86_64.tar.gz &&
+    mv universal-bucket/linux-x86_64.tar.gz.bundle universal-bucket/linux-x86_64.tar.gz)
+else
+  echo "go not found; leaving universal-bucket/linux-x86_64.tar.gz as a plain tarball"
+fi
 
 echo "✓ Build complete!"
 echo "✓ Output: $REPO_ROOT/universal-bucket/linux-x86_64.tar.gz"
@@ -0,0 +1,177 @@
+package gorunpython
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression selects how a tar payload is compressed.
+type Compression uint8
+
+const (
+	// CompressionGzip is the original payload format and remains the default.
+	CompressionGzip Compression = iota
+	// CompressionZstd decompresses several times faster than gzip for large Python trees.
+	CompressionZstd
+	// CompressionNone stores the tar stream as-is, useful when the content is already compressed.
+	CompressionNone
+	// CompressionZstdSeekable writes independent zstd frames plus a seek table, so files can be
+	// read in place (see OpenSealedFS) while plain zstd decoders still read it as one stream.
+	CompressionZstdSeekable
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+func (c Compression) String() string {
+	switch c {
+	case CompressionGzip:
+		return "gzip"
+	case CompressionZstd:
+		return "zstd"
+	case CompressionNone:
+		return "none"
+	case CompressionZstdSeekable:
+		return "zstd-seekable"
+	default:
+		return fmt.Sprintf("Compression(%d)", uint8(c))
+	}
+}
+
+// ParseCompression converts a name such as "gzip", "zstd" or "none" into a Compression.
+func ParseCompression(name string) (Compression, error) {
+	switch name {
+	case "gzip", "gz":
+		return CompressionGzip, nil
+	case "zstd", "zst":
+		return CompressionZstd, nil
+	case "none", "tar":
+		return CompressionNone, nil
+	case "zstd-seekable", "seekable":
+		return CompressionZstdSeekable, nil
+	}
+	return 0, fmt.Errorf("unknown compression %q (want gzip, zstd, zstd-seekable or none)", name)
+}
+
+// Seekable reports whether payloads in this format can be read in place without
+// decompressing everything before the requested file.
+func (c Compression) Seekable() bool {
+	return c == CompressionNone || c == CompressionZstdSeekable
+}
+
+func (c Compression) valid() bool {
+	return c <= CompressionZstdSeekable
+}
+
+// newCompressWriter wraps w with the requested compression. A level of 0 selects the codec default.
+func newCompressWriter(w io.Writer, c Compression, level int) (io.WriteCloser, error) {
+	switch c {
+	case CompressionGzip:
+		if level == 0 {
+			level = gzip.DefaultCompression
+		}
+		gzw, err := gzip.NewWriterLevel(w, level)
+		if err != nil {
+			return nil, fmt.Errorf("create gzip writer: %w", err)
+		}
+		return gzw, nil
+	case CompressionZstd, CompressionZstdSeekable:
+		encLevel := zstd.SpeedDefault
+		if level != 0 {
+			encLevel = zstd.EncoderLevelFromZstd(level)
+		}
+		if c == CompressionZstdSeekable {
+			return newSeekableZstdWriter(w, encLevel)
+		}
+		zw, err := zstd.NewWriter(w, zstd.WithEncoderLevel(encLevel))
+		if err != nil {
+			return nil, fmt.Errorf("create zstd writer: %w", err)
+		}
+		return zw, nil
+	case CompressionNone:
+		return nopWriteCloser{w}, nil
+	}
+	return nil, fmt.Errorf("unsupported compression: %s", c)
+}
+
+// newDecompressReader detects the compression of r from its leading magic bytes and returns a
+// reader over the decompressed tar stream.
+func newDecompressReader(r io.Reader) (io.ReadCloser, Compression, error) {
+	br := bufio.NewReader(r)
+	head, err := br.Peek(tarBlockSize)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return nil, 0, fmt.Errorf("read compression header: %w", err)
+	}
+	c, err := detectCompression(head)
+	if err != nil {
+		return nil, 0, err
+	}
+	rc, err := newDecompressReaderFor(br, c)
+	if err != nil {
+		return nil, 0, err
+	}
+	return rc, c, nil
+}
+
+func newDecompressReaderFor(r io.Reader, c Compression) (io.ReadCloser, error) {
+	switch c {
+	case CompressionGzip:
+		gzr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create gzip reader: %w", err)
+		}
+		return gzr, nil
+	case CompressionZstd, CompressionZstdSeekable:
+		zr, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create zstd reader: %w", err)
+		}
+		return zr.IOReadCloser(), nil
+	case CompressionNone:
+		return io.NopCloser(r), nil
+	}
+	return nil, fmt.Errorf("unsupported compression: %s", c)
+}
+
+const tarBlockSize = 512
+
+// detectCompression identifies a payload from its first tar block. Anything that is neither
+// gzip, zstd nor an uncompressed tar stream is an error rather than a later, confusing tar
+// failure.
+func detectCompression(head []byte) (Compression, error) {
+	switch {
+	case bytes.HasPrefix(head, zstdMagic):
+		return CompressionZstd, nil
+	case bytes.HasPrefix(head, gzipMagic):
+		return CompressionGzip, nil
+	case isTarBlock(head):
+		return CompressionNone, nil
+	}
+	n := min(len(head), len(zstdMagic))
+	return 0, fmt.Errorf("unknown compression (payload starts with % x)", head[:n])
+}
+
+// isTarBlock reports whether head is a ustar header or the zero block that ends an archive.
+func isTarBlock(head []byte) bool {
+	if len(head) < tarBlockSize {
+		return false
+	}
+	magic := head[257:263]
+	if bytes.Equal(magic, []byte("ustar\x00")) || bytes.Equal(magic, []byte("ustar ")) {
+		return true
+	}
+	return bytes.Count(head[:tarBlockSize], []byte{0}) == tarBlockSize
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
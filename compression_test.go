@@ -0,0 +1,96 @@
+package gorunpython
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func tarOf(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for name, body := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(body)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestCompressionRoundTrip(t *testing.T) {
+	payload := tarOf(t, map[string]string{"a.txt": "hello"})
+	for _, c := range []Compression{CompressionGzip, CompressionZstd, CompressionNone, CompressionZstdSeekable} {
+		t.Run(c.String(), func(t *testing.T) {
+			var buf bytes.Buffer
+			w, err := newCompressWriter(&buf, c, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			w.Write(payload)
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+			r, got, err := newDecompressReader(&buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.Close()
+			want := c
+			if c == CompressionZstdSeekable {
+				want = CompressionZstd
+			}
+			if got != want {
+				t.Errorf("detected %s, want %s", got, want)
+			}
+			out, err := io.ReadAll(r)
+			if err != nil || !bytes.Equal(out, payload) {
+				t.Errorf("round trip = %d bytes, %v; want %d bytes", len(out), err, len(payload))
+			}
+		})
+	}
+}
+
+func TestDetectCompression(t *testing.T) {
+	tests := []struct {
+		name    string
+		head    []byte
+		want    Compression
+		wantErr bool
+	}{
+		{"gzip", []byte{0x1f, 0x8b, 8, 0}, CompressionGzip, false},
+		{"zstd", []byte{0x28, 0xb5, 0x2f, 0xfd, 0}, CompressionZstd, false},
+		{"ustar", tarOf(t, map[string]string{"x": "y"}), CompressionNone, false},
+		{"empty archive", tarOf(t, nil), CompressionNone, false},
+		{"garbage", []byte(strings.Repeat("garbage!", 100)), 0, true},
+		{"short", []byte("PK\x03\x04"), 0, true},
+		{"nothing", nil, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := detectCompression(tt.head)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("detectCompression = %s, %v; want %s, error %v", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseCompression(t *testing.T) {
+	for _, c := range []Compression{CompressionGzip, CompressionZstd, CompressionNone, CompressionZstdSeekable} {
+		if got, err := ParseCompression(c.String()); err != nil || got != c {
+			t.Errorf("ParseCompression(%q) = %s, %v", c.String(), got, err)
+		}
+	}
+	if _, err := ParseCompression("lz4"); err == nil {
+		t.Error("ParseCompression(lz4) succeeded")
+	}
+}
@@ -0,0 +1,62 @@
+package gorunpython
+
+import (
+	_ "embed"
+	"fmt"
+	"net"
+	"os/exec"
+	"reflect"
+	"sync"
+)
+
+// dataWorkerSource is the python side of a DataChannel, including the Arrow reader and writer
+// it falls back to when pyarrow isn't installed.
+//
+//go:embed data_worker.py
+var dataWorkerSource string
+
+// A DataChannel is a long-running python worker that exchanges tables with Go through shared
+// memory. Only the segment's descriptor crosses the process boundary; python maps the same
+// pages and reads the Arrow buffers in place. Calls are serialized.
+type DataChannel struct {
+	cmd           *exec.Cmd
+	conn          *net.UnixConn
+	mu            sync.Mutex
+	stopCallbacks func()
+}
+
+// dataReply is the worker's answer to a call.
+type dataReply struct {
+	Size  int          `json:"size"`
+	Error *PythonError `json:"error"`
+}
+
+// CallTable writes in to a new shared segment, calls target with it and returns the table the
+// function returned, or nil if it returned None. The result is copied out of shared memory;
+// use Call and ReadTable to read it in place.
+func (c *DataChannel) CallTable(target string, in *Table) (*Table, error) {
+	seg, err := NewSharedSegment(0)
+	if err != nil {
+		return nil, err
+	}
+	defer seg.Close()
+	if in != nil {
+		if _, err := in.WriteTo(seg); err != nil {
+			return nil, fmt.Errorf("encode table: %w", err)
+		}
+	}
+	out, err := c.Call(target, seg)
+	if err != nil || out == nil {
+		return nil, err
+	}
+	defer out.Close()
+	t, err := ReadTable(out.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("%s: decode result: %w", target, err)
+	}
+	for i, col := range t.Columns {
+		v := reflect.ValueOf(col.Values)
+		t.Columns[i].Values = reflect.AppendSlice(reflect.MakeSlice(v.Type(), 0, v.Len()), v).Interface()
+	}
+	return t, nil
+}
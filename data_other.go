@@ -0,0 +1,16 @@
+//go:build !unix
+
+package gorunpython
+
+// OpenDataChannel is only supported on Unix.
+func (p *pythonInstance) OpenDataChannel(importPaths ...string) (*DataChannel, error) {
+	return nil, ErrDataChannelUnsupported
+}
+
+// Call is only supported on Unix.
+func (c *DataChannel) Call(target string, in *SharedSegment) (*SharedSegment, error) {
+	return nil, ErrDataChannelUnsupported
+}
+
+// Close is only supported on Unix.
+func (c *DataChannel) Close() error { return ErrDataChannelUnsupported }
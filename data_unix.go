@@ -0,0 +1,194 @@
+//go:build unix
+
+package gorunpython
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// OpenDataChannel starts a data channel worker. Functions are imported from the instance's
+// site-packages and from importPaths, which are added to the front of sys.path.
+func (p *pythonInstance) OpenDataChannel(importPaths ...string) (*DataChannel, error) {
+	conn, remote, err := unixSocketPair()
+	if err != nil {
+		return nil, fmt.Errorf("data channel socket: %w", err)
+	}
+	defer remote.Close()
+
+	// The socket is the first extra file, descriptor 3 in the worker
+	args := append([]string{"-c", dataWorkerSource, "3"}, importPaths...)
+	cmd := exec.Command(p.Python, args...)
+	cmd.Env = pythonEnv()
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.ExtraFiles = []*os.File{remote}
+	callbacksStarted, stopCallbacks, err := p.registeredCallbacks().attach(cmd)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		stopCallbacks()
+		conn.Close()
+		return nil, fmt.Errorf("start data channel worker: %w", err)
+	}
+	callbacksStarted()
+	return &DataChannel{cmd: cmd, conn: conn, stopCallbacks: stopCallbacks}, nil
+}
+
+// unixSocketPair returns a connected pair of Unix stream sockets: one for this process and a
+// file for the child to inherit. Neither leaks into other children.
+func unixSocketPair() (*net.UnixConn, *os.File, error) {
+	syscall.ForkLock.RLock()
+	fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM, 0)
+	if err == nil {
+		syscall.CloseOnExec(fds[0])
+		syscall.CloseOnExec(fds[1])
+	}
+	syscall.ForkLock.RUnlock()
+	if err != nil {
+		return nil, nil, err
+	}
+	local := os.NewFile(uintptr(fds[0]), "gorunpython-socket")
+	defer local.Close()
+	remote := os.NewFile(uintptr(fds[1]), "gorunpython-socket-child")
+	conn, err := net.FileConn(local)
+	if err != nil {
+		remote.Close()
+		return nil, nil, err
+	}
+	return conn.(*net.UnixConn), remote, nil
+}
+
+// Call calls the python function target ("module:function") with the Arrow IPC stream in
+// in, which may be nil to pass None. The function receives a pyarrow.Table, or a dict of
+// columns when pyarrow isn't installed, and may return a table (pyarrow or a dict of
+// columns) or None; an exception comes back as a *PythonError. The returned segment holds
+// the result's Arrow IPC stream, or is nil for None; the caller closes it.
+func (c *DataChannel) Call(target string, in *SharedSegment) (*SharedSegment, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	req := struct {
+		Target string `json:"target"`
+		Size   int    `json:"size"`
+	}{Target: target}
+	var rights []byte
+	if in != nil && in.Len() > 0 {
+		req.Size = in.Len()
+		rights = syscall.UnixRights(int(in.f.Fd()))
+	}
+	if err := c.send(req, rights); err != nil {
+		return nil, c.broken(err)
+	}
+
+	var reply dataReply
+	f, err := c.receive(&reply)
+	if err != nil {
+		if f != nil {
+			f.Close()
+		}
+		return nil, c.broken(err)
+	}
+	if reply.Error != nil {
+		if f != nil {
+			f.Close()
+		}
+		return nil, fmt.Errorf("%s: %w", target, reply.Error)
+	}
+	if f == nil {
+		return nil, nil
+	}
+	out, err := openSharedSegment(f, reply.Size)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return out, nil
+}
+
+// send writes a length-prefixed JSON message, with the descriptors in rights attached to
+// its first bytes.
+func (c *DataChannel) send(msg any, rights []byte) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	var head [4]byte
+	binary.BigEndian.PutUint32(head[:], uint32(len(data)))
+	if _, _, err := c.conn.WriteMsgUnix(head[:], rights, nil); err != nil {
+		return err
+	}
+	_, err = c.conn.Write(data)
+	return err
+}
+
+// receive reads a message into msg and returns the descriptor attached to it, if any.
+func (c *DataChannel) receive(msg any) (*os.File, error) {
+	var head [4]byte
+	oob := make([]byte, syscall.CmsgSpace(4))
+	n, oobn, _, _, err := c.conn.ReadMsgUnix(head[:], oob)
+	if err != nil {
+		return nil, err
+	}
+	var f *os.File
+	if oobn > 0 {
+		cmsgs, err := syscall.ParseSocketControlMessage(oob[:oobn])
+		if err != nil {
+			return nil, err
+		}
+		for _, cmsg := range cmsgs {
+			fds, err := syscall.ParseUnixRights(&cmsg)
+			if err != nil {
+				continue
+			}
+			for _, fd := range fds {
+				syscall.CloseOnExec(fd)
+				if f == nil {
+					f = os.NewFile(uintptr(fd), "gorunpython-data-result")
+				} else {
+					syscall.Close(fd)
+				}
+			}
+		}
+	}
+	if n == 0 {
+		return f, io.EOF
+	}
+	if _, err := io.ReadFull(c.conn, head[n:]); err != nil {
+		return f, err
+	}
+	data := make([]byte, binary.BigEndian.Uint32(head[:]))
+	if _, err := io.ReadFull(c.conn, data); err != nil {
+		return f, err
+	}
+	return f, json.Unmarshal(data, msg)
+}
+
+// broken reports a failed exchange, which ends the worker.
+func (c *DataChannel) broken(err error) error {
+	if errors.Is(err, io.EOF) || errors.Is(err, syscall.EPIPE) || errors.Is(err, syscall.ECONNRESET) {
+		return fmt.Errorf("data channel worker exited: %v", c.Close())
+	}
+	c.Close()
+	return fmt.Errorf("data channel: %w", err)
+}
+
+// Close stops the worker and waits for it to exit.
+func (c *DataChannel) Close() error {
+	c.conn.Close()
+	if c.cmd.ProcessState != nil {
+		return nil
+	}
+	err := c.cmd.Wait()
+	c.stopCallbacks()
+	return err
+}
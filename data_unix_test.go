@@ -0,0 +1,72 @@
+//go:build unix
+
+package gorunpython
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestOpenSharedSegmentSize(t *testing.T) {
+	f, err := os.CreateTemp(t.TempDir(), "segment")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString("0123456789"); err != nil {
+		t.Fatal(err)
+	}
+	for _, size := range []int{-1, 11, 1 << 20} {
+		if s, err := openSharedSegment(f, size); err == nil {
+			s.unmap()
+			t.Errorf("openSharedSegment of %d bytes in a 10 byte file succeeded", size)
+		}
+	}
+	s, err := openSharedSegment(f, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.unmap()
+	if string(s.Bytes()) != "0123456789" {
+		t.Errorf("segment holds %q", s.Bytes())
+	}
+}
+
+func TestDataChannel(t *testing.T) {
+	p := hostPythonInstance(t)
+	dir := writeTree(t, "src", map[string]string{
+		"tables.py": "def double(t):\n    return {k: [v * 2 for v in col] for k, col in t.items()}\n" +
+			"def nothing(t):\n    return None\n" +
+			"def fail(t):\n    raise ValueError('bad table')\n",
+	})
+	c, err := p.OpenDataChannel(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	in := &Table{Columns: []Column{{"n", []int64{1, 2, 3}}, {"s", []string{"a", "b", ""}}}}
+	out, err := c.CallTable("tables:double", in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := out.Column("n"); !reflect.DeepEqual(got, []int64{2, 4, 6}) {
+		t.Errorf("n = %v", got)
+	}
+	if got := out.Column("s"); !reflect.DeepEqual(got, []string{"aa", "bb", ""}) {
+		t.Errorf("s = %v", got)
+	}
+	if out, err := c.CallTable("tables:nothing", in); out != nil || err != nil {
+		t.Errorf("None came back as %v, %v", out, err)
+	}
+	var perr *PythonError
+	if _, err := c.CallTable("tables:fail", in); !errors.As(err, &perr) {
+		t.Errorf("exception came back as %v", err)
+	}
+	// The worker survives a failed call.
+	if _, err := c.CallTable("tables:double", in); err != nil {
+		t.Errorf("call after an exception: %v", err)
+	}
+}
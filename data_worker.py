@@ -0,0 +1,389 @@
+# Data channel worker, run with python -c by OpenDataChannel.
+#
+# It serves requests over the Unix socket inherited as the descriptor in argv[1]. A request
+# names a module:function and carries a shared memory descriptor holding an Arrow IPC stream.
+# The function gets the table (a pyarrow.Table when pyarrow is installed, otherwise a dict of
+# columns from the reader below) and may return a table, which goes back the same way.
+import array
+import importlib
+import itertools
+import json
+import mmap
+import os
+import socket
+import struct
+import sys
+import tempfile
+import traceback
+
+try:
+    import pyarrow
+    import pyarrow.ipc
+except ImportError:
+    pyarrow = None
+
+HEADER_SCHEMA = 1
+HEADER_RECORD_BATCH = 3
+TYPE_INT, TYPE_FLOAT, TYPE_UTF8, TYPE_BOOL, TYPE_LARGE_UTF8 = 2, 3, 5, 6, 20
+
+
+class _Flat:
+    """Reads FlatBuffers tables, just enough for Arrow metadata."""
+
+    def __init__(self, buf):
+        self.b = buf
+
+    def scalar(self, fmt, pos):
+        return struct.unpack_from(fmt, self.b, pos)[0]
+
+    def field(self, t, i):
+        vt = t - self.scalar("<i", t)
+        if 4 + 2 * i >= self.scalar("<H", vt):
+            return 0
+        off = self.scalar("<H", vt + 4 + 2 * i)
+        return t + off if off else 0
+
+    def get(self, t, i, fmt, default=0):
+        pos = self.field(t, i)
+        return self.scalar(fmt, pos) if pos else default
+
+    def ref(self, t, i):
+        pos = self.field(t, i)
+        return pos + self.scalar("<I", pos) if pos else 0
+
+    def string(self, t, i):
+        pos = self.ref(t, i)
+        if not pos:
+            return ""
+        n = self.scalar("<I", pos)
+        return bytes(self.b[pos + 4:pos + 4 + n]).decode()
+
+    def vector(self, t, i):
+        pos = self.ref(t, i)
+        return (self.scalar("<I", pos), pos + 4) if pos else (0, 0)
+
+
+def _int_format(bits, signed):
+    fmt = {8: "b", 16: "h", 32: "i", 64: "q"}[bits]
+    return fmt if signed else fmt.upper()
+
+
+def _read_schema(fb, schema):
+    fields = []
+    n, elems = fb.vector(schema, 1)
+    for i in range(n):
+        f = elems + 4 * i
+        f += fb.scalar("<I", f)
+        name = fb.string(f, 0)
+        if fb.field(f, 4) or fb.vector(f, 5)[0]:
+            raise ValueError("column %r: dictionary and nested columns are not supported" % name)
+        kind, spec = fb.get(f, 2, "<B"), fb.ref(f, 3)
+        if kind == TYPE_INT:
+            fmt = _int_format(fb.get(spec, 0, "<i"), fb.get(spec, 1, "<B"))
+        elif kind == TYPE_FLOAT:
+            fmt = {1: "f", 2: "d"}.get(fb.get(spec, 0, "<h"))
+            if fmt is None:
+                raise ValueError("column %r: half-precision floats are not supported" % name)
+        elif kind in (TYPE_UTF8, TYPE_LARGE_UTF8, TYPE_BOOL):
+            fmt = kind
+        else:
+            raise ValueError("column %r: unsupported arrow type %d" % (name, kind))
+        fields.append((name, fmt))
+    return fields
+
+
+def _read_batch(fb, batch, fields, body):
+    if fb.field(batch, 3):
+        raise ValueError("compressed arrow record batches are not supported")
+    rows = fb.get(batch, 0, "<q")
+    _, nodes = fb.vector(batch, 1)
+    _, specs = fb.vector(batch, 2)
+    buffers = itertools.count(specs, 16)
+    columns = {}
+    for i, (name, fmt) in enumerate(fields):
+        if fb.scalar("<q", nodes + 16 * i + 8):
+            raise ValueError("column %r has nulls, which are not supported" % name)
+        next(buffers)  # validity
+        count = 2 if fmt in (TYPE_UTF8, TYPE_LARGE_UTF8) else 1
+        bufs = []
+        for _ in range(count):
+            pos = next(buffers)
+            off, size = fb.scalar("<q", pos), fb.scalar("<q", pos + 8)
+            bufs.append(body[off:off + size])
+        if fmt == TYPE_BOOL:
+            bits = bufs[0]
+            columns[name] = [bool(bits[j >> 3] & (1 << (j & 7))) for j in range(rows)]
+        elif fmt in (TYPE_UTF8, TYPE_LARGE_UTF8):
+            offsets = bufs[0][:(rows + 1) * (4 if fmt == TYPE_UTF8 else 8)].cast("i" if fmt == TYPE_UTF8 else "q")
+            data = bufs[1]
+            columns[name] = [bytes(data[offsets[j]:offsets[j + 1]]).decode() for j in range(rows)]
+        else:
+            size = struct.calcsize(fmt)
+            columns[name] = bufs[0][:rows * size].cast(fmt)
+    return columns
+
+
+def read_table(buf):
+    """Reads an Arrow IPC stream into a dict of columns. Numeric columns are memoryviews of
+    buf; bool and string columns are lists."""
+    buf = memoryview(buf).cast("B")
+    fields, columns, pos = None, None, 0
+    while pos + 4 <= len(buf):
+        size = struct.unpack_from("<I", buf, pos)[0]
+        pos += 4
+        if size == 0xFFFFFFFF:
+            size = struct.unpack_from("<I", buf, pos)[0]
+            pos += 4
+        if size == 0:
+            break
+        fb = _Flat(buf[pos:pos + size])
+        pos += size
+        msg = fb.scalar("<I", 0)
+        kind, header, body_len = fb.get(msg, 1, "<B"), fb.ref(msg, 2), fb.get(msg, 3, "<q")
+        body = buf[pos:pos + body_len]
+        pos += body_len
+        if kind == HEADER_SCHEMA:
+            fields = _read_schema(fb, header)
+        elif kind == HEADER_RECORD_BATCH:
+            batch = _read_batch(fb, header, fields, body)
+            if columns is None:
+                columns = batch
+            else:
+                columns = {k: list(v) + list(batch[k]) for k, v in columns.items()}
+        else:
+            raise ValueError("unsupported arrow message type %d" % kind)
+    if columns is None:
+        columns = {name: [] for name, _ in fields or ()}
+    return columns
+
+
+class _Table(list):
+    pass
+
+
+class _Tables(list):
+    pass
+
+
+class _Builder:
+    """Writes FlatBuffers front to back, as flatbuf.go does: tables are lists of fields
+    (None, (struct format, value), str, _Table, _Tables, or bytes for 16-byte structs)."""
+
+    def __init__(self):
+        self.b = bytearray(4)
+
+    def build(self, root):
+        struct.pack_into("<I", self.b, 0, self.table(root))
+        return bytes(self.b)
+
+    def pad(self, align):
+        self.b += bytes(-len(self.b) % align)
+
+    def u32(self, v):
+        pos = len(self.b)
+        self.b += struct.pack("<I", v)
+        return pos
+
+    def patch(self, slot, target):
+        struct.pack_into("<I", self.b, slot, target - slot)
+
+    def obj(self, v):
+        if isinstance(v, _Table):
+            return self.table(v)
+        if isinstance(v, str):
+            self.pad(4)
+            data = v.encode()
+            pos = self.u32(len(data))
+            self.b += data + b"\0"
+            return pos
+        if isinstance(v, _Tables):
+            self.pad(4)
+            pos = self.u32(len(v))
+            slots = len(self.b)
+            self.b += bytes(4 * len(v))
+            for i, t in enumerate(v):
+                self.patch(slots + 4 * i, self.table(t))
+            return pos
+        self.b += bytes(-(len(self.b) + 4) % 8)
+        pos = self.u32(len(v) // 16)
+        self.b += v
+        return pos
+
+    def table(self, t):
+        self.pad(2)
+        vt = len(self.b)
+        self.b += bytes(4 + 2 * len(t))
+        self.pad(8)
+        start = self.u32(0)
+        struct.pack_into("<i", self.b, start, start - vt)
+        refs = []
+        for i, f in enumerate(t):
+            if f is None:
+                continue
+            size = struct.calcsize(f[0]) if isinstance(f, tuple) else 4
+            self.pad(size)
+            struct.pack_into("<H", self.b, vt + 4 + 2 * i, len(self.b) - start)
+            if isinstance(f, tuple):
+                self.b += struct.pack(*f)
+            else:
+                refs.append((self.u32(0), f))
+        struct.pack_into("<HH", self.b, vt, 4 + 2 * len(t), len(self.b) - start)
+        for slot, f in refs:
+            self.patch(slot, self.obj(f))
+        return start
+
+
+def _encode_column(values):
+    """Returns the arrow type table, row count and data buffers of a column."""
+    if isinstance(values, array.array):
+        values = memoryview(values)
+    if isinstance(values, memoryview):
+        fmt = values.format.lstrip("@=<")
+        if fmt in ("f", "d"):
+            typ = _Table([("<h", 1 if fmt == "f" else 2)])
+            kind = TYPE_FLOAT
+        elif fmt in "bhilqnBHILQN":
+            typ = _Table([("<i", values.itemsize * 8), ("<B", fmt.islower())])
+            kind = TYPE_INT
+        else:
+            raise TypeError("unsupported memoryview format %r" % values.format)
+        return kind, typ, len(values), [values.cast("B")]
+    values = list(values)
+    if all(isinstance(v, bool) for v in values) and values:
+        bits = bytearray((len(values) + 7) // 8)
+        for i, v in enumerate(values):
+            if v:
+                bits[i >> 3] |= 1 << (i & 7)
+        return TYPE_BOOL, _Table(), len(values), [bytes(bits)]
+    if all(isinstance(v, str) for v in values) and values:
+        data = bytearray()
+        offsets = array.array("i", [0])
+        for v in values:
+            data += v.encode()
+            offsets.append(len(data))
+        return TYPE_UTF8, _Table(), len(values), [memoryview(offsets).cast("B"), bytes(data)]
+    if all(isinstance(v, int) and not isinstance(v, bool) for v in values):
+        return _encode_column(array.array("q", values))
+    if all(isinstance(v, (int, float)) and not isinstance(v, bool) for v in values):
+        return _encode_column(array.array("d", values))
+    raise TypeError("column values must all be bools, ints, floats or strs")
+
+
+def _message(header_type, header, body_len):
+    meta = _Builder().build(_Table([("<h", 4), ("<B", header_type), header, ("<q", body_len)]))
+    meta += bytes(-len(meta) % 8)
+    return struct.pack("<Ii", 0xFFFFFFFF, len(meta)) + meta
+
+
+def write_table(columns, out):
+    """Writes a dict of columns to the binary file out as an Arrow IPC stream."""
+    fields, nodes, specs, body, body_len, rows = _Tables(), bytearray(), bytearray(), [], 0, None
+    for name, values in columns.items():
+        kind, typ, n, buffers = _encode_column(values)
+        if rows is not None and n != rows:
+            raise ValueError("column %r has %d rows, want %d" % (name, n, rows))
+        rows = n
+        fields.append(_Table([name, ("<B", 1), ("<B", kind), typ, None, _Tables()]))
+        for b in [b""] + buffers:
+            specs += struct.pack("<qq", body_len, len(b))
+            body.append(b)
+            body_len += len(b) + (-len(b) % 8)
+    rows = rows or 0
+    for _ in fields:
+        nodes += struct.pack("<qq", rows, 0)
+    out.write(_message(HEADER_SCHEMA, _Table([("<h", 0), fields]), 0))
+    out.write(_message(HEADER_RECORD_BATCH, _Table([("<q", rows), bytes(nodes), bytes(specs)]), body_len))
+    for b in body:
+        out.write(b)
+        out.write(bytes(-len(b) % 8))
+    out.write(struct.pack("<Ii", 0xFFFFFFFF, 0))
+
+
+def _recv(sock):
+    head, fds, _, _ = socket.recv_fds(sock, 4, 1)
+    while head and len(head) < 4:
+        more = sock.recv(4 - len(head))
+        if not more:
+            break
+        head += more
+    if len(head) < 4:
+        return None, fds
+    n = struct.unpack(">I", head)[0]
+    data = bytearray()
+    while len(data) < n:
+        chunk = sock.recv(n - len(data))
+        if not chunk:
+            return None, fds
+        data += chunk
+    return json.loads(data), fds
+
+
+def _send(sock, msg, fds=()):
+    data = json.dumps(msg).encode()
+    socket.send_fds(sock, [struct.pack(">I", len(data))], list(fds))
+    sock.sendall(data)
+
+
+def _output_file():
+    if hasattr(os, "memfd_create"):
+        return open(os.memfd_create("gorunpython-data"), "w+b")
+    return tempfile.TemporaryFile(dir="/dev/shm" if os.path.isdir("/dev/shm") else None)
+
+
+def _resolve(target):
+    module, _, attr = target.partition(":")
+    obj = importlib.import_module(module)
+    for part in attr.split(".") if attr else ():
+        obj = getattr(obj, part)
+    return obj
+
+
+def _handle(sock, req, fds):
+    mm = None
+    try:
+        if fds and req["size"]:
+            mm = mmap.mmap(fds[0], req["size"], access=mmap.ACCESS_READ)
+    finally:
+        for fd in fds:
+            os.close(fd)
+    table = None
+    if mm is not None:
+        if pyarrow is not None:
+            table = pyarrow.ipc.open_stream(pyarrow.py_buffer(mm)).read_all()
+        else:
+            table = read_table(mm)
+
+    result = _resolve(req["target"])(table)
+    if result is None:
+        _send(sock, {"size": 0})
+        return
+    with _output_file() as out:
+        if pyarrow is not None and isinstance(result, (pyarrow.Table, pyarrow.RecordBatch)):
+            sink = pyarrow.BufferOutputStream()
+            with pyarrow.ipc.new_stream(sink, result.schema) as writer:
+                writer.write(result)
+            out.write(sink.getvalue())
+        else:
+            write_table(result, out)
+        out.flush()
+        _send(sock, {"size": out.tell()}, [out.fileno()])
+
+
+def main():
+    sock = socket.socket(fileno=int(sys.argv[1]))
+    sys.path[:0] = sys.argv[2:]
+    while True:
+        req, fds = _recv(sock)
+        if req is None:
+            return
+        try:
+            _handle(sock, req, fds)
+        except Exception as e:
+            _send(sock, {"error": {
+                "type": type(e).__name__,
+                "message": str(e),
+                "traceback": traceback.format_exc(),
+            }})
+
+
+main()
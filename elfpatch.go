@@ -0,0 +1,508 @@
+package gorunpython
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// elfPatch lists the changes patchELF makes. Empty fields are left unchanged.
+type elfPatch struct {
+	// Interpreter replaces the PT_INTERP path (the dynamic loader).
+	Interpreter string
+	// RunPath replaces the DT_RUNPATH (or DT_RPATH, if that is what the file uses) search path,
+	// adding a DT_RUNPATH entry if the file has neither.
+	RunPath string
+	// OnlyExistingRunPath skips files that have no DT_RUNPATH or DT_RPATH entry.
+	OnlyExistingRunPath bool
+}
+
+// patchELF rewrites the interpreter and library search path of the ELF file at path.
+//
+// New strings that fit are written in place. Longer ones are placed in a new read-only (or, when
+// the dynamic table has to move, read-write) PT_LOAD segment appended to the file; its program
+// header is taken over from a PT_NOTE entry, since the program header table itself cannot grow.
+// The file is replaced atomically and left untouched if nothing changes.
+func patchELF(path string, patch elfPatch) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	p, err := newELFPatcher(data)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if patch.Interpreter != "" {
+		if err := p.setInterpreter(patch.Interpreter); err != nil {
+			return fmt.Errorf("%s: set interpreter: %w", path, err)
+		}
+	}
+	if patch.RunPath != "" {
+		if err := p.setRunPath(patch.RunPath, patch.OnlyExistingRunPath); err != nil {
+			return fmt.Errorf("%s: set runpath: %w", path, err)
+		}
+	}
+	if !p.changed {
+		return nil
+	}
+	out, err := p.finish()
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".patch-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(out); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(info.Mode().Perm()); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// isELF reports whether the file at path starts with the ELF magic.
+func isELF(path string) bool {
+	prefix, err := readFilePrefix(path, 4)
+	return err == nil && bytes.Equal(prefix, []byte(elf.ELFMAG))
+}
+
+type elfPatcher struct {
+	data  []byte
+	f     *elf.File
+	order binary.ByteOrder
+	is64  bool
+	progs []elf.ProgHeader
+
+	// extra holds the contents of the segment appended by finish, which starts at extraOff in
+	// the file and extraAddr in memory.
+	extra     []byte
+	extraOff  uint64
+	extraAddr uint64
+	align     uint64
+	writable  bool
+	changed   bool
+}
+
+func newELFPatcher(data []byte) (*elfPatcher, error) {
+	f, err := elf.NewFile(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if f.Type != elf.ET_EXEC && f.Type != elf.ET_DYN {
+		return nil, fmt.Errorf("unsupported ELF type %v", f.Type)
+	}
+	p := &elfPatcher{data: data, f: f, order: f.ByteOrder, is64: f.Class == elf.ELFCLASS64}
+	size := uint64(len(data))
+	var maxEnd uint64
+	p.align = 0x1000
+	for i, prog := range f.Progs {
+		p.progs = append(p.progs, prog.ProgHeader)
+		if !fitsIn(prog.Off, prog.Filesz, size) {
+			return nil, fmt.Errorf("segment %d is outside the file", i)
+		}
+		if prog.Type == elf.PT_LOAD {
+			if prog.Vaddr+prog.Memsz < prog.Vaddr || prog.Align&(prog.Align-1) != 0 || prog.Align > 1<<30 {
+				return nil, fmt.Errorf("segment %d has an invalid address or alignment", i)
+			}
+			maxEnd = max(maxEnd, prog.Vaddr+prog.Memsz)
+			p.align = max(p.align, prog.Align)
+		}
+	}
+	phoff, phentsize := p.phdrLayout()
+	if phentsize < p.progSize() || !fitsIn(phoff, uint64(len(p.progs))*phentsize, size) {
+		return nil, errors.New("program header table is outside the file")
+	}
+	if len(f.Sections) > 0 {
+		shoff, shentsize := p.shdrLayout()
+		if shentsize < p.sectionSize() || !fitsIn(shoff, uint64(len(f.Sections))*shentsize, size) {
+			return nil, errors.New("section header table is outside the file")
+		}
+	}
+	p.extraOff = alignUp(size, p.align)
+	p.extraAddr = alignUp(maxEnd, p.align)
+	if p.extraAddr < maxEnd {
+		return nil, errors.New("no address space left for a new segment")
+	}
+	return p, nil
+}
+
+// fitsIn reports whether n bytes at off lie within a file of the given size.
+func fitsIn(off, n, size uint64) bool {
+	return off <= size && n <= size-off
+}
+
+func (p *elfPatcher) progSize() uint64 {
+	if p.is64 {
+		return 56
+	}
+	return 32
+}
+
+func (p *elfPatcher) sectionSize() uint64 {
+	if p.is64 {
+		return 64
+	}
+	return 40
+}
+
+// grow appends b to the new segment and returns its file offset and address.
+func (p *elfPatcher) grow(b []byte) (uint64, uint64) {
+	for len(p.extra)%8 != 0 {
+		p.extra = append(p.extra, 0)
+	}
+	at := uint64(len(p.extra))
+	p.extra = append(p.extra, b...)
+	return p.extraOff + at, p.extraAddr + at
+}
+
+func (p *elfPatcher) setInterpreter(interp string) error {
+	i := p.findProg(elf.PT_INTERP)
+	if i < 0 {
+		return errors.New("file has no PT_INTERP (static executable or shared library)")
+	}
+	prog := &p.progs[i]
+	old, err := cString(p.data, prog.Off)
+	if err != nil {
+		return err
+	}
+	if old == interp {
+		return nil
+	}
+	p.changed = true
+	b := append([]byte(interp), 0)
+	if uint64(len(b)) <= prog.Filesz {
+		clear(p.data[prog.Off : prog.Off+prog.Filesz])
+		copy(p.data[prog.Off:], b)
+		return nil
+	}
+	off, addr := p.grow(b)
+	prog.Off, prog.Vaddr, prog.Paddr = off, addr, addr
+	prog.Filesz, prog.Memsz = uint64(len(b)), uint64(len(b))
+	p.updateSection(".interp", off, addr, uint64(len(b)))
+	return nil
+}
+
+type elfDyn struct {
+	tag elf.DynTag
+	val uint64
+}
+
+func (p *elfPatcher) setRunPath(runPath string, onlyExisting bool) error {
+	di := p.findProg(elf.PT_DYNAMIC)
+	if di < 0 {
+		return errors.New("file has no PT_DYNAMIC (statically linked)")
+	}
+	dynProg := p.progs[di]
+	dyns, err := p.readDynamic(dynProg)
+	if err != nil {
+		return err
+	}
+
+	var strtab, strsz uint64
+	pathIdx := -1
+	for i, d := range dyns {
+		switch d.tag {
+		case elf.DT_STRTAB:
+			strtab = d.val
+		case elf.DT_STRSZ:
+			strsz = d.val
+		case elf.DT_RUNPATH:
+			pathIdx = i
+		case elf.DT_RPATH:
+			if pathIdx < 0 || dyns[pathIdx].tag != elf.DT_RUNPATH {
+				pathIdx = i
+			}
+		}
+	}
+	if pathIdx < 0 && onlyExisting {
+		return nil
+	}
+	strOff, err := p.addrToOffset(strtab)
+	if err != nil || !fitsIn(strOff, strsz, uint64(len(p.data))) {
+		return errors.New("dynamic string table is outside the file")
+	}
+
+	// Rewrite the existing string in place when the new one fits.
+	if pathIdx >= 0 {
+		if dyns[pathIdx].val >= strsz {
+			return errors.New("runpath offset is outside the string table")
+		}
+		at := strOff + dyns[pathIdx].val
+		old, err := cString(p.data, at)
+		if err != nil {
+			return err
+		}
+		if old == runPath {
+			return nil
+		}
+		p.changed = true
+		if len(runPath) <= len(old) {
+			clear(p.data[at : at+uint64(len(old))])
+			copy(p.data[at:], runPath)
+			return nil
+		}
+	}
+	p.changed = true
+
+	// Otherwise copy the string table into the new segment with the path appended.
+	table := make([]byte, 0, strsz+uint64(len(runPath))+1)
+	table = append(table, p.data[strOff:strOff+strsz]...)
+	table = append(append(table, runPath...), 0)
+	off, addr := p.grow(table)
+	p.updateSection(".dynstr", off, addr, uint64(len(table)))
+	for i := range dyns {
+		switch dyns[i].tag {
+		case elf.DT_STRTAB:
+			dyns[i].val = addr
+		case elf.DT_STRSZ:
+			dyns[i].val = uint64(len(table))
+		}
+	}
+	if pathIdx >= 0 {
+		dyns[pathIdx].val = strsz
+		return p.writeDynamic(di, dyns)
+	}
+
+	// Add a DT_RUNPATH entry, reusing a spare DT_NULL if the table has one.
+	used := len(dyns)
+	for used > 0 && dyns[used-1].tag == elf.DT_NULL {
+		used--
+	}
+	if len(dyns)-used >= 2 {
+		dyns[used] = elfDyn{elf.DT_RUNPATH, strsz}
+		return p.writeDynamic(di, dyns)
+	}
+	dyns = append(dyns[:used], elfDyn{elf.DT_RUNPATH, strsz}, elfDyn{elf.DT_NULL, 0})
+	return p.writeDynamic(di, dyns)
+}
+
+func (p *elfPatcher) dynEntSize() uint64 {
+	if p.is64 {
+		return 16
+	}
+	return 8
+}
+
+func (p *elfPatcher) readDynamic(prog elf.ProgHeader) ([]elfDyn, error) {
+	if !fitsIn(prog.Off, prog.Filesz, uint64(len(p.data))) {
+		return nil, errors.New("dynamic table is outside the file")
+	}
+	var dyns []elfDyn
+	b := p.data[prog.Off : prog.Off+prog.Filesz]
+	for size := p.dynEntSize(); uint64(len(b)) >= size; b = b[size:] {
+		var d elfDyn
+		if p.is64 {
+			d = elfDyn{elf.DynTag(p.order.Uint64(b)), p.order.Uint64(b[8:])}
+		} else {
+			d = elfDyn{elf.DynTag(p.order.Uint32(b)), uint64(p.order.Uint32(b[4:]))}
+		}
+		dyns = append(dyns, d)
+	}
+	return dyns, nil
+}
+
+// writeDynamic stores dyns back into the dynamic table, moving the table into the new segment
+// when it has grown past its original size.
+func (p *elfPatcher) writeDynamic(di int, dyns []elfDyn) error {
+	size := p.dynEntSize()
+	b := make([]byte, uint64(len(dyns))*size)
+	for i, d := range dyns {
+		e := b[uint64(i)*size:]
+		if p.is64 {
+			p.order.PutUint64(e, uint64(d.tag))
+			p.order.PutUint64(e[8:], d.val)
+		} else {
+			p.order.PutUint32(e, uint32(d.tag))
+			p.order.PutUint32(e[4:], uint32(d.val))
+		}
+	}
+	prog := &p.progs[di]
+	if uint64(len(b)) <= prog.Filesz {
+		copy(p.data[prog.Off:], b)
+		return nil
+	}
+	// The loader writes DT_DEBUG at run time, so the moved table must be writable.
+	p.writable = true
+	off, addr := p.grow(b)
+	prog.Off, prog.Vaddr, prog.Paddr = off, addr, addr
+	prog.Filesz, prog.Memsz = uint64(len(b)), uint64(len(b))
+	p.updateSection(".dynamic", off, addr, uint64(len(b)))
+	return nil
+}
+
+// finish returns the patched file. If anything was placed in the new segment, a PT_NOTE program
+// header becomes its PT_LOAD entry and is moved after the last PT_LOAD, because loaders expect
+// load segments in ascending address order.
+func (p *elfPatcher) finish() ([]byte, error) {
+	progs := p.progs
+	if len(p.extra) > 0 {
+		ni := p.spareNote()
+		if ni < 0 {
+			return nil, errors.New("new strings do not fit in place and there is no PT_NOTE program header to turn into a new segment")
+		}
+		flags := elf.PF_R
+		if p.writable {
+			flags |= elf.PF_W
+		}
+		load := elf.ProgHeader{
+			Type:   elf.PT_LOAD,
+			Flags:  flags,
+			Off:    p.extraOff,
+			Vaddr:  p.extraAddr,
+			Paddr:  p.extraAddr,
+			Filesz: uint64(len(p.extra)),
+			Memsz:  uint64(len(p.extra)),
+			Align:  p.align,
+		}
+		progs = append([]elf.ProgHeader(nil), p.progs[:ni]...)
+		progs = append(progs, p.progs[ni+1:]...)
+		last := -1
+		for i, prog := range progs {
+			if prog.Type == elf.PT_LOAD {
+				last = i
+			}
+		}
+		progs = append(progs[:last+1], append([]elf.ProgHeader{load}, progs[last+1:]...)...)
+	}
+
+	phoff, phentsize := p.phdrLayout()
+	for i, prog := range progs {
+		p.putProg(p.data[phoff+uint64(i)*phentsize:], prog)
+	}
+	if len(p.extra) == 0 {
+		return p.data, nil
+	}
+	out := make([]byte, p.extraOff, p.extraOff+uint64(len(p.extra)))
+	copy(out, p.data)
+	return append(out, p.extra...), nil
+}
+
+// spareNote picks a PT_NOTE entry to reuse, avoiding any that holds the GNU property note.
+func (p *elfPatcher) spareNote() int {
+	var prop *elf.ProgHeader
+	if i := p.findProg(elf.PT_GNU_PROPERTY); i >= 0 {
+		prop = &p.progs[i]
+	}
+	best := -1
+	for i, prog := range p.progs {
+		if prog.Type != elf.PT_NOTE {
+			continue
+		}
+		if prop != nil && prog.Off <= prop.Off && prop.Off < prog.Off+prog.Filesz {
+			if best < 0 {
+				best = i
+			}
+			continue
+		}
+		return i
+	}
+	return best
+}
+
+func (p *elfPatcher) findProg(typ elf.ProgType) int {
+	for i, prog := range p.progs {
+		if prog.Type == typ {
+			return i
+		}
+	}
+	return -1
+}
+
+func (p *elfPatcher) addrToOffset(addr uint64) (uint64, error) {
+	for _, prog := range p.progs {
+		if prog.Type == elf.PT_LOAD && addr >= prog.Vaddr && addr < prog.Vaddr+prog.Filesz {
+			return addr - prog.Vaddr + prog.Off, nil
+		}
+	}
+	return 0, fmt.Errorf("address %#x is not in a loaded segment", addr)
+}
+
+// updateSection keeps the section header of a moved table in step with its program header, so
+// tools that read sections (readelf, strip) see the new location.
+func (p *elfPatcher) updateSection(name string, off, addr, size uint64) {
+	shoff, shentsize := p.shdrLayout()
+	for i, s := range p.f.Sections {
+		if s.Name != name {
+			continue
+		}
+		e := p.data[shoff+uint64(i)*shentsize:]
+		if p.is64 {
+			p.order.PutUint64(e[16:], addr)
+			p.order.PutUint64(e[24:], off)
+			p.order.PutUint64(e[32:], size)
+		} else {
+			p.order.PutUint32(e[12:], uint32(addr))
+			p.order.PutUint32(e[16:], uint32(off))
+			p.order.PutUint32(e[20:], uint32(size))
+		}
+		return
+	}
+}
+
+func (p *elfPatcher) phdrLayout() (off, entsize uint64) {
+	if p.is64 {
+		return p.order.Uint64(p.data[32:]), uint64(p.order.Uint16(p.data[54:]))
+	}
+	return uint64(p.order.Uint32(p.data[28:])), uint64(p.order.Uint16(p.data[42:]))
+}
+
+func (p *elfPatcher) shdrLayout() (off, entsize uint64) {
+	if p.is64 {
+		return p.order.Uint64(p.data[40:]), uint64(p.order.Uint16(p.data[58:]))
+	}
+	return uint64(p.order.Uint32(p.data[32:])), uint64(p.order.Uint16(p.data[46:]))
+}
+
+func (p *elfPatcher) putProg(b []byte, prog elf.ProgHeader) {
+	if p.is64 {
+		p.order.PutUint32(b[0:], uint32(prog.Type))
+		p.order.PutUint32(b[4:], uint32(prog.Flags))
+		p.order.PutUint64(b[8:], prog.Off)
+		p.order.PutUint64(b[16:], prog.Vaddr)
+		p.order.PutUint64(b[24:], prog.Paddr)
+		p.order.PutUint64(b[32:], prog.Filesz)
+		p.order.PutUint64(b[40:], prog.Memsz)
+		p.order.PutUint64(b[48:], prog.Align)
+		return
+	}
+	p.order.PutUint32(b[0:], uint32(prog.Type))
+	p.order.PutUint32(b[4:], uint32(prog.Off))
+	p.order.PutUint32(b[8:], uint32(prog.Vaddr))
+	p.order.PutUint32(b[12:], uint32(prog.Paddr))
+	p.order.PutUint32(b[16:], uint32(prog.Filesz))
+	p.order.PutUint32(b[20:], uint32(prog.Memsz))
+	p.order.PutUint32(b[24:], uint32(prog.Flags))
+	p.order.PutUint32(b[28:], uint32(prog.Align))
+}
+
+func cString(data []byte, off uint64) (string, error) {
+	if off >= uint64(len(data)) {
+		return "", errors.New("string offset is outside the file")
+	}
+	end := bytes.IndexByte(data[off:], 0)
+	if end < 0 {
+		return "", errors.New("unterminated string")
+	}
+	return string(data[off : off+uint64(end)]), nil
+}
+
+func alignUp(v, align uint64) uint64 {
+	return (v + align - 1) &^ (align - 1)
+}
@@ -0,0 +1,209 @@
+package gorunpython
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// hostELF copies a small dynamically linked host program into a temporary directory.
+func hostELF(t *testing.T) (path, interp string) {
+	t.Helper()
+	if runtime.GOOS != "linux" {
+		t.Skip("needs a Linux host binary")
+	}
+	src, err := exec.LookPath("true")
+	if err != nil {
+		t.Skip("no true binary on the host")
+	}
+	data, err := os.ReadFile(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := elf.Open(src)
+	if err != nil {
+		t.Skipf("%s is not ELF: %v", src, err)
+	}
+	interp = elfInterpreter(f)
+	f.Close()
+	if interp == "" {
+		t.Skipf("%s is statically linked", src)
+	}
+	path = filepath.Join(t.TempDir(), "true")
+	if err := os.WriteFile(path, data, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return path, interp
+}
+
+func readRunPath(t *testing.T, path string) string {
+	t.Helper()
+	f, err := elf.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	for _, tag := range []elf.DynTag{elf.DT_RUNPATH, elf.DT_RPATH} {
+		if vals, err := f.DynString(tag); err == nil && len(vals) > 0 {
+			return vals[0]
+		}
+	}
+	return ""
+}
+
+func TestPatchELF(t *testing.T) {
+	longDir := filepath.Join(t.TempDir(), strings.Repeat("long-directory-name/", 8))
+	if err := os.MkdirAll(longDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name  string
+		patch func(interp string) elfPatch
+	}{
+		{"same interpreter", func(interp string) elfPatch { return elfPatch{Interpreter: interp} }},
+		{"longer interpreter", func(interp string) elfPatch {
+			return elfPatch{Interpreter: filepath.Join(longDir, filepath.Base(interp))}
+		}},
+		{"new runpath", func(string) elfPatch { return elfPatch{RunPath: longDir} }},
+		{"both", func(interp string) elfPatch {
+			return elfPatch{Interpreter: filepath.Join(longDir, filepath.Base(interp)), RunPath: "$ORIGIN/../lib:" + longDir}
+		}},
+		{"only existing runpath", func(string) elfPatch { return elfPatch{RunPath: longDir, OnlyExistingRunPath: true} }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path, interp := hostELF(t)
+			if err := os.Symlink(interp, filepath.Join(longDir, filepath.Base(interp))); err != nil && !os.IsExist(err) {
+				t.Fatal(err)
+			}
+			before := readRunPath(t, path)
+			patch := tt.patch(interp)
+			if err := patchELF(path, patch); err != nil {
+				t.Fatal(err)
+			}
+
+			f, err := elf.Open(path)
+			if err != nil {
+				t.Fatalf("patched file does not parse: %v", err)
+			}
+			gotInterp := elfInterpreter(f)
+			f.Close()
+			wantInterp := interp
+			if patch.Interpreter != "" {
+				wantInterp = patch.Interpreter
+			}
+			if gotInterp != wantInterp {
+				t.Errorf("interpreter = %q, want %q", gotInterp, wantInterp)
+			}
+			wantRunPath := patch.RunPath
+			if patch.RunPath == "" || (patch.OnlyExistingRunPath && before == "") {
+				wantRunPath = before
+			}
+			if got := readRunPath(t, path); got != wantRunPath {
+				t.Errorf("runpath = %q, want %q", got, wantRunPath)
+			}
+			if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0o755 {
+				t.Errorf("mode after patching = %v, %v", info.Mode(), err)
+			}
+			// The patched program must still load and run.
+			if out, err := exec.Command(path).CombinedOutput(); err != nil {
+				t.Errorf("patched binary failed: %v\n%s", err, out)
+			}
+			// Patching again with the same values changes nothing.
+			data, _ := os.ReadFile(path)
+			if err := patchELF(path, patch); err != nil {
+				t.Fatal(err)
+			}
+			if again, _ := os.ReadFile(path); string(again) != string(data) {
+				t.Error("a second identical patch changed the file")
+			}
+		})
+	}
+}
+
+func TestPatchELFMalformed(t *testing.T) {
+	path, _ := hostELF(t)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	tests := map[string][]byte{
+		"empty":      nil,
+		"not elf":    []byte("#!/bin/sh\necho hi\n"),
+		"header":     data[:64],
+		"truncated":  data[:len(data)/4],
+		"bad class":  append([]byte("\x7fELF\x09"), data[5:]...),
+		"relocation": withELFType(data, elf.ET_REL),
+	}
+	if elf.Class(data[elf.EI_CLASS]) == elf.ELFCLASS64 {
+		f, err := elf.NewFile(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		phoff := binary.LittleEndian.Uint64(data[32:])
+		for i, prog := range f.Progs {
+			at := phoff + uint64(i)*56
+			switch prog.Type {
+			case elf.PT_INTERP:
+				tests["interp past end"] = withUint64(data, at+8, 1<<40)
+			case elf.PT_DYNAMIC:
+				tests["dynamic too large"] = withUint64(data, at+32, 1<<63)
+			case elf.PT_LOAD:
+				tests["bad alignment"] = withUint64(data, at+48, 3)
+			}
+		}
+		tests["section table past end"] = withUint64(data, 40, 1<<62)
+	}
+	for name, data := range tests {
+		t.Run(name, func(t *testing.T) {
+			p := filepath.Join(dir, strings.ReplaceAll(name, " ", "-"))
+			if err := os.WriteFile(p, data, 0o755); err != nil {
+				t.Fatal(err)
+			}
+			if err := patchELF(p, elfPatch{Interpreter: "/x", RunPath: "/y"}); err == nil {
+				t.Error("patched a malformed file")
+			}
+		})
+	}
+}
+
+func withELFType(data []byte, typ elf.Type) []byte {
+	out := append([]byte(nil), data...)
+	out[16], out[17] = byte(typ), 0 // e_type, little-endian as on the test hosts
+	return out
+}
+
+func withUint64(data []byte, off, v uint64) []byte {
+	out := append([]byte(nil), data...)
+	binary.LittleEndian.PutUint64(out[off:], v)
+	return out
+}
+
+func TestIsELF(t *testing.T) {
+	dir := t.TempDir()
+	for name, want := range map[string]bool{"\x7fELF\x02\x01": true, "#!/bin/sh": false, "": false} {
+		p := filepath.Join(dir, "f")
+		os.WriteFile(p, []byte(name), 0o644)
+		if got := isELF(p); got != want {
+			t.Errorf("isELF(%q) = %v, want %v", name, got, want)
+		}
+	}
+	if isELF(filepath.Join(dir, "missing")) {
+		t.Error("isELF of a missing file")
+	}
+}
+
+func TestAlignUp(t *testing.T) {
+	for _, tt := range []struct{ v, align, want uint64 }{{0, 0x1000, 0}, {1, 0x1000, 0x1000}, {0x1000, 0x1000, 0x1000}, {0x1001, 8, 0x1008}} {
+		if got := alignUp(tt.v, tt.align); got != tt.want {
+			t.Errorf("alignUp(%#x, %#x) = %#x, want %#x", tt.v, tt.align, got, tt.want)
+		}
+	}
+}
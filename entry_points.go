@@ -0,0 +1,115 @@
+package gorunpython
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// consoleScriptRunner runs a console script entry point the way its generated wrapper would,
+// without depending on the wrapper's shebang. It is run as
+// python -c consoleScriptRunner NAME MODULE ATTRS ARGS...
+const consoleScriptRunner = `import importlib, sys
+name, module, attrs = sys.argv[1:4]
+del sys.argv[1:4]
+sys.argv[0] = name
+obj = importlib.import_module(module)
+for attr in filter(None, attrs.split(".")):
+    obj = getattr(obj, attr)
+sys.exit(obj())`
+
+// consoleScript is a [console_scripts] entry point of an installed distribution.
+type consoleScript struct {
+	Name     string
+	Module   string
+	Function string
+}
+
+// consoleScripts returns the console scripts declared by the distributions installed in
+// siteDir, keyed by name.
+func consoleScripts(siteDir string) (map[string]consoleScript, error) {
+	scripts := map[string]consoleScript{}
+	entries, err := os.ReadDir(siteDir)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if !e.IsDir() || !(strings.HasSuffix(e.Name(), ".dist-info") || strings.HasSuffix(e.Name(), ".egg-info")) {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(siteDir, e.Name(), "entry_points.txt"))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range parseConsoleScripts(data) {
+			scripts[s.Name] = s
+		}
+	}
+	return scripts, nil
+}
+
+// parseConsoleScripts reads the [console_scripts] section of an entry_points.txt. Each entry is
+// "name = module:attr.attr [extras]"; the attribute part may be missing.
+func parseConsoleScripts(data []byte) []consoleScript {
+	var scripts []consoleScript
+	section := ""
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+		if section != "console_scripts" {
+			continue
+		}
+		name, ref, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		ref, _, _ = strings.Cut(ref, "[")
+		module, function, _ := strings.Cut(strings.TrimSpace(ref), ":")
+		s := consoleScript{Name: strings.TrimSpace(name), Module: strings.TrimSpace(module), Function: strings.TrimSpace(function)}
+		if s.Name != "" && s.Module != "" {
+			scripts = append(scripts, s)
+		}
+	}
+	return scripts
+}
+
+// sitePackages returns the instance's site-packages directory.
+func (p *pythonInstance) sitePackages() (string, error) {
+	layout, err := p.resolvedLayout()
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(layout.Stdlib, "site-packages")
+	if info, err := os.Stat(dir); err == nil && info.IsDir() {
+		return dir, nil
+	}
+	output, err := runPythonCommandWithOutput(p.Python, []string{"-c", `import sysconfig; print(sysconfig.get_paths()["purelib"])`})
+	if err != nil {
+		return "", fmt.Errorf("locate site-packages: %w\n%s", err, output)
+	}
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	return lines[len(lines)-1], nil
+}
+
+// entryPointCommand returns how to run the console script e with args: through the interpreter
+// with its module and function, so a stale or foreign shebang in the generated wrapper doesn't
+// matter.
+func (e *pythonExecutable) entryPointCommand(args []string) (string, []string) {
+	if e.Function == "" {
+		return e.python, append([]string{"-m", e.Module}, args...)
+	}
+	return e.python, append([]string{"-c", consoleScriptRunner, e.ExecutableName, e.Module, e.Function}, args...)
+}
@@ -0,0 +1,117 @@
+package gorunpython
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseConsoleScripts(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want []consoleScript
+	}{
+		{"empty", "", nil},
+		{
+			name: "simple",
+			data: "[console_scripts]\nblack = black:patched_main\nblackd = blackd:patched_main [d]\n",
+			want: []consoleScript{{"black", "black", "patched_main"}, {"blackd", "blackd", "patched_main"}},
+		},
+		{
+			name: "other sections",
+			data: "[gui_scripts]\ngui = app:main\n\n[console_scripts]\ncli = app.cli:main\n[pytest11]\nplugin = app.plugin\n",
+			want: []consoleScript{{"cli", "app.cli", "main"}},
+		},
+		{
+			name: "spacing and comments",
+			data: "  [ console_scripts ]  \n# comment\n; comment\n\ttool=pkg.mod : Cls.run \r\n",
+			want: []consoleScript{{"tool", "pkg.mod", "Cls.run"}},
+		},
+		{
+			name: "module only",
+			data: "[console_scripts]\nrun = pkg.__main__\n",
+			want: []consoleScript{{"run", "pkg.__main__", ""}},
+		},
+		{
+			name: "malformed",
+			data: "[console_scripts]\nno equals sign\n= mod:f\nname =\nname = [extra]\n",
+		},
+		{"outside any section", "tool = mod:main\n", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseConsoleScripts([]byte(tt.data)); !slices.Equal(got, tt.want) {
+				t.Errorf("parseConsoleScripts =\n%+v\nwant\n%+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConsoleScripts(t *testing.T) {
+	site := writeTree(t, "site-packages", map[string]string{
+		"black-24.1.dist-info/entry_points.txt": "[console_scripts]\nblack = black:patched_main\n",
+		"old-1.0.egg-info/entry_points.txt":     "[console_scripts]\nold = old.cli:main\n",
+		"plain-1.0.dist-info/METADATA":          "",
+		"notdist/entry_points.txt":              "[console_scripts]\nhidden = hidden:main\n",
+		"file.dist-info":                        "",
+	})
+	got, err := consoleScripts(site)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]consoleScript{
+		"black": {"black", "black", "patched_main"},
+		"old":   {"old", "old.cli", "main"},
+	}
+	if len(got) != len(want) {
+		t.Errorf("consoleScripts = %v, want %v", got, want)
+	}
+	for name, s := range want {
+		if got[name] != s {
+			t.Errorf("%s = %+v, want %+v", name, got[name], s)
+		}
+	}
+	if _, err := consoleScripts(filepath.Join(site, "missing")); err == nil {
+		t.Error("consoleScripts of a missing directory succeeded")
+	}
+}
+
+func TestEntryPointCommand(t *testing.T) {
+	python, err := exec.LookPath("python3")
+	if err != nil {
+		t.Skip("no python3 on the host")
+	}
+	dir := writeTree(t, "src", map[string]string{
+		"tool/__init__.py": "",
+		"tool/cli.py": "import sys\nclass App:\n    @staticmethod\n    def run():\n" +
+			"        print(sys.argv[0], sys.argv[1:])\n        return 3\n",
+		"tool/__main__.py": "import sys\nprint('main', sys.argv[1:])\n",
+	})
+
+	tests := []struct {
+		exe      pythonExecutable
+		wantOut  string
+		wantCode int
+	}{
+		{pythonExecutable{ExecutableName: "tool", Module: "tool.cli", Function: "App.run", python: python}, "tool ['a', '-b']\n", 3},
+		{pythonExecutable{ExecutableName: "tool", Module: "tool", python: python}, "main ['a', '-b']\n", 0},
+	}
+	for _, tt := range tests {
+		name, args := tt.exe.entryPointCommand([]string{"a", "-b"})
+		cmd := exec.Command(name, args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(), "PYTHONPATH="+dir)
+		out, err := cmd.Output()
+		if code := cmd.ProcessState.ExitCode(); code != tt.wantCode || string(out) != tt.wantOut {
+			t.Errorf("%s:%s printed %q and exited %d (%v); want %q and %d", tt.exe.Module, tt.exe.Function,
+				out, code, err, tt.wantOut, tt.wantCode)
+		}
+		if !strings.Contains(strings.Join(args, " "), tt.exe.Module) {
+			t.Errorf("command %q does not name module %s", args, tt.exe.Module)
+		}
+	}
+}
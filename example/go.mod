@@ -5,3 +5,5 @@ go 1.25.6
 replace github.com/ZacTyAdams/go-run-python/v2 => ../
 
 require github.com/ZacTyAdams/go-run-python/v2 v2.0.0-00010101000000-000000000000
+
+require github.com/klauspost/compress v1.20.1 // indirect
@@ -63,16 +63,12 @@ func main() {
 		panic(err)
 	}
 
-	var targetExecutable string
 	for entry := range maps.Keys(pythonInstance.Executables) {
-		if entry == "python"+pythonInstance.PythonVersion {
-			targetExecutable = entry
-			break
-		}
+		fmt.Println("Console script: ", entry)
 	}
 
-	pythonExecutable := pythonInstance.Executables[targetExecutable]
-	pythonExecutable.ExecStream([]string{"--version"})
+	pipExecutable := pythonInstance.Executables["pip"]
+	pipExecutable.ExecStream([]string{"--version"})
 
 	err = pythonInstance.PythonExecStream("hello_world.py")
 	if err != nil {
@@ -0,0 +1,291 @@
+package gorunpython
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ExtractLimits bounds how much an archive may expand to, guarding against decompression bombs.
+// A zero field means no limit.
+type ExtractLimits struct {
+	MaxEntries   int
+	MaxFileSize  int64
+	MaxTotalSize int64
+}
+
+// DefaultExtractLimits applies to the embedded Python bundle and to sealed payloads. The defaults
+// leave ample headroom for a full Python installation with third-party packages.
+var DefaultExtractLimits = ExtractLimits{
+	MaxEntries:   500_000,
+	MaxFileSize:  4 << 30,
+	MaxTotalSize: 16 << 30,
+}
+
+// ExtractArchive unpacks a chunked bundle (see ConvertToBundle) or a gzip, zstd or uncompressed
+// tarball, detected from its magic bytes, into dest. This is how the embedded Python bundle is
+// unpacked.
+func ExtractArchive(data []byte, dest string) error {
+	return extractArchiveSelected(data, dest, nil, nil)
+}
+
+// extractArchiveSelected is like ExtractArchive but only writes entries whose cleaned archive
+// name satisfies keep, and records the files it writes in rec. A nil keep extracts everything
+// and a nil rec records nothing.
+func extractArchiveSelected(data []byte, dest string, keep func(name string) bool, rec *extractRecord) error {
+	if isBundle(data) {
+		return extractBundle(data, dest, DefaultExtractLimits, keep, rec)
+	}
+	r, _, err := newDecompressReader(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	return extractTar(r, dest, DefaultExtractLimits, keep, rec)
+}
+
+// extractTar unpacks an uncompressed tar stream into dest.
+//
+// Every write goes through an os.Root, so no entry can create or modify anything outside dest,
+// even through symlinks. Entry names must be relative and stay inside dest, symlink targets must
+// resolve inside dest, hard links must point at earlier entries, existing files are truncated,
+// and the archive must stay within limits. Entries rejected by a non-nil keep are skipped, and
+// files written are recorded in a non-nil rec.
+func extractTar(r io.Reader, dest string, limits ExtractLimits, keep func(name string) bool, rec *extractRecord) error {
+	root, destReal, err := openExtractRoot(dest)
+	if err != nil {
+		return err
+	}
+	defer root.Close()
+
+	var entries int
+	var total int64
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read tar header: %w", err)
+		}
+		if hdr.Typeflag == tar.TypeXGlobalHeader {
+			continue
+		}
+
+		entries++
+		if limits.MaxEntries > 0 && entries > limits.MaxEntries {
+			return fmt.Errorf("archive has more than %d entries", limits.MaxEntries)
+		}
+		if err := checkArchiveEntry(hdr); err != nil {
+			return err
+		}
+		name, _ := cleanArchivePath(hdr.Name)
+		if name == "." || (keep != nil && !keep(name)) {
+			continue
+		}
+		target := filepath.FromSlash(name)
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := root.MkdirAll(target, 0o755); err != nil {
+				return fmt.Errorf("failed to create directory: %w", err)
+			}
+		case tar.TypeReg:
+			if limits.MaxFileSize > 0 && hdr.Size > limits.MaxFileSize {
+				return fmt.Errorf("%s is %d bytes, over the %d byte limit", hdr.Name, hdr.Size, limits.MaxFileSize)
+			}
+			total += hdr.Size
+			if limits.MaxTotalSize > 0 && total > limits.MaxTotalSize {
+				return fmt.Errorf("archive expands to more than %d bytes", limits.MaxTotalSize)
+			}
+			if err := extractRegular(root, target, hdr, tr, rec); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			if err := prepareLink(root, target); err != nil {
+				return err
+			}
+			if err := checkSymlinkTarget(destReal, target, hdr.Linkname); err != nil {
+				return err
+			}
+			if err := root.Symlink(hdr.Linkname, target); err != nil {
+				return fmt.Errorf("failed to create symlink: %w", err)
+			}
+		case tar.TypeLink:
+			if err := prepareLink(root, target); err != nil {
+				return err
+			}
+			linkName, _ := cleanArchivePath(hdr.Linkname)
+			if err := root.Link(filepath.FromSlash(linkName), target); err != nil {
+				return fmt.Errorf("failed to create hard link: %w", err)
+			}
+			rec.link(name, linkName)
+		}
+	}
+}
+
+// openExtractRoot creates dest if needed and opens it as an os.Root, also returning its real
+// absolute path for symlink checks.
+func openExtractRoot(dest string) (*os.Root, string, error) {
+	if err := os.MkdirAll(dest, 0o755); err != nil {
+		return nil, "", fmt.Errorf("failed to create destination: %w", err)
+	}
+	destReal, err := filepath.EvalSymlinks(dest)
+	if err != nil {
+		return nil, "", fmt.Errorf("resolve destination: %w", err)
+	}
+	destReal, err = filepath.Abs(destReal)
+	if err != nil {
+		return nil, "", fmt.Errorf("resolve absolute dest: %w", err)
+	}
+	root, err := os.OpenRoot(destReal)
+	if err != nil {
+		return nil, "", fmt.Errorf("open destination: %w", err)
+	}
+	return root, destReal, nil
+}
+
+func extractRegular(root *os.Root, target string, hdr *tar.Header, r io.Reader, rec *extractRecord) error {
+	if err := root.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return fmt.Errorf("failed to create file directory: %w", err)
+	}
+	// Replace rather than follow an existing symlink at the target.
+	if info, err := root.Lstat(target); err == nil && info.Mode()&os.ModeSymlink != 0 {
+		if err := root.Remove(target); err != nil {
+			return fmt.Errorf("failed to replace symlink: %w", err)
+		}
+	}
+	mode := os.FileMode(hdr.Mode).Perm()
+	f, err := root.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode)
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+	w := io.Writer(f)
+	var h hash.Hash
+	if rec != nil {
+		h = sha256.New()
+		w = io.MultiWriter(f, h)
+	}
+	if _, err := io.Copy(w, r); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to write file content: %w", err)
+	}
+	if rec != nil {
+		info, err := f.Stat()
+		if err != nil {
+			_ = f.Close()
+			return fmt.Errorf("stat extracted file: %w", err)
+		}
+		rec.add(manifestEntry{Path: filepath.ToSlash(target), Size: info.Size(), ModTime: info.ModTime().UnixNano(), SHA256: hex.EncodeToString(h.Sum(nil))})
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to close extracted file: %w", err)
+	}
+	// OpenFile only applies mode when it creates the file.
+	if err := root.Chmod(target, mode); err != nil {
+		return fmt.Errorf("failed to set file mode: %w", err)
+	}
+	return nil
+}
+
+// prepareLink creates the parent of a link entry and removes any non-directory already at target.
+func prepareLink(root *os.Root, target string) error {
+	if err := root.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return fmt.Errorf("failed to create link directory: %w", err)
+	}
+	info, err := root.Lstat(target)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("stat existing entry: %w", err)
+	}
+	if info.IsDir() {
+		return fmt.Errorf("cannot replace directory %s with a link", target)
+	}
+	if err := root.Remove(target); err != nil {
+		return fmt.Errorf("failed to replace existing entry: %w", err)
+	}
+	return nil
+}
+
+// checkArchiveEntry rejects entries with unsafe names, unsupported types or unsafe link targets
+// that can be detected without touching the file system.
+func checkArchiveEntry(hdr *tar.Header) error {
+	if _, err := cleanArchivePath(hdr.Name); err != nil {
+		return err
+	}
+	switch hdr.Typeflag {
+	case tar.TypeDir, tar.TypeReg:
+		return nil
+	case tar.TypeSymlink:
+		return checkSymlinkText(hdr.Name, hdr.Linkname)
+	case tar.TypeLink:
+		linkName, err := cleanArchivePath(hdr.Linkname)
+		if err != nil || linkName == "." {
+			return fmt.Errorf("invalid hard link target %q for %q", hdr.Linkname, hdr.Name)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported entry type in archive (%c) for %q", hdr.Typeflag, hdr.Name)
+	}
+}
+
+// checkSymlinkText rejects absolute targets, and targets where ".." follows a named component:
+// the OS resolves that component (possibly a symlink) before applying "..", so a lexical check
+// could not vouch for where the link ends up.
+func checkSymlinkText(name, target string) error {
+	if target == "" || path.IsAbs(filepath.ToSlash(target)) || filepath.IsAbs(target) || filepath.VolumeName(target) != "" {
+		return fmt.Errorf("symlink %q has absolute or empty target %q", name, target)
+	}
+	seenName := false
+	for _, part := range strings.Split(filepath.ToSlash(target), "/") {
+		switch part {
+		case "", ".":
+		case "..":
+			if seenName {
+				return fmt.Errorf("symlink %q has unsupported target %q", name, target)
+			}
+		default:
+			seenName = true
+		}
+	}
+	if _, err := cleanArchivePath(path.Join(path.Dir(filepath.ToSlash(name)), filepath.ToSlash(target))); err != nil {
+		return fmt.Errorf("symlink %q points outside the archive: %q", name, target)
+	}
+	return nil
+}
+
+// checkSymlinkTarget verifies that a symlink at target (relative to destReal) pointing at
+// linkTarget resolves inside destReal, using the real location of the link's directory.
+func checkSymlinkTarget(destReal, target, linkTarget string) error {
+	parentReal, err := filepath.EvalSymlinks(filepath.Join(destReal, filepath.Dir(target)))
+	if err != nil {
+		return fmt.Errorf("resolve symlink directory: %w", err)
+	}
+	resolved := filepath.Join(parentReal, filepath.FromSlash(linkTarget))
+	rel, err := filepath.Rel(destReal, resolved)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(os.PathSeparator)) {
+		return fmt.Errorf("symlink %q points outside the destination: %q", target, linkTarget)
+	}
+	return nil
+}
+
+// cleanArchivePath normalizes a tar entry name and rejects absolute or parent-relative paths.
+func cleanArchivePath(name string) (string, error) {
+	clean := path.Clean(filepath.ToSlash(name))
+	if strings.HasPrefix(clean, "/") || clean == ".." || strings.HasPrefix(clean, "../") || filepath.VolumeName(name) != "" {
+		return "", fmt.Errorf("invalid path in archive: %q", name)
+	}
+	return clean, nil
+}
@@ -0,0 +1,252 @@
+package gorunpython
+
+import (
+	"archive/tar"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// tarEntry is one entry of a crafted archive; body is only written for regular files.
+type tarEntry struct {
+	hdr  tar.Header
+	body string
+}
+
+func tarFile(name, body string) tarEntry {
+	return tarEntry{tar.Header{Name: name, Mode: 0o644, Size: int64(len(body)), Typeflag: tar.TypeReg}, body}
+}
+
+func tarSymlink(name, target string) tarEntry {
+	return tarEntry{hdr: tar.Header{Name: name, Linkname: target, Mode: 0o777, Typeflag: tar.TypeSymlink}}
+}
+
+func tarHardlink(name, target string) tarEntry {
+	return tarEntry{hdr: tar.Header{Name: name, Linkname: target, Mode: 0o644, Typeflag: tar.TypeLink}}
+}
+
+func tarEntries(t *testing.T, entries ...tarEntry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, e := range entries {
+		hdr := e.hdr
+		if err := tw.WriteHeader(&hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(e.body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestCleanArchivePath(t *testing.T) {
+	tests := []struct {
+		name, want string
+		ok         bool
+	}{
+		{"a/b.txt", "a/b.txt", true},
+		{"./a//b/../c", "a/c", true},
+		{"a/..", ".", true},
+		{"/etc/passwd", "", false},
+		{"..", "", false},
+		{"../x", "", false},
+		{"a/../../x", "", false},
+	}
+	for _, tt := range tests {
+		got, err := cleanArchivePath(tt.name)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("cleanArchivePath(%q) = %q, %v; want %q, ok %v", tt.name, got, err, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestCheckArchiveEntry(t *testing.T) {
+	tests := []struct {
+		entry tarEntry
+		ok    bool
+	}{
+		{tarFile("a.txt", ""), true},
+		{tarFile("../a.txt", ""), false},
+		{tarSymlink("lib/link", "../bin/python"), true},
+		{tarSymlink("lib/link", "/bin/sh"), false},
+		{tarSymlink("lib/link", ""), false},
+		{tarSymlink("lib/link", "../../etc"), false},
+		{tarSymlink("lib/link", "sub/../../x"), false},
+		{tarHardlink("b", "a"), true},
+		{tarHardlink("b", "../a"), false},
+		{tarHardlink("b", "."), false},
+		{tarEntry{hdr: tar.Header{Name: "dev", Typeflag: tar.TypeChar}}, false},
+		{tarEntry{hdr: tar.Header{Name: "fifo", Typeflag: tar.TypeFifo}}, false},
+	}
+	for _, tt := range tests {
+		err := checkArchiveEntry(&tt.entry.hdr)
+		if (err == nil) != tt.ok {
+			t.Errorf("checkArchiveEntry(%q -> %q) = %v, want ok %v", tt.entry.hdr.Name, tt.entry.hdr.Linkname, err, tt.ok)
+		}
+	}
+}
+
+func TestExtractArchive(t *testing.T) {
+	dest := t.TempDir()
+	data := tarEntries(t,
+		tarEntry{hdr: tar.Header{Name: "bin/", Mode: 0o755, Typeflag: tar.TypeDir}},
+		tarEntry{tar.Header{Name: "bin/python", Mode: 0o755, Size: 6, Typeflag: tar.TypeReg}, "binary"},
+		tarSymlink("bin/python3", "python"),
+		tarHardlink("bin/python3.14", "bin/python"),
+	)
+	if err := ExtractArchive(data, dest); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"bin/python", "bin/python3", "bin/python3.14"} {
+		got, err := os.ReadFile(filepath.Join(dest, name))
+		if err != nil || string(got) != "binary" {
+			t.Errorf("%s = %q, %v", name, got, err)
+		}
+	}
+	if info, err := os.Stat(filepath.Join(dest, "bin/python")); err != nil || info.Mode().Perm() != 0o755 {
+		t.Errorf("bin/python mode = %v, %v; want 0755", info.Mode(), err)
+	}
+}
+
+func TestExtractArchiveRejects(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []tarEntry
+	}{
+		{"traversal", []tarEntry{tarFile("../escape.txt", "x")}},
+		{"absolute path", []tarEntry{tarFile("/tmp/escape.txt", "x")}},
+		{"absolute symlink", []tarEntry{tarSymlink("link", "/etc")}},
+		{"escaping symlink", []tarEntry{tarSymlink("a/link", "../../outside")}},
+		{"hard link outside", []tarEntry{tarHardlink("link", "../outside")}},
+		{"device", []tarEntry{{hdr: tar.Header{Name: "null", Typeflag: tar.TypeChar}}}},
+		// A symlink to a directory followed by a file written through it must not escape.
+		{"write through symlink", []tarEntry{tarSymlink("dir", "."), tarFile("dir/../../escape.txt", "x")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parent := t.TempDir()
+			dest := filepath.Join(parent, "dest")
+			if err := ExtractArchive(tarEntries(t, tt.entries...), dest); err == nil {
+				t.Fatal("extracted an unsafe archive")
+			}
+			if _, err := os.Stat(filepath.Join(parent, "escape.txt")); err == nil {
+				t.Error("archive wrote outside the destination")
+			}
+		})
+	}
+}
+
+func TestExtractArchiveSymlinkedDirectory(t *testing.T) {
+	// A directory symlink already in dest that leads outside it must not be written through.
+	parent := t.TempDir()
+	dest := filepath.Join(parent, "dest")
+	outside := filepath.Join(parent, "outside")
+	if err := os.Mkdir(outside, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(dest, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(dest, "lib")); err != nil {
+		t.Fatal(err)
+	}
+	err := ExtractArchive(tarEntries(t, tarFile("lib/evil.txt", "x")), dest)
+	if err == nil {
+		t.Error("wrote through a pre-existing symlink that leaves the destination")
+	}
+	if _, err := os.Stat(filepath.Join(outside, "evil.txt")); err == nil {
+		t.Error("archive wrote outside the destination")
+	}
+}
+
+func TestExtractArchiveTruncatesExisting(t *testing.T) {
+	dest := t.TempDir()
+	target := filepath.Join(dest, "a.txt")
+	if err := os.WriteFile(target, []byte("a much longer previous version"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ExtractArchive(tarEntries(t, tarFile("a.txt", "new")), dest); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(target)
+	if err != nil || string(got) != "new" {
+		t.Errorf("a.txt = %q, %v; want %q", got, err, "new")
+	}
+	if info, _ := os.Stat(target); info.Mode().Perm() != 0o644 {
+		t.Errorf("a.txt mode = %v, want 0644", info.Mode().Perm())
+	}
+}
+
+func TestExtractArchiveReplacesSymlink(t *testing.T) {
+	// A regular file entry over an existing symlink replaces the link instead of writing
+	// through it.
+	parent := t.TempDir()
+	dest := filepath.Join(parent, "dest")
+	victim := filepath.Join(parent, "victim.txt")
+	if err := os.WriteFile(victim, []byte("keep"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(dest, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(victim, filepath.Join(dest, "a.txt")); err != nil {
+		t.Fatal(err)
+	}
+	if err := ExtractArchive(tarEntries(t, tarFile("a.txt", "new")), dest); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(victim); string(got) != "keep" {
+		t.Errorf("victim = %q, the extractor wrote through a symlink", got)
+	}
+	if info, err := os.Lstat(filepath.Join(dest, "a.txt")); err != nil || !info.Mode().IsRegular() {
+		t.Errorf("a.txt is not a regular file: %v", err)
+	}
+}
+
+func TestExtractTarLimits(t *testing.T) {
+	data := tarEntries(t, tarFile("a", strings.Repeat("a", 10)), tarFile("b", strings.Repeat("b", 10)), tarFile("c", "c"))
+	tests := []struct {
+		name   string
+		limits ExtractLimits
+		want   string
+	}{
+		{"none", ExtractLimits{}, ""},
+		{"entries", ExtractLimits{MaxEntries: 2}, "more than 2 entries"},
+		{"file size", ExtractLimits{MaxFileSize: 5}, "over the 5 byte limit"},
+		{"total size", ExtractLimits{MaxTotalSize: 15}, "more than 15 bytes"},
+		{"within", ExtractLimits{MaxEntries: 3, MaxFileSize: 10, MaxTotalSize: 21}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := extractTar(bytes.NewReader(data), t.TempDir(), tt.limits, nil, nil)
+			if tt.want == "" && err != nil {
+				t.Fatal(err)
+			}
+			if tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)) {
+				t.Fatalf("err = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtractArchiveSelected(t *testing.T) {
+	dest := t.TempDir()
+	data := tarEntries(t, tarFile("keep/a.txt", "a"), tarFile("skip/b.txt", "b"))
+	keep := func(name string) bool { return strings.HasPrefix(name, "keep/") }
+	if err := extractArchiveSelected(data, dest, keep, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dest, "keep/a.txt")); err != nil {
+		t.Error(err)
+	}
+	if _, err := os.Stat(filepath.Join(dest, "skip")); err == nil {
+		t.Error("extracted an entry keep rejected")
+	}
+}
@@ -0,0 +1,235 @@
+package gorunpython
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// Just enough FlatBuffers to read and write Arrow IPC metadata. Objects are laid out front to
+// back: a table comes first and the strings, vectors and tables it refers to follow it, so
+// every offset points forward as the format requires.
+
+// fbValue is a table field or vector element.
+type fbValue interface{}
+
+type (
+	// fbScalar is a fixed-size little-endian scalar field.
+	fbScalar struct {
+		size int
+		v    uint64
+	}
+	// fbTable holds fields by index; nil fields are left out.
+	fbTable []fbValue
+	// fbString is a string field.
+	fbString string
+	// fbTables is a vector of tables.
+	fbTables []fbTable
+	// fbStructs is a vector of structs of size bytes each, aligned to align.
+	fbStructs struct {
+		size, align int
+		data        []byte
+	}
+)
+
+func fbInt8(v uint8) fbScalar  { return fbScalar{1, uint64(v)} }
+func fbInt16(v int16) fbScalar { return fbScalar{2, uint64(uint16(v))} }
+func fbInt32(v int32) fbScalar { return fbScalar{4, uint64(uint32(v))} }
+func fbInt64(v int64) fbScalar { return fbScalar{8, uint64(v)} }
+func fbBool(v bool) fbScalar {
+	if v {
+		return fbInt8(1)
+	}
+	return fbInt8(0)
+}
+
+type fbBuilder struct{ b []byte }
+
+// fbBuild serializes root as a finished buffer.
+func fbBuild(root fbTable) []byte {
+	w := &fbBuilder{b: make([]byte, 4, 256)}
+	pos := w.object(root)
+	binary.LittleEndian.PutUint32(w.b, uint32(pos))
+	return w.b
+}
+
+func (w *fbBuilder) pad(align int) {
+	for len(w.b)%align != 0 {
+		w.b = append(w.b, 0)
+	}
+}
+
+func (w *fbBuilder) u32(v uint32) int {
+	pos := len(w.b)
+	w.b = binary.LittleEndian.AppendUint32(w.b, v)
+	return pos
+}
+
+// object writes v and returns its position.
+func (w *fbBuilder) object(v fbValue) int {
+	switch v := v.(type) {
+	case fbTable:
+		return w.table(v)
+	case fbString:
+		w.pad(4)
+		pos := w.u32(uint32(len(v)))
+		w.b = append(append(w.b, v...), 0)
+		return pos
+	case fbTables:
+		w.pad(4)
+		pos := w.u32(uint32(len(v)))
+		slots := len(w.b)
+		w.b = append(w.b, make([]byte, 4*len(v))...)
+		for i, t := range v {
+			w.patch(slots+4*i, w.table(t))
+		}
+		return pos
+	case fbStructs:
+		for (len(w.b)+4)%v.align != 0 {
+			w.b = append(w.b, 0)
+		}
+		pos := w.u32(uint32(len(v.data) / v.size))
+		w.b = append(w.b, v.data...)
+		return pos
+	}
+	panic("flatbuffers: unsupported value")
+}
+
+// patch points the offset at slot to target.
+func (w *fbBuilder) patch(slot, target int) {
+	binary.LittleEndian.PutUint32(w.b[slot:], uint32(target-slot))
+}
+
+func (w *fbBuilder) table(t fbTable) int {
+	// The vtable goes first, then the table: soffset, then fields in order, each aligned
+	w.pad(2)
+	vtable := len(w.b)
+	w.b = append(w.b, make([]byte, 4+2*len(t))...)
+	w.pad(8)
+	start := w.u32(0)
+	binary.LittleEndian.PutUint32(w.b[start:], uint32(int32(start-vtable)))
+
+	type ref struct {
+		slot int
+		v    fbValue
+	}
+	var refs []ref
+	for i, f := range t {
+		if f == nil {
+			continue
+		}
+		size := 4
+		if s, ok := f.(fbScalar); ok {
+			size = s.size
+		}
+		w.pad(size)
+		binary.LittleEndian.PutUint16(w.b[vtable+4+2*i:], uint16(len(w.b)-start))
+		if s, ok := f.(fbScalar); ok {
+			var buf [8]byte
+			binary.LittleEndian.PutUint64(buf[:], s.v)
+			w.b = append(w.b, buf[:size]...)
+		} else {
+			refs = append(refs, ref{w.u32(0), f})
+		}
+	}
+	binary.LittleEndian.PutUint16(w.b[vtable:], uint16(4+2*len(t)))
+	binary.LittleEndian.PutUint16(w.b[vtable+2:], uint16(len(w.b)-start))
+
+	for _, r := range refs {
+		w.patch(r.slot, w.object(r.v))
+	}
+	return start
+}
+
+var errFlatbuffer = errors.New("malformed flatbuffer")
+
+// fbReader reads tables from a finished buffer. Out-of-range reads panic with errFlatbuffer,
+// which fbRead turns back into an error.
+type fbReader []byte
+
+// fbRead calls fn with the root table of buf, recovering from malformed input.
+func fbRead(buf []byte, fn func(r fbReader, root int) error) (err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			if e != errFlatbuffer {
+				panic(e)
+			}
+			err = errFlatbuffer
+		}
+	}()
+	r := fbReader(buf)
+	return fn(r, r.deref(0))
+}
+
+func (r fbReader) check(pos, n int) {
+	if pos < 0 || n < 0 || pos+n > len(r) || pos+n < pos {
+		panic(errFlatbuffer)
+	}
+}
+
+func (r fbReader) u16(pos int) uint16 { r.check(pos, 2); return binary.LittleEndian.Uint16(r[pos:]) }
+func (r fbReader) u32(pos int) uint32 { r.check(pos, 4); return binary.LittleEndian.Uint32(r[pos:]) }
+func (r fbReader) u64(pos int) uint64 { r.check(pos, 8); return binary.LittleEndian.Uint64(r[pos:]) }
+
+// deref follows the offset stored at pos.
+func (r fbReader) deref(pos int) int { return pos + int(r.u32(pos)) }
+
+// field returns the position of field i of the table at t, or 0 if it is absent.
+func (r fbReader) field(t, i int) int {
+	vtable := t - int(int32(r.u32(t)))
+	if 4+2*i >= int(r.u16(vtable)) {
+		return 0
+	}
+	off := int(r.u16(vtable + 4 + 2*i))
+	if off == 0 {
+		return 0
+	}
+	return t + off
+}
+
+func (r fbReader) int(t, i, size int, def int64) int64 {
+	pos := r.field(t, i)
+	if pos == 0 {
+		return def
+	}
+	switch size {
+	case 1:
+		r.check(pos, 1)
+		return int64(r[pos])
+	case 2:
+		return int64(int16(r.u16(pos)))
+	case 4:
+		return int64(int32(r.u32(pos)))
+	}
+	return int64(r.u64(pos))
+}
+
+// ref returns the position of the object field i refers to, or 0.
+func (r fbReader) ref(t, i int) int {
+	pos := r.field(t, i)
+	if pos == 0 {
+		return 0
+	}
+	return r.deref(pos)
+}
+
+func (r fbReader) string(t, i int) string {
+	pos := r.ref(t, i)
+	if pos == 0 {
+		return ""
+	}
+	n := int(r.u32(pos))
+	r.check(pos+4, n)
+	return string(r[pos+4 : pos+4+n])
+}
+
+// vector returns the element count and first element position of the vector field i.
+func (r fbReader) vector(t, i int) (n, elems int) {
+	pos := r.ref(t, i)
+	if pos == 0 {
+		return 0, 0
+	}
+	// Every element takes at least a byte, which keeps n within the buffer
+	n = int(r.u32(pos))
+	r.check(pos+4, n)
+	return n, pos + 4
+}
@@ -1,3 +1,5 @@
 module github.com/ZacTyAdams/go-run-python/v2
 
 go 1.25.6
+
+require github.com/klauspost/compress v1.20.1
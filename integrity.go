@@ -0,0 +1,428 @@
+package gorunpython
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// manifestFileName is written at the root of every extracted tree.
+const manifestFileName = ".gorunpython-manifest.json"
+
+type treeManifest struct {
+	// Source is the key (see bundleKey) of the bundle the tree was extracted from, so repairs
+	// never mix files from a different bundle.
+	Source string `json:"source"`
+	// Stamp is the file system time the entries were recorded at. As in git's racy-clean
+	// check, a size and mtime match only vouches for a file's contents if its mtime is older.
+	Stamp   int64           `json:"stamp"`
+	Entries []manifestEntry `json:"entries"`
+}
+
+type manifestEntry struct {
+	Path    string `json:"path"`
+	Size    int64  `json:"size"`
+	ModTime int64  `json:"mtime"`
+	SHA256  string `json:"sha256,omitempty"`
+	Link    string `json:"link,omitempty"`
+}
+
+// unchanged reports whether got has the size, mtime and link recorded in e, and e was recorded
+// at least one file system clock tick after the file was last written.
+func (e manifestEntry) unchanged(got *manifestEntry, stamp int64) bool {
+	return got.Size == e.Size && got.ModTime == e.ModTime && got.Link == e.Link && e.ModTime < stamp
+}
+
+// IntegrityReport lists the files of an extracted tree that no longer match its manifest.
+type IntegrityReport struct {
+	Checked  int
+	Missing  []string
+	Modified []string
+}
+
+// OK reports whether every checked file matched the manifest.
+func (r *IntegrityReport) OK() bool {
+	return len(r.Missing) == 0 && len(r.Modified) == 0
+}
+
+func (r *IntegrityReport) damaged() []string {
+	return append(append([]string(nil), r.Missing...), r.Modified...)
+}
+
+func (r *IntegrityReport) String() string {
+	return fmt.Sprintf("%d files checked, %d missing, %d modified", r.Checked, len(r.Missing), len(r.Modified))
+}
+
+// Verify hashes every file recorded in the instance's manifest and reports the ones that are
+// missing or differ. Files added since the manifest was written (e.g. by pip) are not reported.
+func (p *pythonInstance) Verify() (*IntegrityReport, error) {
+	m, err := readManifest(p.ExtractionPath)
+	if err != nil {
+		return nil, err
+	}
+	if m == nil {
+		return nil, fmt.Errorf("no integrity manifest in %s", p.ExtractionPath)
+	}
+	return verifyManifest(p.ExtractionPath, m, true), nil
+}
+
+// Repair verifies the instance and re-extracts only the missing or modified files from the
+// embedded Python bundle. It returns the report of what was repaired.
+func (p *pythonInstance) Repair() (*IntegrityReport, error) {
+	report, err := p.Verify()
+	if err != nil {
+		return nil, err
+	}
+	if report.OK() {
+		return report, nil
+	}
+	m, err := readManifest(p.ExtractionPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.repair(m, report); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// checkKept makes sure a kept instance came from the instance's bundle and runs a quick size and
+// mtime check on it before it is reused, hashing only the files that look changed. A tree without
+// a manifest, or with one that has no hashes, is rejected rather than trusted as it is. Damaged
+// files are repaired when GORUNPYTHON_REPAIR is set; otherwise an error is returned so a fresh
+// copy is extracted instead.
+func (p *pythonInstance) checkKept() error {
+	m, err := readManifest(p.ExtractionPath)
+	if err != nil {
+		return err
+	}
+	if m == nil {
+		return errors.New("no integrity manifest")
+	}
+	if m.Source == "" || !m.hashed() {
+		return errors.New("integrity manifest has no content hashes")
+	}
+	if p.source == nil {
+		return errors.New("no bundle to check the instance against")
+	}
+	if _, key, err := p.readSource(); err != nil {
+		return err
+	} else if key != m.Source {
+		return fmt.Errorf("extracted from a different bundle than %s", p.source)
+	}
+	report := verifyManifest(p.ExtractionPath, m, false)
+	if report.OK() {
+		return nil
+	}
+	if repairKept == "" {
+		return fmt.Errorf("%s (set GORUNPYTHON_REPAIR to repair kept instances)", report)
+	}
+	fmt.Println("Repairing kept instance: ", report)
+	return p.repair(m, report)
+}
+
+// repair re-extracts the damaged files in report and runs the same setup on them as a fresh
+// extraction, after which every file must again match the hash m recorded for it. Files the
+// bundle can't restore, such as ones pip rewrote, make it fail rather than become the new
+// baseline.
+func (p *pythonInstance) repair(m *treeManifest, report *IntegrityReport) error {
+	if p.source == nil {
+		return errors.New("instance has no bundle to repair from")
+	}
+	data, key, err := p.readSource()
+	if err != nil {
+		return err
+	}
+	if m.Source != "" && m.Source != key {
+		return fmt.Errorf("instance was extracted from a different bundle than %s and cannot be repaired from it", p.source)
+	}
+
+	want := make(map[string]bool)
+	for _, name := range report.damaged() {
+		want[name] = true
+		if noisy != "" {
+			fmt.Println("Re-extracting: ", name)
+		}
+	}
+	if err := extractArchiveSelected(data, p.ExtractionPath, func(name string) bool { return want[name] }, nil); err != nil {
+		return fmt.Errorf("re-extract damaged files: %w", err)
+	}
+	layout, err := p.resolvedLayout()
+	if err != nil {
+		return err
+	}
+	if err := fixupExtractedTree(runtime.GOOS, p.ExtractionPath, layout); err != nil {
+		return err
+	}
+
+	stamp, err := fsNow(p.ExtractionPath)
+	if err != nil {
+		return err
+	}
+	if after := verifyManifest(p.ExtractionPath, m, true); !after.OK() {
+		return fmt.Errorf("repair left damaged files (%s): %s", after, strings.Join(after.damaged(), ", "))
+	}
+	// Everything matched its hash, so only the sizes and mtimes need updating.
+	for i, e := range m.Entries {
+		got, err := manifestEntryFor(filepath.Join(p.ExtractionPath, filepath.FromSlash(e.Path)), e.Path)
+		if err != nil || got == nil {
+			return fmt.Errorf("stat repaired file %s: %w", e.Path, err)
+		}
+		m.Entries[i].Size, m.Entries[i].ModTime = got.Size, got.ModTime
+	}
+	m.Stamp = stamp
+	return p.saveManifest(m)
+}
+
+// writeManifest records the size, modification time and sha256 of every file in the tree. Files
+// that prev (or, if prev is nil, the manifest already in the tree) shows to be unchanged keep
+// the hash recorded there; the others are hashed.
+func (p *pythonInstance) writeManifest(prev *treeManifest) error {
+	if prev == nil {
+		var err error
+		if prev, err = readManifest(p.ExtractionPath); err != nil {
+			prev = nil // rewritten from scratch below
+		}
+	}
+	m, err := buildManifest(p.ExtractionPath, prev)
+	if err != nil {
+		return err
+	}
+	if m.Source = p.sourceKey; m.Source == "" && p.source != nil {
+		if _, m.Source, err = p.readSource(); err != nil {
+			return err
+		}
+	}
+	return p.saveManifest(m)
+}
+
+func (p *pythonInstance) saveManifest(m *treeManifest) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return fmt.Errorf("encode integrity manifest: %w", err)
+	}
+	manifestPath := filepath.Join(p.ExtractionPath, manifestFileName)
+	tmp := manifestPath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("write integrity manifest: %w", err)
+	}
+	return os.Rename(tmp, manifestPath)
+}
+
+func readManifest(root string) (*treeManifest, error) {
+	data, err := os.ReadFile(filepath.Join(root, manifestFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read integrity manifest: %w", err)
+	}
+	var m treeManifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("decode integrity manifest: %w", err)
+	}
+	return &m, nil
+}
+
+// hashed reports whether every regular file in m has a recorded sha256.
+func (m *treeManifest) hashed() bool {
+	for _, e := range m.Entries {
+		if e.Link == "" && e.SHA256 == "" {
+			return false
+		}
+	}
+	return true
+}
+
+func buildManifest(root string, prev *treeManifest) (*treeManifest, error) {
+	known := map[string]manifestEntry{}
+	var prevStamp int64
+	if prev != nil {
+		for _, e := range prev.Entries {
+			known[e.Path] = e
+		}
+		prevStamp = prev.Stamp
+	}
+	stamp, err := fsNow(root)
+	if err != nil {
+		return nil, err
+	}
+	m := &treeManifest{Stamp: stamp}
+	err = filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel == manifestFileName || rel == manifestFileName+".tmp" || rel == ".keep" {
+			return nil
+		}
+		entry, err := manifestEntryFor(path, rel)
+		if err != nil || entry == nil {
+			return err
+		}
+		if entry.Link == "" {
+			if old, ok := known[rel]; ok && old.SHA256 != "" && old.unchanged(entry, prevStamp) {
+				entry.SHA256 = old.SHA256
+			} else if entry.SHA256, err = hashFile(path); err != nil {
+				return err
+			}
+		}
+		m.Entries = append(m.Entries, *entry)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("build integrity manifest: %w", err)
+	}
+	return m, nil
+}
+
+// manifestEntryFor describes the file at path without hashing it. It returns nil for entries the
+// manifest does not track (devices, sockets and so on).
+func manifestEntryFor(path, rel string) (*manifestEntry, error) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return nil, err
+	}
+	entry := &manifestEntry{Path: rel, Size: info.Size(), ModTime: info.ModTime().UnixNano()}
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		if entry.Link, err = os.Readlink(path); err != nil {
+			return nil, err
+		}
+	case info.Mode().IsRegular():
+	default:
+		return nil, nil
+	}
+	return entry, nil
+}
+
+// verifyManifest compares the tree with m. A full check hashes every file; a quick check only
+// hashes files whose size and mtime don't vouch for them. Files recorded without a sha256 can't
+// be checked and count as modified.
+func verifyManifest(root string, m *treeManifest, full bool) *IntegrityReport {
+	report := &IntegrityReport{}
+	for _, want := range m.Entries {
+		report.Checked++
+		path := filepath.Join(root, filepath.FromSlash(want.Path))
+		got, err := manifestEntryFor(path, want.Path)
+		if err != nil || got == nil {
+			report.Missing = append(report.Missing, want.Path)
+			continue
+		}
+		if got.Link != want.Link || got.Size != want.Size || (want.Link == "" && want.SHA256 == "") {
+			report.Modified = append(report.Modified, want.Path)
+			continue
+		}
+		if want.Link != "" || (!full && want.unchanged(got, m.Stamp)) {
+			continue
+		}
+		sum, err := hashFile(path)
+		if err != nil || sum != want.SHA256 {
+			report.Modified = append(report.Modified, want.Path)
+		}
+	}
+	return report
+}
+
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// fsNow returns the current time of dir's file system clock, which can lag the wall clock and
+// is what file mtimes are compared against.
+func fsNow(dir string) (int64, error) {
+	f, err := os.CreateTemp(dir, ".stamp")
+	if err != nil {
+		return 0, fmt.Errorf("read file system time: %w", err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return 0, fmt.Errorf("read file system time: %w", err)
+	}
+	return info.ModTime().UnixNano(), nil
+}
+
+// extractRecord collects a manifest entry for every file an extraction writes, hashing contents
+// as they are written so the tree doesn't have to be read back. A nil record collects nothing.
+type extractRecord struct {
+	mu      sync.Mutex
+	entries map[string]manifestEntry
+}
+
+func newExtractRecord() *extractRecord {
+	return &extractRecord{entries: make(map[string]manifestEntry)}
+}
+
+func (r *extractRecord) add(e manifestEntry) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries[e.Path] = e
+}
+
+// link records name as a hard link to the already extracted target.
+func (r *extractRecord) link(name, target string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if e, ok := r.entries[target]; ok {
+		e.Path = name
+		r.entries[name] = e
+	}
+}
+
+// manifest returns what was recorded as a manifest stamped now, for writeManifest to take hashes
+// from. It must be called before anything else touches the tree.
+func (r *extractRecord) manifest(root string) (*treeManifest, error) {
+	stamp, err := fsNow(root)
+	if err != nil {
+		return nil, err
+	}
+	m := &treeManifest{Stamp: stamp}
+	for _, e := range r.entries {
+		m.Entries = append(m.Entries, e)
+	}
+	return m, nil
+}
+
+// readSource reads the instance's bundle and returns it with its key, which is cached.
+func (p *pythonInstance) readSource() ([]byte, string, error) {
+	data, err := p.source.ReadBundle()
+	if err != nil {
+		return nil, "", err
+	}
+	if p.sourceKey == "" {
+		p.sourceKey = bundleKey(data)
+	}
+	return data, p.sourceKey, nil
+}
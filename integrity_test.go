@@ -0,0 +1,359 @@
+package gorunpython
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// manifestTree writes files under a fresh directory and returns an instance rooted there. The
+// files are dated an hour back, so a manifest written now can vouch for them by size and mtime.
+func manifestTree(t *testing.T, files map[string]string) *pythonInstance {
+	t.Helper()
+	dir := writeTree(t, "tree", files)
+	earlier := time.Now().Add(-time.Hour)
+	for rel := range files {
+		if err := os.Chtimes(filepath.Join(dir, filepath.FromSlash(rel)), earlier, earlier); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return &pythonInstance{ExtractionPath: dir, source: BundleFromBytes([]byte("bundle"))}
+}
+
+// editKeepingMtime rewrites the file at path without changing its modification time.
+func editKeepingMtime(t *testing.T, path, body string) {
+	t.Helper()
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(body), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, info.ModTime(), info.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerifyManifest(t *testing.T) {
+	later := time.Now().Add(time.Hour)
+	tests := []struct {
+		name     string
+		change   func(t *testing.T, dir string)
+		full     bool
+		missing  []string
+		modified []string
+	}{
+		{name: "intact", change: func(*testing.T, string) {}},
+		{name: "removed", change: func(t *testing.T, dir string) { os.Remove(filepath.Join(dir, "a.py")) }, missing: []string{"a.py"}},
+		{name: "resized", change: func(t *testing.T, dir string) { os.WriteFile(filepath.Join(dir, "a.py"), []byte("longer"), 0o644) }, modified: []string{"a.py"}},
+		{name: "touched", change: func(t *testing.T, dir string) { os.Chtimes(filepath.Join(dir, "a.py"), later, later) }},
+		{name: "touched and edited", change: func(t *testing.T, dir string) {
+			os.WriteFile(filepath.Join(dir, "a.py"), []byte("b"), 0o644)
+		}, modified: []string{"a.py"}},
+		{name: "same size edit, quick", change: func(t *testing.T, dir string) {
+			editKeepingMtime(t, filepath.Join(dir, "a.py"), "b")
+		}},
+		{name: "same size edit, full", full: true, change: func(t *testing.T, dir string) {
+			editKeepingMtime(t, filepath.Join(dir, "a.py"), "b")
+		}, modified: []string{"a.py"}},
+		{name: "relinked", change: func(t *testing.T, dir string) {
+			os.Remove(filepath.Join(dir, "link"))
+			os.Symlink("b.py", filepath.Join(dir, "link"))
+		}, modified: []string{"link"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := manifestTree(t, map[string]string{"a.py": "a", "b.py": "bb"})
+			if err := os.Symlink("a.py", filepath.Join(p.ExtractionPath, "link")); err != nil {
+				t.Fatal(err)
+			}
+			if err := p.writeManifest(nil); err != nil {
+				t.Fatal(err)
+			}
+			m, err := readManifest(p.ExtractionPath)
+			if err != nil || m == nil {
+				t.Fatalf("readManifest = %v, %v", m, err)
+			}
+			tt.change(t, p.ExtractionPath)
+			report := verifyManifest(p.ExtractionPath, m, tt.full)
+			if report.Checked != 3 || strings.Join(report.Missing, ",") != strings.Join(tt.missing, ",") ||
+				strings.Join(report.Modified, ",") != strings.Join(tt.modified, ",") {
+				t.Errorf("report = %+v, want missing %v, modified %v", report, tt.missing, tt.modified)
+			}
+		})
+	}
+}
+
+func TestVerifyManifestRacyEntries(t *testing.T) {
+	p := manifestTree(t, map[string]string{"a.py": "a"})
+	if err := p.writeManifest(nil); err != nil {
+		t.Fatal(err)
+	}
+	m, err := readManifest(p.ExtractionPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	editKeepingMtime(t, filepath.Join(p.ExtractionPath, "a.py"), "b")
+
+	// An entry written in the same clock tick as the manifest can't be vouched for by its mtime.
+	m.Stamp = m.Entries[0].ModTime
+	if report := verifyManifest(p.ExtractionPath, m, false); strings.Join(report.Modified, ",") != "a.py" {
+		t.Errorf("quick check of a racy entry = %+v, want a.py modified", report)
+	}
+	// Nor can an entry without a hash.
+	m.Stamp, m.Entries[0].SHA256 = time.Now().UnixNano(), ""
+	if report := verifyManifest(p.ExtractionPath, m, false); strings.Join(report.Modified, ",") != "a.py" {
+		t.Errorf("quick check of an unhashed entry = %+v, want a.py modified", report)
+	}
+}
+
+func TestWriteManifestKeepsHashes(t *testing.T) {
+	p := manifestTree(t, map[string]string{"a.py": "a", "b.py": "b"})
+	if err := p.writeManifest(nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(p.ExtractionPath, "b.py"), []byte("changed"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(p.ExtractionPath, "c.py"), []byte("new"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// A same-size edit that keeps the mtime is not noticed; the old hash is kept, so a full
+	// check still reports it.
+	editKeepingMtime(t, filepath.Join(p.ExtractionPath, "a.py"), "z")
+	if err := p.writeManifest(nil); err != nil {
+		t.Fatal(err)
+	}
+	m, err := readManifest(p.ExtractionPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Entries) != 3 || !m.hashed() {
+		t.Fatalf("entries = %+v, want three hashed files", m.Entries)
+	}
+	if m.Source != bundleKey([]byte("bundle")) {
+		t.Errorf("source = %q, want the bundle key", m.Source)
+	}
+	if report := verifyManifest(p.ExtractionPath, m, true); strings.Join(report.Modified, ",") != "a.py" {
+		t.Errorf("full check = %+v, want a.py modified", report)
+	}
+}
+
+func TestBuildManifestHashesRacyEntries(t *testing.T) {
+	p := manifestTree(t, map[string]string{"a.py": "a"})
+	path := filepath.Join(p.ExtractionPath, "a.py")
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := hashFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prev := &treeManifest{Entries: []manifestEntry{{Path: "a.py", Size: 1, ModTime: info.ModTime().UnixNano(), SHA256: "stale"}}}
+	for _, tt := range []struct {
+		stamp int64
+		want  string
+	}{
+		{info.ModTime().UnixNano() + 1, "stale"},
+		{info.ModTime().UnixNano(), want},
+	} {
+		prev.Stamp = tt.stamp
+		m, err := buildManifest(p.ExtractionPath, prev)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(m.Entries) != 1 || m.Entries[0].SHA256 != tt.want {
+			t.Errorf("stamp %d: entries = %+v, want sha256 %s", tt.stamp, m.Entries, tt.want)
+		}
+	}
+}
+
+func TestExtractRecord(t *testing.T) {
+	tarball := tarEntries(t, tarFile("lib/a.py", "alpha"), tarFile("lib/empty.py", ""), tarHardlink("lib/b.py", "lib/a.py"), tarSymlink("lib/c.py", "a.py"))
+	for name, data := range map[string][]byte{
+		"tarball": tarball,
+		"bundle":  convertToBundle(t, tarball, BundleOptions{}),
+	} {
+		t.Run(name, func(t *testing.T) {
+			dest := t.TempDir()
+			rec := newExtractRecord()
+			if err := extractArchiveSelected(data, dest, nil, rec); err != nil {
+				t.Fatal(err)
+			}
+			if len(rec.entries) != 3 {
+				t.Errorf("recorded %d files, want 3: %+v", len(rec.entries), rec.entries)
+			}
+			for rel, e := range rec.entries {
+				path := filepath.Join(dest, filepath.FromSlash(rel))
+				sum, err := hashFile(path)
+				got, _ := manifestEntryFor(path, rel)
+				if err != nil || e.SHA256 != sum || got == nil || got.Size != e.Size || got.ModTime != e.ModTime {
+					t.Errorf("%s recorded as %+v, is %+v with sha256 %s", rel, e, got, sum)
+				}
+			}
+		})
+	}
+}
+
+func TestVerify(t *testing.T) {
+	p := manifestTree(t, map[string]string{"a.py": "a", "lib/b.py": "b"})
+	if _, err := p.Verify(); err == nil {
+		t.Error("Verify without a manifest succeeded")
+	}
+	if err := p.writeManifest(nil); err != nil {
+		t.Fatal(err)
+	}
+	// Files added later are not tracked.
+	if err := os.WriteFile(filepath.Join(p.ExtractionPath, "new.py"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if report, err := p.Verify(); err != nil || !report.OK() || report.Checked != 2 {
+		t.Errorf("Verify = %v, %v", report, err)
+	}
+	// Verify compares contents, and doesn't take a tampered tree as the new baseline.
+	editKeepingMtime(t, filepath.Join(p.ExtractionPath, "lib/b.py"), "c")
+	for range 2 {
+		if report, err := p.Verify(); err != nil || strings.Join(report.Modified, ",") != "lib/b.py" {
+			t.Errorf("Verify after an edit = %v, %v", report, err)
+		}
+	}
+}
+
+// extractedTestTree extracts a bundle of files into a fresh directory the way
+// CreatePythonInstanceFromBundle does, and returns an instance for it with a manifest.
+func extractedTestTree(t *testing.T, files map[string]string) *pythonInstance {
+	t.Helper()
+	data := tarOf(t, files)
+	dir := filepath.Join(t.TempDir(), "python-tmp")
+	rec := newExtractRecord()
+	if err := extractArchiveSelected(data, dir, nil, rec); err != nil {
+		t.Fatal(err)
+	}
+	extracted, err := rec.manifest(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	layout, err := extractedLayout(runtime.GOOS, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fixupExtractedTree(runtime.GOOS, dir, layout); err != nil {
+		t.Fatal(err)
+	}
+	p := &pythonInstance{ExtractionPath: dir, ExecutablesPath: layout.BinDir, layout: layout, source: BundleFromBytes(data)}
+	if err := p.writeManifest(extracted); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestRepair(t *testing.T) {
+	prefix := "python"
+	if runtime.GOOS == "darwin" || runtime.GOOS == "android" {
+		prefix = "prefix"
+	}
+	files := map[string]string{
+		prefix + "/bin/python3.14":       "not really python",
+		prefix + "/bin/tool":             "#!/build/python/bin/python3.14\nprint('tool')\n",
+		prefix + "/lib/python3.14/os.py": "import sys\n",
+	}
+	p := extractedTestTree(t, files)
+	if report, err := p.Verify(); err != nil || !report.OK() {
+		t.Fatalf("fresh tree: Verify = %v, %v", report, err)
+	}
+
+	// Damaged files are restored and set up again, and must then match the manifest.
+	os.Remove(filepath.Join(p.ExtractionPath, prefix, "bin", "tool"))
+	editKeepingMtime(t, filepath.Join(p.ExtractionPath, prefix, "lib", "python3.14", "os.py"), "import os\n")
+	report, err := p.Repair()
+	if err != nil || len(report.damaged()) != 2 {
+		t.Fatalf("Repair = %v, %v", report, err)
+	}
+	if report, err := p.Verify(); err != nil || !report.OK() {
+		t.Fatalf("after repair: Verify = %v, %v", report, err)
+	}
+
+	// A file the manifest records with contents the bundle doesn't have (as after a pip
+	// upgrade) can't be repaired, and the failure is not recorded as the new baseline.
+	osPath := filepath.Join(p.ExtractionPath, prefix, "lib", "python3.14", "os.py")
+	if err := os.WriteFile(osPath, []byte("upgraded\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.writeManifest(nil); err != nil {
+		t.Fatal(err)
+	}
+	os.Remove(osPath)
+	if _, err := p.Repair(); err == nil || !strings.Contains(err.Error(), "os.py") {
+		t.Errorf("Repair of a file the bundle can't restore = %v", err)
+	}
+	if report, err := p.Verify(); err != nil || strings.Join(report.Modified, ",") != prefix+"/lib/python3.14/os.py" {
+		t.Errorf("after a failed repair: Verify = %v, %v", report, err)
+	}
+}
+
+func TestCheckKept(t *testing.T) {
+	p := manifestTree(t, map[string]string{"a.py": "a"})
+	if err := p.checkKept(); err == nil {
+		t.Error("checkKept trusted a tree without a manifest")
+	}
+	if err := p.writeManifest(nil); err != nil {
+		t.Fatal(err)
+	}
+	kept := &pythonInstance{ExtractionPath: p.ExtractionPath, source: BundleFromBytes([]byte("another bundle"))}
+	if err := kept.checkKept(); err == nil || !strings.Contains(err.Error(), "different bundle") {
+		t.Errorf("checkKept = %v, want a different bundle error", err)
+	}
+	same := &pythonInstance{ExtractionPath: p.ExtractionPath, source: BundleFromBytes([]byte("bundle"))}
+	if err := same.checkKept(); err != nil {
+		t.Errorf("checkKept = %v", err)
+	}
+
+	m, err := readManifest(p.ExtractionPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Entries[0].SHA256 = ""
+	if err := p.saveManifest(m); err != nil {
+		t.Fatal(err)
+	}
+	if err := same.checkKept(); err == nil {
+		t.Error("checkKept trusted a manifest without hashes")
+	}
+}
+
+func TestBundleKey(t *testing.T) {
+	big := []byte(strings.Repeat("x", 1<<20))
+	edited := append([]byte(nil), big...)
+	edited[len(edited)/2] = 'y'
+	withManifest := tarOf(t, map[string]string{BundleManifestName: `{"version":"3.14","layout":{"bin":"p/bin","interpreter":"p/bin/python3"},"sha256":"abc"}`})
+
+	if bundleKey(big) == bundleKey(edited) {
+		t.Error("bundles differing in the middle share a key")
+	}
+	if bundleKey(big) == bundleKey(big[:len(big)-1]) {
+		t.Error("bundles of different sizes share a key")
+	}
+	if got := bundleKey(withManifest); got != "tree:abc" {
+		t.Errorf("bundleKey = %q, want the manifest digest", got)
+	}
+}
+
+func TestCreatePythonInstanceFromBundleErrors(t *testing.T) {
+	t.Chdir(t.TempDir())
+	for _, data := range [][]byte{
+		[]byte("not a bundle"),
+		tarOf(t, map[string]string{"README": "no python here"}),
+	} {
+		if _, err := CreatePythonInstanceFromBundle(BundleFromBytes(data)); err == nil {
+			t.Error("created an instance from a bundle without python")
+		}
+	}
+	if left, _ := filepath.Glob("python-tmp*"); len(left) != 0 {
+		t.Errorf("failed creates left %v behind", left)
+	}
+}
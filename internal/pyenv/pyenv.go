@@ -0,0 +1,87 @@
+// Package pyenv is the environment isolation profile shared by gorunpython and python-launcher.
+// It keeps the host's Python configuration out of the bundled interpreter: PYTHON* variables
+// that change where code is imported from are removed, user site-packages are disabled and the
+// locale is pinned, so the same program behaves the same on every machine.
+package pyenv
+
+import "strings"
+
+// PassthroughEnvVar lists, comma separated, variables the profile leaves alone, e.g.
+// "PYTHONPATH,LC_ALL". "*" turns the profile off.
+const PassthroughEnvVar = "GORUNPYTHON_ENV_PASSTHROUGH"
+
+// Pinned are set to these values whatever the host has.
+var Pinned = []struct{ Name, Value string }{
+	{"PYTHONNOUSERSITE", "1"},
+	{"PYTHONSAFEPATH", "1"},
+	{"LC_ALL", "C.UTF-8"},
+	{"LANG", "C.UTF-8"},
+}
+
+// Kept are PYTHON* variables that only affect output and diagnostics, not what gets imported, so
+// they are passed through.
+var Kept = map[string]bool{
+	"PYTHONUNBUFFERED":        true,
+	"PYTHONIOENCODING":        true,
+	"PYTHONUTF8":              true,
+	"PYTHONDONTWRITEBYTECODE": true,
+	"PYTHONPYCACHEPREFIX":     true,
+	"PYTHONHASHSEED":          true,
+	"PYTHONWARNINGS":          true,
+	"PYTHONFAULTHANDLER":      true,
+	"PYTHONDEVMODE":           true,
+	"PYTHONTRACEMALLOC":       true,
+	"PYTHONVERBOSE":           true,
+}
+
+// Isolate applies the profile to env, leaving the variables named in passthrough as they are.
+func Isolate(env []string, passthrough []string) []string {
+	pass := map[string]bool{}
+	for _, name := range passthrough {
+		if name == "*" {
+			return env
+		}
+		pass[name] = true
+	}
+	pinned := map[string]bool{}
+	for _, v := range Pinned {
+		pinned[v.Name] = true
+	}
+
+	out := make([]string, 0, len(env)+len(Pinned))
+	for _, kv := range env {
+		name, _, _ := strings.Cut(kv, "=")
+		switch {
+		case pass[name]:
+		case pinned[name]:
+			continue
+		case strings.HasPrefix(name, "PYTHON") && !Kept[name]:
+			continue
+		}
+		out = append(out, kv)
+	}
+	for _, v := range Pinned {
+		if !pass[v.Name] {
+			out = append(out, v.Name+"="+v.Value)
+		}
+	}
+	return out
+}
+
+// Passthrough returns the names listed by PassthroughEnvVar in env.
+func Passthrough(env []string) []string {
+	var names []string
+	for _, kv := range env {
+		value, ok := strings.CutPrefix(kv, PassthroughEnvVar+"=")
+		if !ok {
+			continue
+		}
+		names = nil
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
@@ -0,0 +1,95 @@
+package pyenv
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestIsolate(t *testing.T) {
+	host := []string{
+		"PATH=/usr/bin",
+		"HOME=/home/u",
+		"PYTHONPATH=/host/site",
+		"PYTHONHOME=/usr",
+		"PYTHONSTARTUP=/home/u/.pythonrc",
+		"PYTHONUNBUFFERED=1",
+		"PYTHONNOUSERSITE=0",
+		"LC_ALL=de_DE.ISO-8859-1",
+		"LANG=de_DE",
+		"LC_CTYPE=de_DE",
+		"NOTPYTHONPATH=x",
+	}
+	tests := []struct {
+		name        string
+		passthrough []string
+		want        []string
+	}{
+		{
+			name: "default",
+			want: []string{
+				"PATH=/usr/bin", "HOME=/home/u", "PYTHONUNBUFFERED=1", "LC_CTYPE=de_DE", "NOTPYTHONPATH=x",
+				"PYTHONNOUSERSITE=1", "PYTHONSAFEPATH=1", "LC_ALL=C.UTF-8", "LANG=C.UTF-8",
+			},
+		},
+		{
+			name:        "passthrough",
+			passthrough: []string{"PYTHONPATH", "LC_ALL", "UNSET"},
+			want: []string{
+				"PATH=/usr/bin", "HOME=/home/u", "PYTHONPATH=/host/site", "PYTHONUNBUFFERED=1",
+				"LC_ALL=de_DE.ISO-8859-1", "LC_CTYPE=de_DE", "NOTPYTHONPATH=x",
+				"PYTHONNOUSERSITE=1", "PYTHONSAFEPATH=1", "LANG=C.UTF-8",
+			},
+		},
+		{
+			name:        "off",
+			passthrough: []string{"PYTHONPATH", "*"},
+			want:        host,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Isolate(slices.Clone(host), tt.passthrough); !slices.Equal(got, tt.want) {
+				t.Errorf("Isolate =\n%q\nwant\n%q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsolateKeepsDiagnostics(t *testing.T) {
+	for name := range Kept {
+		if !strings.HasPrefix(name, "PYTHON") {
+			t.Errorf("Kept lists %s, which the profile never removes", name)
+		}
+		if got := Isolate([]string{name + "=1"}, nil); got[0] != name+"=1" {
+			t.Errorf("Isolate removed %s", name)
+		}
+	}
+	for _, v := range Pinned {
+		if Kept[v.Name] {
+			t.Errorf("%s is both pinned and kept", v.Name)
+		}
+	}
+}
+
+func TestPassthrough(t *testing.T) {
+	tests := []struct {
+		env  []string
+		want []string
+	}{
+		{nil, nil},
+		{[]string{"PATH=/bin"}, nil},
+		{[]string{PassthroughEnvVar + "="}, nil},
+		{[]string{PassthroughEnvVar + "=PYTHONPATH"}, []string{"PYTHONPATH"}},
+		{[]string{PassthroughEnvVar + "= PYTHONPATH, ,LC_ALL ,"}, []string{"PYTHONPATH", "LC_ALL"}},
+		{[]string{PassthroughEnvVar + "=*"}, []string{"*"}},
+		// The last setting wins, as it does for the environment of a started process.
+		{[]string{PassthroughEnvVar + "=A", PassthroughEnvVar + "=B"}, []string{"B"}},
+		{[]string{PassthroughEnvVar + "X=A"}, nil},
+	}
+	for _, tt := range tests {
+		if got := Passthrough(tt.env); !slices.Equal(got, tt.want) {
+			t.Errorf("Passthrough(%q) = %q, want %q", tt.env, got, tt.want)
+		}
+	}
+}
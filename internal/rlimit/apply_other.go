@@ -0,0 +1,13 @@
+//go:build !unix
+
+package rlimit
+
+import "errors"
+
+// Apply fails: this platform has no setrlimit.
+func Apply(limits []Limit) error {
+	if len(limits) == 0 {
+		return nil
+	}
+	return errors.New("resource limits are not supported on this platform")
+}
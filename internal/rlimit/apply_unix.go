@@ -0,0 +1,26 @@
+//go:build unix
+
+package rlimit
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// Apply sets limits on the calling process.
+func Apply(limits []Limit) error {
+	for _, l := range limits {
+		var r syscall.Rlimit
+		setField(&r.Cur, l.Cur)
+		setField(&r.Max, l.Max)
+		if err := syscall.Setrlimit(l.Resource, &r); err != nil {
+			return fmt.Errorf("setrlimit %d: %w", l.Resource, err)
+		}
+	}
+	return nil
+}
+
+// setField stores v in an Rlimit field, which is signed on some systems.
+func setField[T ~int64 | ~uint64](field *T, v uint64) {
+	*field = T(v)
+}
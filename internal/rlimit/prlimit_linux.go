@@ -0,0 +1,19 @@
+package rlimit
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+// ApplyTo sets limits on the process pid with prlimit(2).
+func ApplyTo(pid int, limits []Limit) error {
+	for _, l := range limits {
+		r := syscall.Rlimit{Cur: l.Cur, Max: l.Max}
+		_, _, errno := syscall.RawSyscall6(syscall.SYS_PRLIMIT64, uintptr(pid), uintptr(l.Resource), uintptr(unsafe.Pointer(&r)), 0, 0, 0)
+		if errno != 0 {
+			return fmt.Errorf("prlimit %d on %d: %w", l.Resource, pid, errno)
+		}
+	}
+	return nil
+}
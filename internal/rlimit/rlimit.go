@@ -0,0 +1,58 @@
+// Package rlimit passes resource limits from gorunpython to python-launcher, which sets them on
+// itself just before it becomes python. Setting them from outside while a Go program is still
+// starting up can leave its runtime short of the address space it reserves. On Linux, processes
+// that aren't Go programs get them from outside with ApplyTo before running code of their own.
+package rlimit
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// EnvVar carries the encoded limits to the launcher.
+const EnvVar = "GORUNPYTHON_RLIMITS"
+
+// Limit is a setrlimit resource number with its soft and hard values.
+type Limit struct {
+	Resource int
+	Cur      uint64
+	Max      uint64
+}
+
+// Encode formats limits as "resource:cur:max,...".
+func Encode(limits []Limit) string {
+	parts := make([]string, len(limits))
+	for i, l := range limits {
+		parts[i] = fmt.Sprintf("%d:%d:%d", l.Resource, l.Cur, l.Max)
+	}
+	return strings.Join(parts, ",")
+}
+
+// Decode parses the output of Encode.
+func Decode(s string) ([]Limit, error) {
+	var limits []Limit
+	for _, part := range strings.Split(s, ",") {
+		if part == "" {
+			continue
+		}
+		fields := strings.Split(part, ":")
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("malformed limit %q", part)
+		}
+		resource, err := strconv.Atoi(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("malformed limit %q: %w", part, err)
+		}
+		cur, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("malformed limit %q: %w", part, err)
+		}
+		max, err := strconv.ParseUint(fields[2], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("malformed limit %q: %w", part, err)
+		}
+		limits = append(limits, Limit{resource, cur, max})
+	}
+	return limits, nil
+}
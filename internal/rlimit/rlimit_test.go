@@ -0,0 +1,31 @@
+package rlimit
+
+import (
+	"math"
+	"slices"
+	"testing"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	for _, limits := range [][]Limit{
+		nil,
+		{{Resource: 7, Cur: 64, Max: 64}},
+		{{Resource: 9, Cur: 1 << 30, Max: 1 << 30}, {Resource: 0, Cur: 2, Max: 3}, {Resource: 6, Cur: 0, Max: math.MaxUint64}},
+	} {
+		got, err := Decode(Encode(limits))
+		if err != nil || !slices.Equal(got, limits) {
+			t.Errorf("Decode(Encode(%v)) = %v, %v", limits, got, err)
+		}
+	}
+}
+
+func TestDecodeMalformed(t *testing.T) {
+	for _, s := range []string{"7", "7:1", "7:1:2:3", "x:1:2", "7:-1:2", "7:1:y", "7:1:18446744073709551616", "7:1:2,8"} {
+		if got, err := Decode(s); err == nil {
+			t.Errorf("Decode(%q) = %v, want an error", s, got)
+		}
+	}
+	if got, err := Decode(",7:1:2,"); err != nil || len(got) != 1 {
+		t.Errorf("Decode with empty parts = %v, %v", got, err)
+	}
+}
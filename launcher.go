@@ -0,0 +1,180 @@
+package gorunpython
+
+import (
+	"bytes"
+	"debug/elf"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// launcherName is the python-launcher installed in the bin directory of Linux trees. It runs the
+// bundled interpreter under the bundled loader and libraries, so console scripts pointed at it
+// work when other processes run them directly.
+const launcherName = "python-launcher"
+
+// installLauncher puts python-launcher in the tree's bin directory, unless the bundle shipped its
+// own, and returns its path. It returns "" when there is no launcher for this platform.
+func installLauncher(osName string, layout *pythonLayout) (string, error) {
+	if osName != "linux" {
+		return "", nil
+	}
+	path := filepath.Join(layout.BinDir, launcherName)
+	if _, err := os.Stat(path); err == nil {
+		return path, nil
+	}
+	if len(embeddedLauncher) == 0 {
+		return "", nil
+	}
+	if err := os.WriteFile(path, embeddedLauncher, 0o755); err != nil {
+		return "", fmt.Errorf("install %s: %w", launcherName, err)
+	}
+	if noisy != "" {
+		fmt.Println("Installed python launcher at: ", path)
+	}
+	return path, nil
+}
+
+// findLauncher returns the launcher installed in binDir, or "".
+func findLauncher(binDir string) string {
+	path := filepath.Join(binDir, launcherName)
+	if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
+		return path
+	}
+	return ""
+}
+
+// pointScriptsAtLauncher rewrites scripts in binDir whose interpreter is one of the python
+// executables there, such as console scripts written by pip, to run through launcher instead.
+// Only the interpreter line (or trampoline) is rewritten; the rest of the script is left as is.
+func pointScriptsAtLauncher(binDir string, launcher string) error {
+	entries, err := os.ReadDir(binDir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		p := filepath.Join(binDir, e.Name())
+		if !e.Type().IsRegular() || p == launcher || !isBundledPython(binDir, scriptInterpreter(p)) {
+			continue
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return fmt.Errorf("point %s at %s: %w", p, launcherName, err)
+		}
+		header, interp, args := scriptHeader(data)
+		if !isBundledPython(binDir, interp) {
+			continue
+		}
+		// WriteFile keeps the mode of an existing file.
+		if err := os.WriteFile(p, append([]byte(interpreterLine(launcher, args)), data[len(header):]...), 0o644); err != nil {
+			return fmt.Errorf("point %s at %s: %w", p, launcherName, err)
+		}
+		if noisy != "" {
+			fmt.Println("Pointed script at python launcher: ", p)
+		}
+	}
+	return nil
+}
+
+// isBundledPython reports whether path is a python executable in binDir.
+func isBundledPython(binDir string, path string) bool {
+	return path != "" && filepath.Dir(path) == binDir && strings.HasPrefix(filepath.Base(path), "python") &&
+		filepath.Base(path) != launcherName
+}
+
+// scriptInterpreter returns the interpreter a script at path runs with, or "" (see scriptHeader).
+func scriptInterpreter(path string) string {
+	prefix, err := readFilePrefix(path, 1024)
+	if err != nil {
+		return ""
+	}
+	_, interp, _ := scriptHeader(prefix)
+	return interp
+}
+
+// scriptHeader splits off the lines of a script that choose its interpreter: the "#!" line, or
+// all three lines of a "#!/bin/sh" trampoline as pip and relocateShebang write for long paths. It
+// returns them with the interpreter and its arguments, or interp "" if data is neither.
+func scriptHeader(data []byte) (header []byte, interp string, args []string) {
+	if !bytes.HasPrefix(data, []byte("#!")) {
+		return nil, "", nil
+	}
+	line := firstLine(data)
+	fields := strings.Fields(string(line[2:]))
+	if len(fields) == 0 {
+		return nil, "", nil
+	}
+	if fields[0] != "/bin/sh" {
+		return line, fields[0], fields[1:]
+	}
+
+	exec := firstLine(data[len(line):])
+	rest, ok := bytes.CutPrefix(exec, []byte("'''exec' "))
+	var end []byte
+	if ok {
+		end = firstLine(data[len(line)+len(exec):])
+	}
+	if !ok || !bytes.Equal(bytes.TrimRight(end, "\r\n"), []byte("' '''")) {
+		return nil, "", nil
+	}
+	interp, tail, ok := shellWord(strings.TrimRight(string(rest), "\r\n"))
+	if !ok {
+		return nil, "", nil
+	}
+	words := strings.Fields(tail)
+	if len(words) < 2 || words[len(words)-2] != `"$0"` || words[len(words)-1] != `"$@"` {
+		return nil, "", nil
+	}
+	return data[:len(line)+len(exec)+len(end)], interp, words[:len(words)-2]
+}
+
+// interpreterLine returns the "#!" line that runs interp with args, or a /bin/sh trampoline
+// when that would be too long for the kernel or interp contains whitespace.
+func interpreterLine(interp string, args []string) string {
+	line := strings.Join(append([]string{"#!" + interp}, args...), " ")
+	if len(line) <= maxShebangLength && !strings.ContainsAny(interp, " \t") {
+		return line + "\n"
+	}
+	return shTrampoline(interp, args)
+}
+
+// shellWord reads a word written by shellQuote, or an unquoted one, from the start of s.
+func shellWord(s string) (word, rest string, ok bool) {
+	if !strings.HasPrefix(s, `"`) {
+		word, rest, _ = strings.Cut(s, " ")
+		return word, rest, word != ""
+	}
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '"':
+			return b.String(), s[i+1:], true
+		case c == '\\' && i+1 < len(s) && strings.IndexByte(`\"$`+"`", s[i+1]) >= 0:
+			i++
+			b.WriteByte(s[i])
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", "", false
+}
+
+// launcherCommand returns how to run the executable at path with args: through launcher when
+// path is the bundled interpreter or a script that runs it, otherwise directly.
+func launcherCommand(launcher string, path string, args []string) (string, []string) {
+	if launcher == "" || path == launcher {
+		return path, args
+	}
+	binDir := filepath.Dir(launcher)
+	if isBundledPython(binDir, path) {
+		if f, err := elf.Open(path); err == nil {
+			f.Close()
+			return launcher, args
+		}
+	}
+	if interp := scriptInterpreter(path); interp == launcher || isBundledPython(binDir, interp) {
+		return launcher, append([]string{path}, args...)
+	}
+	return path, args
+}
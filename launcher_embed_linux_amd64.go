@@ -0,0 +1,10 @@
+//go:build linux && amd64
+
+package gorunpython
+
+import _ "embed"
+
+//go:generate sh -c "cd python-launcher && sh build_python_launcher_linux_x86-64.sh"
+
+//go:embed python-launcher/python-launcher-linux-amd64
+var embeddedLauncher []byte
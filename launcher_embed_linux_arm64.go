@@ -0,0 +1,10 @@
+//go:build linux && arm64 && !android
+
+package gorunpython
+
+import _ "embed"
+
+//go:generate sh -c "cd python-launcher && sh build_python_launcher_linux_arm64.sh"
+
+//go:embed python-launcher/python-launcher-linux-arm64
+var embeddedLauncher []byte
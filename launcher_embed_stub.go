@@ -0,0 +1,6 @@
+//go:build !(linux && amd64) && !(linux && arm64 && !android)
+
+package gorunpython
+
+// No launcher is built for this platform; bundles that ship their own are still used.
+var embeddedLauncher []byte
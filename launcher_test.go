@@ -0,0 +1,134 @@
+package gorunpython
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestScriptHeader(t *testing.T) {
+	body := "import sys\nprint(sys.argv)\n"
+	tests := []struct {
+		name   string
+		script string
+		interp string
+		args   []string
+	}{
+		{"shebang", "#!/p/bin/python3.14\n", "/p/bin/python3.14", nil},
+		{"shebang with args", "#!/p/bin/python3 -E -s\n", "/p/bin/python3", []string{"-E", "-s"}},
+		{"env", "#!/usr/bin/env python3\n", "/usr/bin/env", []string{"python3"}},
+		{"trampoline", "#!/bin/sh\n'''exec' \"/p q/bin/python3\" \"$0\" \"$@\"\n' '''\n", "/p q/bin/python3", nil},
+		{"trampoline with args", "#!/bin/sh\n'''exec' \"/p/bin/python3\" -E \"$0\" \"$@\"\n' '''\n", "/p/bin/python3", []string{"-E"}},
+		{"unquoted trampoline", "#!/bin/sh\n'''exec' /p/bin/python3 \"$0\" \"$@\"\n' '''\n", "/p/bin/python3", nil},
+		{"escaped trampoline", "#!/bin/sh\n'''exec' \"/p/\\$x\\\"/python3\" \"$0\" \"$@\"\n' '''\n", "/p/$x\"/python3", nil},
+		{"plain sh", "#!/bin/sh\necho hi\n", "", nil},
+		{"unterminated trampoline", "#!/bin/sh\n'''exec' \"/p/bin/python3\" \"$0\" \"$@\"\necho\n", "", nil},
+		{"unterminated quote", "#!/bin/sh\n'''exec' \"/p/bin/python3 \"$0\n' '''\n", "", nil},
+		{"empty shebang", "#!\n", "", nil},
+		{"no shebang", "print(1)\n", "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := []byte(tt.script + body)
+			header, interp, args := scriptHeader(data)
+			if interp != tt.interp || !slices.Equal(args, tt.args) {
+				t.Fatalf("scriptHeader = %q, %q; want %q, %q", interp, args, tt.interp, tt.args)
+			}
+			if interp != "" && string(header) != tt.script {
+				t.Errorf("header = %q, want %q", header, tt.script)
+			}
+		})
+	}
+}
+
+func TestInterpreterLineRoundTrip(t *testing.T) {
+	long := "/" + strings.Repeat("x", maxShebangLength) + "/python-launcher"
+	for _, interp := range []string{"/p/bin/python-launcher", "/p q/bin/python-launcher", long, "/p/$HOME\"`/python-launcher"} {
+		for _, args := range [][]string{nil, {"-E"}} {
+			line := interpreterLine(interp, args)
+			if strings.HasPrefix(line, "#!/bin/sh") != (interp == long || strings.Contains(interp, " ")) {
+				t.Errorf("interpreterLine(%q) = %q", interp, line)
+			}
+			if _, got, gotArgs := scriptHeader([]byte(line + "print(1)\n")); got != interp || !slices.Equal(gotArgs, args) {
+				t.Errorf("interpreterLine(%q, %q) reads back as %q, %q", interp, args, got, gotArgs)
+			}
+		}
+	}
+}
+
+func TestPointScriptsAtLauncher(t *testing.T) {
+	binDir := t.TempDir()
+	python := filepath.Join(binDir, "python3")
+	launcher := filepath.Join(binDir, launcherName)
+	other := filepath.Join(t.TempDir(), "python3")
+	body := "# " + python + " is the interpreter\nimport sys\n"
+	files := map[string]struct{ before, after string }{
+		"tool": {"#!" + python + "\n" + body, "#!" + launcher + "\n" + body},
+		// Only the whole interpreter token counts: python3.14 is not python3 followed by ".14".
+		"versioned":  {"#!" + python + ".14 -E\n" + body, "#!" + launcher + " -E\n" + body},
+		"trampoline": {"#!/bin/sh\n'''exec' \"" + python + "\" \"$0\" \"$@\"\n' '''\n" + body, "#!" + launcher + "\n" + body},
+		"foreign":    {"#!" + other + "\n" + body, ""},
+		"subdir":     {"#!" + filepath.Join(binDir, "sub", "python3") + "\n" + body, ""},
+		"env":        {"#!/usr/bin/env python3\n" + body, ""},
+		"data":       {"no interpreter " + python + "\n", ""},
+	}
+	for name, f := range files {
+		if err := os.WriteFile(filepath.Join(binDir, name), []byte(f.before), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	os.WriteFile(python+".14", nil, 0o755)
+	os.WriteFile(launcher, []byte("#!"+python+"\n"), 0o755)
+
+	for range 2 {
+		if err := pointScriptsAtLauncher(binDir, launcher); err != nil {
+			t.Fatal(err)
+		}
+		for name, f := range files {
+			want := f.after
+			if want == "" {
+				want = f.before
+			}
+			if got, _ := os.ReadFile(filepath.Join(binDir, name)); string(got) != want {
+				t.Errorf("%s:\n%s\nwant:\n%s", name, got, want)
+			}
+		}
+	}
+	if info, _ := os.Stat(filepath.Join(binDir, "tool")); info.Mode().Perm() != 0o755 {
+		t.Errorf("rewritten script mode = %v", info.Mode())
+	}
+	if got, _ := os.ReadFile(launcher); string(got) != "#!"+python+"\n" {
+		t.Error("the launcher itself was rewritten")
+	}
+}
+
+func TestLauncherCommand(t *testing.T) {
+	binDir := t.TempDir()
+	launcher := filepath.Join(binDir, launcherName)
+	script := filepath.Join(binDir, "tool")
+	os.WriteFile(script, []byte("#!"+launcher+"\nprint(1)\n"), 0o755)
+	pipScript := filepath.Join(binDir, "pip")
+	os.WriteFile(pipScript, []byte("#!"+filepath.Join(binDir, "python3")+"\nprint(1)\n"), 0o755)
+	shell := filepath.Join(binDir, "run.sh")
+	os.WriteFile(shell, []byte("#!/bin/sh\necho\n"), 0o755)
+
+	tests := []struct {
+		launcher, path string
+		wantPath       string
+		wantArgs       []string
+	}{
+		{"", script, script, []string{"a"}},
+		{launcher, launcher, launcher, []string{"a"}},
+		{launcher, script, launcher, []string{script, "a"}},
+		{launcher, pipScript, launcher, []string{pipScript, "a"}},
+		{launcher, shell, shell, []string{"a"}},
+	}
+	for _, tt := range tests {
+		path, args := launcherCommand(tt.launcher, tt.path, []string{"a"})
+		if path != tt.wantPath || !slices.Equal(args, tt.wantArgs) {
+			t.Errorf("launcherCommand(%q, %q) = %q, %q; want %q, %q", tt.launcher, tt.path, path, args, tt.wantPath, tt.wantArgs)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package gorunpython
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// pythonLayout locates the parts of an extracted Python installation.
+type pythonLayout struct {
+	// Version is the interpreter's major.minor version, with a "t" suffix for free-threaded builds.
+	Version     string
+	Prefix      string
+	BinDir      string
+	LibDir      string
+	Stdlib      string
+	DynLoad     string
+	Interpreter string
+	// Loader is the bundled dynamic loader named by the bundle manifest, if any.
+	Loader string
+}
+
+var stdlibDirPattern = regexp.MustCompile(`^python(\d+)\.(\d+)(t?)$`)
+
+// sysconfigPathsScript prints what detectLayout needs when the tree itself doesn't tell.
+const sysconfigPathsScript = `import json, sys, sysconfig
+p = sysconfig.get_paths()
+print(json.dumps({"version": sysconfig.get_python_version() + getattr(sys, "abiflags", "").replace("d", ""), "stdlib": p["stdlib"], "platstdlib": p["platstdlib"]}))`
+
+// extractedLayout returns the layout of a bundle extracted to dir: from its bundle manifest if it
+// has one, otherwise detected from the tree under the prefix older bundles use on osName.
+func extractedLayout(osName, dir string) (*pythonLayout, error) {
+	m, err := readBundleManifest(dir)
+	if err != nil {
+		return nil, err
+	}
+	if m != nil {
+		return m.pythonLayout(dir)
+	}
+	binDir := filepath.Join(dir, "python", "bin")
+	if osName == "darwin" || osName == "android" {
+		binDir = filepath.Join(dir, "prefix", "bin")
+	}
+	return detectLayout(binDir)
+}
+
+// detectLayout works out the layout of the installation whose executables are in binDir. The
+// version and standard library come from the lib/pythonX.Y directory of the tree (the newest,
+// if there are several); a tree without one is asked through sysconfig instead.
+func detectLayout(binDir string) (*pythonLayout, error) {
+	prefix := filepath.Dir(binDir)
+	l := &pythonLayout{Prefix: prefix, BinDir: binDir, LibDir: filepath.Join(prefix, "lib")}
+
+	if version, ok := newestStdlibVersion(l.LibDir); ok {
+		l.Version = version
+		l.Stdlib = filepath.Join(l.LibDir, "python"+version)
+		l.DynLoad = filepath.Join(l.Stdlib, "lib-dynload")
+		interpreter, err := resolvePythonExecutable(binDir, version)
+		if err != nil {
+			return nil, err
+		}
+		l.Interpreter = interpreter
+		return l, nil
+	}
+
+	interpreter, err := resolvePythonExecutable(binDir, PythonVersion)
+	if err != nil {
+		return nil, err
+	}
+	l.Interpreter = interpreter
+	output, err := runPythonCommandWithOutput(interpreter, []string{"-c", sysconfigPathsScript})
+	if err != nil {
+		return nil, fmt.Errorf("query sysconfig of %s: %w\n%s", interpreter, err, output)
+	}
+	var paths struct {
+		Version    string `json:"version"`
+		Stdlib     string `json:"stdlib"`
+		Platstdlib string `json:"platstdlib"`
+	}
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	if err := json.Unmarshal([]byte(lines[len(lines)-1]), &paths); err != nil {
+		return nil, fmt.Errorf("decode sysconfig paths: %w", err)
+	}
+	l.Version, l.Stdlib = paths.Version, paths.Stdlib
+	l.DynLoad = filepath.Join(paths.Platstdlib, "lib-dynload")
+	return l, nil
+}
+
+// newestStdlibVersion returns the highest X.Y among libDir/pythonX.Y directories.
+func newestStdlibVersion(libDir string) (string, bool) {
+	entries, err := os.ReadDir(libDir)
+	if err != nil {
+		return "", false
+	}
+	var best string
+	var bestMajor, bestMinor int
+	for _, e := range entries {
+		m := stdlibDirPattern.FindStringSubmatch(e.Name())
+		if m == nil || !e.IsDir() {
+			continue
+		}
+		major, _ := strconv.Atoi(m[1])
+		minor, _ := strconv.Atoi(m[2])
+		if best == "" || major > bestMajor || (major == bestMajor && minor > bestMinor) {
+			best, bestMajor, bestMinor = m[1]+"."+m[2]+m[3], major, minor
+		}
+	}
+	return best, best != ""
+}
+
+// resolvedLayout returns the instance's layout, detecting it if the instance was built without one.
+func (p *pythonInstance) resolvedLayout() (*pythonLayout, error) {
+	if p.layout == nil {
+		l, err := detectLayout(p.ExecutablesPath)
+		if err != nil {
+			return nil, err
+		}
+		p.layout = l
+	}
+	return p.layout, nil
+}
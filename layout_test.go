@@ -0,0 +1,117 @@
+package gorunpython
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNewestStdlibVersion(t *testing.T) {
+	tests := []struct {
+		name string
+		dirs []string
+		want string
+	}{
+		{"none", []string{"pkgconfig"}, ""},
+		{"one", []string{"python3.14", "pkgconfig"}, "3.14"},
+		{"numeric order", []string{"python3.9", "python3.12", "python3.10"}, "3.12"},
+		{"major first", []string{"python2.7", "python3.1"}, "3.1"},
+		{"free-threaded", []string{"python3.14t"}, "3.14t"},
+		{"not a version", []string{"python3", "python3.x", "python-3.12", "python3.12.1"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			libDir := t.TempDir()
+			for _, d := range tt.dirs {
+				if err := os.Mkdir(filepath.Join(libDir, d), 0o755); err != nil {
+					t.Fatal(err)
+				}
+			}
+			got, ok := newestStdlibVersion(libDir)
+			if got != tt.want || ok != (tt.want != "") {
+				t.Errorf("newestStdlibVersion = %q, %v; want %q", got, ok, tt.want)
+			}
+		})
+	}
+	// Files named like a stdlib directory are ignored.
+	libDir := t.TempDir()
+	os.WriteFile(filepath.Join(libDir, "python3.99"), nil, 0o644)
+	if got, ok := newestStdlibVersion(libDir); ok {
+		t.Errorf("newestStdlibVersion picked the file %q", got)
+	}
+	if _, ok := newestStdlibVersion(filepath.Join(libDir, "missing")); ok {
+		t.Error("newestStdlibVersion of a missing directory")
+	}
+}
+
+func TestResolvePythonExecutable(t *testing.T) {
+	tests := []struct {
+		files []string
+		want  string
+	}{
+		{[]string{"python3.14", "python3", "python"}, "python3.14"},
+		{[]string{"python3", "python"}, "python3"},
+		{[]string{"python"}, "python"},
+		{[]string{"python3.13"}, ""},
+	}
+	for _, tt := range tests {
+		binDir := t.TempDir()
+		for _, f := range tt.files {
+			os.WriteFile(filepath.Join(binDir, f), nil, 0o755)
+		}
+		got, err := resolvePythonExecutable(binDir, "3.14")
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("%v: resolved %q, want an error", tt.files, got)
+			}
+			continue
+		}
+		if err != nil || got != filepath.Join(binDir, tt.want) {
+			t.Errorf("%v: resolvePythonExecutable = %q, %v; want %s", tt.files, got, err, tt.want)
+		}
+	}
+}
+
+func TestExtractedLayoutFromTree(t *testing.T) {
+	dir := writeTree(t, "python-tmp", map[string]string{
+		"python/bin/python3.13":                   "",
+		"python/bin/python3":                      "",
+		"python/lib/python3.13/os.py":             "",
+		"python/lib/python3.13/lib-dynload/_a.so": "",
+		"python/lib/python3.12/os.py":             "",
+	})
+	l, err := extractedLayout("linux", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prefix := filepath.Join(dir, "python")
+	want := pythonLayout{
+		Version:     "3.13",
+		Prefix:      prefix,
+		BinDir:      filepath.Join(prefix, "bin"),
+		LibDir:      filepath.Join(prefix, "lib"),
+		Stdlib:      filepath.Join(prefix, "lib", "python3.13"),
+		DynLoad:     filepath.Join(prefix, "lib", "python3.13", "lib-dynload"),
+		Interpreter: filepath.Join(prefix, "bin", "python3.13"),
+	}
+	if *l != want {
+		t.Errorf("layout = %+v\nwant     %+v", *l, want)
+	}
+}
+
+func TestExtractedLayoutPrefixByOS(t *testing.T) {
+	for osName, prefix := range map[string]string{"linux": "python", "darwin": "prefix", "android": "prefix"} {
+		dir := writeTree(t, osName, map[string]string{
+			prefix + "/bin/python3.14":       "",
+			prefix + "/lib/python3.14/os.py": "",
+		})
+		l, err := extractedLayout(osName, dir)
+		if err != nil {
+			t.Errorf("%s: %v", osName, err)
+			continue
+		}
+		if want := filepath.Join(dir, prefix, "bin"); l.BinDir != want {
+			t.Errorf("%s: bin = %s, want %s", osName, l.BinDir, want)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package gorunpython
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+// ErrLimitExceeded is wrapped by the error Run returns when python was stopped by one of its
+// limits; Result.LimitExceeded says which.
+var ErrLimitExceeded = errors.New("resource limit exceeded")
+
+// ErrLimitUnsupported is wrapped by the error Run returns for limits this platform can't apply.
+var ErrLimitUnsupported = errors.New("resource limit not supported on this platform")
+
+// Limit names a resource limit.
+type Limit string
+
+const (
+	LimitAddressSpace Limit = "address space"
+	LimitCPUTime      Limit = "cpu time"
+	LimitOpenFiles    Limit = "open files"
+	LimitProcesses    Limit = "processes"
+	LimitOutput       Limit = "output"
+)
+
+// Limits caps the resources of one python run. Zero fields are unlimited.
+//
+// On Linux the kernel limits are in place before any of python runs: the launcher or the
+// sandbox helper sets them right before its exec, and python started directly is held in a
+// /bin/sh until they are set on it with prlimit. Processes is enforced with the pids controller
+// of a cgroup v2 child of this process's cgroup where that can be created, and python is started
+// inside it, which covers the whole process tree; otherwise with RLIMIT_NPROC, which counts all
+// processes of the user and does not apply to root. AddressSpace and OpenFiles make allocations
+// and opens inside python fail (MemoryError, EMFILE) rather than stopping it. Other platforms
+// only support OutputBytes.
+type Limits struct {
+	// AddressSpace is the most virtual memory python may map, in bytes.
+	AddressSpace uint64
+	// CPUTime is the most processor time python may use; it is killed after that.
+	CPUTime time.Duration
+	// OpenFiles is the most file descriptors python may have open.
+	OpenFiles uint64
+	// Processes is the most processes and threads the run may have at once.
+	Processes uint64
+	// OutputBytes is the most python may write to stdout and stderr together; it is killed
+	// once it writes more, and the excess is dropped.
+	OutputBytes int64
+}
+
+// kernelLimits reports whether l sets anything besides OutputBytes.
+func (l Limits) kernelLimits() bool {
+	return l.AddressSpace != 0 || l.CPUTime != 0 || l.OpenFiles != 0 || l.Processes != 0
+}
+
+// outputBudget is the output a run may still write before it is stopped.
+type outputBudget struct {
+	mu        sync.Mutex
+	remaining int64
+	exceeded  bool
+	onExceed  func()
+}
+
+func (b *outputBudget) writer(w io.Writer) io.Writer {
+	return &budgetWriter{b, w}
+}
+
+type budgetWriter struct {
+	b *outputBudget
+	w io.Writer
+}
+
+// Write passes p on while the budget lasts. Past it, output is dropped rather than failed so
+// the copying goroutine keeps draining the pipe until the process is gone.
+func (w *budgetWriter) Write(p []byte) (int, error) {
+	w.b.mu.Lock()
+	defer w.b.mu.Unlock()
+	if w.b.exceeded {
+		return len(p), nil
+	}
+	if int64(len(p)) <= w.b.remaining {
+		w.b.remaining -= int64(len(p))
+		return w.w.Write(p)
+	}
+	keep := p[:w.b.remaining]
+	w.b.remaining = 0
+	w.b.exceeded = true
+	if w.b.onExceed != nil {
+		w.b.onExceed()
+	}
+	if _, err := w.w.Write(keep); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
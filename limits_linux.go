@@ -0,0 +1,286 @@
+package gorunpython
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/ZacTyAdams/go-run-python/v2/internal/rlimit"
+)
+
+// rlimitNproc is RLIMIT_NPROC, which package syscall doesn't define.
+const rlimitNproc = 6
+
+// cgroup2SuperMagic is the statfs type of a cgroup v2 mount.
+const cgroup2SuperMagic = 0x63677270
+
+// cgroupRoot is where the cgroup v2 hierarchy is mounted.
+const cgroupRoot = "/sys/fs/cgroup"
+
+var runCgroupSeq atomic.Int64
+
+// limitState applies a run's limits and finds out afterwards which one stopped it.
+type limitState struct {
+	limits Limits
+	// cgroup is the run's cgroup v2 directory, or "" if Processes falls back to RLIMIT_NPROC.
+	cgroup string
+	// cgroupDir is held open while the run starts so the process can be created in the cgroup.
+	cgroupDir *os.File
+	// viaLauncher is set when python starts through python-launcher, which then sets the
+	// rlimits on itself right before it becomes python.
+	viaLauncher bool
+	// gate and gateRead are the ends of the pipe that holds python until started has set its
+	// rlimits.
+	gate, gateRead *os.File
+}
+
+func prepareLimits(l Limits, viaLauncher bool) (*limitState, error) {
+	s := &limitState{limits: l, viaLauncher: viaLauncher}
+	if l.Processes != 0 {
+		s.cgroup = newRunCgroup(l.Processes)
+	}
+	return s, nil
+}
+
+// newRunCgroup creates a child of this process's cgroup with pids.max set, or returns "" when
+// cgroup v2 or its pids controller isn't available to this process.
+func newRunCgroup(maxPids uint64) string {
+	if !cloneIntoCgroup() {
+		return ""
+	}
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(cgroupRoot, &st); err != nil || int64(st.Type) != cgroup2SuperMagic {
+		return ""
+	}
+	own, err := ownCgroup()
+	if err != nil {
+		return ""
+	}
+	dir := filepath.Join(cgroupRoot, own, fmt.Sprintf("gorunpython-%d-%d", os.Getpid(), runCgroupSeq.Add(1)))
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		return ""
+	}
+	// pids.max is missing unless the pids controller is enabled for children of this process's
+	// cgroup, which is left to whoever manages it
+	if err := os.WriteFile(filepath.Join(dir, "pids.max"), []byte(strconv.FormatUint(maxPids, 10)), 0o644); err != nil {
+		os.Remove(dir)
+		if noisy != "" {
+			fmt.Println("No cgroup v2 pids controller available, limiting processes with RLIMIT_NPROC: ", err)
+		}
+		return ""
+	}
+	return dir
+}
+
+// cloneIntoCgroup reports whether the kernel can create a process directly in a cgroup
+// (clone3 with CLONE_INTO_CGROUP, Linux 5.7). Joining one after the start would leave python
+// briefly outside it.
+func cloneIntoCgroup() bool {
+	var u syscall.Utsname
+	if err := syscall.Uname(&u); err != nil {
+		return false
+	}
+	var release []byte
+	for _, c := range u.Release {
+		if c == 0 {
+			break
+		}
+		release = append(release, byte(c))
+	}
+	var major, minor int
+	if _, err := fmt.Sscanf(string(release), "%d.%d", &major, &minor); err != nil {
+		return false
+	}
+	return major > 5 || (major == 5 && minor >= 7)
+}
+
+// ownCgroup returns this process's cgroup v2 path.
+func ownCgroup() (string, error) {
+	data, err := os.ReadFile("/proc/self/cgroup")
+	if err != nil {
+		return "", err
+	}
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		if path, ok := strings.CutPrefix(sc.Text(), "0::"); ok {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("no cgroup v2 entry in /proc/self/cgroup")
+}
+
+// rlimits returns the limits set with setrlimit.
+func (s *limitState) rlimits() []rlimit.Limit {
+	l := s.limits
+	var limits []rlimit.Limit
+	if l.AddressSpace != 0 {
+		limits = append(limits, rlimit.Limit{Resource: syscall.RLIMIT_AS, Cur: l.AddressSpace, Max: l.AddressSpace})
+	}
+	if l.CPUTime != 0 {
+		// SIGXCPU at the soft limit, SIGKILL a second later if python ignores it
+		secs := uint64((l.CPUTime + time.Second - 1) / time.Second)
+		limits = append(limits, rlimit.Limit{Resource: syscall.RLIMIT_CPU, Cur: secs, Max: secs + 1})
+	}
+	if l.OpenFiles != 0 {
+		limits = append(limits, rlimit.Limit{Resource: syscall.RLIMIT_NOFILE, Cur: l.OpenFiles, Max: l.OpenFiles})
+	}
+	if l.Processes != 0 && s.cgroup == "" {
+		limits = append(limits, rlimit.Limit{Resource: rlimitNproc, Cur: l.Processes, Max: l.Processes})
+	}
+	return limits
+}
+
+// env returns what to add to python's environment for the launcher to set the rlimits.
+func (s *limitState) env() []string {
+	limits := s.rlimits()
+	if !s.viaLauncher || len(limits) == 0 {
+		return nil
+	}
+	return []string{rlimit.EnvVar + "=" + rlimit.Encode(limits)}
+}
+
+// childLimits returns the rlimits whatever becomes python must set on itself before its exec,
+// or nil when the launcher sets them.
+func (s *limitState) childLimits() []rlimit.Limit {
+	if s.viaLauncher {
+		return nil
+	}
+	return s.rlimits()
+}
+
+// gateShell holds python until its rlimits are set: it waits for a line on a pipe and then
+// execs python with the pipe closed.
+const gateShell = "/bin/sh"
+
+// gateScript is the script gateShell runs, with the descriptor of the gate's read end filled in.
+const gateScript = `read -r _ <&%[1]d && exec "$0" "$@" %[1]d<&-`
+
+// setup makes cmd start with the limits in place, so none of python runs without them. Unless
+// the launcher or the sandbox helper sets the rlimits, cmd is started as a shell that waits on a
+// pipe until started has set them on it, then execs python. With a cgroup, the process is
+// created inside it.
+func (s *limitState) setup(cmd *exec.Cmd, sandboxed bool) error {
+	if limits := s.childLimits(); len(limits) > 0 && !sandboxed {
+		if err := s.hold(cmd); err != nil {
+			return err
+		}
+	}
+	if s.cgroup == "" {
+		return nil
+	}
+	dir, err := os.Open(s.cgroup)
+	if err != nil {
+		return err
+	}
+	s.cgroupDir = dir
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.UseCgroupFD = true
+	cmd.SysProcAttr.CgroupFD = int(dir.Fd())
+	return nil
+}
+
+// hold makes cmd start as gateShell waiting on a new pipe.
+func (s *limitState) hold(cmd *exec.Cmd) error {
+	// The shell only takes single digit descriptors in redirections
+	fd := 3 + len(cmd.ExtraFiles)
+	if fd > 9 {
+		return fmt.Errorf("%w: too many files passed to python to hold it for its rlimits", ErrLimitUnsupported)
+	}
+	if _, err := os.Stat(gateShell); err != nil {
+		return fmt.Errorf("%w: rlimits need %s: %v", ErrLimitUnsupported, gateShell, err)
+	}
+	r, w, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	s.gateRead, s.gate = r, w
+	cmd.ExtraFiles = append(cmd.ExtraFiles, r)
+	cmd.Args = append([]string{"sh", "-c", fmt.Sprintf(gateScript, fd), cmd.Path}, cmd.Args[1:]...)
+	cmd.Path = gateShell
+	return nil
+}
+
+// started sets the rlimits on the process setup held and lets it go on to become python. If
+// they can't be set, the process is left to exit without running python.
+func (s *limitState) started(p *os.Process) error {
+	if s.gate == nil {
+		return nil
+	}
+	s.gateRead.Close()
+	s.gateRead = nil
+	defer s.closeGate()
+	if err := rlimit.ApplyTo(p.Pid, s.childLimits()); err != nil {
+		return err
+	}
+	_, err := s.gate.Write([]byte("\n"))
+	return err
+}
+
+// closeGate closes what is left of the pipe that holds python.
+func (s *limitState) closeGate() {
+	if s.gateRead != nil {
+		s.gateRead.Close()
+		s.gateRead = nil
+	}
+	if s.gate != nil {
+		s.gate.Close()
+		s.gate = nil
+	}
+}
+
+// kill stops python and, when the run has a cgroup, everything it started.
+func (s *limitState) kill(p *os.Process) {
+	if s.cgroup != "" {
+		os.WriteFile(filepath.Join(s.cgroup, "cgroup.kill"), []byte("1"), 0o644)
+	}
+	p.Kill()
+}
+
+// exceeded returns the limit that stopped the run that ended with ps, if any.
+func (s *limitState) exceeded(ps *os.ProcessState) Limit {
+	if ws, ok := ps.Sys().(syscall.WaitStatus); ok && ws.Signaled() && s.limits.CPUTime != 0 {
+		used := ps.UserTime() + ps.SystemTime()
+		if ws.Signal() == syscall.SIGXCPU || (ws.Signal() == syscall.SIGKILL && used >= s.limits.CPUTime) {
+			return LimitCPUTime
+		}
+	}
+	if s.cgroup != "" {
+		data, _ := os.ReadFile(filepath.Join(s.cgroup, "pids.events"))
+		for _, line := range strings.Split(string(data), "\n") {
+			if n, ok := strings.CutPrefix(line, "max "); ok && n != "0" {
+				return LimitProcesses
+			}
+		}
+	}
+	return ""
+}
+
+// close removes the run's cgroup, killing anything python left behind in it.
+func (s *limitState) close() {
+	s.closeGate()
+	if s.cgroupDir != nil {
+		s.cgroupDir.Close()
+		s.cgroupDir = nil
+	}
+	if s.cgroup == "" {
+		return
+	}
+	os.WriteFile(filepath.Join(s.cgroup, "cgroup.kill"), []byte("1"), 0o644)
+	for i := 0; i < 50; i++ {
+		if err := os.Remove(s.cgroup); err == nil || os.IsNotExist(err) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	s.cgroup = ""
+}
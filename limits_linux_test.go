@@ -0,0 +1,138 @@
+package gorunpython
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/ZacTyAdams/go-run-python/v2/internal/rlimit"
+)
+
+// limitScript prints the limits the shell started with, before it could have been changed from
+// outside.
+const limitScript = `echo files=$(ulimit -n) cpu=$(ulimit -t) env=${GORUNPYTHON_RLIMITS-unset}; cat /proc/self/cgroup`
+
+// runLimited runs cmd set up by s as Run does and returns its combined output.
+func runLimited(t *testing.T, s *limitState, cmd *exec.Cmd) (string, error) {
+	t.Helper()
+	if err := s.setup(cmd, false); err != nil {
+		t.Fatal(err)
+	}
+	var out strings.Builder
+	cmd.Stdout, cmd.Stderr = &out, &out
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	err := s.started(cmd.Process)
+	if werr := cmd.Wait(); err == nil {
+		err = werr
+	}
+	return out.String(), err
+}
+
+func TestLimitsSetBeforeStart(t *testing.T) {
+	limits := Limits{OpenFiles: 37, CPUTime: 90 * time.Second}
+	for _, viaLauncher := range []bool{false, true} {
+		s, err := prepareLimits(limits, viaLauncher)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The descriptor of the pipe that held the shell must not reach it
+		cmd := exec.Command("/bin/sh", "-c", limitScript+"; [ -e /dev/fd/3 ] && echo gate open; :")
+		cmd.Env = append(os.Environ(), s.env()...)
+		out, err := runLimited(t, s, cmd)
+		s.close()
+		if err != nil {
+			t.Fatalf("%v\n%s", err, out)
+		}
+		if viaLauncher {
+			// The launcher sets them; a shell standing in for it only gets the variable.
+			if !strings.Contains(out, "env="+rlimit.Encode(s.rlimits())) {
+				t.Errorf("via the launcher: %s", out)
+			}
+			continue
+		}
+		if !strings.Contains(out, "files=37 cpu=90 env=unset") || strings.Contains(out, "gate open") {
+			t.Errorf("limits in the child: %s", out)
+		}
+	}
+}
+
+func TestLimitsNotSet(t *testing.T) {
+	// No process may have more open files than fs.nr_open, not even root's
+	s, err := prepareLimits(Limits{OpenFiles: 1 << 40}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.close()
+	out, err := runLimited(t, s, exec.Command("/bin/sh", "-c", "echo ran"))
+	if err == nil || strings.Contains(out, "ran") {
+		t.Errorf("run went ahead without its limits: %v\n%s", err, out)
+	}
+}
+
+func TestLimitsProcessesCgroup(t *testing.T) {
+	s, err := prepareLimits(Limits{Processes: 8}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.close()
+	if s.cgroup == "" {
+		t.Skip("no cgroup v2 pids controller or clone into cgroup for this process")
+	}
+	if data, _ := os.ReadFile(filepath.Join(s.cgroup, "pids.max")); strings.TrimSpace(string(data)) != "8" {
+		t.Errorf("pids.max = %q", data)
+	}
+	out, err := runLimited(t, s, exec.Command("/bin/sh", "-c", limitScript))
+	if err != nil {
+		t.Fatalf("%v\n%s", err, out)
+	}
+	own, _ := ownCgroup()
+	if want := "0::" + filepath.Join(own, filepath.Base(s.cgroup)); !strings.Contains(out, want) {
+		t.Errorf("child started outside its cgroup %s:\n%s", want, out)
+	}
+	for _, l := range s.rlimits() {
+		if l.Resource == rlimitNproc {
+			t.Error("RLIMIT_NPROC set although the cgroup limits processes")
+		}
+	}
+}
+
+func TestLimitsInSandbox(t *testing.T) {
+	s, err := prepareLimits(Limits{OpenFiles: 41}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.close()
+	cmd := exec.Command("/bin/sh", "-c", limitScript)
+	out, err := sandboxed(t, &Sandbox{}, t.TempDir(), cmd, s.childLimits()...)
+	if err != nil {
+		t.Fatalf("%v\n%s", err, out)
+	}
+	if !strings.Contains(out, "files=41 ") {
+		t.Errorf("limits in the sandbox: %s", out)
+	}
+	if s.setup(cmd, true); s.gate != nil || cmd.Path == gateShell {
+		t.Error("a sandboxed run is also held for its rlimits")
+	}
+}
+
+func TestLimitsExceeded(t *testing.T) {
+	s, err := prepareLimits(Limits{CPUTime: time.Second}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.close()
+	cmd := exec.Command("/bin/sh", "-c", "while :; do :; done")
+	_, err = runLimited(t, s, cmd)
+	if got := s.exceeded(cmd.ProcessState); got != LimitCPUTime {
+		t.Errorf("exceeded = %q after %v, want %q", got, err, LimitCPUTime)
+	}
+	if ws := cmd.ProcessState.Sys().(syscall.WaitStatus); !ws.Signaled() {
+		t.Errorf("busy loop ended with %v", err)
+	}
+}
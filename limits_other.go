@@ -0,0 +1,35 @@
+//go:build !linux
+
+package gorunpython
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+
+	"github.com/ZacTyAdams/go-run-python/v2/internal/rlimit"
+)
+
+// limitState only supports the output limit, which Run enforces itself.
+type limitState struct{}
+
+func prepareLimits(l Limits, viaLauncher bool) (*limitState, error) {
+	if l.kernelLimits() {
+		return nil, fmt.Errorf("%w: only OutputBytes can be limited", ErrLimitUnsupported)
+	}
+	return &limitState{}, nil
+}
+
+func (s *limitState) env() []string { return nil }
+
+func (s *limitState) childLimits() []rlimit.Limit { return nil }
+
+func (s *limitState) setup(cmd *exec.Cmd, sandboxed bool) error { return nil }
+
+func (s *limitState) started(p *os.Process) error { return nil }
+
+func (s *limitState) kill(p *os.Process) { p.Kill() }
+
+func (s *limitState) exceeded(ps *os.ProcessState) Limit { return "" }
+
+func (s *limitState) close() {}
@@ -0,0 +1,135 @@
+package gorunpython
+
+import (
+	"debug/elf"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// libcFlavor identifies the C library an ELF binary was linked against, as told by its loader.
+type libcFlavor string
+
+const (
+	libcUnknown libcFlavor = ""
+	libcGlibc   libcFlavor = "glibc"
+	libcMusl    libcFlavor = "musl"
+)
+
+type loaderKey struct {
+	goos   string
+	goarch string
+	libc   libcFlavor
+}
+
+// loaderTable lists the file name of the dynamic loader for each platform and libc. A bundle
+// ships the loader in its lib directory under this name.
+var loaderTable = map[loaderKey]string{
+	{"linux", "amd64", libcGlibc}: "ld-linux-x86-64.so.2",
+	{"linux", "arm64", libcGlibc}: "ld-linux-aarch64.so.1",
+	{"linux", "arm", libcGlibc}:   "ld-linux-armhf.so.3",
+	{"linux", "386", libcGlibc}:   "ld-linux.so.2",
+	{"linux", "amd64", libcMusl}:  "ld-musl-x86_64.so.1",
+	{"linux", "arm64", libcMusl}:  "ld-musl-aarch64.so.1",
+	{"linux", "arm", libcMusl}:    "ld-musl-armhf.so.1",
+	{"linux", "386", libcMusl}:    "ld-musl-i386.so.1",
+}
+
+// systemGlibcLoaders are where glibc distributions install the loader for each GOARCH.
+var systemGlibcLoaders = map[string][]string{
+	"amd64": {"/lib64/ld-linux-x86-64.so.2", "/lib/x86_64-linux-gnu/ld-linux-x86-64.so.2"},
+	"arm64": {"/lib/ld-linux-aarch64.so.1", "/lib/aarch64-linux-gnu/ld-linux-aarch64.so.1"},
+	"arm":   {"/lib/ld-linux-armhf.so.3", "/lib/arm-linux-gnueabihf/ld-linux-armhf.so.3"},
+	"386":   {"/lib/ld-linux.so.2", "/lib/i386-linux-gnu/ld-linux.so.2"},
+}
+
+// elfMachineArch maps an ELF machine to its GOARCH.
+var elfMachineArch = map[elf.Machine]string{
+	elf.EM_X86_64:  "amd64",
+	elf.EM_AARCH64: "arm64",
+	elf.EM_ARM:     "arm",
+	elf.EM_386:     "386",
+}
+
+// hostLibc reports the C library of the running Linux system.
+var hostLibc = sync.OnceValue(func() libcFlavor {
+	if runtime.GOOS != "linux" {
+		return libcUnknown
+	}
+	for _, p := range systemGlibcLoaders[runtime.GOARCH] {
+		if _, err := os.Stat(p); err == nil {
+			return libcGlibc
+		}
+	}
+	if matches, _ := filepath.Glob("/lib/ld-musl-*.so.1"); len(matches) > 0 {
+		return libcMusl
+	}
+	return libcUnknown
+})
+
+// libcFromInterpreter infers the C library from a PT_INTERP path.
+func libcFromInterpreter(interp string) libcFlavor {
+	base := filepath.Base(interp)
+	switch {
+	case strings.HasPrefix(base, "ld-musl-"):
+		return libcMusl
+	case strings.HasPrefix(base, "ld-linux"):
+		return libcGlibc
+	}
+	return libcUnknown
+}
+
+// resolveLoader returns the bundled loader in libDir that the ELF binary at binaryPath should run
+// under, or "" if the host's own loader will do (static binaries, or a bundle built for the
+// host's libc that ships no loader). It fails when the binary needs a different libc than the
+// host has and the bundle does not include a loader for it.
+func resolveLoader(binaryPath string, libDir string) (string, error) {
+	f, err := elf.Open(binaryPath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	interp := elfInterpreter(f)
+	if interp == "" {
+		return "", nil
+	}
+
+	libc := libcFromInterpreter(interp)
+	goarch, ok := elfMachineArch[f.Machine]
+	if !ok {
+		return "", fmt.Errorf("%s is built for unsupported machine %v", binaryPath, f.Machine)
+	}
+	if name, ok := loaderTable[loaderKey{runtime.GOOS, goarch, libc}]; ok {
+		loader := filepath.Join(libDir, name)
+		if _, err := os.Stat(loader); err == nil {
+			return loader, nil
+		}
+	}
+
+	host := hostLibc()
+	if libc != libcUnknown && host != libcUnknown && libc != host {
+		return "", fmt.Errorf("%s is linked against %s but this host uses %s, and the bundle ships no %s loader in %s",
+			binaryPath, libc, host, libc, libDir)
+	}
+	return "", nil
+}
+
+// elfInterpreter returns the PT_INTERP path of f, or "" if it has none.
+func elfInterpreter(f *elf.File) string {
+	for _, prog := range f.Progs {
+		if prog.Type != elf.PT_INTERP {
+			continue
+		}
+		b := make([]byte, prog.Filesz)
+		if _, err := prog.ReadAt(b, 0); err != nil {
+			return ""
+		}
+		interp, _, _ := strings.Cut(string(b), "\x00")
+		return interp
+	}
+	return ""
+}
@@ -0,0 +1,106 @@
+package gorunpython
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestLibcFromInterpreter(t *testing.T) {
+	tests := []struct {
+		interp string
+		want   libcFlavor
+	}{
+		{"/lib64/ld-linux-x86-64.so.2", libcGlibc},
+		{"/lib/ld-linux-aarch64.so.1", libcGlibc},
+		{"/lib/ld-linux.so.2", libcGlibc},
+		{"/lib/ld-musl-x86_64.so.1", libcMusl},
+		{"ld-musl-aarch64.so.1", libcMusl},
+		{"/system/bin/linker64", libcUnknown},
+		{"", libcUnknown},
+	}
+	for _, tt := range tests {
+		if got := libcFromInterpreter(tt.interp); got != tt.want {
+			t.Errorf("libcFromInterpreter(%q) = %q, want %q", tt.interp, got, tt.want)
+		}
+	}
+}
+
+func TestLoaderTable(t *testing.T) {
+	// Every loader in the table must be recognised as its own libc, and every architecture with
+	// system glibc loaders must have a glibc entry of the same name.
+	for key, name := range loaderTable {
+		if got := libcFromInterpreter(name); got != key.libc {
+			t.Errorf("%s is listed for %s but looks like %q", name, key.libc, got)
+		}
+	}
+	for goarch, paths := range systemGlibcLoaders {
+		name, ok := loaderTable[loaderKey{"linux", goarch, libcGlibc}]
+		if !ok {
+			t.Errorf("no glibc loader for linux/%s", goarch)
+			continue
+		}
+		for _, p := range paths {
+			if filepath.Base(p) != name {
+				t.Errorf("system loader %s for %s is not named %s", p, goarch, name)
+			}
+		}
+	}
+}
+
+func TestResolveLoader(t *testing.T) {
+	path, interp := hostELF(t)
+	libc := libcFromInterpreter(interp)
+	if libc == libcUnknown || hostLibc() != libc {
+		t.Skipf("host loader %s is not a recognised glibc or musl loader", interp)
+	}
+	name := loaderTable[loaderKey{runtime.GOOS, runtime.GOARCH, libc}]
+
+	// Without a bundled loader the host's is used.
+	if got, err := resolveLoader(path, t.TempDir()); err != nil || got != "" {
+		t.Errorf("resolveLoader without a bundled loader = %q, %v", got, err)
+	}
+
+	// A bundled loader for the binary's libc is preferred.
+	libDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(libDir, name), nil, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := resolveLoader(path, libDir); err != nil || got != filepath.Join(libDir, name) {
+		t.Errorf("resolveLoader with a bundled loader = %q, %v", got, err)
+	}
+
+	// A binary for the other libc needs its loader in the bundle.
+	other := libcMusl
+	if libc == libcMusl {
+		other = libcGlibc
+	}
+	otherName, ok := loaderTable[loaderKey{runtime.GOOS, runtime.GOARCH, other}]
+	if !ok {
+		t.Skipf("no %s loader for %s", other, runtime.GOARCH)
+	}
+	if err := patchELF(path, elfPatch{Interpreter: "/lib/" + otherName}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := resolveLoader(path, t.TempDir()); err == nil || !strings.Contains(err.Error(), string(other)) {
+		t.Errorf("resolveLoader for a %s binary on a %s host = %v, want an error", other, libc, err)
+	}
+	if err := os.WriteFile(filepath.Join(libDir, otherName), nil, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := resolveLoader(path, libDir); err != nil || got != filepath.Join(libDir, otherName) {
+		t.Errorf("resolveLoader with the other libc's loader = %q, %v", got, err)
+	}
+}
+
+func TestResolveLoaderNotELF(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "script")
+	if err := os.WriteFile(p, []byte("#!/bin/sh\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := resolveLoader(p, t.TempDir()); err == nil {
+		t.Error("resolveLoader of a script succeeded")
+	}
+}
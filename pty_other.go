@@ -0,0 +1,16 @@
+//go:build !linux
+
+package gorunpython
+
+import (
+	"os"
+	"syscall"
+)
+
+func openPTY(rows, cols uint16) (master, slave *os.File, err error) {
+	return nil, nil, ErrPTYUnsupported
+}
+
+func setWinsize(f *os.File, rows, cols uint16) error { return ErrPTYUnsupported }
+
+func ptySysProcAttr() *syscall.SysProcAttr { return nil }
@@ -1,2 +1,3 @@
-GOOS="linux" GOARCH="arm64" go build -o "python-launcher-linux-arm64"
-# cp "python-launcher-linux-arm64" "python-tmp2677616181/python/bin"
\ No newline at end of file
+# Static and independent of where and from which commit it is built, so the embedded binary is
+# reproducible from the tree
+CGO_ENABLED=0 GOOS="linux" GOARCH="arm64" go build -trimpath -buildvcs=false -o "python-launcher-linux-arm64" .
@@ -1,3 +1,3 @@
-GOOS="linux" GOARCH="amd64" go build -o "python-launcher-linux-amd64"
-# cp "python-launcher-linux-amd64" "python-tmp2677616181/python/bin"
-# ./python-tmp2677616181/python/bin/python-launcher-linux-amd64
\ No newline at end of file
+# Static and independent of where and from which commit it is built, so the embedded binary is
+# reproducible from the tree
+CGO_ENABLED=0 GOOS="linux" GOARCH="amd64" go build -trimpath -buildvcs=false -o "python-launcher-linux-amd64" .
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/ZacTyAdams/go-run-python/v2/internal/pyenv"
+)
+
+// configFileName is the sidecar file next to the launcher that overrides what it runs.
+const configFileName = "python-launcher.json"
+
+// bundleManifestName is the bundle manifest written by gorunpython-bundle at the bundle root.
+const bundleManifestName = ".gorunpython-bundle.json"
+
+// noLoader as the loader runs the interpreter directly even if a bundled loader is present.
+const noLoader = "none"
+
+// launcherConfig says how to start Python. Relative paths in the sidecar file are relative to
+// the launcher's directory.
+type launcherConfig struct {
+	// Interpreter is the python executable, e.g. "python3.14".
+	Interpreter string `json:"interpreter,omitempty"`
+	// Loader is the dynamic loader to run the interpreter under, or "none".
+	Loader string `json:"loader,omitempty"`
+	// LibraryPath is the directory of the bundled shared libraries.
+	LibraryPath string `json:"library_path,omitempty"`
+	// PythonHome is exported as PYTHONHOME. Python run through the loader always gets it, since
+	// it can't work out its prefix from its own path then.
+	PythonHome string `json:"python_home,omitempty"`
+	// Env adds or overrides environment variables for Python, after the isolation profile.
+	Env map[string]string `json:"env,omitempty"`
+	// Passthrough names variables the isolation profile leaves alone, as GORUNPYTHON_ENV_PASSTHROUGH
+	// does; "*" turns it off.
+	Passthrough []string `json:"passthrough,omitempty"`
+	// Verbose describes the command on stderr before running it.
+	Verbose bool `json:"verbose,omitempty"`
+
+	origin       string
+	explicitHome bool
+}
+
+// bundleManifest is the part of the bundle manifest the launcher reads.
+type bundleManifest struct {
+	Layout struct {
+		Prefix      string `json:"prefix"`
+		Bin         string `json:"bin"`
+		Lib         string `json:"lib"`
+		Interpreter string `json:"interpreter"`
+	} `json:"layout"`
+	Loader string `json:"loader"`
+}
+
+// loaderNames are the dynamic loaders a bundle may ship in its lib directory, by GOARCH.
+var loaderNames = map[string][]string{
+	"amd64": {"ld-linux-x86-64.so.2", "ld-musl-x86_64.so.1"},
+	"arm64": {"ld-linux-aarch64.so.1", "ld-musl-aarch64.so.1"},
+	"arm":   {"ld-linux-armhf.so.3", "ld-musl-armhf.so.1"},
+	"386":   {"ld-linux.so.2", "ld-musl-i386.so.1"},
+}
+
+// loadConfig works out what to run for the launcher in binDir: the bundle manifest above it if
+// there is one, then the sidecar file, then the tree itself for anything still unset.
+func loadConfig(binDir string) (*launcherConfig, error) {
+	cfg := &launcherConfig{origin: "detected"}
+	var origins []string
+
+	manifestPath, m, err := findBundleManifest(binDir)
+	if err != nil {
+		return nil, err
+	}
+	if m != nil {
+		root := filepath.Dir(manifestPath)
+		fromRoot := func(p string) string {
+			if p == "" {
+				return ""
+			}
+			return filepath.Join(root, filepath.FromSlash(p))
+		}
+		cfg.Interpreter = fromRoot(m.Layout.Interpreter)
+		cfg.LibraryPath = fromRoot(m.Layout.Lib)
+		cfg.PythonHome = fromRoot(m.Layout.Prefix)
+		cfg.Loader = fromRoot(m.Loader)
+		origins = append(origins, manifestPath)
+	}
+
+	sidecar := filepath.Join(binDir, configFileName)
+	raw, err := os.ReadFile(sidecar)
+	switch {
+	case err == nil:
+		var side launcherConfig
+		if err := json.Unmarshal(raw, &side); err != nil {
+			return nil, fmt.Errorf("parse %s: %w", sidecar, err)
+		}
+		cfg.merge(&side, binDir)
+		origins = append(origins, sidecar)
+	case !errors.Is(err, fs.ErrNotExist):
+		return nil, err
+	}
+	if len(origins) > 0 {
+		cfg.origin = strings.Join(origins, ", ")
+	}
+
+	prefix := filepath.Dir(binDir)
+	if cfg.PythonHome == "" {
+		cfg.PythonHome = prefix
+	}
+	if cfg.LibraryPath == "" {
+		cfg.LibraryPath = filepath.Join(prefix, "lib")
+	}
+	if cfg.Interpreter == "" {
+		cfg.Interpreter, err = findPythonExe(binDir, cfg.LibraryPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+	switch cfg.Loader {
+	case "":
+		cfg.Loader = findLoader(cfg.LibraryPath)
+	case noLoader:
+		cfg.Loader = ""
+	}
+	return cfg, nil
+}
+
+// merge applies the set fields of a sidecar config, resolving its paths against binDir.
+func (c *launcherConfig) merge(side *launcherConfig, binDir string) {
+	resolve := func(p string) string {
+		if p == "" || p == noLoader || filepath.IsAbs(p) {
+			return p
+		}
+		return filepath.Join(binDir, p)
+	}
+	if side.Interpreter != "" {
+		c.Interpreter = resolve(side.Interpreter)
+	}
+	if side.Loader != "" {
+		c.Loader = resolve(side.Loader)
+	}
+	if side.LibraryPath != "" {
+		c.LibraryPath = resolve(side.LibraryPath)
+	}
+	if side.PythonHome != "" {
+		c.PythonHome = resolve(side.PythonHome)
+		c.explicitHome = true
+	}
+	c.Env = side.Env
+	c.Passthrough = side.Passthrough
+	c.Verbose = side.Verbose
+}
+
+// findBundleManifest looks for the bundle manifest in binDir and the directories above it, and
+// returns the first whose bin directory is binDir.
+func findBundleManifest(binDir string) (string, *bundleManifest, error) {
+	for dir := binDir; ; dir = filepath.Dir(dir) {
+		path := filepath.Join(dir, bundleManifestName)
+		raw, err := os.ReadFile(path)
+		if err == nil {
+			var m bundleManifest
+			if err := json.Unmarshal(raw, &m); err != nil {
+				return "", nil, fmt.Errorf("parse %s: %w", path, err)
+			}
+			if filepath.Join(dir, filepath.FromSlash(m.Layout.Bin)) == binDir {
+				return path, &m, nil
+			}
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return "", nil, err
+		}
+		if filepath.Dir(dir) == dir {
+			return "", nil, nil
+		}
+	}
+}
+
+// findLoader returns the bundled dynamic loader in libDir, or "" to let the interpreter use the
+// one it names itself.
+func findLoader(libDir string) string {
+	if runtime.GOOS != "linux" {
+		return ""
+	}
+	for _, name := range loaderNames[runtime.GOARCH] {
+		candidate := filepath.Join(libDir, name)
+		if _, err := os.Stat(candidate); err == nil {
+			return candidate
+		}
+	}
+	return ""
+}
+
+// command returns the argv that runs Python with args.
+func (c *launcherConfig) command(args []string) []string {
+	if c.Loader == "" {
+		return append([]string{c.Interpreter}, args...)
+	}
+	// Run the loader directly and control the library search path tightly. musl's loader has
+	// no --inhibit-cache, and doesn't need it.
+	argv := []string{c.Loader, "--library-path", c.LibraryPath}
+	if strings.HasPrefix(filepath.Base(c.Loader), "ld-linux") {
+		argv = append(argv, "--inhibit-cache")
+	}
+	argv = append(argv, c.Interpreter)
+	return append(argv, args...)
+}
+
+// environ returns the environment for Python: env under the isolation profile, with the bundle's
+// library path and the sidecar's variables.
+func (c *launcherConfig) environ(env []string) []string {
+	env = pyenv.Isolate(env, append(pyenv.Passthrough(env), c.Passthrough...))
+	// Avoid mixing host/container glibc/musl bits:
+	env = scrubEnv(env, []string{"LD_LIBRARY_PATH", "LD_PRELOAD", "LD_AUDIT"})
+	env = append(env, "LD_LIBRARY_PATH="+c.LibraryPath) // keep it tight
+	if c.Loader != "" || c.explicitHome {
+		// This helps Python find its stdlib predictably when invoked via the loader
+		env = append(scrubEnv(env, []string{"PYTHONHOME"}), "PYTHONHOME="+c.PythonHome)
+	}
+
+	keys := make([]string, 0, len(c.Env))
+	for k := range c.Env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	env = scrubEnv(env, keys)
+	for _, k := range keys {
+		env = append(env, k+"="+c.Env[k])
+	}
+	return env
+}
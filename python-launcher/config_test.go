@@ -0,0 +1,229 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/ZacTyAdams/go-run-python/v2/internal/testtree"
+)
+
+func TestLoadConfig(t *testing.T) {
+	loader := ""
+	if names := loaderNames[runtime.GOARCH]; runtime.GOOS == "linux" && len(names) > 0 {
+		loader = names[0]
+	}
+	manifest := `{"layout":{"prefix":"py","bin":"py/bin","lib":"py/lib64","interpreter":"py/bin/python3.13"},"loader":"py/lib64/ld.so"}`
+
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  func(root string) launcherConfig
+		err   string
+	}{
+		{
+			name:  "detected",
+			files: map[string]string{"py/bin/python3.12": "", "py/bin/python3": "", "py/lib/python3.12/": "", "py/lib/python3.9/": ""},
+			want: func(root string) launcherConfig {
+				return launcherConfig{Interpreter: root + "/py/bin/python3.12", LibraryPath: root + "/py/lib", PythonHome: root + "/py"}
+			},
+		},
+		{
+			name:  "detected fallback",
+			files: map[string]string{"py/bin/python3": "", "py/lib/python3.12/": ""},
+			want: func(root string) launcherConfig {
+				return launcherConfig{Interpreter: root + "/py/bin/python3", LibraryPath: root + "/py/lib", PythonHome: root + "/py"}
+			},
+		},
+		{
+			name:  "detected loader",
+			files: map[string]string{"py/bin/python3": "", "py/lib/" + loader: ""},
+			want: func(root string) launcherConfig {
+				c := launcherConfig{Interpreter: root + "/py/bin/python3", LibraryPath: root + "/py/lib", PythonHome: root + "/py"}
+				if loader != "" {
+					c.Loader = root + "/py/lib/" + loader
+				}
+				return c
+			},
+		},
+		{
+			name:  "no interpreter",
+			files: map[string]string{"py/bin/pip": "", "py/lib/python3.12/": ""},
+			err:   "no python executable",
+		},
+		{
+			name:  "manifest",
+			files: map[string]string{bundleManifestName: manifest},
+			want: func(root string) launcherConfig {
+				return launcherConfig{Interpreter: root + "/py/bin/python3.13", LibraryPath: root + "/py/lib64", PythonHome: root + "/py", Loader: root + "/py/lib64/ld.so"}
+			},
+		},
+		{
+			name:  "manifest for another bin directory",
+			files: map[string]string{bundleManifestName: strings.Replace(manifest, `"bin":"py/bin"`, `"bin":"other/bin"`, 1), "py/bin/python3": ""},
+			want: func(root string) launcherConfig {
+				return launcherConfig{Interpreter: root + "/py/bin/python3", LibraryPath: root + "/py/lib", PythonHome: root + "/py"}
+			},
+		},
+		{
+			name:  "bad manifest",
+			files: map[string]string{bundleManifestName: "{"},
+			err:   "parse",
+		},
+		{
+			name: "sidecar over manifest",
+			files: map[string]string{
+				bundleManifestName: manifest,
+				"py/bin/" + configFileName: `{"interpreter":"python3.14","loader":"none","python_home":"/opt/py",` +
+					`"env":{"A":"1"},"passthrough":["HOME"],"verbose":true}`,
+			},
+			want: func(root string) launcherConfig {
+				return launcherConfig{
+					Interpreter: root + "/py/bin/python3.14", LibraryPath: root + "/py/lib64", PythonHome: "/opt/py",
+					Env: map[string]string{"A": "1"}, Passthrough: []string{"HOME"}, Verbose: true, explicitHome: true,
+				}
+			},
+		},
+		{
+			name:  "sidecar relative paths",
+			files: map[string]string{"py/bin/" + configFileName: `{"interpreter":"../real/python","library_path":"../real/lib","loader":"../real/lib/ld.so"}`},
+			want: func(root string) launcherConfig {
+				return launcherConfig{Interpreter: root + "/py/real/python", LibraryPath: root + "/py/real/lib", PythonHome: root + "/py", Loader: root + "/py/real/lib/ld.so"}
+			},
+		},
+		{
+			name:  "bad sidecar",
+			files: map[string]string{"py/bin/" + configFileName: `{"interpreter":1}`},
+			err:   "parse",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			testtree.Write(t, root, tt.files, 0o755)
+			os.MkdirAll(filepath.Join(root, "py", "bin"), 0o755)
+			got, err := loadConfig(filepath.Join(root, "py", "bin"))
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("err = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := tt.want(root)
+			for _, p := range []*string{&want.Interpreter, &want.LibraryPath, &want.PythonHome, &want.Loader} {
+				*p = filepath.FromSlash(*p)
+			}
+			if got.Interpreter != want.Interpreter || got.LibraryPath != want.LibraryPath || got.PythonHome != want.PythonHome ||
+				got.Loader != want.Loader || got.Verbose != want.Verbose || got.explicitHome != want.explicitHome ||
+				!slices.Equal(got.Passthrough, want.Passthrough) || len(got.Env) != len(want.Env) {
+				t.Errorf("config = %+v\nwant     %+v", *got, want)
+			}
+		})
+	}
+}
+
+func TestCommand(t *testing.T) {
+	tests := []struct {
+		cfg  launcherConfig
+		want []string
+	}{
+		{launcherConfig{Interpreter: "/p/bin/python3"}, []string{"/p/bin/python3", "-c", "pass"}},
+		{
+			launcherConfig{Interpreter: "/p/bin/python3", Loader: "/p/lib/ld-linux-x86-64.so.2", LibraryPath: "/p/lib"},
+			[]string{"/p/lib/ld-linux-x86-64.so.2", "--library-path", "/p/lib", "--inhibit-cache", "/p/bin/python3", "-c", "pass"},
+		},
+		{
+			launcherConfig{Interpreter: "/p/bin/python3", Loader: "/p/lib/ld-musl-x86_64.so.1", LibraryPath: "/p/lib"},
+			[]string{"/p/lib/ld-musl-x86_64.so.1", "--library-path", "/p/lib", "/p/bin/python3", "-c", "pass"},
+		},
+	}
+	for _, tt := range tests {
+		if got := tt.cfg.command([]string{"-c", "pass"}); !slices.Equal(got, tt.want) {
+			t.Errorf("command = %q, want %q", got, tt.want)
+		}
+	}
+}
+
+func TestEnviron(t *testing.T) {
+	host := []string{"PATH=/usr/bin", "LD_PRELOAD=/evil.so", "LD_LIBRARY_PATH=/host/lib", "PYTHONHOME=/host", "A=host"}
+	lookup := func(env []string, key string) (string, int) {
+		var val string
+		n := 0
+		for _, kv := range env {
+			if k, v, _ := strings.Cut(kv, "="); k == key {
+				val, n = v, n+1
+			}
+		}
+		return val, n
+	}
+
+	direct := launcherConfig{Interpreter: "/p/bin/python3", LibraryPath: "/p/lib", PythonHome: "/p", Env: map[string]string{"A": "mine"}}
+	env := direct.environ(host)
+	for key, want := range map[string]string{"LD_LIBRARY_PATH": "/p/lib", "A": "mine", "LD_PRELOAD": "", "PYTHONHOME": ""} {
+		if got, n := lookup(env, key); got != want || n > 1 {
+			t.Errorf("%s = %q (%d times), want %q", key, got, n, want)
+		}
+	}
+
+	// Run through a loader, Python can't find its home by itself.
+	loaded := direct
+	loaded.Loader = "/p/lib/ld.so"
+	if got, n := lookup(loaded.environ(host), "PYTHONHOME"); got != "/p" || n != 1 {
+		t.Errorf("PYTHONHOME under the loader = %q (%d times)", got, n)
+	}
+}
+
+func TestScrubEnv(t *testing.T) {
+	got := scrubEnv([]string{"A=1", "AB=2", "B=3", "A=4"}, []string{"A"})
+	if want := []string{"AB=2", "B=3"}; !slices.Equal(got, want) {
+		t.Errorf("scrubEnv = %q, want %q", got, want)
+	}
+}
+
+// TestLauncherExit builds the launcher, points it at /bin/sh and checks it stays silent and exits
+// with the interpreter's status.
+func TestLauncherExit(t *testing.T) {
+	if runtime.GOOS == "windows" || testing.Short() {
+		t.Skip("needs /bin/sh and a go toolchain")
+	}
+	goTool, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("no go toolchain")
+	}
+	binDir := filepath.Join(t.TempDir(), "python", "bin")
+	testtree.Write(t, binDir, map[string]string{configFileName: `{"interpreter":"/bin/sh","loader":"none"}`}, 0o644)
+	launcher := filepath.Join(binDir, "python-launcher")
+	if out, err := exec.Command(goTool, "build", "-o", launcher, ".").CombinedOutput(); err != nil {
+		t.Fatalf("build launcher: %v\n%s", err, out)
+	}
+
+	cmd := exec.Command(launcher, "-c", `read line; echo "got $line"; exit 7`)
+	cmd.Stdin = strings.NewReader("input\n")
+	out, err := cmd.Output()
+	if code := cmd.ProcessState.ExitCode(); code != 7 {
+		t.Errorf("exit code = %d (%v), want 7", code, err)
+	}
+	if string(out) != "got input\n" {
+		t.Errorf("stdout = %q, want only the interpreter's output", out)
+	}
+
+	cmd = exec.Command(launcher, "-c", "kill -TERM $$")
+	cmd.Run()
+	if status := cmd.ProcessState.String(); !strings.Contains(status, "terminated") {
+		t.Errorf("killed interpreter: launcher %s, want it terminated by the signal", status)
+	}
+
+	testtree.Write(t, binDir, map[string]string{configFileName: `{"interpreter":"/nonexistent/python","loader":"none"}`}, 0o644)
+	cmd = exec.Command(launcher)
+	cmd.Run()
+	if code := cmd.ProcessState.ExitCode(); code != launchFailed {
+		t.Errorf("missing interpreter: exit code = %d, want %d", code, launchFailed)
+	}
+}
@@ -0,0 +1,11 @@
+//go:build unix
+
+package main
+
+import "syscall"
+
+// run replaces the launcher with argv, so Python inherits its pid, terminal and signals and
+// its exit status is the launcher's. It only returns if the exec fails.
+func run(argv []string, env []string) (int, error) {
+	return 0, syscall.Exec(argv[0], argv, env)
+}
@@ -1,3 +0,0 @@
-module python-launcher
-
-go 1.25.6
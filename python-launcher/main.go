@@ -1,84 +1,108 @@
+// python-launcher runs the bundled Python interpreter next to it as if it were python itself:
+// it prints nothing of its own, passes arguments, stdin and the terminal straight through, and
+// exits the way Python does. That makes it usable as the shebang target of console scripts.
+//
+// On Unix the launcher replaces itself with the interpreter (or the bundled dynamic loader
+// running it), so exit codes, signals and job control behave exactly as with python.
 package main
 
 import (
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
-	"runtime"
 	"strings"
+
+	"github.com/ZacTyAdams/go-run-python/v2/internal/rlimit"
 )
 
-func main() {
-	fmt.Println("Hello, World!")
+// debugEnvVar makes the launcher describe what it is about to run on stderr.
+const debugEnvVar = "GORUNPYTHON_LAUNCHER_DEBUG"
+
+// launchFailed is the exit status when the interpreter can't be started, as a shell uses for a
+// command it can't run.
+const launchFailed = 127
 
+func main() {
 	exePath, err := os.Executable()
 	if err != nil {
-		fmt.Println("Error getting executable path:", err)
-		os.Exit(1)
+		fail("locate launcher: %v", err)
 	}
-	exeDir := filepath.Dir(exePath)
-
-	// Layout assumption:
+	// Layout assumption when nothing says otherwise:
 	// <root>/python/bin/python-launcher   (this binary)
-	// <root>/python/bin/python3.14
+	// <root>/python/bin/python3.X         (X from <root>/python/lib/python3.X)
 	// <root>/python/lib/ld-linux-*.so.*
 	// <root>/python/lib/libc.so.6, etc
-	pythonBinDir := exeDir
-	pythonRoot := filepath.Clean(filepath.Join(pythonBinDir, ".."))
-	pythonLibDir := filepath.Join(pythonRoot, "lib")
-	pythonExe := filepath.Join(pythonBinDir, "python3.14")
-
-	fmt.Printf("Python root: %s\n", pythonRoot)
-	fmt.Printf("Python bin:  %s\n", pythonBinDir)
-	fmt.Printf("Python lib:  %s\n", pythonLibDir)
-	fmt.Printf("Python exe:  %s\n", pythonExe)
-
-	// Pick the right dynamic loader (interpreter) bundled with your python
-	var loaderName string
-	switch runtime.GOARCH {
-	case "amd64":
-		loaderName = "ld-linux-x86-64.so.2"
-	case "arm64":
-		loaderName = "ld-linux-aarch64.so.1"
-	default:
-		fmt.Printf("Packaged interpreter not available for architecture: %s\n", runtime.GOARCH)
-		os.Exit(1)
+	cfg, err := loadConfig(filepath.Dir(exePath))
+	if err != nil {
+		fail("%v", err)
+	}
+	if os.Getenv(debugEnvVar) != "" {
+		cfg.Verbose = true
 	}
-	loaderPath := filepath.Join(pythonLibDir, loaderName)
-	fmt.Printf("Loader:      %s\n", loaderPath)
 
-	// Pass through args to python
-	pyArgs := os.Args[1:]
+	argv := cfg.command(os.Args[1:])
+	env := scrubEnv(cfg.environ(os.Environ()), []string{rlimit.EnvVar})
+	if cfg.Verbose {
+		fmt.Fprintf(os.Stderr, "python-launcher: config:      %s\n", cfg.origin)
+		fmt.Fprintf(os.Stderr, "python-launcher: interpreter: %s\n", cfg.Interpreter)
+		fmt.Fprintf(os.Stderr, "python-launcher: loader:      %s\n", cfg.Loader)
+		fmt.Fprintf(os.Stderr, "python-launcher: lib:         %s\n", cfg.LibraryPath)
+		fmt.Fprintf(os.Stderr, "python-launcher: home:        %s\n", cfg.PythonHome)
+		fmt.Fprintf(os.Stderr, "python-launcher: exec:        %s\n", strings.Join(argv, " "))
+	}
 
-	// IMPORTANT: Run the loader directly and control the library search path tightly
-	cmdArgs := append([]string{
-		"--library-path", pythonLibDir,
-		"--inhibit-cache",
-		pythonExe,
-	}, pyArgs...)
+	// Set last, so this Go program has all the address space it needs while it starts up
+	if raw := os.Getenv(rlimit.EnvVar); raw != "" {
+		limits, err := rlimit.Decode(raw)
+		if err != nil {
+			fail("%s: %v", rlimit.EnvVar, err)
+		}
+		if err := rlimit.Apply(limits); err != nil {
+			fail("%v", err)
+		}
+	}
 
-	cmd := exec.Command(loaderPath, cmdArgs...)
-	cmd.Stdin = os.Stdin
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	code, err := run(argv, env)
+	if err != nil {
+		fail("run %s: %v", argv[0], err)
+	}
+	os.Exit(code)
+}
 
-	// Avoid mixing host/container glibc/musl bits:
-	env := os.Environ()
-	env = scrubEnv(env, []string{"LD_LIBRARY_PATH", "LD_PRELOAD", "LD_AUDIT"})
-	env = append(env,
-		"LD_LIBRARY_PATH="+pythonLibDir, // keep it tight
-		// These help Python find its stdlib predictably when invoked via loader
-		"PYTHONHOME="+pythonRoot,
-	)
-	cmd.Env = env
+// fail reports a launcher error on stderr, leaving stdout to Python alone, and exits.
+func fail(format string, args ...any) {
+	fmt.Fprintf(os.Stderr, "python-launcher: "+format+"\n", args...)
+	os.Exit(launchFailed)
+}
 
-	if err := cmd.Run(); err != nil {
-		fmt.Println("Error running command:", err)
-		os.Exit(1)
+// findPythonExe returns the versioned interpreter matching the newest lib/pythonX.Y directory,
+// falling back to python3.
+func findPythonExe(binDir, libDir string) (string, error) {
+	var best string
+	var bestMajor, bestMinor int
+	entries, _ := os.ReadDir(libDir)
+	for _, e := range entries {
+		var major, minor int
+		if !e.IsDir() || !strings.HasPrefix(e.Name(), "python") {
+			continue
+		}
+		if _, err := fmt.Sscanf(e.Name(), "python%d.%d", &major, &minor); err != nil {
+			continue
+		}
+		if best == "" || major > bestMajor || (major == bestMajor && minor > bestMinor) {
+			best, bestMajor, bestMinor = e.Name(), major, minor
+		}
 	}
-
-	fmt.Println("Done!")
+	for _, name := range []string{best, "python3", "python"} {
+		if name == "" {
+			continue
+		}
+		candidate := filepath.Join(binDir, name)
+		if info, err := os.Stat(candidate); err == nil && !info.IsDir() {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("no python executable in %s", binDir)
 }
 
 func scrubEnv(env []string, keys []string) []string {
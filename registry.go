@@ -0,0 +1,168 @@
+package gorunpython
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// registeredBundle is a bundle CreatePythonInstance can pick by version.
+type registeredBundle struct {
+	version string
+	src     BundleSource
+}
+
+var (
+	registryMu sync.Mutex
+	registry   []registeredBundle
+)
+
+// RegisterBundle makes src available to CreatePythonInstance(WithVersion(version)). If version
+// is empty it is read from the bundle's manifest. Registering a version again replaces the earlier
+// bundle. Build-tag specific files call it from init to embed extra versions, and programs can
+// call it with a BundleFromFile for versions shipped separately.
+func RegisterBundle(version string, src BundleSource) error {
+	if version == "" {
+		data, err := src.ReadBundle()
+		if err != nil {
+			return err
+		}
+		m, err := ReadBundleManifest(data)
+		if err != nil {
+			return fmt.Errorf("version of %s: %w", src, err)
+		}
+		version = m.Version
+	}
+
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	for i, b := range registry {
+		if b.version == version {
+			registry[i].src = src
+			return nil
+		}
+	}
+	registry = append(registry, registeredBundle{version, src})
+	return nil
+}
+
+// AvailableVersions lists the Python versions CreatePythonInstance can create, newest first. It
+// includes the embedded bundle.
+func AvailableVersions() []string {
+	var versions []string
+	for _, b := range availableBundles() {
+		versions = append(versions, b.version)
+	}
+	return versions
+}
+
+// availableBundles returns the registered bundles plus the embedded one, newest first.
+func availableBundles() []registeredBundle {
+	registryMu.Lock()
+	bundles := append([]registeredBundle(nil), registry...)
+	registryMu.Unlock()
+
+	if len(embeddedPython) > 0 && !hasVersion(bundles, PythonVersion) {
+		bundles = append(bundles, registeredBundle{PythonVersion, EmbeddedBundle()})
+	}
+	sort.SliceStable(bundles, func(i, j int) bool { return compareVersions(bundles[i].version, bundles[j].version) > 0 })
+	return bundles
+}
+
+func hasVersion(bundles []registeredBundle, version string) bool {
+	for _, b := range bundles {
+		if b.version == version {
+			return true
+		}
+	}
+	return false
+}
+
+// Option configures CreatePythonInstance.
+type Option func(*createOptions)
+
+type createOptions struct {
+	version string
+}
+
+// WithVersion selects the bundle for a Python version such as "3.12". A bare major version
+// ("3") selects the newest matching bundle. Free-threaded builds are only selected by a version
+// ending in "t", such as "3.14t" or "3t".
+func WithVersion(version string) Option {
+	return func(o *createOptions) { o.version = version }
+}
+
+// selectBundle picks the bundle CreatePythonInstance uses.
+func selectBundle(o createOptions) (BundleSource, error) {
+	if o.version == "" {
+		// Without an embedded bundle or GORUNPYTHON_BUNDLE, fall back to the newest registered one
+		if os.Getenv(bundleEnvVar) == "" && len(embeddedPython) == 0 {
+			for _, b := range availableBundles() {
+				if !freeThreaded(b.version) {
+					return b.src, nil
+				}
+			}
+		}
+		return defaultBundleSource(), nil
+	}
+
+	bundles := availableBundles()
+	for _, b := range bundles {
+		if matchesVersion(b.version, o.version) {
+			return b.src, nil
+		}
+	}
+	available := "none"
+	if len(bundles) > 0 {
+		available = strings.Join(AvailableVersions(), ", ")
+	}
+	return nil, fmt.Errorf("python %s is not available (available versions: %s)", o.version, available)
+}
+
+// compareVersions orders dotted versions numerically; a trailing "t" (free-threaded) sorts below
+// the default build of the same version.
+func compareVersions(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y string
+		if i < len(as) {
+			x = as[i]
+		}
+		if i < len(bs) {
+			y = bs[i]
+		}
+		xn, _ := strconv.Atoi(strings.TrimSuffix(x, "t"))
+		yn, _ := strconv.Atoi(strings.TrimSuffix(y, "t"))
+		if xn != yn {
+			return xn - yn
+		}
+		if x != y {
+			if xt, yt := freeThreaded(x), freeThreaded(y); xt != yt {
+				if xt {
+					return -1
+				}
+				return 1
+			}
+			return strings.Compare(x, y)
+		}
+	}
+	return 0
+}
+
+// freeThreaded reports whether version names a free-threaded build, such as "3.14t".
+func freeThreaded(version string) bool {
+	return strings.HasSuffix(version, "t")
+}
+
+// matchesVersion reports whether a bundle of version satisfies a request for want. Free-threaded
+// builds are only picked when want asks for one, e.g. "3.14t" or "3t".
+func matchesVersion(version, want string) bool {
+	if freeThreaded(version) != freeThreaded(want) {
+		return false
+	}
+	version, want = strings.TrimSuffix(version, "t"), strings.TrimSuffix(want, "t")
+	return version == want || strings.HasPrefix(version, want+".")
+}
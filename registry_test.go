@@ -0,0 +1,153 @@
+package gorunpython
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+// withRegistry replaces the bundle registry for the duration of a test.
+func withRegistry(t *testing.T, bundles ...registeredBundle) {
+	t.Helper()
+	registryMu.Lock()
+	saved := registry
+	registry = bundles
+	registryMu.Unlock()
+	t.Cleanup(func() {
+		registryMu.Lock()
+		registry = saved
+		registryMu.Unlock()
+	})
+}
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int // sign only
+	}{
+		{"3.12", "3.12", 0},
+		{"3.12", "3.9", 1},
+		{"3.10", "3.9", 1},
+		{"3.9", "3.10", -1},
+		{"3.12.1", "3.12", 1},
+		{"3.14", "3", 1},
+		{"4.0", "3.99", 1},
+		{"3.14t", "3.14", -1},
+		{"3.14", "3.14t", 1},
+		{"3.14t", "3.13", 1},
+		{"3.13t", "3.14", -1},
+	}
+	for _, tt := range tests {
+		got := compareVersions(tt.a, tt.b)
+		if sign(got) != tt.want {
+			t.Errorf("compareVersions(%q, %q) = %d, want sign %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func sign(n int) int {
+	switch {
+	case n > 0:
+		return 1
+	case n < 0:
+		return -1
+	}
+	return 0
+}
+
+func TestRegisterBundle(t *testing.T) {
+	withRegistry(t)
+	first, second := BundleFromBytes([]byte("first")), BundleFromBytes([]byte("second"))
+	if err := RegisterBundle("3.12", first); err != nil {
+		t.Fatal(err)
+	}
+	if err := RegisterBundle("3.12", second); err != nil {
+		t.Fatal(err)
+	}
+	if len(registry) != 1 || string(registry[0].src.(bytesSource)) != "second" {
+		t.Errorf("registering a version twice left %v", registry)
+	}
+
+	// An empty version comes from the bundle manifest.
+	tarball := tarEntries(t, tarFile(BundleManifestName, testBundleManifest))
+	if err := RegisterBundle("", BundleFromBytes(tarball)); err != nil {
+		t.Fatal(err)
+	}
+	if !hasVersion(registry, "3.14") {
+		t.Errorf("manifest version not registered: %v", registry)
+	}
+	if err := RegisterBundle("", BundleFromBytes(tarEntries(t, tarFile("python/bin/python3", "")))); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("registering a bundle without a version or manifest: %v", err)
+	}
+	if err := RegisterBundle("", BundleFromFile("/nonexistent/bundle")); err == nil {
+		t.Error("registered an unreadable bundle")
+	}
+}
+
+func TestSelectBundle(t *testing.T) {
+	t.Setenv(bundleEnvVar, "")
+	src := func(v string) BundleSource { return BundleFromBytes([]byte(v)) }
+	withRegistry(t,
+		registeredBundle{"3.9", src("3.9")},
+		registeredBundle{"3.12", src("3.12")},
+		registeredBundle{"3.10", src("3.10")},
+		registeredBundle{"2.7", src("2.7")},
+		registeredBundle{"3.13t", src("3.13t")},
+	)
+
+	tests := []struct {
+		version string
+		want    string // bundle contents, or "" for an error
+	}{
+		{"3.10", "3.10"},
+		{"3.1", ""},
+		{"2", "2.7"},
+		{"4", ""},
+		{"3.13", ""},
+		{"3.13t", "3.13t"},
+		{"3t", "3.13t"},
+		{"3.12t", ""},
+	}
+	if len(embeddedPython) == 0 {
+		tests = append(tests, struct{ version, want string }{"", "3.12"}, struct{ version, want string }{"3", "3.12"})
+	}
+	for _, tt := range tests {
+		got, err := selectBundle(createOptions{version: tt.version})
+		if tt.want == "" {
+			if err == nil || !strings.Contains(err.Error(), "3.10") {
+				t.Errorf("selectBundle(%q) = %v, %v; want an error listing the versions", tt.version, got, err)
+			}
+			continue
+		}
+		if err != nil || string(got.(bytesSource)) != tt.want {
+			t.Errorf("selectBundle(%q) = %v, %v; want %s", tt.version, got, err, tt.want)
+		}
+	}
+
+	// GORUNPYTHON_BUNDLE wins over registered bundles when no version is asked for.
+	t.Setenv(bundleEnvVar, "/some/bundle")
+	if got, err := selectBundle(createOptions{}); err != nil || got.String() != "/some/bundle" {
+		t.Errorf("selectBundle with %s = %v, %v", bundleEnvVar, got, err)
+	}
+}
+
+func TestAvailableVersionsOrder(t *testing.T) {
+	withRegistry(t,
+		registeredBundle{"3.9", nil},
+		registeredBundle{"3.13t", nil},
+		registeredBundle{"3.13", nil},
+	)
+	got := strings.Join(AvailableVersions(), " ")
+	want := "3.13 3.13t 3.9"
+	if len(embeddedPython) > 0 {
+		// The embedded version sorts in among the registered ones.
+		if !strings.Contains(got, PythonVersion) {
+			t.Errorf("AvailableVersions() = %s, missing embedded %s", got, PythonVersion)
+		}
+		return
+	}
+	if got != want {
+		t.Errorf("AvailableVersions() = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,370 @@
+package gorunpython
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// RelocationManifestName is the file at the root of a Python bundle that describes which files
+// contain the install prefix the bundle was built with.
+const RelocationManifestName = ".gorunpython-relocation.json"
+
+// maxShebangLength is the longest "#!" line Linux will honour; longer interpreter lines are
+// replaced with a /bin/sh trampoline.
+const maxShebangLength = 127
+
+// RelocationKind says how the original prefix is rewritten in a file.
+type RelocationKind string
+
+const (
+	// RelocateText replaces every occurrence of the prefix; the file may change length.
+	RelocateText RelocationKind = "text"
+	// RelocateShebang is a script whose "#!" line names an interpreter under the prefix. The
+	// interpreter line is rewritten, falling back to a trampoline if it would grow too long, and
+	// the rest of the file is treated as text.
+	RelocateShebang RelocationKind = "shebang"
+	// RelocateBinary replaces the prefix inside NUL-terminated strings, padding with NULs so the
+	// file keeps its size. If the new prefix is longer than the original the file is left alone,
+	// and the interpreter finds its libraries through the RPATH and the launcher instead.
+	RelocateBinary RelocationKind = "binary"
+)
+
+// RelocationManifest lists the files in a bundle that embed the original install prefix.
+type RelocationManifest struct {
+	// Prefix is the absolute install prefix the bundle was built with.
+	Prefix string `json:"prefix"`
+	// Root is the slash-separated directory in the bundle that corresponds to Prefix.
+	Root  string           `json:"root"`
+	Files []RelocationFile `json:"files"`
+	// Relocated is the absolute prefix the files were last rewritten to. It is set in extracted
+	// trees, not in bundles.
+	Relocated string `json:"relocated,omitempty"`
+}
+
+// RelocationFile is one file that needs rewriting. Path is slash-separated and relative to the
+// bundle root.
+type RelocationFile struct {
+	Path string         `json:"path"`
+	Kind RelocationKind `json:"kind"`
+}
+
+// GenerateRelocationManifest scans the extracted bundle in dir for files containing prefix and
+// classifies each one. root is the directory inside dir that prefix was installed to.
+func GenerateRelocationManifest(dir, prefix, root string) (*RelocationManifest, error) {
+	if !path.IsAbs(prefix) {
+		return nil, fmt.Errorf("prefix %q is not absolute", prefix)
+	}
+	root, err := cleanArchivePath(root)
+	if err != nil {
+		return nil, err
+	}
+	m := &RelocationManifest{Prefix: path.Clean(prefix), Root: root}
+	old := []byte(m.Prefix)
+	err = filepath.WalkDir(dir, func(p string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel == RelocationManifestName || rel == manifestFileName {
+			return nil
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		if !bytes.Contains(data, old) {
+			return nil
+		}
+		kind := RelocateText
+		switch {
+		case bytes.IndexByte(data, 0) >= 0:
+			kind = RelocateBinary
+		case bytes.HasPrefix(data, []byte("#!")) && bytes.Contains(firstLine(data), old):
+			kind = RelocateShebang
+		}
+		m.Files = append(m.Files, RelocationFile{Path: rel, Kind: kind})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("scan for prefix: %w", err)
+	}
+	sort.Slice(m.Files, func(i, j int) bool { return m.Files[i].Path < m.Files[j].Path })
+	return m, nil
+}
+
+// WriteRelocationManifest stores m at the root of dir so it is packed into the bundle.
+func WriteRelocationManifest(dir string, m *RelocationManifest) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode relocation manifest: %w", err)
+	}
+	return os.WriteFile(filepath.Join(dir, RelocationManifestName), append(data, '\n'), 0o644)
+}
+
+// readRelocationManifest returns the manifest in dir, or nil if the bundle has none.
+func readRelocationManifest(dir string) (*RelocationManifest, error) {
+	data, err := os.ReadFile(filepath.Join(dir, RelocationManifestName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read relocation manifest: %w", err)
+	}
+	var m RelocationManifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("decode relocation manifest: %w", err)
+	}
+	if !path.IsAbs(m.Prefix) {
+		return nil, fmt.Errorf("relocation manifest has non-absolute prefix %q", m.Prefix)
+	}
+	return &m, nil
+}
+
+// relocateTree rewrites the files listed in dir's relocation manifest so they refer to where the
+// bundle was extracted, and records that location in the manifest. It reports false if the bundle
+// has no manifest. Running it again is harmless: occurrences of the original prefix that are part
+// of the new one are left alone, files re-extracted by a repair are rewritten, and files of a
+// tree that was moved are rewritten from its previous location.
+func relocateTree(dir string) (bool, error) {
+	m, err := readRelocationManifest(dir)
+	if err != nil || m == nil {
+		return false, err
+	}
+	root, err := cleanArchivePath(m.Root)
+	if err != nil {
+		return true, err
+	}
+	newPrefix, err := filepath.Abs(filepath.Join(dir, filepath.FromSlash(root)))
+	if err != nil {
+		return true, err
+	}
+	oldPrefixes := []string{m.Prefix}
+	if m.Relocated != "" && m.Relocated != newPrefix && m.Relocated != m.Prefix {
+		oldPrefixes = append([]string{m.Relocated}, oldPrefixes...)
+	}
+	for _, f := range m.Files {
+		name, err := cleanArchivePath(f.Path)
+		if err != nil {
+			return true, err
+		}
+		rewritten := false
+		for _, oldPrefix := range oldPrefixes {
+			changed, err := relocateFile(filepath.Join(dir, filepath.FromSlash(name)), f.Kind, oldPrefix, newPrefix)
+			if errors.Is(err, errPrefixTooLong) {
+				if noisy != "" {
+					fmt.Println("Leaving binary at its build prefix: ", f.Path)
+				}
+				continue
+			}
+			if err != nil {
+				return true, fmt.Errorf("relocate %s: %w", f.Path, err)
+			}
+			rewritten = rewritten || changed
+		}
+		if rewritten && noisy != "" {
+			fmt.Println("Relocated: ", f.Path)
+		}
+	}
+	if m.Relocated != newPrefix {
+		m.Relocated = newPrefix
+		if err := WriteRelocationManifest(dir, m); err != nil {
+			return true, fmt.Errorf("record relocation: %w", err)
+		}
+	}
+	return true, nil
+}
+
+// relocateFile rewrites oldPrefix to newPrefix in the file at filePath, and reports whether the
+// file changed. Missing files and files without oldPrefix are left alone.
+func relocateFile(filePath string, kind RelocationKind, oldPrefix, newPrefix string) (bool, error) {
+	data, err := os.ReadFile(filePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	old, repl := []byte(oldPrefix), []byte(newPrefix)
+	if oldPrefix == newPrefix || !bytes.Contains(data, old) {
+		return false, nil
+	}
+
+	var out []byte
+	switch kind {
+	case RelocateText:
+		out = replacePrefix(data, old, repl)
+	case RelocateShebang:
+		out, err = relocateShebang(data, old, repl)
+	case RelocateBinary:
+		out, err = relocateBinary(data, old, repl)
+	default:
+		err = fmt.Errorf("unknown relocation kind %q", kind)
+	}
+	if err != nil {
+		return false, err
+	}
+	if bytes.Equal(out, data) {
+		return false, nil
+	}
+	// WriteFile keeps the mode of an existing file.
+	return true, os.WriteFile(filePath, out, 0o644)
+}
+
+// relocateShebang rewrites the interpreter line of a script, switching to a /bin/sh trampoline
+// when the new line is too long for the kernel or the interpreter path contains whitespace.
+func relocateShebang(data, old, repl []byte) ([]byte, error) {
+	line := firstLine(data)
+	body := replacePrefix(data[len(line):], old, repl)
+	newLine := replacePrefix(line, old, repl)
+
+	fields := strings.Fields(strings.TrimSpace(string(line[2:])))
+	if len(fields) == 0 {
+		return nil, errors.New("empty interpreter line")
+	}
+	interp := string(replacePrefix([]byte(fields[0]), old, repl))
+	if len(bytes.TrimRight(newLine, "\r\n")) <= maxShebangLength && !strings.ContainsAny(interp, " \t") {
+		return append(newLine, body...), nil
+	}
+	if !strings.HasPrefix(path.Base(filepath.ToSlash(interp)), "python") {
+		return nil, fmt.Errorf("interpreter line for %s would exceed %d bytes", interp, maxShebangLength)
+	}
+	return append([]byte(shTrampoline(interp, fields[1:])), body...), nil
+}
+
+// shTrampoline returns script lines that are valid as both sh and Python: sh execs interp with
+// args and the script, and Python sees a string literal.
+func shTrampoline(interp string, args []string) string {
+	words := append([]string{shellQuote(interp)}, args...)
+	return fmt.Sprintf("#!/bin/sh\n'''exec' %s \"$0\" \"$@\"\n' '''\n", strings.Join(words, " "))
+}
+
+// errPrefixTooLong is returned by relocateBinary when the new prefix does not fit.
+var errPrefixTooLong = errors.New("new prefix is longer than the original and cannot be patched into a binary")
+
+// relocateBinary replaces old inside each NUL-terminated string that contains it and pads the
+// string with NULs so offsets elsewhere in the file stay valid.
+func relocateBinary(data, old, repl []byte) ([]byte, error) {
+	out := append([]byte(nil), data...)
+	for i := 0; ; {
+		at := bytes.Index(out[i:], old)
+		if at < 0 {
+			return out, nil
+		}
+		start := i + at
+		end := bytes.IndexByte(out[start:], 0)
+		if end < 0 {
+			end = len(out)
+		} else {
+			end += start
+		}
+		seg := replacePrefix(out[start:end], old, repl)
+		if len(seg) > end-start {
+			return nil, errPrefixTooLong
+		}
+		n := copy(out[start:end], seg)
+		clear(out[start+n : end])
+		i = end
+	}
+}
+
+// replacePrefix replaces old with repl in data, except where old is part of an occurrence of
+// repl, so that replacing again changes nothing even when repl contains old.
+func replacePrefix(data, old, repl []byte) []byte {
+	var within []int // offsets of old inside repl
+	for k := 0; k+len(old) <= len(repl); k++ {
+		if bytes.HasPrefix(repl[k:], old) {
+			within = append(within, k)
+		}
+	}
+	if len(within) == 0 {
+		return bytes.ReplaceAll(data, old, repl)
+	}
+	var out []byte
+	for i := 0; ; {
+		at := bytes.Index(data[i:], old)
+		if at < 0 {
+			return append(out, data[i:]...)
+		}
+		j := i + at
+		kept := false
+		for _, k := range within {
+			if j-k >= i && bytes.HasPrefix(data[j-k:], repl) {
+				out = append(out, data[i:j-k+len(repl)]...)
+				i, kept = j-k+len(repl), true
+				break
+			}
+		}
+		if !kept {
+			out = append(append(out, data[i:j]...), repl...)
+			i = j + len(old)
+		}
+	}
+}
+
+func firstLine(data []byte) []byte {
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		return data[:i+1]
+	}
+	return data
+}
+
+func shellQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, `$`, `\$`, "`", "\\`").Replace(s) + `"`
+}
+
+// fixLegacyShebangs handles bundles without a relocation manifest: scripts in binDir whose
+// interpreter is a missing python* binary are pointed at the interpreter of the same name in
+// binDir.
+func fixLegacyShebangs(binDir string) error {
+	entries, err := os.ReadDir(binDir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if !e.Type().IsRegular() {
+			continue
+		}
+		p := filepath.Join(binDir, e.Name())
+		prefix, err := readFilePrefix(p, 512)
+		if err != nil || !bytes.HasPrefix(prefix, []byte("#!")) {
+			continue
+		}
+		fields := strings.Fields(string(bytes.TrimPrefix(firstLine(prefix), []byte("#!"))))
+		if len(fields) == 0 || !filepath.IsAbs(fields[0]) {
+			continue
+		}
+		interp := fields[0]
+		base := filepath.Base(interp)
+		if !strings.HasPrefix(base, "python") {
+			continue
+		}
+		if _, err := os.Stat(interp); err == nil {
+			continue
+		}
+		local := filepath.Join(binDir, base)
+		if _, err := os.Stat(local); err != nil {
+			continue
+		}
+		if _, err := relocateFile(p, RelocateShebang, interp, local); err != nil {
+			return fmt.Errorf("fix shebang of %s: %w", p, err)
+		}
+		if noisy != "" {
+			fmt.Println("Corrected shebang in file: ", p)
+		}
+	}
+	return nil
+}
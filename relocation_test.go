@@ -0,0 +1,204 @@
+package gorunpython
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReplacePrefix(t *testing.T) {
+	tests := []struct {
+		data, old, repl, want string
+	}{
+		{"/opt/py/lib:/opt/py/bin", "/opt/py", "/new", "/new/lib:/new/bin"},
+		{"no prefix here", "/opt/py", "/new", "no prefix here"},
+		// repl contains old at its start, middle or end
+		{"/opt/py/lib", "/opt/py", "/opt/py/x", "/opt/py/x/lib"},
+		{"/opt/py/x/lib", "/opt/py", "/opt/py/x", "/opt/py/x/lib"},
+		{"/opt/py/x/lib /opt/py/bin", "/opt/py", "/opt/py/x", "/opt/py/x/lib /opt/py/x/bin"},
+		{"/home/opt/py/lib", "/opt/py", "/home/opt/py", "/home/opt/py/lib"},
+		{"/opt/py/lib", "/opt/py", "/home/opt/py", "/home/opt/py/lib"},
+		{"/opt/py/opt/py", "/opt/py", "/opt/py/opt/py", "/opt/py/opt/py"},
+	}
+	for _, tt := range tests {
+		got := string(replacePrefix([]byte(tt.data), []byte(tt.old), []byte(tt.repl)))
+		if got != tt.want {
+			t.Errorf("replacePrefix(%q, %q, %q) = %q, want %q", tt.data, tt.old, tt.repl, got, tt.want)
+		}
+		if again := string(replacePrefix([]byte(got), []byte(tt.old), []byte(tt.repl))); again != got {
+			t.Errorf("replacing %q again gave %q", got, again)
+		}
+	}
+}
+
+func TestRelocateShebang(t *testing.T) {
+	long := "/" + strings.Repeat("d", maxShebangLength)
+	tests := []struct {
+		name, data, repl, want string
+		err                    bool
+	}{
+		{"short", "#!/opt/py/bin/python3 -E\nprint('/opt/py')\n", "/new", "#!/new/bin/python3 -E\nprint('/new')\n", false},
+		{"too long", "#!/opt/py/bin/python3\nx\n", long, "#!/bin/sh\n'''exec' \"" + long + "/bin/python3\" \"$0\" \"$@\"\n' '''\nx\n", false},
+		{"whitespace", "#!/opt/py/bin/python3\n", "/new dir", "#!/bin/sh\n'''exec' \"/new dir/bin/python3\" \"$0\" \"$@\"\n' '''\n", false},
+		{"not python", "#!/opt/py/bin/perl\n", long, "", true},
+		{"empty", "#!\n/opt/py\n", "/new", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := relocateShebang([]byte(tt.data), []byte("/opt/py"), []byte(tt.repl))
+			if (err != nil) != tt.err {
+				t.Fatalf("err = %v, want error %v", err, tt.err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRelocateBinary(t *testing.T) {
+	data := []byte("\x7fELF\x00/opt/python/lib\x00other\x00/opt/python\x00")
+	got, err := relocateBinary(data, []byte("/opt/python"), []byte("/new"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []byte("\x7fELF\x00/new/lib\x00\x00\x00\x00\x00\x00\x00\x00other\x00/new\x00\x00\x00\x00\x00\x00\x00\x00")
+	if !bytes.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if _, err := relocateBinary(data, []byte("/opt/python"), []byte("/a/much/longer/prefix")); err != errPrefixTooLong {
+		t.Errorf("err = %v, want errPrefixTooLong", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "libpython.so")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if changed, err := relocateFile(path, RelocateBinary, "/opt/python", "/a/much/longer/prefix"); changed || err != errPrefixTooLong {
+		t.Errorf("relocateFile = %v, %v; want unchanged and errPrefixTooLong", changed, err)
+	}
+	if got, _ := os.ReadFile(path); !bytes.Equal(got, data) {
+		t.Errorf("binary was rewritten to %q", got)
+	}
+}
+
+// relocatableTree writes a bundle built at /opt/py whose files are listed in its relocation
+// manifest, and returns the extraction directory.
+func relocatableTree(t *testing.T) string {
+	t.Helper()
+	dir := writeTree(t, "python-tmp", map[string]string{
+		"python/bin/pip":            "#!/opt/py/bin/python3\nimport pip\n",
+		"python/lib/sysconfig.py":   "PREFIX = '/opt/py'\nLIBDIR = '/opt/py/lib'\n",
+		"python/lib/libpython.so":   "\x7fELF\x00/opt/py/lib\x00",
+		"python/lib/pkgconfig/a.pc": "prefix=/opt/py\n",
+	})
+	m := &RelocationManifest{Prefix: "/opt/py", Root: "python", Files: []RelocationFile{
+		{"python/bin/pip", RelocateShebang},
+		{"python/lib/libpython.so", RelocateBinary},
+		{"python/lib/pkgconfig/a.pc", RelocateText},
+		{"python/lib/sysconfig.py", RelocateText},
+		{"python/missing.txt", RelocateText},
+	}}
+	if err := WriteRelocationManifest(dir, m); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestRelocateTreeTwice(t *testing.T) {
+	dir := relocatableTree(t)
+	newPrefix := filepath.Join(dir, "python")
+	for run := 1; run <= 2; run++ {
+		relocated, err := relocateTree(dir)
+		if err != nil || !relocated {
+			t.Fatalf("run %d: relocateTree = %v, %v", run, relocated, err)
+		}
+		got, _ := os.ReadFile(filepath.Join(dir, "python/lib/sysconfig.py"))
+		if want := "PREFIX = '" + newPrefix + "'\nLIBDIR = '" + newPrefix + "/lib'\n"; string(got) != want {
+			t.Errorf("run %d: sysconfig.py = %q, want %q", run, got, want)
+		}
+		got, _ = os.ReadFile(filepath.Join(dir, "python/bin/pip"))
+		if !strings.HasPrefix(string(got), "#!"+newPrefix+"/bin/python3\n") && !strings.Contains(string(got), "'''exec' \""+newPrefix+"/bin/python3\"") {
+			t.Errorf("run %d: pip = %q", run, got)
+		}
+		// The extraction path is longer than the build prefix, so the binary is left alone.
+		got, _ = os.ReadFile(filepath.Join(dir, "python/lib/libpython.so"))
+		if string(got) != "\x7fELF\x00/opt/py/lib\x00" {
+			t.Errorf("run %d: libpython.so = %q", run, got)
+		}
+	}
+	m, err := readRelocationManifest(dir)
+	if err != nil || m.Relocated != newPrefix {
+		t.Errorf("manifest records %q, %v; want %q", m.Relocated, err, newPrefix)
+	}
+}
+
+func TestRelocateTreeInsideBuildPrefix(t *testing.T) {
+	// Extracting below the build prefix makes the new prefix contain the old one.
+	dir := writeTree(t, "python-tmp", map[string]string{"python/lib/a.txt": "x"})
+	newPrefix := filepath.Join(dir, "python")
+	oldPrefix := filepath.Dir(dir)
+	if err := os.WriteFile(filepath.Join(dir, "python/lib/a.txt"), []byte(oldPrefix+"/lib"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	m := &RelocationManifest{Prefix: oldPrefix, Root: "python", Files: []RelocationFile{{"python/lib/a.txt", RelocateText}}}
+	if err := WriteRelocationManifest(dir, m); err != nil {
+		t.Fatal(err)
+	}
+	for range 2 {
+		if _, err := relocateTree(dir); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, _ := os.ReadFile(filepath.Join(dir, "python/lib/a.txt")); string(got) != newPrefix+"/lib" {
+		t.Errorf("a.txt = %q, want %q", got, newPrefix+"/lib")
+	}
+}
+
+func TestRelocateTreeMoved(t *testing.T) {
+	dir := relocatableTree(t)
+	if _, err := relocateTree(dir); err != nil {
+		t.Fatal(err)
+	}
+	moved := filepath.Join(t.TempDir(), "moved")
+	if err := os.Rename(dir, moved); err != nil {
+		t.Fatal(err)
+	}
+	// A repair restores a file with the build prefix while others point at the old location.
+	if err := os.WriteFile(filepath.Join(moved, "python/lib/pkgconfig/a.pc"), []byte("prefix=/opt/py\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := relocateTree(moved); err != nil {
+		t.Fatal(err)
+	}
+	newPrefix := filepath.Join(moved, "python")
+	for name, want := range map[string]string{
+		"python/lib/sysconfig.py":   "PREFIX = '" + newPrefix + "'\nLIBDIR = '" + newPrefix + "/lib'\n",
+		"python/lib/pkgconfig/a.pc": "prefix=" + newPrefix + "\n",
+	} {
+		if got, _ := os.ReadFile(filepath.Join(moved, name)); string(got) != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestRelocateFileLeavesRelocatedFiles(t *testing.T) {
+	dir := writeTree(t, "tree", map[string]string{"a.txt": "/new/lib"})
+	path := filepath.Join(dir, "a.txt")
+	if changed, err := relocateFile(path, RelocateText, "/new", "/new/x"); err != nil || !changed {
+		t.Fatalf("relocateFile = %v, %v", changed, err)
+	}
+	if got, _ := os.ReadFile(path); string(got) != "/new/x/lib" {
+		t.Fatalf("a.txt = %q", got)
+	}
+	before, _ := os.Stat(path)
+	if changed, err := relocateFile(path, RelocateText, "/new", "/new/x"); err != nil || changed {
+		t.Fatalf("second relocateFile = %v, %v", changed, err)
+	}
+	// Rewriting identical content would still look like a modification to the integrity check.
+	if after, _ := os.Stat(path); !after.ModTime().Equal(before.ModTime()) {
+		t.Error("a second relocation rewrote an already relocated file")
+	}
+}
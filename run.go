@@ -0,0 +1,124 @@
+package gorunpython
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+// RunSpec describes one run of the instance's python.
+type RunSpec struct {
+	// Args are passed to python, e.g. {"script.py"} or {"-c", code}.
+	Args []string
+	// Dir is the working directory; empty means the current one.
+	Dir string
+	// Env adds variables on top of the isolation profile.
+	Env []string
+	// Stdin is python's standard input; nil means none.
+	Stdin io.Reader
+	// Stdout and Stderr receive python's output; nil means this process's own.
+	Stdout io.Writer
+	Stderr io.Writer
+	// Sandbox, if set, contains the run (see Sandbox).
+	Sandbox *Sandbox
+	// Limits caps the run's resources (see Limits).
+	Limits Limits
+}
+
+// Result describes how a run ended.
+type Result struct {
+	// ExitCode is python's exit status, or -1 if it was killed by a signal.
+	ExitCode int
+	// Signal is the signal that killed python, if any.
+	Signal os.Signal
+	// LimitExceeded is the limit that stopped python, or "" if none did.
+	LimitExceeded Limit
+	// UserTime and SystemTime are the processor time python used.
+	UserTime   time.Duration
+	SystemTime time.Duration
+	// WallTime is how long the run took.
+	WallTime time.Duration
+}
+
+// Run runs the instance's python as described by spec and waits for it to finish. The Result is
+// returned whenever python started. The error is an *exec.ExitError if python failed, or wraps
+// ErrLimitExceeded if one of its limits stopped it.
+func (p *pythonInstance) Run(spec RunSpec) (*Result, error) {
+	cmd := exec.Command(p.Python, spec.Args...)
+	cmd.Dir = spec.Dir
+	cmd.Env = append(pythonEnv(), spec.Env...)
+	cmd.Stdin = spec.Stdin
+	cmd.Stdout = spec.Stdout
+	if cmd.Stdout == nil {
+		cmd.Stdout = os.Stdout
+	}
+	cmd.Stderr = spec.Stderr
+	if cmd.Stderr == nil {
+		cmd.Stderr = os.Stderr
+	}
+
+	limits, err := prepareLimits(spec.Limits, p.launcher != "" && p.Python == p.launcher)
+	if err != nil {
+		return nil, err
+	}
+	defer limits.close()
+	cmd.Env = append(cmd.Env, limits.env()...)
+	var budget *outputBudget
+	if spec.Limits.OutputBytes > 0 {
+		budget = &outputBudget{remaining: spec.Limits.OutputBytes, onExceed: func() { limits.kill(cmd.Process) }}
+		cmd.Stdout = budget.writer(cmd.Stdout)
+		cmd.Stderr = budget.writer(cmd.Stderr)
+	}
+
+	callbacksStarted, stopCallbacks, err := p.registeredCallbacks().attach(cmd)
+	if err != nil {
+		return nil, err
+	}
+	defer stopCallbacks()
+
+	if spec.Sandbox != nil {
+		cleanup, err := spec.Sandbox.apply(cmd, p.ExtractionPath, limits.childLimits())
+		if err != nil {
+			return nil, fmt.Errorf("sandbox: %w", err)
+		}
+		defer cleanup()
+	}
+	if err := limits.setup(cmd, spec.Sandbox != nil); err != nil {
+		return nil, fmt.Errorf("apply limits: %w", err)
+	}
+
+	start := time.Now()
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	if err := limits.started(cmd.Process); err != nil {
+		limits.kill(cmd.Process)
+		cmd.Wait()
+		return nil, fmt.Errorf("apply limits: %w", err)
+	}
+	callbacksStarted()
+	waitErr := cmd.Wait()
+
+	ps := cmd.ProcessState
+	res := &Result{
+		ExitCode:   ps.ExitCode(),
+		UserTime:   ps.UserTime(),
+		SystemTime: ps.SystemTime(),
+		WallTime:   time.Since(start),
+	}
+	if ws, ok := ps.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+		res.Signal = ws.Signal()
+	}
+	if budget != nil && budget.exceeded {
+		res.LimitExceeded = LimitOutput
+	} else {
+		res.LimitExceeded = limits.exceeded(ps)
+	}
+	if res.LimitExceeded != "" {
+		return res, fmt.Errorf("python exceeded its %s limit: %w", res.LimitExceeded, ErrLimitExceeded)
+	}
+	return res, waitErr
+}
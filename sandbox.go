@@ -0,0 +1,25 @@
+package gorunpython
+
+import "errors"
+
+// ErrSandboxUnsupported is returned by Run for a sandboxed spec on a platform without sandbox
+// support.
+var ErrSandboxUnsupported = errors.New("sandbox is not supported on this platform")
+
+// Sandbox contains a python run on Linux. Python starts in new user, mount, pid, network, IPC and
+// UTS namespaces, so it has no network and sees only its own processes. Its file system is the
+// host's system directories and the extracted python tree, mounted read-only, plus a private
+// /tmp, a writable scratch directory and the paths listed here. It runs in a session of its own
+// without a controlling terminal. A seccomp allowlist turns away system calls that could escape
+// or inspect the host, such as mount, ptrace, bpf or setns, and terminal ioctls like TIOCSTI.
+//
+// It needs unprivileged user namespaces. On other platforms Run returns ErrSandboxUnsupported.
+type Sandbox struct {
+	// Scratch is the writable directory, mounted at the same path. Empty means a fresh temporary
+	// directory removed after the run. The working directory defaults to it.
+	Scratch string
+	// ReadOnly are further host paths to mount read-only, e.g. the directory of a script.
+	ReadOnly []string
+	// Writable are further host paths to mount read-write.
+	Writable []string
+}
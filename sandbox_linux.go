@@ -0,0 +1,399 @@
+package gorunpython
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/ZacTyAdams/go-run-python/v2/internal/rlimit"
+)
+
+// sandboxArg0 is the argv[0] of the copy of this program that sets the sandbox up inside the
+// new namespaces before it becomes python. Its argv[1] is the descriptor of an unlinked file
+// holding the configuration.
+const sandboxArg0 = "gorunpython-sandbox"
+
+// sandboxSystemDirs are mirrored read-only into every sandbox so dynamically linked programs
+// and the host's certificates and time zones keep working.
+var sandboxSystemDirs = []string{"/bin", "/sbin", "/usr", "/lib", "/lib32", "/lib64", "/libx32", "/etc"}
+
+// sandboxDevices are the device nodes bound into the sandbox's /dev. There is no tty: python
+// runs in a session of its own, without a controlling terminal.
+var sandboxDevices = []string{"null", "zero", "full", "random", "urandom"}
+
+// sandboxConfig is what the sandbox helper needs to build the sandbox and start python in it.
+type sandboxConfig struct {
+	Root     string   `json:"root"`
+	Path     string   `json:"path"`
+	Args     []string `json:"args"`
+	Dir      string   `json:"dir"`
+	ReadOnly []string `json:"read_only"`
+	Writable []string `json:"writable"`
+	// Limits are set on the helper as it becomes python.
+	Limits []rlimit.Limit `json:"limits,omitempty"`
+}
+
+func init() {
+	// Only the helper started by apply runs as pid 1 under this name with the configuration on an
+	// inherited descriptor; the environment is not trusted for this
+	if len(os.Args) == 2 && os.Args[0] == sandboxArg0 && os.Getpid() == 1 {
+		sandboxMain(os.Args[1])
+	}
+}
+
+// apply makes cmd start in a sandbox around the python tree at root, with limits set right
+// before python starts. The returned function removes the temporary directories once cmd has
+// finished.
+func (s *Sandbox) apply(cmd *exec.Cmd, root string, limits []rlimit.Limit) (func(), error) {
+	if seccompArch == 0 {
+		return nil, fmt.Errorf("%w: no seccomp filter for %s", ErrSandboxUnsupported, runtime.GOARCH)
+	}
+	var temps []string
+	var config *os.File
+	cleanup := func() {
+		if config != nil {
+			config.Close()
+		}
+		for _, d := range temps {
+			os.RemoveAll(d)
+		}
+	}
+
+	scratch := s.Scratch
+	if scratch == "" {
+		d, err := os.MkdirTemp("", "gorunpython-scratch")
+		if err != nil {
+			return nil, err
+		}
+		temps = append(temps, d)
+		scratch = d
+	}
+	newRoot, err := os.MkdirTemp("", "gorunpython-sandbox")
+	if err != nil {
+		cleanup()
+		return nil, err
+	}
+	temps = append(temps, newRoot)
+
+	cfg := sandboxConfig{Root: newRoot, Path: cmd.Path, Args: cmd.Args, Limits: limits}
+	for _, p := range append([]string{scratch}, s.Writable...) {
+		abs, err := filepath.Abs(p)
+		if err != nil {
+			cleanup()
+			return nil, err
+		}
+		cfg.Writable = append(cfg.Writable, abs)
+	}
+	for _, p := range append([]string{root}, s.ReadOnly...) {
+		abs, err := filepath.Abs(p)
+		if err != nil {
+			cleanup()
+			return nil, err
+		}
+		cfg.ReadOnly = append(cfg.ReadOnly, abs)
+	}
+	cfg.Dir = cfg.Writable[0]
+	if cmd.Dir != "" {
+		if cfg.Dir, err = filepath.Abs(cmd.Dir); err != nil {
+			cleanup()
+			return nil, err
+		}
+		if !withinAny(cfg.Dir, cfg.Writable) && !withinAny(cfg.Dir, cfg.ReadOnly) {
+			cfg.ReadOnly = append(cfg.ReadOnly, cfg.Dir)
+		}
+	}
+	if config, err = writeSandboxConfig(&cfg, newRoot); err != nil {
+		cleanup()
+		return nil, err
+	}
+
+	fd := 3 + len(cmd.ExtraFiles)
+	cmd.ExtraFiles = append(cmd.ExtraFiles, config)
+	cmd.Path = "/proc/self/exe"
+	cmd.Args = []string{sandboxArg0, strconv.Itoa(fd)}
+	cmd.Dir = ""
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Cloneflags: syscall.CLONE_NEWUSER | syscall.CLONE_NEWNS | syscall.CLONE_NEWPID | syscall.CLONE_NEWNET |
+			syscall.CLONE_NEWIPC | syscall.CLONE_NEWUTS,
+		UidMappings:                []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getuid(), Size: 1}},
+		GidMappings:                []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getgid(), Size: 1}},
+		GidMappingsEnableSetgroups: false,
+		Pdeathsig:                  syscall.SIGKILL,
+	}
+	return cleanup, nil
+}
+
+// writeSandboxConfig stores cfg in an unlinked file in dir and returns it open for the helper
+// to read.
+func writeSandboxConfig(cfg *sandboxConfig, dir string) (*os.File, error) {
+	raw, err := json.Marshal(cfg)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.CreateTemp(dir, "config")
+	if err != nil {
+		return nil, err
+	}
+	os.Remove(f.Name())
+	if _, err := f.Write(raw); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+func withinAny(path string, dirs []string) bool {
+	for _, d := range dirs {
+		if path == d || strings.HasPrefix(path, d+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// sandboxMain runs in the helper: it builds the sandbox, locks it down and becomes python.
+func sandboxMain(configFD string) {
+	// The seccomp filter is installed on this thread and carried over by exec
+	runtime.LockOSThread()
+
+	cfg, err := readSandboxConfig(configFD)
+	if err != nil {
+		sandboxFail(err)
+	}
+	// A session of its own leaves python without a controlling terminal to push input into
+	if _, err := syscall.Setsid(); err != nil {
+		sandboxFail(fmt.Errorf("new session: %w", err))
+	}
+	if err := cfg.enter(); err != nil {
+		sandboxFail(err)
+	}
+	if err := installSeccomp(); err != nil {
+		sandboxFail(err)
+	}
+	// Last, so nothing above runs short of memory or descriptors
+	if err := rlimit.Apply(cfg.Limits); err != nil {
+		sandboxFail(err)
+	}
+	err = syscall.Exec(cfg.Path, cfg.Args, os.Environ())
+	sandboxFail(fmt.Errorf("exec %s: %w", cfg.Path, err))
+}
+
+// readSandboxConfig reads the configuration apply passed on descriptor fd and closes it.
+func readSandboxConfig(fd string) (*sandboxConfig, error) {
+	n, err := strconv.Atoi(fd)
+	if err != nil || n < 3 {
+		return nil, fmt.Errorf("invalid configuration descriptor %q", fd)
+	}
+	f := os.NewFile(uintptr(n), "sandbox-config")
+	defer f.Close()
+	var cfg sandboxConfig
+	if err := json.NewDecoder(f).Decode(&cfg); err != nil {
+		return nil, fmt.Errorf("decode configuration: %w", err)
+	}
+	return &cfg, nil
+}
+
+func sandboxFail(err error) {
+	fmt.Fprintln(os.Stderr, "gorunpython sandbox:", err)
+	os.Exit(126)
+}
+
+// enter builds the sandbox's file system in a tmpfs at c.Root and switches to it.
+func (c *sandboxConfig) enter() error {
+	// Keep the mounts below from propagating back to the host
+	if err := syscall.Mount("", "/", "", syscall.MS_REC|syscall.MS_PRIVATE, ""); err != nil {
+		return fmt.Errorf("make mounts private: %w", err)
+	}
+	if err := syscall.Mount("tmpfs", c.Root, "tmpfs", syscall.MS_NOSUID|syscall.MS_NODEV, "mode=0755"); err != nil {
+		return fmt.Errorf("mount root: %w", err)
+	}
+	for _, d := range sandboxSystemDirs {
+		if err := c.mirror(d); err != nil {
+			return err
+		}
+	}
+	if err := c.mountTmpfs("/tmp", "mode=1777"); err != nil {
+		return err
+	}
+
+	type bind struct {
+		path     string
+		readOnly bool
+	}
+	var binds []bind
+	for _, p := range c.ReadOnly {
+		binds = append(binds, bind{p, true})
+	}
+	for _, p := range c.Writable {
+		binds = append(binds, bind{p, false})
+	}
+	// Parents before children
+	sort.SliceStable(binds, func(i, j int) bool { return binds[i].path < binds[j].path })
+	for _, b := range binds {
+		if err := c.bind(b.path, b.readOnly); err != nil {
+			return err
+		}
+	}
+
+	if err := c.mountProc(); err != nil {
+		return err
+	}
+	if err := c.mountDev(); err != nil {
+		return err
+	}
+
+	oldRoot := filepath.Join(c.Root, ".oldroot")
+	if err := os.Mkdir(oldRoot, 0o700); err != nil {
+		return err
+	}
+	if err := syscall.PivotRoot(c.Root, oldRoot); err != nil {
+		return fmt.Errorf("pivot root: %w", err)
+	}
+	if err := os.Chdir("/"); err != nil {
+		return err
+	}
+	if err := syscall.Unmount("/.oldroot", syscall.MNT_DETACH); err != nil {
+		return fmt.Errorf("detach host root: %w", err)
+	}
+	if err := os.Remove("/.oldroot"); err != nil {
+		return err
+	}
+	if err := syscall.Mount("", "/", "", syscall.MS_REMOUNT|syscall.MS_BIND|syscall.MS_RDONLY|syscall.MS_NOSUID|syscall.MS_NODEV, ""); err != nil {
+		return fmt.Errorf("make root read-only: %w", err)
+	}
+	if err := os.Chdir(c.Dir); err != nil {
+		return fmt.Errorf("working directory: %w", err)
+	}
+	return nil
+}
+
+// mirror reproduces a host system directory, or the symlink a merged-/usr system has in its
+// place, inside the sandbox.
+func (c *sandboxConfig) mirror(dir string) error {
+	info, err := os.Lstat(dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSymlink != 0 {
+		target, err := os.Readlink(dir)
+		if err != nil {
+			return err
+		}
+		return os.Symlink(target, filepath.Join(c.Root, dir))
+	}
+	return c.bind(dir, true)
+}
+
+// bind mounts the host path src at the same path inside the sandbox.
+func (c *sandboxConfig) bind(src string, readOnly bool) error {
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	target := filepath.Join(c.Root, src)
+	if info.IsDir() {
+		err = os.MkdirAll(target, 0o755)
+	} else if err = os.MkdirAll(filepath.Dir(target), 0o755); err == nil {
+		var f *os.File
+		if f, err = os.OpenFile(target, os.O_CREATE|os.O_WRONLY, 0o644); err == nil {
+			f.Close()
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if err := syscall.Mount(src, target, "", syscall.MS_BIND|syscall.MS_REC, ""); err != nil {
+		return fmt.Errorf("bind %s: %w", src, err)
+	}
+	if !readOnly {
+		return nil
+	}
+	// A user namespace may not clear flags the host mount has, so carry them over
+	flags := uintptr(syscall.MS_BIND | syscall.MS_REMOUNT | syscall.MS_RDONLY)
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(target, &st); err == nil {
+		for stFlag, msFlag := range statfsMountFlags {
+			if int64(st.Flags)&stFlag != 0 {
+				flags |= msFlag
+			}
+		}
+	}
+	if err := syscall.Mount("", target, "", flags, ""); err != nil {
+		return fmt.Errorf("make %s read-only: %w", src, err)
+	}
+	return nil
+}
+
+// statfsMountFlags maps statfs ST_* flags to the mount flags they come from.
+var statfsMountFlags = map[int64]uintptr{
+	0x2:    syscall.MS_NOSUID,
+	0x4:    syscall.MS_NODEV,
+	0x8:    syscall.MS_NOEXEC,
+	0x400:  syscall.MS_NOATIME,
+	0x800:  syscall.MS_NODIRATIME,
+	0x1000: syscall.MS_RELATIME,
+}
+
+func (c *sandboxConfig) mountTmpfs(dir string, options string) error {
+	target := filepath.Join(c.Root, dir)
+	if err := os.MkdirAll(target, 0o755); err != nil {
+		return err
+	}
+	if err := syscall.Mount("tmpfs", target, "tmpfs", syscall.MS_NOSUID|syscall.MS_NODEV, options); err != nil {
+		return fmt.Errorf("mount %s: %w", dir, err)
+	}
+	return nil
+}
+
+// mountProc gives the sandbox a /proc for its own pid namespace. The host's is never bound in
+// its place, so where a new one can't be mounted (as in containers that mask parts of /proc)
+// the sandbox can't be set up.
+func (c *sandboxConfig) mountProc() error {
+	target := filepath.Join(c.Root, "proc")
+	if err := os.MkdirAll(target, 0o555); err != nil {
+		return err
+	}
+	if err := syscall.Mount("proc", target, "proc", syscall.MS_NOSUID|syscall.MS_NODEV|syscall.MS_NOEXEC, ""); err != nil {
+		return fmt.Errorf("mount /proc: %w", err)
+	}
+	return nil
+}
+
+// mountDev gives the sandbox a /dev with only the harmless devices.
+func (c *sandboxConfig) mountDev() error {
+	if err := c.mountTmpfs("/dev", "mode=0755"); err != nil {
+		return err
+	}
+	for _, name := range sandboxDevices {
+		if _, err := os.Stat("/dev/" + name); err != nil {
+			continue
+		}
+		if err := c.bind("/dev/"+name, false); err != nil {
+			return err
+		}
+	}
+	for name, target := range map[string]string{
+		"fd": "/proc/self/fd", "stdin": "/proc/self/fd/0", "stdout": "/proc/self/fd/1", "stderr": "/proc/self/fd/2",
+	} {
+		if err := os.Symlink(target, filepath.Join(c.Root, "dev", name)); err != nil {
+			return err
+		}
+	}
+	// multiprocessing keeps its semaphores here
+	return c.mountTmpfs("/dev/shm", "mode=1777")
+}
@@ -0,0 +1,137 @@
+package gorunpython
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/ZacTyAdams/go-run-python/v2/internal/rlimit"
+)
+
+// sandboxed runs cmd in a sandbox around root and returns its combined output.
+func sandboxed(t *testing.T, s *Sandbox, root string, cmd *exec.Cmd, limits ...rlimit.Limit) (string, error) {
+	t.Helper()
+	if seccompArch == 0 {
+		t.Skip("no seccomp filter for this architecture")
+	}
+	if err := exec.Command("unshare", "-U", "-r", "-p", "-f", "--mount-proc", "true").Run(); err != nil {
+		t.Skipf("unprivileged user namespaces are not available: %v", err)
+	}
+	var out bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &out, &out
+	cleanup, err := s.apply(cmd, root, limits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+	err = cmd.Run()
+	return out.String(), err
+}
+
+func TestSandbox(t *testing.T) {
+	root := writeTree(t, "python", map[string]string{"bin/data": "tree"})
+	writable := t.TempDir()
+	script := strings.Join([]string{
+		`echo pid=$$`,
+		`echo session=$(cut -d' ' -f6 /proc/self/stat)`,
+		`echo init=$(tr '\0' ' ' </proc/1/cmdline)`,
+		`ls /dev | tr '\n' ' '; echo`,
+		`cat ` + root + `/bin/data; echo`,
+		`touch ` + root + `/bin/new 2>/dev/null && echo tree-$(echo writable)`,
+		`echo out > ` + writable + `/out`,
+		`echo fd=$(cat <&5)`,
+	}, "\n")
+	cmd := exec.Command("/bin/sh", "-c", script)
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.WriteString("inherited")
+	w.Close()
+	defer r.Close()
+	cmd.ExtraFiles = []*os.File{nil, nil, r} // fd 5, as callbacks and data channels pass theirs
+
+	out, err := sandboxed(t, &Sandbox{Writable: []string{writable}}, root, cmd)
+	if err != nil {
+		t.Fatalf("%v\n%s", err, out)
+	}
+	for _, want := range []string{"pid=1\n", "session=1\n", "init=/bin/sh -c", "tree\n", "fd=inherited\n"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output lacks %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "tree-writable") {
+		t.Error("the python tree is writable")
+	}
+	if strings.Contains(out, " tty ") {
+		t.Errorf("/dev/tty is bound into the sandbox:\n%s", out)
+	}
+	if data, _ := os.ReadFile(filepath.Join(writable, "out")); string(data) != "out\n" {
+		t.Errorf("writable directory holds %q", data)
+	}
+}
+
+func TestSandboxTerminal(t *testing.T) {
+	python, err := exec.LookPath("python3")
+	if err != nil {
+		t.Skip("no python3 on the host")
+	}
+	real, err := filepath.EvalSymlinks(python)
+	if err != nil {
+		t.Fatal(err)
+	}
+	master, slave, err := openPTY(24, 80)
+	if err != nil {
+		t.Skipf("no pty: %v", err)
+	}
+	defer master.Close()
+	defer slave.Close()
+
+	// Ordinary terminal ioctls work; pushing input into the terminal does not.
+	code := `import fcntl, sys, termios
+termios.tcgetattr(0)
+try:
+    fcntl.ioctl(0, termios.TIOCSTI, b"x")
+except PermissionError:
+    print("denied")
+`
+	cmd := exec.Command(real, "-c", code)
+	cmd.Stdin = slave
+	out, err := sandboxed(t, &Sandbox{ReadOnly: []string{filepath.Dir(filepath.Dir(real))}}, t.TempDir(), cmd)
+	if err != nil || out != "denied\n" {
+		t.Errorf("TIOCSTI in the sandbox: %v\n%s", err, out)
+	}
+}
+
+func TestSandboxConfig(t *testing.T) {
+	cfg := sandboxConfig{Root: "/r", Path: "/p", Args: []string{"/p", strings.Repeat("x", 1<<20)}, Dir: "/d"}
+	f, err := writeSandboxConfig(&cfg, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(f.Name()); !os.IsNotExist(err) {
+		t.Errorf("configuration file %s is still linked", f.Name())
+	}
+	fd, err := syscall.Dup(int(f.Fd()))
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := readSandboxConfig(strconv.Itoa(fd))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Root != cfg.Root || got.Dir != cfg.Dir || len(got.Args) != 2 || got.Args[1] != cfg.Args[1] {
+		t.Errorf("read back %s %s %s and %d arguments", got.Root, got.Path, got.Dir, len(got.Args))
+	}
+	for _, fd := range []string{"", "x", "0", "2", "-1"} {
+		if _, err := readSandboxConfig(fd); err == nil {
+			t.Errorf("readSandboxConfig(%q) succeeded", fd)
+		}
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package gorunpython
+
+import (
+	"os/exec"
+
+	"github.com/ZacTyAdams/go-run-python/v2/internal/rlimit"
+)
+
+func (s *Sandbox) apply(cmd *exec.Cmd, root string, limits []rlimit.Limit) (func(), error) {
+	return nil, ErrSandboxUnsupported
+}
@@ -3,24 +3,58 @@ package gorunpython
 import (
 	"archive/tar"
 	"bytes"
-	"compress/gzip"
 	"encoding/binary"
-	"errors"
 	"fmt"
 	"io"
 	"os"
-	"path"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 )
 
-const sealTrailerMagic = "GORUNPYSEALv1\n"
+const (
+	sealTrailerMagic   = "GORUNPYSEALv1\n"
+	sealTrailerMagicV2 = "GORUNPYSEALv2\n"
+)
+
+// SealOptions controls how a directory is packaged into a sealed payload.
+type SealOptions struct {
+	// Compression selects the payload codec. The zero value is gzip.
+	Compression Compression
+	// Level is the codec-specific compression level; 0 uses the codec default.
+	Level int
+	// Exclude lists gitignore-style patterns, relative to the sealed directory, for paths to leave
+	// out of the payload. See DefaultSealExcludes for a common starting set.
+	Exclude []string
+	// Include, when non-empty, restricts the payload to paths matching at least one of these
+	// gitignore-style patterns (a matching directory includes everything below it).
+	Include []string
+	// IgnoreFile names a gitignore-style file at the directory root whose patterns are added to
+	// Exclude. Defaults to SealIgnoreFile; the file itself is never sealed.
+	IgnoreFile string
+	// NoIgnoreFile disables reading IgnoreFile.
+	NoIgnoreFile bool
+	// Deterministic produces byte-for-byte reproducible payloads: entries are sorted by name,
+	// ownership is zeroed, modes are normalized to 0755/0644 and every entry gets the same
+	// modification time (ModTime, else SOURCE_DATE_EPOCH, else the Unix epoch).
+	Deterministic bool
+	// ModTime is the timestamp used for every entry when Deterministic is set.
+	ModTime time.Time
+}
 
 // SealDirectoryIntoBinary packages dirPath as a tar.gz payload and appends it to binaryPath,
 // producing a new sibling executable with a "-sealed" suffix.
 //
 // If binaryPath already contains a seal payload, it will be replaced.
 func SealDirectoryIntoBinary(binaryPath, dirPath string) (string, error) {
+	return SealDirectoryIntoBinaryWithOptions(binaryPath, dirPath, SealOptions{})
+}
+
+// SealDirectoryIntoBinaryWithOptions is like SealDirectoryIntoBinary but lets the caller choose
+// the payload compression. The chosen codec is recorded in the seal trailer.
+func SealDirectoryIntoBinaryWithOptions(binaryPath, dirPath string, opts SealOptions) (string, error) {
 	binaryInfo, err := os.Stat(binaryPath)
 	if err != nil {
 		return "", fmt.Errorf("stat binary: %w", err)
@@ -37,13 +71,13 @@ func SealDirectoryIntoBinary(binaryPath, dirPath string) (string, error) {
 		return "", fmt.Errorf("dirPath is not a directory: %s", dirPath)
 	}
 
-	payload, err := tarGzDirectory(dirPath)
+	payload, err := tarDirectory(dirPath, opts)
 	if err != nil {
 		return "", err
 	}
 
 	sealedPath := sealedSiblingPath(binaryPath)
-	if err := writeSealedBinary(sealedPath, binaryPath, payload, binaryInfo.Mode()); err != nil {
+	if err := writeSealedBinary(sealedPath, binaryPath, payload, opts.Compression, binaryInfo.Mode()); err != nil {
 		return "", err
 	}
 	return sealedPath, nil
@@ -52,6 +86,12 @@ func SealDirectoryIntoBinary(binaryPath, dirPath string) (string, error) {
 // SealDirectoryIntoRunningExecutable seals dirPath into the currently running executable
 // and writes a new "-sealed" executable next to it.
 func SealDirectoryIntoRunningExecutable(dirPath string) (string, error) {
+	return SealDirectoryIntoRunningExecutableWithOptions(dirPath, SealOptions{})
+}
+
+// SealDirectoryIntoRunningExecutableWithOptions is like SealDirectoryIntoRunningExecutable but
+// lets the caller choose the payload compression.
+func SealDirectoryIntoRunningExecutableWithOptions(dirPath string, opts SealOptions) (string, error) {
 	exePath, err := os.Executable()
 	if err != nil {
 		return "", fmt.Errorf("resolve executable path: %w", err)
@@ -60,7 +100,7 @@ func SealDirectoryIntoRunningExecutable(dirPath string) (string, error) {
 	if err != nil {
 		return "", fmt.Errorf("resolve executable symlink: %w", err)
 	}
-	return SealDirectoryIntoBinary(exePath, dirPath)
+	return SealDirectoryIntoBinaryWithOptions(exePath, dirPath, opts)
 }
 
 // UnsealDirectoryNextToExecutableIfPresent checks whether the running executable contains a sealed
@@ -77,7 +117,14 @@ func UnsealDirectoryNextToExecutableIfPresent() (bool, error) {
 		return false, fmt.Errorf("resolve executable symlink: %w", err)
 	}
 
-	f, err := os.Open(exePath)
+	return UnsealBinaryInto(exePath, filepath.Dir(exePath))
+}
+
+// UnsealBinaryInto extracts the sealed payload of binaryPath into destDir.
+//
+// Returns (false, nil) if binaryPath carries no payload.
+func UnsealBinaryInto(binaryPath, destDir string) (bool, error) {
+	f, err := os.Open(binaryPath)
 	if err != nil {
 		return false, fmt.Errorf("open executable: %w", err)
 	}
@@ -91,13 +138,14 @@ func UnsealDirectoryNextToExecutableIfPresent() (bool, error) {
 		return false, nil
 	}
 
-	payload := make([]byte, sealInfo.payloadSize)
-	if _, err := f.ReadAt(payload, sealInfo.payloadOffset); err != nil {
-		return false, fmt.Errorf("read sealed payload: %w", err)
+	payload := io.NewSectionReader(f, sealInfo.payloadOffset, sealInfo.payloadSize)
+	r, err := newDecompressReaderFor(payload, sealInfo.compression)
+	if err != nil {
+		return false, err
 	}
+	defer r.Close()
 
-	destDir := filepath.Dir(exePath)
-	if err := extractTarGzSafe(payload, destDir); err != nil {
+	if err := extractTar(r, destDir, DefaultExtractLimits, nil, nil); err != nil {
 		return false, err
 	}
 	return true, nil
@@ -106,6 +154,8 @@ func UnsealDirectoryNextToExecutableIfPresent() (bool, error) {
 type sealInfo struct {
 	payloadOffset int64
 	payloadSize   int64
+	trailerLen    int64
+	compression   Compression
 }
 
 func readSealInfo(f *os.File) (*sealInfo, error) {
@@ -114,20 +164,40 @@ func readSealInfo(f *os.File) (*sealInfo, error) {
 		return nil, fmt.Errorf("stat executable: %w", err)
 	}
 	size := st.Size()
-	trailerLen := int64(len(sealTrailerMagic) + 8)
-	if size < trailerLen {
-		return nil, nil
-	}
 
-	trailer := make([]byte, trailerLen)
-	if _, err := f.ReadAt(trailer, size-trailerLen); err != nil {
-		return nil, fmt.Errorf("read seal trailer: %w", err)
+	// v2 trailer: magic, one compression byte, little-endian payload size.
+	// v1 trailer: magic, little-endian payload size; the payload is always gzip.
+	trailerLen := int64(len(sealTrailerMagicV2) + 1 + 8)
+	compression := CompressionGzip
+	var sizeBytes []byte
+	if size >= trailerLen {
+		trailer := make([]byte, trailerLen)
+		if _, err := f.ReadAt(trailer, size-trailerLen); err != nil {
+			return nil, fmt.Errorf("read seal trailer: %w", err)
+		}
+		if string(trailer[:len(sealTrailerMagicV2)]) == sealTrailerMagicV2 {
+			compression = Compression(trailer[len(sealTrailerMagicV2)])
+			if !compression.valid() {
+				return nil, fmt.Errorf("unknown sealed payload compression (%d)", compression)
+			}
+			sizeBytes = trailer[len(sealTrailerMagicV2)+1:]
+		}
 	}
-	magic := string(trailer[:len(sealTrailerMagic)])
-	if magic != sealTrailerMagic {
-		return nil, nil
+	if sizeBytes == nil {
+		trailerLen = int64(len(sealTrailerMagic) + 8)
+		if size < trailerLen {
+			return nil, nil
+		}
+		trailer := make([]byte, trailerLen)
+		if _, err := f.ReadAt(trailer, size-trailerLen); err != nil {
+			return nil, fmt.Errorf("read seal trailer: %w", err)
+		}
+		if string(trailer[:len(sealTrailerMagic)]) != sealTrailerMagic {
+			return nil, nil
+		}
+		sizeBytes = trailer[len(sealTrailerMagic):]
 	}
-	payloadSizeU64 := binary.LittleEndian.Uint64(trailer[len(sealTrailerMagic):])
+	payloadSizeU64 := binary.LittleEndian.Uint64(sizeBytes)
 	if payloadSizeU64 == 0 {
 		return nil, fmt.Errorf("invalid sealed payload size (0)")
 	}
@@ -139,7 +209,12 @@ func readSealInfo(f *os.File) (*sealInfo, error) {
 	if payloadOffset < 0 {
 		return nil, fmt.Errorf("invalid sealed payload offset")
 	}
-	return &sealInfo{payloadOffset: payloadOffset, payloadSize: payloadSize}, nil
+	return &sealInfo{
+		payloadOffset: payloadOffset,
+		payloadSize:   payloadSize,
+		trailerLen:    trailerLen,
+		compression:   compression,
+	}, nil
 }
 
 func sealedSiblingPath(binaryPath string) string {
@@ -152,7 +227,7 @@ func sealedSiblingPath(binaryPath string) string {
 	return filepath.Join(dir, base+"-sealed")
 }
 
-func writeSealedBinary(outPath, inPath string, payload []byte, mode os.FileMode) error {
+func writeSealedBinary(outPath, inPath string, payload []byte, compression Compression, mode os.FileMode) error {
 	in, err := os.Open(inPath)
 	if err != nil {
 		return fmt.Errorf("open input binary: %w", err)
@@ -181,9 +256,12 @@ func writeSealedBinary(outPath, inPath string, payload []byte, mode os.FileMode)
 	if _, err := out.Write(payload); err != nil {
 		return fmt.Errorf("write sealed payload: %w", err)
 	}
-	if _, err := out.WriteString(sealTrailerMagic); err != nil {
+	if _, err := out.WriteString(sealTrailerMagicV2); err != nil {
 		return fmt.Errorf("write seal magic: %w", err)
 	}
+	if _, err := out.Write([]byte{byte(compression)}); err != nil {
+		return fmt.Errorf("write seal compression: %w", err)
+	}
 	var sizeBuf [8]byte
 	binary.LittleEndian.PutUint64(sizeBuf[:], uint64(len(payload)))
 	if _, err := out.Write(sizeBuf[:]); err != nil {
@@ -209,159 +287,114 @@ func sealedBaseSize(f *os.File) (int64, error) {
 	if info == nil {
 		return size, nil
 	}
-	trailerLen := int64(len(sealTrailerMagic) + 8)
-	return size - trailerLen - info.payloadSize, nil
+	return size - info.trailerLen - info.payloadSize, nil
 }
 
-func tarGzDirectory(dirPath string) ([]byte, error) {
-	rootAbs, err := filepath.Abs(dirPath)
+// tarDirectory packages dirPath as a tar stream compressed according to opts.
+func tarDirectory(dirPath string, opts SealOptions) ([]byte, error) {
+	entries, err := collectSealEntries(dirPath, opts)
 	if err != nil {
-		return nil, fmt.Errorf("resolve absolute directory: %w", err)
+		return nil, err
+	}
+	var normalize func(*tar.Header)
+	if opts.Deterministic {
+		modTime := opts.ModTime
+		if modTime.IsZero() {
+			if modTime, err = sourceDateEpoch(); err != nil {
+				return nil, err
+			}
+		}
+		sort.Slice(entries, func(i, j int) bool { return entries[i].name < entries[j].name })
+		normalize = func(hdr *tar.Header) { normalizeHeader(hdr, modTime) }
 	}
-	rootName := filepath.Base(rootAbs)
 
 	var buf bytes.Buffer
-	gzw := gzip.NewWriter(&buf)
-	tw := tar.NewWriter(gzw)
+	cw, err := newCompressWriter(&buf, opts.Compression, opts.Level)
+	if err != nil {
+		return nil, err
+	}
+	tw := tar.NewWriter(cw)
 
 	closeAll := func(closeErr error) ([]byte, error) {
 		_ = tw.Close()
-		_ = gzw.Close()
+		_ = cw.Close()
 		if closeErr != nil {
 			return nil, closeErr
 		}
 		return buf.Bytes(), nil
 	}
 
-	walkErr := filepath.WalkDir(rootAbs, func(fullPath string, d os.DirEntry, err error) error {
-		if err != nil {
-			return err
-		}
-		info, err := d.Info()
-		if err != nil {
-			return err
-		}
-		if info.Mode()&os.ModeSymlink != 0 {
-			return fmt.Errorf("symlinks are not supported in sealed directories: %s", fullPath)
-		}
-
-		rel, err := filepath.Rel(rootAbs, fullPath)
-		if err != nil {
-			return err
-		}
-		rel = filepath.ToSlash(rel)
-		name := rootName
-		if rel != "." {
-			name = rootName + "/" + rel
-		}
-		if info.IsDir() {
-			if !strings.HasSuffix(name, "/") {
-				name += "/"
-			}
-		}
-
-		hdr, err := tar.FileInfoHeader(info, "")
-		if err != nil {
-			return err
-		}
-		hdr.Name = name
-		if err := tw.WriteHeader(hdr); err != nil {
-			return err
-		}
-		if info.IsDir() {
-			return nil
+	for _, e := range entries {
+		if err := writeSealEntry(tw, e, normalize); err != nil {
+			return closeAll(err)
 		}
-		if !info.Mode().IsRegular() {
-			return fmt.Errorf("unsupported file type in sealed directory: %s", fullPath)
-		}
-		file, err := os.Open(fullPath)
-		if err != nil {
-			return err
-		}
-		_, copyErr := io.Copy(tw, file)
-		closeErr := file.Close()
-		if copyErr != nil {
-			return copyErr
-		}
-		if closeErr != nil {
-			return closeErr
-		}
-		return nil
-	})
-	if walkErr != nil {
-		return closeAll(walkErr)
 	}
 	if err := tw.Close(); err != nil {
 		return nil, err
 	}
-	if err := gzw.Close(); err != nil {
+	if err := cw.Close(); err != nil {
 		return nil, err
 	}
 	return buf.Bytes(), nil
 }
 
-func extractTarGzSafe(data []byte, dest string) error {
-	gzr, err := gzip.NewReader(io.NopCloser(bytes.NewReader(data)))
+// writeSealEntry writes e to tw, passing its header through normalize first when non-nil.
+func writeSealEntry(tw *tar.Writer, e sealEntry, normalize func(*tar.Header)) error {
+	hdr, err := tar.FileInfoHeader(e.info, "")
 	if err != nil {
-		return fmt.Errorf("failed to create gzip reader: %w", err)
+		return err
 	}
-	defer gzr.Close()
-
-	tr := tar.NewReader(gzr)
-	destAbs, err := filepath.Abs(dest)
+	hdr.Name = e.name
+	if normalize != nil {
+		normalize(hdr)
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	if e.info.IsDir() {
+		return nil
+	}
+	file, err := os.Open(e.fullPath)
 	if err != nil {
-		return fmt.Errorf("resolve absolute dest: %w", err)
+		return err
 	}
+	_, copyErr := io.Copy(tw, file)
+	closeErr := file.Close()
+	if copyErr != nil {
+		return copyErr
+	}
+	if closeErr != nil {
+		return closeErr
+	}
+	return nil
+}
 
-	for {
-		hdr, err := tr.Next()
-		if errors.Is(err, io.EOF) {
-			break
-		}
-		if err != nil {
-			return fmt.Errorf("failed to read tar header: %w", err)
-		}
-
-		clean := path.Clean(hdr.Name)
-		if clean == "." {
-			continue
-		}
-		if strings.HasPrefix(clean, "/") || clean == ".." || strings.HasPrefix(clean, "../") {
-			return fmt.Errorf("invalid path in sealed archive: %q", hdr.Name)
-		}
-
-		target := filepath.Join(destAbs, filepath.FromSlash(clean))
-		rel, err := filepath.Rel(destAbs, target)
-		if err != nil {
-			return fmt.Errorf("validate path in archive: %w", err)
-		}
-		if rel == ".." || strings.HasPrefix(rel, ".."+string(os.PathSeparator)) {
-			return fmt.Errorf("invalid path traversal in sealed archive: %q", hdr.Name)
-		}
+// normalizeHeader strips host-specific metadata from hdr so identical trees produce identical
+// archives regardless of who sealed them, when, or with which umask.
+func normalizeHeader(hdr *tar.Header, modTime time.Time) {
+	mode := int64(0o644)
+	if hdr.Typeflag == tar.TypeDir || hdr.Mode&0o111 != 0 {
+		mode = 0o755
+	}
+	*hdr = tar.Header{
+		Typeflag: hdr.Typeflag,
+		Name:     hdr.Name,
+		Size:     hdr.Size,
+		Mode:     mode,
+		ModTime:  modTime.UTC().Truncate(time.Second),
+	}
+}
 
-		switch hdr.Typeflag {
-		case tar.TypeDir:
-			if err := os.MkdirAll(target, 0o755); err != nil {
-				return fmt.Errorf("failed to create directory: %w", err)
-			}
-		case tar.TypeReg:
-			if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
-				return fmt.Errorf("failed to create file directory: %w", err)
-			}
-			f, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_RDWR, os.FileMode(hdr.Mode))
-			if err != nil {
-				return fmt.Errorf("failed to create file: %w", err)
-			}
-			if _, err := io.Copy(f, tr); err != nil {
-				_ = f.Close()
-				return fmt.Errorf("failed to write file content: %w", err)
-			}
-			if err := f.Close(); err != nil {
-				return fmt.Errorf("failed to close extracted file: %w", err)
-			}
-		default:
-			return fmt.Errorf("unsupported entry type in sealed archive (%c) for %q", hdr.Typeflag, hdr.Name)
-		}
+// sourceDateEpoch returns the time in SOURCE_DATE_EPOCH (see reproducible-builds.org), or the
+// Unix epoch when it is unset.
+func sourceDateEpoch() (time.Time, error) {
+	v := os.Getenv("SOURCE_DATE_EPOCH")
+	if v == "" {
+		return time.Unix(0, 0), nil
 	}
-	return nil
+	secs, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid SOURCE_DATE_EPOCH %q: %w", v, err)
+	}
+	return time.Unix(secs, 0), nil
 }
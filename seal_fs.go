@@ -0,0 +1,289 @@
+package gorunpython
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// SealedFS serves the files of a sealed payload directly from the binary, without extracting
+// them. Paths match the extracted layout, so they start with the sealed directory's name.
+//
+// The payload must have been sealed with CompressionNone or CompressionZstdSeekable.
+// A SealedFS is safe for concurrent use.
+type SealedFS struct {
+	f       *os.File
+	closer  io.Closer
+	data    io.ReaderAt
+	entries map[string]*sealedFSEntry
+}
+
+type sealedFSEntry struct {
+	name     string // full slash-separated path; "." for the root
+	size     int64
+	mode     fs.FileMode
+	modTime  time.Time
+	offset   int64 // start of the file content in the uncompressed tar stream
+	children []*sealedFSEntry
+}
+
+var (
+	_ fs.ReadDirFS  = (*SealedFS)(nil)
+	_ fs.ReadFileFS = (*SealedFS)(nil)
+	_ fs.StatFS     = (*SealedFS)(nil)
+)
+
+// OpenSealedFS returns a file system over the sealed payload of the running executable,
+// usable with http.FS, template.ParseFS and friends. It returns ErrNotSealed if the executable
+// carries no payload.
+func OpenSealedFS() (fs.FS, error) {
+	exePath, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("resolve executable path: %w", err)
+	}
+	exePath, err = filepath.EvalSymlinks(exePath)
+	if err != nil {
+		return nil, fmt.Errorf("resolve executable symlink: %w", err)
+	}
+	return OpenSealedFSFromBinary(exePath)
+}
+
+// OpenSealedFSFromBinary is like OpenSealedFS for an arbitrary sealed binary. The returned
+// SealedFS keeps the binary open until Close is called.
+func OpenSealedFSFromBinary(binaryPath string) (*SealedFS, error) {
+	f, info, err := openSealedBinary(binaryPath)
+	if err != nil {
+		return nil, err
+	}
+	sfs := &SealedFS{f: f}
+
+	payload := io.NewSectionReader(f, info.payloadOffset, info.payloadSize)
+	var size int64
+	switch info.compression {
+	case CompressionNone:
+		sfs.data, size = payload, info.payloadSize
+	case CompressionZstdSeekable:
+		zr, err := newSeekableZstdReader(payload, info.payloadSize)
+		if err != nil {
+			_ = f.Close()
+			return nil, err
+		}
+		sfs.data, sfs.closer, size = zr, zr, zr.Size()
+	default:
+		_ = f.Close()
+		return nil, fmt.Errorf("sealed payload uses %s compression, which cannot be read in place; reseal with %s or %s",
+			info.compression, CompressionNone, CompressionZstdSeekable)
+	}
+
+	if err := sfs.index(size); err != nil {
+		_ = sfs.Close()
+		return nil, err
+	}
+	return sfs, nil
+}
+
+// index reads every tar header once and records where each file's content starts.
+func (s *SealedFS) index(size int64) error {
+	root := &sealedFSEntry{name: ".", mode: fs.ModeDir | 0o555}
+	s.entries = map[string]*sealedFSEntry{".": root}
+
+	sr := io.NewSectionReader(s.data, 0, size)
+	tr := tar.NewReader(sr)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read tar header: %w", err)
+		}
+		name, err := cleanArchivePath(hdr.Name)
+		if err != nil {
+			return err
+		}
+		if name == "." {
+			continue
+		}
+		offset, err := sr.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return fmt.Errorf("locate %s: %w", hdr.Name, err)
+		}
+
+		var mode fs.FileMode
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			mode = fs.ModeDir
+		case tar.TypeReg:
+		default:
+			return fmt.Errorf("unsupported entry type in sealed archive (%c) for %q", hdr.Typeflag, hdr.Name)
+		}
+		e := s.ensureDir(path.Dir(name))
+		entry, ok := s.entries[name]
+		if !ok {
+			entry = &sealedFSEntry{name: name}
+			s.entries[name] = entry
+			e.children = append(e.children, entry)
+		}
+		entry.size = hdr.Size
+		entry.mode = mode | fs.FileMode(hdr.Mode).Perm()
+		entry.modTime = hdr.ModTime
+		entry.offset = offset
+	}
+
+	for _, e := range s.entries {
+		sort.Slice(e.children, func(i, j int) bool { return e.children[i].name < e.children[j].name })
+	}
+	return nil
+}
+
+// ensureDir returns the directory entry for name, creating it and its parents if the archive
+// did not list them explicitly.
+func (s *SealedFS) ensureDir(name string) *sealedFSEntry {
+	if e, ok := s.entries[name]; ok {
+		return e
+	}
+	parent := s.ensureDir(path.Dir(name))
+	e := &sealedFSEntry{name: name, mode: fs.ModeDir | 0o555}
+	s.entries[name] = e
+	parent.children = append(parent.children, e)
+	return e
+}
+
+func (s *SealedFS) lookup(op, name string) (*sealedFSEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	e, ok := s.entries[name]
+	if !ok {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	return e, nil
+}
+
+// Open implements fs.FS. Regular files implement io.ReaderAt and io.Seeker.
+func (s *SealedFS) Open(name string) (fs.File, error) {
+	e, err := s.lookup("open", name)
+	if err != nil {
+		return nil, err
+	}
+	if e.mode.IsDir() {
+		return &sealedFSDir{entry: e}, nil
+	}
+	return &sealedFSFile{entry: e, SectionReader: io.NewSectionReader(s.data, e.offset, e.size)}, nil
+}
+
+// ReadFile implements fs.ReadFileFS.
+func (s *SealedFS) ReadFile(name string) ([]byte, error) {
+	e, err := s.lookup("readfile", name)
+	if err != nil {
+		return nil, err
+	}
+	if e.mode.IsDir() {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: errors.New("is a directory")}
+	}
+	buf := make([]byte, e.size)
+	if _, err := s.data.ReadAt(buf, e.offset); err != nil && !errors.Is(err, io.EOF) {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: err}
+	}
+	return buf, nil
+}
+
+// ReadDir implements fs.ReadDirFS.
+func (s *SealedFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	e, err := s.lookup("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	if !e.mode.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+	}
+	return e.dirEntries(), nil
+}
+
+// Stat implements fs.StatFS.
+func (s *SealedFS) Stat(name string) (fs.FileInfo, error) {
+	e, err := s.lookup("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return sealedFSInfo{e}, nil
+}
+
+// Close releases the underlying binary.
+func (s *SealedFS) Close() error {
+	if s.closer != nil {
+		_ = s.closer.Close()
+	}
+	return s.f.Close()
+}
+
+func (e *sealedFSEntry) dirEntries() []fs.DirEntry {
+	entries := make([]fs.DirEntry, 0, len(e.children))
+	for _, c := range e.children {
+		entries = append(entries, fs.FileInfoToDirEntry(sealedFSInfo{c}))
+	}
+	return entries
+}
+
+// sealedFSInfo implements fs.FileInfo for a sealed entry.
+type sealedFSInfo struct {
+	e *sealedFSEntry
+}
+
+func (i sealedFSInfo) Name() string {
+	if i.e.name == "." {
+		return "."
+	}
+	return path.Base(i.e.name)
+}
+func (i sealedFSInfo) Size() int64        { return i.e.size }
+func (i sealedFSInfo) Mode() fs.FileMode  { return i.e.mode }
+func (i sealedFSInfo) ModTime() time.Time { return i.e.modTime }
+func (i sealedFSInfo) IsDir() bool        { return i.e.mode.IsDir() }
+func (i sealedFSInfo) Sys() any           { return nil }
+
+// sealedFSFile is an open regular file of a SealedFS.
+type sealedFSFile struct {
+	*io.SectionReader
+	entry *sealedFSEntry
+}
+
+func (f *sealedFSFile) Stat() (fs.FileInfo, error) { return sealedFSInfo{f.entry}, nil }
+func (f *sealedFSFile) Close() error               { return nil }
+
+// sealedFSDir is an open directory of a SealedFS.
+type sealedFSDir struct {
+	entry  *sealedFSEntry
+	offset int
+}
+
+func (d *sealedFSDir) Stat() (fs.FileInfo, error) { return sealedFSInfo{d.entry}, nil }
+func (d *sealedFSDir) Close() error               { return nil }
+
+func (d *sealedFSDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.entry.name, Err: errors.New("is a directory")}
+}
+
+// ReadDir implements fs.ReadDirFile.
+func (d *sealedFSDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	all := d.entry.dirEntries()[d.offset:]
+	if n <= 0 {
+		d.offset += len(all)
+		return all, nil
+	}
+	if len(all) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(all) {
+		n = len(all)
+	}
+	d.offset += n
+	return all[:n], nil
+}
@@ -0,0 +1,35 @@
+package gorunpython
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+func TestOpenSealedFS(t *testing.T) {
+	files := map[string]string{"config.json": `{"a": 1}`, "templates/index.html": "<p>hi</p>", "templates/x/y.txt": "deep"}
+	for _, c := range []Compression{CompressionNone, CompressionZstdSeekable} {
+		t.Run(c.String(), func(t *testing.T) {
+			sealed := sealTestTree(t, files, SealOptions{Compression: c})
+			fsys, err := OpenSealedFSFromBinary(sealed)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer fsys.Close()
+			if err := fstest.TestFS(fsys, "assets/config.json", "assets/templates/index.html", "assets/templates/x/y.txt"); err != nil {
+				t.Fatal(err)
+			}
+			data, err := fsys.ReadFile("assets/templates/x/y.txt")
+			if err != nil || string(data) != "deep" {
+				t.Errorf("ReadFile = %q, %v", data, err)
+			}
+		})
+	}
+}
+
+func TestOpenSealedFSNeedsSeekablePayload(t *testing.T) {
+	sealed := sealTestTree(t, map[string]string{"a": "b"}, SealOptions{Compression: CompressionGzip})
+	if fsys, err := OpenSealedFSFromBinary(sealed); err == nil {
+		fsys.Close()
+		t.Error("OpenSealedFSFromBinary accepted a gzip payload")
+	}
+}
@@ -0,0 +1,278 @@
+package gorunpython
+
+import (
+	"archive/tar"
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// SealIgnoreFile is the name of the gitignore-style file read from the root of a sealed directory.
+const SealIgnoreFile = ".sealignore"
+
+// DefaultSealExcludes lists patterns for content that rarely belongs in a sealed payload:
+// VCS metadata, Python bytecode caches and editor files.
+var DefaultSealExcludes = []string{
+	".git/",
+	".hg/",
+	".svn/",
+	"__pycache__/",
+	"*.pyc",
+	"*.pyo",
+	".DS_Store",
+	"Thumbs.db",
+	".idea/",
+	".vscode/",
+	"*.swp",
+	"*~",
+}
+
+// PreviewSeal reports the entries that SealDirectoryIntoBinaryWithOptions would place in the
+// payload for dirPath and opts, without reading file contents or writing anything.
+func PreviewSeal(dirPath string, opts SealOptions) ([]SealedEntry, error) {
+	entries, err := collectSealEntries(dirPath, opts)
+	if err != nil {
+		return nil, err
+	}
+	preview := make([]SealedEntry, 0, len(entries))
+	for _, e := range entries {
+		se := SealedEntry{
+			Name:     e.name,
+			Typeflag: tar.TypeReg,
+			Mode:     e.info.Mode().Perm(),
+			ModTime:  e.info.ModTime(),
+		}
+		if e.info.IsDir() {
+			se.Typeflag = tar.TypeDir
+		} else {
+			se.Size = e.info.Size()
+		}
+		preview = append(preview, se)
+	}
+	return preview, nil
+}
+
+// sealEntry is a file or directory selected for sealing.
+type sealEntry struct {
+	fullPath string
+	rel      string // slash-separated path relative to the sealed directory, "." for the root
+	name     string // archive name, prefixed with the sealed directory's base name
+	info     os.FileInfo
+}
+
+// collectSealEntries walks dirPath and returns the entries that pass the include/exclude rules
+// of opts and the directory's ignore file, in walk order.
+func collectSealEntries(dirPath string, opts SealOptions) ([]sealEntry, error) {
+	rootAbs, err := filepath.Abs(dirPath)
+	if err != nil {
+		return nil, fmt.Errorf("resolve absolute directory: %w", err)
+	}
+	rootName := filepath.Base(rootAbs)
+
+	excludePatterns := append([]string(nil), opts.Exclude...)
+	if !opts.NoIgnoreFile {
+		ignoreFile := opts.IgnoreFile
+		if ignoreFile == "" {
+			ignoreFile = SealIgnoreFile
+		}
+		filePatterns, err := readIgnoreFile(filepath.Join(rootAbs, ignoreFile))
+		if err != nil {
+			return nil, err
+		}
+		excludePatterns = append(excludePatterns, filePatterns...)
+		// The ignore file configures sealing; it is not part of the payload.
+		excludePatterns = append(excludePatterns, "/"+filepath.ToSlash(ignoreFile))
+	}
+	excludes := parseIgnorePatterns(excludePatterns)
+	includes := parseIgnorePatterns(opts.Include)
+
+	var entries []sealEntry
+	walkErr := filepath.WalkDir(rootAbs, func(fullPath string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(rootAbs, fullPath)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel != "." && excludes.matches(rel, info.IsDir()) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("symlinks are not supported in sealed directories: %s", fullPath)
+		}
+		if !info.IsDir() && !info.Mode().IsRegular() {
+			return fmt.Errorf("unsupported file type in sealed directory: %s", fullPath)
+		}
+
+		name := rootName
+		if rel != "." {
+			name = rootName + "/" + rel
+		}
+		if info.IsDir() {
+			name += "/"
+		}
+		entries = append(entries, sealEntry{fullPath: fullPath, rel: rel, name: name, info: info})
+		return nil
+	})
+	if walkErr != nil {
+		return nil, walkErr
+	}
+
+	if len(includes.rules) == 0 {
+		return entries, nil
+	}
+	return filterIncluded(entries, includes), nil
+}
+
+// filterIncluded keeps entries matched by an include rule (directly or through an ancestor
+// directory), the root, and directories needed to hold kept files.
+func filterIncluded(entries []sealEntry, includes ignoreMatcher) []sealEntry {
+	keep := map[string]bool{".": true}
+	for _, e := range entries {
+		if e.rel == "." || !includes.matchesWithParents(e.rel, e.info.IsDir()) {
+			continue
+		}
+		for dir := e.rel; dir != "."; dir = path.Dir(dir) {
+			keep[dir] = true
+		}
+	}
+
+	filtered := entries[:0]
+	for _, e := range entries {
+		if keep[e.rel] {
+			filtered = append(filtered, e)
+		}
+	}
+	return filtered
+}
+
+func readIgnoreFile(ignorePath string) ([]string, error) {
+	f, err := os.Open(ignorePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("open ignore file: %w", err)
+	}
+	defer f.Close()
+
+	var patterns []string
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		patterns = append(patterns, sc.Text())
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("read ignore file %s: %w", ignorePath, err)
+	}
+	return patterns, nil
+}
+
+// ignoreRule is one parsed gitignore-style pattern.
+type ignoreRule struct {
+	segments []string
+	negate   bool
+	dirOnly  bool
+}
+
+// ignoreMatcher applies gitignore-style rules; the last matching rule wins.
+type ignoreMatcher struct {
+	rules []ignoreRule
+}
+
+// parseIgnorePatterns parses gitignore-style patterns. Blank lines and '#' comments are skipped,
+// '!' negates, a trailing '/' matches only directories, a leading or inner '/' anchors the
+// pattern to the root, and '**' matches any number of path segments.
+func parseIgnorePatterns(patterns []string) ignoreMatcher {
+	var m ignoreMatcher
+	for _, p := range patterns {
+		p = strings.TrimRight(p, " \t\r")
+		if p == "" || strings.HasPrefix(p, "#") {
+			continue
+		}
+		var rule ignoreRule
+		if strings.HasPrefix(p, "!") {
+			rule.negate = true
+			p = p[1:]
+		} else if strings.HasPrefix(p, `\`) {
+			p = p[1:]
+		}
+		if strings.HasSuffix(p, "/") {
+			rule.dirOnly = true
+			p = strings.TrimRight(p, "/")
+		}
+		if p == "" {
+			continue
+		}
+		anchored := strings.Contains(p, "/")
+		p = strings.TrimPrefix(p, "/")
+		rule.segments = strings.Split(p, "/")
+		if !anchored {
+			rule.segments = append([]string{"**"}, rule.segments...)
+		}
+		m.rules = append(m.rules, rule)
+	}
+	return m
+}
+
+// matches reports whether rel (slash-separated, relative to the root) is selected by the rules.
+func (m ignoreMatcher) matches(rel string, isDir bool) bool {
+	segments := strings.Split(rel, "/")
+	matched := false
+	for _, r := range m.rules {
+		if r.dirOnly && !isDir {
+			continue
+		}
+		if matchSegments(r.segments, segments) {
+			matched = !r.negate
+		}
+	}
+	return matched
+}
+
+// matchesWithParents reports whether rel or any of its parent directories is selected.
+func (m ignoreMatcher) matchesWithParents(rel string, isDir bool) bool {
+	segments := strings.Split(rel, "/")
+	for i := 1; i <= len(segments); i++ {
+		if m.matches(strings.Join(segments[:i], "/"), i < len(segments) || isDir) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			rest := pattern[1:]
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(rest, name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		ok, err := path.Match(pattern[0], name[0])
+		if err != nil || !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
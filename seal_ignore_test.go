@@ -0,0 +1,88 @@
+package gorunpython
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestIgnoreMatcher(t *testing.T) {
+	tests := []struct {
+		patterns []string
+		path     string
+		isDir    bool
+		want     bool
+	}{
+		{[]string{"*.pyc"}, "a/b/c.pyc", false, true},
+		{[]string{"*.pyc"}, "a/b/c.py", false, false},
+		{[]string{"__pycache__/"}, "pkg/__pycache__", true, true},
+		{[]string{"__pycache__/"}, "pkg/__pycache__", false, false},
+		{[]string{"/build"}, "build", true, true},
+		{[]string{"/build"}, "src/build", true, false},
+		{[]string{"docs/*.md"}, "docs/a.md", false, true},
+		{[]string{"docs/*.md"}, "x/docs/a.md", false, false},
+		{[]string{"a/**/z"}, "a/b/c/z", false, true},
+		{[]string{"a/**/z"}, "a/z", false, true},
+		{[]string{"*.log", "!keep.log"}, "keep.log", false, false},
+		{[]string{"*.log", "!keep.log"}, "drop.log", false, true},
+		{[]string{"# comment", "", "   "}, "anything", false, false},
+		{[]string{`\#hash`}, "#hash", false, true},
+	}
+	for _, tt := range tests {
+		m := parseIgnorePatterns(tt.patterns)
+		if got := m.matches(tt.path, tt.isDir); got != tt.want {
+			t.Errorf("%q matches %q (dir %v) = %v, want %v", tt.patterns, tt.path, tt.isDir, got, tt.want)
+		}
+	}
+}
+
+func TestIgnoreMatcherParents(t *testing.T) {
+	m := parseIgnorePatterns([]string{".git/"})
+	if !m.matchesWithParents(".git/objects/ab", false) {
+		t.Error("a file below an excluded directory is not excluded")
+	}
+}
+
+func previewNames(t *testing.T, dir string, opts SealOptions) []string {
+	t.Helper()
+	entries, err := PreviewSeal(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		if !e.IsDir() {
+			names = append(names, e.Name)
+		}
+	}
+	slices.Sort(names)
+	return names
+}
+
+func TestPreviewSeal(t *testing.T) {
+	dir := writeTree(t, "app", map[string]string{
+		"main.py":                  "print(1)",
+		"pkg/mod.py":               "x = 1",
+		"pkg/__pycache__/mod.pyc":  "bytecode",
+		".git/HEAD":                "ref",
+		"notes.txt":                "todo",
+		"data/big.bin":             "0000",
+		SealIgnoreFile:             "*.txt\n",
+		"pkg/__pycache__/keep.txt": "",
+	})
+
+	got := previewNames(t, dir, SealOptions{Exclude: DefaultSealExcludes})
+	want := []string{"app/data/big.bin", "app/main.py", "app/pkg/mod.py"}
+	if !slices.Equal(got, want) {
+		t.Errorf("with default excludes and %s: %v, want %v", SealIgnoreFile, got, want)
+	}
+
+	got = previewNames(t, dir, SealOptions{Exclude: DefaultSealExcludes, Include: []string{"pkg/"}})
+	if want := []string{"app/pkg/mod.py"}; !slices.Equal(got, want) {
+		t.Errorf("with include pkg/: %v, want %v", got, want)
+	}
+
+	got = previewNames(t, dir, SealOptions{NoIgnoreFile: true, Exclude: []string{".git/", "__pycache__/", "data/"}})
+	if want := []string{"app/.sealignore", "app/main.py", "app/notes.txt", "app/pkg/mod.py"}; !slices.Equal(got, want) {
+		t.Errorf("without ignore file: %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,224 @@
+package gorunpython
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ErrNotSealed is returned when a binary does not carry a sealed payload.
+var ErrNotSealed = errors.New("binary does not contain a sealed payload")
+
+// SealedPayload describes the payload appended to a sealed binary.
+type SealedPayload struct {
+	Offset      int64
+	Size        int64
+	Compression Compression
+}
+
+// SealedEntry describes a single file or directory inside a sealed payload.
+type SealedEntry struct {
+	Name     string
+	Typeflag byte
+	Size     int64
+	Mode     os.FileMode
+	ModTime  time.Time
+}
+
+// IsDir reports whether the entry is a directory.
+func (e SealedEntry) IsDir() bool {
+	return e.Typeflag == tar.TypeDir
+}
+
+// InspectSealedBinary reports where the sealed payload of binaryPath lives and how it is compressed.
+func InspectSealedBinary(binaryPath string) (*SealedPayload, error) {
+	f, info, err := openSealedBinary(binaryPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return &SealedPayload{
+		Offset:      info.payloadOffset,
+		Size:        info.payloadSize,
+		Compression: info.compression,
+	}, nil
+}
+
+// ListSealedEntries returns the entries of the sealed payload of binaryPath in archive order.
+func ListSealedEntries(binaryPath string) ([]SealedEntry, error) {
+	var entries []SealedEntry
+	err := walkSealedPayload(binaryPath, func(hdr *tar.Header, _ io.Reader) error {
+		entries = append(entries, SealedEntry{
+			Name:     hdr.Name,
+			Typeflag: hdr.Typeflag,
+			Size:     hdr.Size,
+			Mode:     os.FileMode(hdr.Mode).Perm(),
+			ModTime:  hdr.ModTime,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// VerifySealedBinary reads the whole sealed payload of binaryPath and checks that it decompresses,
+// that every entry passes the extractor's path, type and link checks, and that file contents
+// match their recorded sizes.
+func VerifySealedBinary(binaryPath string) error {
+	var entries int
+	var total int64
+	limits := DefaultExtractLimits
+	return walkSealedPayload(binaryPath, func(hdr *tar.Header, r io.Reader) error {
+		if hdr.Typeflag == tar.TypeXGlobalHeader {
+			return nil
+		}
+		if err := checkArchiveEntry(hdr); err != nil {
+			return err
+		}
+		entries++
+		if limits.MaxEntries > 0 && entries > limits.MaxEntries {
+			return fmt.Errorf("archive has more than %d entries", limits.MaxEntries)
+		}
+		switch hdr.Typeflag {
+		case tar.TypeReg:
+			total += hdr.Size
+			if limits.MaxFileSize > 0 && hdr.Size > limits.MaxFileSize {
+				return fmt.Errorf("%s is %d bytes, over the %d byte limit", hdr.Name, hdr.Size, limits.MaxFileSize)
+			}
+			if limits.MaxTotalSize > 0 && total > limits.MaxTotalSize {
+				return fmt.Errorf("archive expands to more than %d bytes", limits.MaxTotalSize)
+			}
+			n, err := io.Copy(io.Discard, r)
+			if err != nil {
+				return fmt.Errorf("read %s: %w", hdr.Name, err)
+			}
+			if n != hdr.Size {
+				return fmt.Errorf("size mismatch for %s: header %d, content %d", hdr.Name, hdr.Size, n)
+			}
+		}
+		return nil
+	})
+}
+
+// CopySealedFile writes the contents of the regular file name from the sealed payload of
+// binaryPath to w.
+func CopySealedFile(w io.Writer, binaryPath, name string) error {
+	want, err := cleanArchivePath(name)
+	if err != nil {
+		return err
+	}
+	found := errors.New("found")
+	err = walkSealedPayload(binaryPath, func(hdr *tar.Header, r io.Reader) error {
+		clean, err := cleanArchivePath(hdr.Name)
+		if err != nil || clean != want {
+			return nil
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			return fmt.Errorf("%s is not a regular file", name)
+		}
+		if _, err := io.Copy(w, r); err != nil {
+			return fmt.Errorf("copy %s: %w", name, err)
+		}
+		return found
+	})
+	if errors.Is(err, found) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return fmt.Errorf("%s: %w", name, os.ErrNotExist)
+}
+
+// StripSealedBinary writes a copy of inPath without its sealed payload to outPath.
+// inPath and outPath may be the same file.
+func StripSealedBinary(inPath, outPath string) error {
+	in, info, err := openSealedBinary(inPath)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	st, err := in.Stat()
+	if err != nil {
+		return fmt.Errorf("stat input binary: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(outPath), "."+filepath.Base(outPath)+".strip-*")
+	if err != nil {
+		return fmt.Errorf("create output binary: %w", err)
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath)
+
+	if _, err := io.Copy(tmp, io.NewSectionReader(in, 0, info.payloadOffset)); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("copy base binary: %w", err)
+	}
+	if err := tmp.Chmod(st.Mode().Perm()); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("chmod output binary: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("close output binary: %w", err)
+	}
+	if err := os.Rename(tmpPath, outPath); err != nil {
+		return fmt.Errorf("replace output binary: %w", err)
+	}
+	return nil
+}
+
+// openSealedBinary opens binaryPath and reads its seal trailer, returning ErrNotSealed if absent.
+func openSealedBinary(binaryPath string) (*os.File, *sealInfo, error) {
+	f, err := os.Open(binaryPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("open binary: %w", err)
+	}
+	info, err := readSealInfo(f)
+	if err != nil {
+		_ = f.Close()
+		return nil, nil, err
+	}
+	if info == nil {
+		_ = f.Close()
+		return nil, nil, fmt.Errorf("%s: %w", binaryPath, ErrNotSealed)
+	}
+	return f, info, nil
+}
+
+// walkSealedPayload calls fn for each tar entry of the sealed payload of binaryPath.
+// Returning an error from fn stops the walk and returns that error.
+func walkSealedPayload(binaryPath string, fn func(hdr *tar.Header, r io.Reader) error) error {
+	f, info, err := openSealedBinary(binaryPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	payload := io.NewSectionReader(f, info.payloadOffset, info.payloadSize)
+	r, err := newDecompressReaderFor(payload, info.compression)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read tar header: %w", err)
+		}
+		if err := fn(hdr, tr); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package gorunpython
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ZacTyAdams/go-run-python/v2/internal/testtree"
+)
+
+// writeTree creates files (slash-separated names) under a new directory named name.
+func writeTree(t *testing.T, name string, files map[string]string) string {
+	t.Helper()
+	root := filepath.Join(t.TempDir(), name)
+	testtree.Write(t, root, files, 0o644)
+	return root
+}
+
+// sealTestTree seals files into a stand-in binary and returns the sealed binary's path.
+func sealTestTree(t *testing.T, files map[string]string, opts SealOptions) string {
+	t.Helper()
+	dir := writeTree(t, "assets", files)
+	bin := filepath.Join(t.TempDir(), "app")
+	if err := os.WriteFile(bin, []byte("\x7fELF not really a binary"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := SealDirectoryIntoBinaryWithOptions(bin, dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sealed
+}
+
+func TestInspectSealedBinary(t *testing.T) {
+	for _, c := range []Compression{CompressionGzip, CompressionZstd, CompressionNone, CompressionZstdSeekable} {
+		t.Run(c.String(), func(t *testing.T) {
+			sealed := sealTestTree(t, map[string]string{"a.txt": "alpha", "sub/b.txt": "beta"}, SealOptions{Compression: c})
+
+			info, err := InspectSealedBinary(sealed)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Compression != c || info.Offset != int64(len("\x7fELF not really a binary")) || info.Size <= 0 {
+				t.Errorf("InspectSealedBinary = %+v", info)
+			}
+			if err := VerifySealedBinary(sealed); err != nil {
+				t.Errorf("VerifySealedBinary: %v", err)
+			}
+
+			entries, err := ListSealedEntries(sealed)
+			if err != nil {
+				t.Fatal(err)
+			}
+			names := map[string]bool{}
+			for _, e := range entries {
+				names[e.Name] = true
+			}
+			for _, want := range []string{"assets/a.txt", "assets/sub/b.txt"} {
+				if !names[want] {
+					t.Errorf("ListSealedEntries is missing %s: %v", want, names)
+				}
+			}
+
+			var buf bytes.Buffer
+			if err := CopySealedFile(&buf, sealed, "assets/sub/b.txt"); err != nil || buf.String() != "beta" {
+				t.Errorf("CopySealedFile = %q, %v", buf.String(), err)
+			}
+			if err := CopySealedFile(&buf, sealed, "assets/missing"); !errors.Is(err, os.ErrNotExist) {
+				t.Errorf("CopySealedFile(missing) = %v", err)
+			}
+		})
+	}
+}
+
+func TestStripSealedBinary(t *testing.T) {
+	sealed := sealTestTree(t, map[string]string{"a.txt": "alpha"}, SealOptions{})
+	stripped := filepath.Join(t.TempDir(), "stripped")
+	if err := StripSealedBinary(sealed, stripped); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(stripped)
+	if err != nil || string(data) != "\x7fELF not really a binary" {
+		t.Errorf("stripped binary = %q, %v", data, err)
+	}
+	if _, err := InspectSealedBinary(stripped); !errors.Is(err, ErrNotSealed) {
+		t.Errorf("InspectSealedBinary(stripped) = %v, want ErrNotSealed", err)
+	}
+}
+
+func TestVerifySealedBinaryCorrupt(t *testing.T) {
+	sealed := sealTestTree(t, map[string]string{"a.txt": "alpha"}, SealOptions{Compression: CompressionGzip})
+	info, err := InspectSealedBinary(sealed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(sealed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := info.Offset + 10; i < info.Offset+info.Size-8; i++ {
+		data[i] ^= 0xff
+	}
+	if err := os.WriteFile(sealed, data, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifySealedBinary(sealed); err == nil {
+		t.Error("VerifySealedBinary accepted a corrupt payload")
+	}
+}
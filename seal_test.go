@@ -0,0 +1,83 @@
+package gorunpython
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTarDirectoryDeterministic(t *testing.T) {
+	files := map[string]string{"b.txt": "beta", "a/c.py": "print(1)", "z.bin": "zz"}
+	first := writeTree(t, "tree", files)
+	second := writeTree(t, "tree", files)
+	// Different mtimes and modes on the second copy must not show in the payload
+	old := time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC)
+	for _, name := range []string{"b.txt", "a/c.py", "z.bin"} {
+		p := filepath.Join(second, filepath.FromSlash(name))
+		os.Chtimes(p, old, old)
+		os.Chmod(p, 0o600)
+	}
+	t.Setenv("SOURCE_DATE_EPOCH", "1700000000")
+
+	for _, c := range []Compression{CompressionGzip, CompressionZstd, CompressionNone} {
+		opts := SealOptions{Compression: c, Deterministic: true}
+		a, err := tarDirectory(first, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := tarDirectory(second, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(a, b) {
+			t.Errorf("%s: deterministic payloads differ", c)
+		}
+	}
+
+	payload, err := tarDirectory(first, SealOptions{Compression: CompressionNone, Deterministic: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(bytes.NewReader(payload))
+	var names []string
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, hdr.Name)
+		if hdr.Uid != 0 || hdr.Gid != 0 || hdr.Uname != "" || hdr.Gname != "" {
+			t.Errorf("%s keeps ownership %d/%d %q/%q", hdr.Name, hdr.Uid, hdr.Gid, hdr.Uname, hdr.Gname)
+		}
+		if !hdr.ModTime.Equal(time.Unix(1700000000, 0)) {
+			t.Errorf("%s has mtime %v, want SOURCE_DATE_EPOCH", hdr.Name, hdr.ModTime)
+		}
+		if want := int64(0o644); hdr.Typeflag == tar.TypeReg && hdr.Mode != want {
+			t.Errorf("%s has mode %o, want %o", hdr.Name, hdr.Mode, want)
+		}
+	}
+	for i := 1; i < len(names); i++ {
+		if names[i-1] > names[i] {
+			t.Errorf("entries are not sorted: %v", names)
+			break
+		}
+	}
+}
+
+func TestSourceDateEpoch(t *testing.T) {
+	t.Setenv("SOURCE_DATE_EPOCH", "")
+	if got, err := sourceDateEpoch(); err != nil || !got.Equal(time.Unix(0, 0)) {
+		t.Errorf("unset: %v, %v", got, err)
+	}
+	t.Setenv("SOURCE_DATE_EPOCH", "not-a-number")
+	if _, err := sourceDateEpoch(); err == nil {
+		t.Error("invalid SOURCE_DATE_EPOCH accepted")
+	}
+}
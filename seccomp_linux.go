@@ -0,0 +1,170 @@
+package gorunpython
+
+import (
+	"encoding/binary"
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+// seccompAllowed are the system calls python may make in a sandbox, by name. Names a platform
+// doesn't have are skipped. Anything else fails with EPERM, or ENOSYS if it is newer than every
+// call the platform table knows, so the C library falls back as it would on an older kernel.
+var seccompAllowed = []string{
+	// files and descriptors
+	"read", "write", "readv", "writev", "pread64", "pwrite64", "preadv", "pwritev", "preadv2", "pwritev2",
+	"open", "openat", "openat2", "creat", "close", "close_range", "dup", "dup2", "dup3", "lseek",
+	"stat", "fstat", "lstat", "newfstatat", "statx", "statfs", "fstatfs", "access", "faccessat", "faccessat2",
+	"fcntl", "flock", "fsync", "fdatasync", "truncate", "ftruncate", "fallocate", "fadvise64",
+	"getdents", "getdents64", "getcwd", "chdir", "fchdir",
+	"rename", "renameat", "renameat2", "mkdir", "mkdirat", "rmdir", "link", "linkat", "unlink", "unlinkat",
+	"symlink", "symlinkat", "readlink", "readlinkat", "chmod", "fchmod", "fchmodat", "fchmodat2",
+	"chown", "fchown", "lchown", "fchownat", "umask", "utime", "utimes", "utimensat", "futimesat",
+	"getxattr", "lgetxattr", "fgetxattr", "listxattr", "llistxattr", "flistxattr",
+	"pipe", "pipe2", "ioctl", "sendfile", "splice", "tee", "copy_file_range",
+	"select", "pselect6", "poll", "ppoll", "epoll_create", "epoll_create1", "epoll_ctl", "epoll_wait",
+	"epoll_pwait", "epoll_pwait2", "eventfd", "eventfd2", "signalfd", "signalfd4",
+	"timerfd_create", "timerfd_settime", "timerfd_gettime",
+	"inotify_init", "inotify_init1", "inotify_add_watch", "inotify_rm_watch", "memfd_create",
+	// memory
+	"brk", "mmap", "munmap", "mremap", "mprotect", "madvise", "msync", "mincore", "mlock", "mlock2", "munlock",
+	"membarrier",
+	// processes, threads and signals
+	"clone", "fork", "vfork", "execve", "execveat", "wait4", "waitid", "exit", "exit_group",
+	"kill", "tkill", "tgkill", "pidfd_open", "pidfd_send_signal",
+	"rt_sigaction", "rt_sigprocmask", "rt_sigreturn", "rt_sigsuspend", "rt_sigpending", "rt_sigtimedwait",
+	"rt_sigqueueinfo", "sigaltstack", "pause", "restart_syscall",
+	"futex", "futex_waitv", "set_robust_list", "get_robust_list", "set_tid_address", "rseq", "arch_prctl", "prctl",
+	"sched_yield", "sched_getaffinity", "sched_getparam", "sched_getscheduler", "sched_getattr",
+	"sched_get_priority_max", "sched_get_priority_min", "getcpu",
+	"getpid", "getppid", "gettid", "getuid", "geteuid", "getgid", "getegid", "getgroups", "getresuid",
+	"getresgid", "getpgid", "getpgrp", "getsid", "setpgid", "setsid", "capget",
+	"getrlimit", "setrlimit", "prlimit64", "getrusage", "times", "sysinfo", "uname", "getrandom",
+	// time
+	"nanosleep", "clock_nanosleep", "clock_gettime", "clock_getres", "gettimeofday", "time",
+	"getitimer", "setitimer", "alarm",
+	// sockets; the network namespace leaves only loopback and local sockets
+	"socket", "socketpair", "connect", "accept", "accept4", "bind", "listen", "shutdown",
+	"getsockname", "getpeername", "setsockopt", "getsockopt",
+	"sendto", "recvfrom", "sendmsg", "recvmsg", "sendmmsg", "recvmmsg",
+	// System V IPC, private to the IPC namespace
+	"shmget", "shmat", "shmdt", "shmctl", "semget", "semop", "semtimedop", "semctl",
+}
+
+// seccompDeniedIoctls are terminal ioctls python may not make even on a descriptor it was
+// given: TIOCSTI pushes input into a terminal and TIOCLINUX can read and write the console.
+var seccompDeniedIoctls = []uint32{
+	0x5412, // TIOCSTI
+	0x541c, // TIOCLINUX
+}
+
+// cloneNamespaceFlags are the clone flags that would create namespaces of the sandbox's own.
+const cloneNamespaceFlags = syscall.CLONE_NEWUSER | syscall.CLONE_NEWNS | syscall.CLONE_NEWPID |
+	syscall.CLONE_NEWNET | syscall.CLONE_NEWIPC | syscall.CLONE_NEWUTS | 0x02000000 /* CLONE_NEWCGROUP */
+
+const (
+	bpfLoadAbs = 0x20 // BPF_LD | BPF_W | BPF_ABS
+	bpfJeq     = 0x15 // BPF_JMP | BPF_JEQ | BPF_K
+	bpfJge     = 0x35 // BPF_JMP | BPF_JGE | BPF_K
+	bpfJset    = 0x45 // BPF_JMP | BPF_JSET | BPF_K
+	bpfRet     = 0x06 // BPF_RET | BPF_K
+
+	seccompRetKillProcess = 0x80000000
+	seccompRetErrno       = 0x00050000
+	seccompRetAllow       = 0x7fff0000
+
+	// offsets into struct seccomp_data
+	seccompDataNr   = 0
+	seccompDataArch = 4
+	seccompDataArg0 = 16
+	seccompDataArg1 = 24
+)
+
+type sockFilter struct {
+	Code uint16
+	Jt   uint8
+	Jf   uint8
+	K    uint32
+}
+
+type sockFprog struct {
+	Len    uint16
+	Filter *sockFilter
+}
+
+// seccompFilter builds the sandbox's BPF program.
+func seccompFilter() []sockFilter {
+	stmt := func(code uint16, k uint32) sockFilter { return sockFilter{Code: code, K: k} }
+	jump := func(code uint16, k uint32, jt, jf uint8) sockFilter { return sockFilter{code, jt, jf, k} }
+
+	arg0, arg1 := uint32(seccompDataArg0), uint32(seccompDataArg1)
+	if binary.NativeEndian.Uint16([]byte{0, 1}) == 1 {
+		// the low half of the 64-bit argument, which is all of an ioctl request
+		arg0, arg1 = arg0+4, arg1+4
+	}
+
+	maxKnown := uint32(0)
+	for _, nr := range seccompSyscalls {
+		maxKnown = max(maxKnown, nr)
+	}
+
+	prog := []sockFilter{
+		stmt(bpfLoadAbs, seccompDataArch),
+		jump(bpfJeq, seccompArch, 1, 0),
+		stmt(bpfRet, seccompRetKillProcess),
+		stmt(bpfLoadAbs, seccompDataNr),
+	}
+	if seccompSyscallBit != 0 {
+		// Another ABI on the same architecture, such as x32
+		prog = append(prog,
+			jump(bpfJge, seccompSyscallBit, 0, 1),
+			stmt(bpfRet, seccompRetErrno|uint32(syscall.EPERM)))
+	}
+	prog = append(prog,
+		jump(bpfJge, maxKnown+1, 0, 1),
+		stmt(bpfRet, seccompRetErrno|uint32(syscall.ENOSYS)),
+		// clone3 passes its flags in memory the filter can't read; make the C library use clone
+		jump(bpfJeq, 435, 0, 1),
+		stmt(bpfRet, seccompRetErrno|uint32(syscall.ENOSYS)),
+		// clone, but not into new namespaces
+		jump(bpfJeq, seccompSyscalls["clone"], 0, 4),
+		stmt(bpfLoadAbs, arg0),
+		jump(bpfJset, cloneNamespaceFlags, 0, 1),
+		stmt(bpfRet, seccompRetErrno|uint32(syscall.EPERM)),
+		stmt(bpfRet, seccompRetAllow),
+	)
+	// ioctl, but not the requests that reach beyond python's own descriptors
+	denied := len(seccompDeniedIoctls)
+	prog = append(prog, jump(bpfJeq, seccompSyscalls["ioctl"], 0, uint8(denied+3)), stmt(bpfLoadAbs, arg1))
+	for i, req := range seccompDeniedIoctls {
+		prog = append(prog, jump(bpfJeq, req, uint8(denied-i), 0))
+	}
+	prog = append(prog, stmt(bpfRet, seccompRetAllow), stmt(bpfRet, seccompRetErrno|uint32(syscall.EPERM)))
+
+	for _, name := range seccompAllowed {
+		nr, ok := seccompSyscalls[name]
+		if !ok || name == "clone" || name == "ioctl" {
+			continue
+		}
+		prog = append(prog, jump(bpfJeq, nr, 0, 1), stmt(bpfRet, seccompRetAllow))
+	}
+	return append(prog, stmt(bpfRet, seccompRetErrno|uint32(syscall.EPERM)))
+}
+
+// installSeccomp sets no_new_privs and installs the sandbox filter on the calling thread.
+func installSeccomp() error {
+	const (
+		prSetNoNewPrivs   = 38
+		prSetSeccomp      = 22
+		seccompModeFilter = 2
+	)
+	if _, _, errno := syscall.RawSyscall6(syscall.SYS_PRCTL, prSetNoNewPrivs, 1, 0, 0, 0, 0); errno != 0 {
+		return fmt.Errorf("set no_new_privs: %w", errno)
+	}
+	filter := seccompFilter()
+	prog := sockFprog{Len: uint16(len(filter)), Filter: &filter[0]}
+	if _, _, errno := syscall.RawSyscall6(syscall.SYS_PRCTL, prSetSeccomp, seccompModeFilter, uintptr(unsafe.Pointer(&prog)), 0, 0, 0); errno != 0 {
+		return fmt.Errorf("install seccomp filter: %w", errno)
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package gorunpython
+
+import "syscall"
+
+const seccompArch = 0xc000003e // AUDIT_ARCH_X86_64
+
+// seccompSyscallBit marks x32 system calls, which the sandbox turns away.
+const seccompSyscallBit = 0x40000000
+
+// seccompSyscalls numbers the allowed system calls on linux/amd64.
+var seccompSyscalls = map[string]uint32{
+	"read": syscall.SYS_READ, "write": syscall.SYS_WRITE, "readv": syscall.SYS_READV, "writev": syscall.SYS_WRITEV,
+	"pread64": syscall.SYS_PREAD64, "pwrite64": syscall.SYS_PWRITE64, "preadv": syscall.SYS_PREADV,
+	"pwritev": syscall.SYS_PWRITEV, "preadv2": 327, "pwritev2": 328,
+	"open": syscall.SYS_OPEN, "openat": syscall.SYS_OPENAT, "openat2": 437, "creat": syscall.SYS_CREAT,
+	"close": syscall.SYS_CLOSE, "close_range": 436, "dup": syscall.SYS_DUP, "dup2": syscall.SYS_DUP2,
+	"dup3": syscall.SYS_DUP3, "lseek": syscall.SYS_LSEEK,
+	"stat": syscall.SYS_STAT, "fstat": syscall.SYS_FSTAT, "lstat": syscall.SYS_LSTAT,
+	"newfstatat": syscall.SYS_NEWFSTATAT, "statx": 332, "statfs": syscall.SYS_STATFS, "fstatfs": syscall.SYS_FSTATFS,
+	"access": syscall.SYS_ACCESS, "faccessat": syscall.SYS_FACCESSAT, "faccessat2": 439,
+	"fcntl": syscall.SYS_FCNTL, "flock": syscall.SYS_FLOCK, "fsync": syscall.SYS_FSYNC,
+	"fdatasync": syscall.SYS_FDATASYNC, "truncate": syscall.SYS_TRUNCATE, "ftruncate": syscall.SYS_FTRUNCATE,
+	"fallocate": syscall.SYS_FALLOCATE, "fadvise64": syscall.SYS_FADVISE64,
+	"getdents": syscall.SYS_GETDENTS, "getdents64": syscall.SYS_GETDENTS64, "getcwd": syscall.SYS_GETCWD,
+	"chdir": syscall.SYS_CHDIR, "fchdir": syscall.SYS_FCHDIR,
+	"rename": syscall.SYS_RENAME, "renameat": syscall.SYS_RENAMEAT, "renameat2": 316,
+	"mkdir": syscall.SYS_MKDIR, "mkdirat": syscall.SYS_MKDIRAT, "rmdir": syscall.SYS_RMDIR,
+	"link": syscall.SYS_LINK, "linkat": syscall.SYS_LINKAT, "unlink": syscall.SYS_UNLINK,
+	"unlinkat": syscall.SYS_UNLINKAT, "symlink": syscall.SYS_SYMLINK, "symlinkat": syscall.SYS_SYMLINKAT,
+	"readlink": syscall.SYS_READLINK, "readlinkat": syscall.SYS_READLINKAT,
+	"chmod": syscall.SYS_CHMOD, "fchmod": syscall.SYS_FCHMOD, "fchmodat": syscall.SYS_FCHMODAT, "fchmodat2": 452,
+	"chown": syscall.SYS_CHOWN, "fchown": syscall.SYS_FCHOWN, "lchown": syscall.SYS_LCHOWN,
+	"fchownat": syscall.SYS_FCHOWNAT, "umask": syscall.SYS_UMASK, "utime": syscall.SYS_UTIME,
+	"utimes": syscall.SYS_UTIMES, "utimensat": syscall.SYS_UTIMENSAT, "futimesat": syscall.SYS_FUTIMESAT,
+	"getxattr": syscall.SYS_GETXATTR, "lgetxattr": syscall.SYS_LGETXATTR, "fgetxattr": syscall.SYS_FGETXATTR,
+	"listxattr": syscall.SYS_LISTXATTR, "llistxattr": syscall.SYS_LLISTXATTR, "flistxattr": syscall.SYS_FLISTXATTR,
+	"pipe": syscall.SYS_PIPE, "pipe2": syscall.SYS_PIPE2, "ioctl": syscall.SYS_IOCTL,
+	"sendfile": syscall.SYS_SENDFILE, "splice": syscall.SYS_SPLICE, "tee": syscall.SYS_TEE, "copy_file_range": 326,
+	"select": syscall.SYS_SELECT, "pselect6": syscall.SYS_PSELECT6, "poll": syscall.SYS_POLL,
+	"ppoll": syscall.SYS_PPOLL, "epoll_create": syscall.SYS_EPOLL_CREATE, "epoll_create1": syscall.SYS_EPOLL_CREATE1,
+	"epoll_ctl": syscall.SYS_EPOLL_CTL, "epoll_wait": syscall.SYS_EPOLL_WAIT, "epoll_pwait": syscall.SYS_EPOLL_PWAIT,
+	"epoll_pwait2": 441, "eventfd": syscall.SYS_EVENTFD, "eventfd2": syscall.SYS_EVENTFD2,
+	"signalfd": syscall.SYS_SIGNALFD, "signalfd4": syscall.SYS_SIGNALFD4,
+	"timerfd_create": syscall.SYS_TIMERFD_CREATE, "timerfd_settime": syscall.SYS_TIMERFD_SETTIME,
+	"timerfd_gettime": syscall.SYS_TIMERFD_GETTIME, "inotify_init": syscall.SYS_INOTIFY_INIT,
+	"inotify_init1": syscall.SYS_INOTIFY_INIT1, "inotify_add_watch": syscall.SYS_INOTIFY_ADD_WATCH,
+	"inotify_rm_watch": syscall.SYS_INOTIFY_RM_WATCH, "memfd_create": 319,
+	"brk": syscall.SYS_BRK, "mmap": syscall.SYS_MMAP, "munmap": syscall.SYS_MUNMAP, "mremap": syscall.SYS_MREMAP,
+	"mprotect": syscall.SYS_MPROTECT, "madvise": syscall.SYS_MADVISE, "msync": syscall.SYS_MSYNC,
+	"mincore": syscall.SYS_MINCORE, "mlock": syscall.SYS_MLOCK, "mlock2": 325, "munlock": syscall.SYS_MUNLOCK,
+	"membarrier": 324,
+	"clone":      syscall.SYS_CLONE, "fork": syscall.SYS_FORK, "vfork": syscall.SYS_VFORK, "execve": syscall.SYS_EXECVE,
+	"execveat": 322, "wait4": syscall.SYS_WAIT4, "waitid": syscall.SYS_WAITID, "exit": syscall.SYS_EXIT,
+	"exit_group": syscall.SYS_EXIT_GROUP, "kill": syscall.SYS_KILL, "tkill": syscall.SYS_TKILL,
+	"tgkill": syscall.SYS_TGKILL, "pidfd_open": 434, "pidfd_send_signal": 424,
+	"rt_sigaction": syscall.SYS_RT_SIGACTION, "rt_sigprocmask": syscall.SYS_RT_SIGPROCMASK,
+	"rt_sigreturn": syscall.SYS_RT_SIGRETURN, "rt_sigsuspend": syscall.SYS_RT_SIGSUSPEND,
+	"rt_sigpending": syscall.SYS_RT_SIGPENDING, "rt_sigtimedwait": syscall.SYS_RT_SIGTIMEDWAIT,
+	"rt_sigqueueinfo": syscall.SYS_RT_SIGQUEUEINFO, "sigaltstack": syscall.SYS_SIGALTSTACK,
+	"pause": syscall.SYS_PAUSE, "restart_syscall": syscall.SYS_RESTART_SYSCALL,
+	"futex": syscall.SYS_FUTEX, "futex_waitv": 449, "set_robust_list": syscall.SYS_SET_ROBUST_LIST,
+	"get_robust_list": syscall.SYS_GET_ROBUST_LIST, "set_tid_address": syscall.SYS_SET_TID_ADDRESS, "rseq": 334,
+	"arch_prctl": syscall.SYS_ARCH_PRCTL, "prctl": syscall.SYS_PRCTL,
+	"sched_yield": syscall.SYS_SCHED_YIELD, "sched_getaffinity": syscall.SYS_SCHED_GETAFFINITY,
+	"sched_getparam": syscall.SYS_SCHED_GETPARAM, "sched_getscheduler": syscall.SYS_SCHED_GETSCHEDULER,
+	"sched_getattr": 315, "sched_get_priority_max": syscall.SYS_SCHED_GET_PRIORITY_MAX,
+	"sched_get_priority_min": syscall.SYS_SCHED_GET_PRIORITY_MIN, "getcpu": 309,
+	"getpid": syscall.SYS_GETPID, "getppid": syscall.SYS_GETPPID, "gettid": syscall.SYS_GETTID,
+	"getuid": syscall.SYS_GETUID, "geteuid": syscall.SYS_GETEUID, "getgid": syscall.SYS_GETGID,
+	"getegid": syscall.SYS_GETEGID, "getgroups": syscall.SYS_GETGROUPS, "getresuid": syscall.SYS_GETRESUID,
+	"getresgid": syscall.SYS_GETRESGID, "getpgid": syscall.SYS_GETPGID, "getpgrp": syscall.SYS_GETPGRP,
+	"getsid": syscall.SYS_GETSID, "setpgid": syscall.SYS_SETPGID, "setsid": syscall.SYS_SETSID,
+	"capget": syscall.SYS_CAPGET, "getrlimit": syscall.SYS_GETRLIMIT, "setrlimit": syscall.SYS_SETRLIMIT,
+	"prlimit64": syscall.SYS_PRLIMIT64, "getrusage": syscall.SYS_GETRUSAGE, "times": syscall.SYS_TIMES,
+	"sysinfo": syscall.SYS_SYSINFO, "uname": syscall.SYS_UNAME, "getrandom": 318,
+	"nanosleep": syscall.SYS_NANOSLEEP, "clock_nanosleep": syscall.SYS_CLOCK_NANOSLEEP,
+	"clock_gettime": syscall.SYS_CLOCK_GETTIME, "clock_getres": syscall.SYS_CLOCK_GETRES,
+	"gettimeofday": syscall.SYS_GETTIMEOFDAY, "time": syscall.SYS_TIME, "getitimer": syscall.SYS_GETITIMER,
+	"setitimer": syscall.SYS_SETITIMER, "alarm": syscall.SYS_ALARM,
+	"socket": syscall.SYS_SOCKET, "socketpair": syscall.SYS_SOCKETPAIR, "connect": syscall.SYS_CONNECT,
+	"accept": syscall.SYS_ACCEPT, "accept4": syscall.SYS_ACCEPT4, "bind": syscall.SYS_BIND,
+	"listen": syscall.SYS_LISTEN, "shutdown": syscall.SYS_SHUTDOWN, "getsockname": syscall.SYS_GETSOCKNAME,
+	"getpeername": syscall.SYS_GETPEERNAME, "setsockopt": syscall.SYS_SETSOCKOPT,
+	"getsockopt": syscall.SYS_GETSOCKOPT, "sendto": syscall.SYS_SENDTO, "recvfrom": syscall.SYS_RECVFROM,
+	"sendmsg": syscall.SYS_SENDMSG, "recvmsg": syscall.SYS_RECVMSG, "sendmmsg": 307, "recvmmsg": syscall.SYS_RECVMMSG,
+	"shmget": syscall.SYS_SHMGET, "shmat": syscall.SYS_SHMAT, "shmdt": syscall.SYS_SHMDT, "shmctl": syscall.SYS_SHMCTL,
+	"semget": syscall.SYS_SEMGET, "semop": syscall.SYS_SEMOP, "semtimedop": syscall.SYS_SEMTIMEDOP,
+	"semctl": syscall.SYS_SEMCTL,
+}
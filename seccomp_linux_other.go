@@ -0,0 +1,10 @@
+//go:build linux && !amd64 && !arm64
+
+package gorunpython
+
+// No seccomp filter is defined for this architecture, so Run refuses sandboxed specs.
+const seccompArch = 0
+
+const seccompSyscallBit = 0
+
+var seccompSyscalls = map[string]uint32{}
@@ -0,0 +1,106 @@
+package gorunpython
+
+import (
+	"encoding/binary"
+	"syscall"
+	"testing"
+)
+
+// runFilter evaluates the sandbox's BPF program for one system call the way the kernel would.
+func runFilter(t *testing.T, prog []sockFilter, arch, nr uint32, args ...uint64) uint32 {
+	t.Helper()
+	data := make([]byte, 64) // struct seccomp_data
+	binary.NativeEndian.PutUint32(data[seccompDataNr:], nr)
+	binary.NativeEndian.PutUint32(data[seccompDataArch:], arch)
+	for i, a := range args {
+		binary.NativeEndian.PutUint64(data[seccompDataArg0+8*i:], a)
+	}
+	var acc uint32
+	for pc := 0; pc < len(prog); pc++ {
+		ins := prog[pc]
+		switch ins.Code {
+		case bpfLoadAbs:
+			acc = binary.NativeEndian.Uint32(data[ins.K:])
+		case bpfRet:
+			return ins.K
+		case bpfJeq, bpfJge, bpfJset:
+			taken := map[uint16]bool{bpfJeq: acc == ins.K, bpfJge: acc >= ins.K, bpfJset: acc&ins.K != 0}[ins.Code]
+			if taken {
+				pc += int(ins.Jt)
+			} else {
+				pc += int(ins.Jf)
+			}
+		default:
+			t.Fatalf("unexpected instruction %#x at %d", ins.Code, pc)
+		}
+	}
+	t.Fatal("filter ran off its end")
+	return 0
+}
+
+func TestSeccompFilter(t *testing.T) {
+	if seccompArch == 0 {
+		t.Skip("no seccomp filter for this architecture")
+	}
+	prog := seccompFilter()
+	if len(prog) > 4096 {
+		t.Fatalf("filter has %d instructions, more than the kernel accepts", len(prog))
+	}
+	maxKnown := uint32(0)
+	for _, nr := range seccompSyscalls {
+		maxKnown = max(maxKnown, nr)
+	}
+	eperm := seccompRetErrno | uint32(syscall.EPERM)
+	enosys := seccompRetErrno | uint32(syscall.ENOSYS)
+
+	tests := []struct {
+		name string
+		arch uint32
+		nr   uint32
+		args []uint64
+		want uint32
+	}{
+		{"read", seccompArch, seccompSyscalls["read"], nil, seccompRetAllow},
+		{"openat", seccompArch, seccompSyscalls["openat"], nil, seccompRetAllow},
+		{"mount", seccompArch, syscall.SYS_MOUNT, nil, eperm},
+		{"ptrace", seccompArch, syscall.SYS_PTRACE, nil, eperm},
+		{"unknown newer call", seccompArch, maxKnown + 1, nil, enosys},
+		{"clone3", seccompArch, 435, nil, enosys},
+		{"other architecture", seccompArch ^ 1, seccompSyscalls["read"], nil, seccompRetKillProcess},
+		{"thread", seccompArch, seccompSyscalls["clone"], []uint64{syscall.CLONE_VM | syscall.CLONE_THREAD}, seccompRetAllow},
+		{"new namespace", seccompArch, seccompSyscalls["clone"], []uint64{syscall.CLONE_NEWUSER}, eperm},
+		{"TCGETS", seccompArch, seccompSyscalls["ioctl"], []uint64{0, syscall.TCGETS}, seccompRetAllow},
+		{"FIONREAD", seccompArch, seccompSyscalls["ioctl"], []uint64{1, syscall.TIOCINQ}, seccompRetAllow},
+		{"TIOCSTI", seccompArch, seccompSyscalls["ioctl"], []uint64{0, syscall.TIOCSTI}, eperm},
+		{"TIOCLINUX", seccompArch, seccompSyscalls["ioctl"], []uint64{0, 0x541c}, eperm},
+		// The kernel takes the request as 32 bits, so high bits must not get TIOCSTI through.
+		{"TIOCSTI high bits", seccompArch, seccompSyscalls["ioctl"], []uint64{0, 1<<32 | syscall.TIOCSTI}, eperm},
+	}
+	if seccompSyscallBit != 0 {
+		tests = append(tests, struct {
+			name string
+			arch uint32
+			nr   uint32
+			args []uint64
+			want uint32
+		}{"x32", seccompArch, seccompSyscallBit | seccompSyscalls["read"], nil, eperm})
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := runFilter(t, prog, tt.arch, tt.nr, tt.args...); got != tt.want {
+				t.Errorf("filter returned %#x, want %#x", got, tt.want)
+			}
+		})
+	}
+
+	// Every allowed call the platform knows is let through.
+	for _, name := range seccompAllowed {
+		nr, ok := seccompSyscalls[name]
+		if !ok || name == "clone" {
+			continue
+		}
+		if got := runFilter(t, prog, seccompArch, nr, 0, 0); got != seccompRetAllow {
+			t.Errorf("%s returned %#x", name, got)
+		}
+	}
+}
@@ -0,0 +1,297 @@
+package gorunpython
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// ErrPTYUnsupported is returned by StartSession for SessionPTY on platforms without PTY support.
+var ErrPTYUnsupported = errors.New("pty sessions are not supported on this platform")
+
+// PythonPrompt matches the interactive interpreter waiting for a new statement.
+var PythonPrompt = regexp.MustCompile(`>>> $`)
+
+// SessionOption configures StartSession.
+type SessionOption func(*sessionOptions)
+
+type sessionOptions struct {
+	args       []string
+	dir        string
+	env        []string
+	pty        bool
+	rows, cols uint16
+}
+
+// SessionArgs replaces the default arguments, which start the interactive interpreter
+// unbuffered and without its banner ("-i", "-q", "-u").
+func SessionArgs(args ...string) SessionOption {
+	return func(o *sessionOptions) { o.args = args }
+}
+
+// SessionDir sets the session's working directory.
+func SessionDir(dir string) SessionOption {
+	return func(o *sessionOptions) { o.dir = dir }
+}
+
+// SessionEnv adds variables on top of the isolation profile, e.g. "PYTHON_BASIC_REPL=1" for the
+// plain REPL of Python 3.13 and later in a PTY.
+func SessionEnv(env ...string) SessionOption {
+	return func(o *sessionOptions) { o.env = append(o.env, env...) }
+}
+
+// SessionPTY runs python on a pseudo-terminal of the given size, so it behaves as it does in a
+// terminal: line editing, echo, prompts on the terminal and job control keys. Linux only.
+func SessionPTY(rows, cols uint16) SessionOption {
+	return func(o *sessionOptions) { o.pty, o.rows, o.cols = true, rows, cols }
+}
+
+// A Session is a running python driven through its standard streams. Output from stdout and
+// stderr arrives merged, in order, through Read and the Expect methods; input goes in through
+// Write. A Session is safe for use by one reader and one writer at a time.
+type Session struct {
+	cmd           *exec.Cmd
+	input         io.WriteCloser
+	pty           *os.File
+	stopCallbacks func()
+
+	mu       sync.Mutex
+	buf      []byte
+	readErr  error
+	changed  chan struct{}
+	atPrompt bool
+
+	waitOnce sync.Once
+	waitErr  error
+}
+
+// StartSession starts python for interactive use, by default as a REPL over pipes.
+func (p *pythonInstance) StartSession(opts ...SessionOption) (*Session, error) {
+	o := sessionOptions{args: []string{"-i", "-q", "-u"}}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	cmd := exec.Command(p.Python, o.args...)
+	cmd.Dir = o.dir
+	cmd.Env = append(pythonEnv(), o.env...)
+	s := &Session{cmd: cmd, changed: make(chan struct{})}
+
+	var output io.Reader
+	if o.pty {
+		master, slave, err := openPTY(o.rows, o.cols)
+		if err != nil {
+			return nil, err
+		}
+		defer slave.Close()
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = slave, slave, slave
+		cmd.SysProcAttr = ptySysProcAttr()
+		s.pty, s.input, output = master, master, master
+	} else {
+		stdin, err := cmd.StdinPipe()
+		if err != nil {
+			return nil, err
+		}
+		// One pipe for both streams keeps their order
+		r, w, err := os.Pipe()
+		if err != nil {
+			stdin.Close()
+			return nil, err
+		}
+		defer w.Close()
+		cmd.Stdout, cmd.Stderr = w, w
+		s.input, output = stdin, r
+	}
+
+	// With a PTY the input and output are the same master file
+	closeStreams := func() {
+		if c, ok := output.(io.Closer); ok {
+			c.Close()
+		}
+		if s.pty == nil {
+			s.input.Close()
+		}
+	}
+	callbacksStarted, stopCallbacks, err := p.registeredCallbacks().attach(cmd)
+	if err != nil {
+		closeStreams()
+		return nil, err
+	}
+	s.stopCallbacks = stopCallbacks
+	if err := cmd.Start(); err != nil {
+		stopCallbacks()
+		closeStreams()
+		return nil, err
+	}
+	callbacksStarted()
+	go s.pump(output)
+	return s, nil
+}
+
+// pump moves python's output into the session buffer until it ends.
+func (s *Session) pump(r io.Reader) {
+	chunk := make([]byte, 32*1024)
+	for {
+		n, err := r.Read(chunk)
+		s.mu.Lock()
+		s.buf = append(s.buf, chunk[:n]...)
+		if err != nil {
+			// A PTY reports EIO once the last process using it has gone
+			s.readErr = io.EOF
+			if c, ok := r.(io.Closer); ok && s.pty == nil {
+				c.Close()
+			}
+		}
+		close(s.changed)
+		s.changed = make(chan struct{})
+		s.mu.Unlock()
+		if err != nil {
+			return
+		}
+	}
+}
+
+// Write sends p to python's input.
+func (s *Session) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	s.atPrompt = false
+	s.mu.Unlock()
+	return s.input.Write(p)
+}
+
+// SendLine sends line followed by a newline.
+func (s *Session) SendLine(line string) error {
+	_, err := s.Write([]byte(line + "\n"))
+	return err
+}
+
+// Read reads output python has written, blocking until there is some. It returns io.EOF once
+// python has exited and all output has been read.
+func (s *Session) Read(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.atPrompt = false
+	for len(s.buf) == 0 {
+		if s.readErr != nil {
+			return 0, s.readErr
+		}
+		changed := s.changed
+		s.mu.Unlock()
+		<-changed
+		s.mu.Lock()
+	}
+	n := copy(p, s.buf)
+	s.buf = s.buf[n:]
+	return n, nil
+}
+
+// Expect waits until python's output matches re and returns the output up to and including
+// the match, which is consumed. It fails if ctx ends or python exits first; the error then
+// comes with the unmatched output, which is left for the next read.
+func (s *Session) Expect(ctx context.Context, re *regexp.Regexp) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.atPrompt = false
+	for {
+		if loc := re.FindIndex(s.buf); loc != nil {
+			out := string(s.buf[:loc[1]])
+			s.buf = s.buf[loc[1]:]
+			return out, nil
+		}
+		if s.readErr != nil {
+			return string(s.buf), fmt.Errorf("expect %s: python exited: %w", re, s.readErr)
+		}
+		changed := s.changed
+		s.mu.Unlock()
+		select {
+		case <-changed:
+			s.mu.Lock()
+		case <-ctx.Done():
+			s.mu.Lock()
+			return string(s.buf), fmt.Errorf("expect %s: %w", re, ctx.Err())
+		}
+	}
+}
+
+// ExpectString waits for text to appear in python's output, as Expect does.
+func (s *Session) ExpectString(ctx context.Context, text string) (string, error) {
+	return s.Expect(ctx, regexp.MustCompile(regexp.QuoteMeta(text)))
+}
+
+// Eval runs a single statement in a REPL session and returns what it printed, without the
+// prompt. It waits for the first prompt on its own. Compound statements need the blank line
+// that ends them in the REPL, and their "... " prompts appear in the output.
+func (s *Session) Eval(ctx context.Context, code string) (string, error) {
+	s.mu.Lock()
+	atPrompt := s.atPrompt
+	s.mu.Unlock()
+	if !atPrompt {
+		if _, err := s.Expect(ctx, PythonPrompt); err != nil {
+			return "", err
+		}
+	}
+	if err := s.SendLine(code); err != nil {
+		return "", err
+	}
+	out, err := s.Expect(ctx, PythonPrompt)
+	if err != nil {
+		return out, err
+	}
+	s.mu.Lock()
+	s.atPrompt = true
+	s.mu.Unlock()
+
+	out = strings.TrimSuffix(out, ">>> ")
+	if s.pty != nil {
+		// The terminal echoes the input and ends lines with \r\n
+		out = strings.ReplaceAll(out, "\r\n", "\n")
+		out = strings.TrimPrefix(out, code+"\n")
+	}
+	return out, nil
+}
+
+// Resize changes the size of a PTY session's terminal.
+func (s *Session) Resize(rows, cols uint16) error {
+	if s.pty == nil {
+		return errors.New("session has no pty")
+	}
+	return setWinsize(s.pty, rows, cols)
+}
+
+// Wait waits for python to exit.
+func (s *Session) Wait() error {
+	s.waitOnce.Do(func() {
+		s.waitErr = s.cmd.Wait()
+		s.stopCallbacks()
+		if s.pty != nil {
+			s.pty.Close()
+		}
+	})
+	return s.waitErr
+}
+
+// Close ends the session: it closes python's input (sends end-of-file on a PTY), which ends the
+// REPL, and waits for python to exit.
+func (s *Session) Close() error {
+	if s.pty != nil {
+		s.pty.Write([]byte{4})
+	} else {
+		s.input.Close()
+	}
+	return s.Wait()
+}
+
+// Kill stops python at once.
+func (s *Session) Kill() error {
+	if err := s.cmd.Process.Kill(); err != nil {
+		return err
+	}
+	s.Wait()
+	return nil
+}
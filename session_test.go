@@ -0,0 +1,125 @@
+package gorunpython
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func hostPythonInstance(t *testing.T) *pythonInstance {
+	t.Helper()
+	python, err := exec.LookPath("python3")
+	if err != nil {
+		t.Skip("no python3 on the host")
+	}
+	return &pythonInstance{Python: python}
+}
+
+func TestSessionEval(t *testing.T) {
+	p := hostPythonInstance(t)
+	tests := []struct {
+		name string
+		opts []SessionOption
+	}{
+		{"pipes", nil},
+		{"pty", []SessionOption{SessionPTY(24, 80), SessionEnv("PYTHON_BASIC_REPL=1")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := p.StartSession(tt.opts...)
+			if errors.Is(err, ErrPTYUnsupported) {
+				t.Skip(err)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer s.Kill()
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+
+			for _, e := range []struct{ code, want string }{{"print(6 * 7)", "42\n"}, {"x = 1", ""}, {"x + 1", "2\n"}} {
+				if out, err := s.Eval(ctx, e.code); err != nil || out != e.want {
+					t.Errorf("Eval(%q) = %q, %v; want %q", e.code, out, err, e.want)
+				}
+			}
+			if out, err := s.Eval(ctx, "import sys; print('err', file=sys.stderr)"); err != nil || out != "err\n" {
+				t.Errorf("stderr = %q, %v", out, err)
+			}
+			if err := s.Close(); err != nil {
+				t.Errorf("Close = %v", err)
+			}
+		})
+	}
+}
+
+func TestSessionExpect(t *testing.T) {
+	p := hostPythonInstance(t)
+	s, err := p.StartSession(SessionArgs("-u", "-c", "print('ready'); import sys; print(sys.stdin.readline().upper(), end='')"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Kill()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if out, err := s.ExpectString(ctx, "ready\n"); err != nil || out != "ready\n" {
+		t.Fatalf("ExpectString = %q, %v", out, err)
+	}
+	short, cancelShort := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancelShort()
+	if _, err := s.Expect(short, regexp.MustCompile("never")); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expect past its deadline = %v", err)
+	}
+	if err := s.SendLine("hello"); err != nil {
+		t.Fatal(err)
+	}
+	if out, err := s.Expect(ctx, regexp.MustCompile("never")); err == nil || out != "HELLO\n" {
+		t.Errorf("Expect after exit = %q, %v; want the unmatched output and an error", out, err)
+	}
+	rest, err := io.ReadAll(s)
+	if err != nil || string(rest) != "HELLO\n" {
+		t.Errorf("remaining output = %q, %v", rest, err)
+	}
+	if err := s.Wait(); err != nil {
+		t.Errorf("Wait = %v", err)
+	}
+}
+
+func TestSessionStartFailure(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("counts descriptors through /proc")
+	}
+	p := &pythonInstance{Python: filepath.Join(t.TempDir(), "missing")}
+	open := func() int {
+		fds, err := os.ReadDir("/proc/self/fd")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(fds)
+	}
+	before := open()
+	for _, opts := range [][]SessionOption{nil, {SessionPTY(24, 80)}} {
+		if s, err := p.StartSession(opts...); err == nil {
+			s.Kill()
+			t.Fatal("StartSession of a missing python succeeded")
+		}
+	}
+	if after := open(); after != before {
+		t.Errorf("%d descriptors open after failed starts, %d before", after, before)
+	}
+}
+
+func TestSessionResizeWithoutPTY(t *testing.T) {
+	s := &Session{}
+	if err := s.Resize(24, 80); err == nil || !strings.Contains(err.Error(), "no pty") {
+		t.Errorf("Resize = %v", err)
+	}
+}
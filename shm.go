@@ -0,0 +1,50 @@
+package gorunpython
+
+import (
+	"errors"
+	"os"
+)
+
+// ErrDataChannelUnsupported is returned by the data channel and shared segments on platforms
+// without Unix sockets and shared memory.
+var ErrDataChannelUnsupported = errors.New("data channels are not supported on this platform")
+
+// A SharedSegment is a block of shared memory backed by a file descriptor, which can be
+// handed to a Python process that maps the same pages. Write appends to it, growing it as
+// needed, so an Arrow IPC writer can stream straight into shared memory.
+type SharedSegment struct {
+	f    *os.File
+	mem  []byte
+	size int
+}
+
+// Write appends p to the segment.
+func (s *SharedSegment) Write(p []byte) (int, error) {
+	if need := s.size + len(p); need > len(s.mem) {
+		if err := s.grow(max(need, 2*len(s.mem))); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(s.mem[s.size:], p)
+	s.size += n
+	return n, nil
+}
+
+// Bytes returns the data written to the segment. It shares the segment's memory and is
+// valid until the next Write or Close.
+func (s *SharedSegment) Bytes() []byte { return s.mem[:s.size:s.size] }
+
+// Len returns the number of bytes written to the segment.
+func (s *SharedSegment) Len() int { return s.size }
+
+// Reset empties the segment, keeping its memory.
+func (s *SharedSegment) Reset() { s.size = 0 }
+
+// Close unmaps the segment and closes its descriptor.
+func (s *SharedSegment) Close() error {
+	err := s.unmap()
+	if cerr := s.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
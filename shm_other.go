@@ -0,0 +1,12 @@
+//go:build !unix
+
+package gorunpython
+
+// NewSharedSegment is only supported on Unix.
+func NewSharedSegment(capacity int) (*SharedSegment, error) {
+	return nil, ErrDataChannelUnsupported
+}
+
+func (s *SharedSegment) grow(capacity int) error { return ErrDataChannelUnsupported }
+
+func (s *SharedSegment) unmap() error { return nil }
@@ -0,0 +1,75 @@
+//go:build unix
+
+package gorunpython
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// NewSharedSegment creates an empty shared segment with room for capacity bytes. It lives in
+// /dev/shm when that exists and is removed from the file system at once, so it goes away
+// with the last descriptor or mapping.
+func NewSharedSegment(capacity int) (*SharedSegment, error) {
+	dir := os.TempDir()
+	if st, err := os.Stat("/dev/shm"); err == nil && st.IsDir() {
+		dir = "/dev/shm"
+	}
+	f, err := os.CreateTemp(dir, "gorunpython-data-*")
+	if err != nil {
+		return nil, fmt.Errorf("create shared segment: %w", err)
+	}
+	os.Remove(f.Name())
+	s := &SharedSegment{f: f}
+	if err := s.grow(max(capacity, 64<<10)); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// openSharedSegment maps size bytes of a segment received from python. Mapped pages past the
+// end of the file would fault on access, so size must be within the file.
+func openSharedSegment(f *os.File, size int) (*SharedSegment, error) {
+	st, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("shared segment: %w", err)
+	}
+	if size < 0 || int64(size) > st.Size() {
+		return nil, fmt.Errorf("shared segment of %d bytes holds %d", st.Size(), size)
+	}
+	s := &SharedSegment{f: f, size: size}
+	if size > 0 {
+		mem, err := syscall.Mmap(int(f.Fd()), 0, size, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+		if err != nil {
+			return nil, fmt.Errorf("map shared segment: %w", err)
+		}
+		s.mem = mem
+	}
+	return s, nil
+}
+
+func (s *SharedSegment) grow(capacity int) error {
+	if err := s.unmap(); err != nil {
+		return err
+	}
+	if err := s.f.Truncate(int64(capacity)); err != nil {
+		return fmt.Errorf("grow shared segment: %w", err)
+	}
+	mem, err := syscall.Mmap(int(s.f.Fd()), 0, capacity, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+	if err != nil {
+		return fmt.Errorf("map shared segment: %w", err)
+	}
+	s.mem = mem
+	return nil
+}
+
+func (s *SharedSegment) unmap() error {
+	if s.mem == nil {
+		return nil
+	}
+	err := syscall.Munmap(s.mem)
+	s.mem = nil
+	return err
+}
@@ -0,0 +1,230 @@
+package gorunpython
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// The seekable zstd layout follows the zstd seekable format: the stream is a sequence of
+// independent zstd frames, each holding at most seekableFrameSize bytes, followed by a skippable
+// frame containing a seek table. Ordinary zstd decoders read it as a normal stream; readers that
+// understand the seek table can decompress any byte range by inflating only the frames it spans.
+const (
+	seekableFrameSize      = 1 << 20
+	seekableSkippableMagic = 0x184D2A5E
+	seekableFooterMagic    = 0x8F92EAB1
+	seekableFooterLen      = 9
+	seekableEntryLen       = 8
+	seekableChecksumFlag   = 0x80
+)
+
+// seekableZstdWriter compresses its input into independent fixed-size zstd frames and writes the
+// seek table on Close.
+type seekableZstdWriter struct {
+	w      io.Writer
+	enc    *zstd.Encoder
+	buf    []byte
+	frames [][2]uint32 // compressed size, decompressed size
+}
+
+func newSeekableZstdWriter(w io.Writer, level zstd.EncoderLevel) (*seekableZstdWriter, error) {
+	enc, err := zstd.NewWriter(nil, zstd.WithEncoderLevel(level), zstd.WithEncoderConcurrency(1))
+	if err != nil {
+		return nil, fmt.Errorf("create zstd writer: %w", err)
+	}
+	return &seekableZstdWriter{w: w, enc: enc, buf: make([]byte, 0, seekableFrameSize)}, nil
+}
+
+func (s *seekableZstdWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		n := min(len(p), seekableFrameSize-len(s.buf))
+		s.buf = append(s.buf, p[:n]...)
+		p = p[n:]
+		written += n
+		if len(s.buf) == seekableFrameSize {
+			if err := s.flushFrame(); err != nil {
+				return written, err
+			}
+		}
+	}
+	return written, nil
+}
+
+func (s *seekableZstdWriter) flushFrame() error {
+	if len(s.buf) == 0 {
+		return nil
+	}
+	frame := s.enc.EncodeAll(s.buf, nil)
+	if _, err := s.w.Write(frame); err != nil {
+		return fmt.Errorf("write zstd frame: %w", err)
+	}
+	s.frames = append(s.frames, [2]uint32{uint32(len(frame)), uint32(len(s.buf))})
+	s.buf = s.buf[:0]
+	return nil
+}
+
+func (s *seekableZstdWriter) Close() error {
+	if err := s.flushFrame(); err != nil {
+		return err
+	}
+	_ = s.enc.Close()
+
+	tableLen := len(s.frames)*seekableEntryLen + seekableFooterLen
+	table := make([]byte, 8, 8+tableLen)
+	binary.LittleEndian.PutUint32(table[0:], seekableSkippableMagic)
+	binary.LittleEndian.PutUint32(table[4:], uint32(tableLen))
+	for _, f := range s.frames {
+		table = binary.LittleEndian.AppendUint32(table, f[0])
+		table = binary.LittleEndian.AppendUint32(table, f[1])
+	}
+	table = binary.LittleEndian.AppendUint32(table, uint32(len(s.frames)))
+	table = append(table, 0) // descriptor: no per-frame checksums
+	table = binary.LittleEndian.AppendUint32(table, seekableFooterMagic)
+	if _, err := s.w.Write(table); err != nil {
+		return fmt.Errorf("write zstd seek table: %w", err)
+	}
+	return nil
+}
+
+// seekableFrame locates one frame of a seekable zstd stream.
+type seekableFrame struct {
+	compOffset   int64
+	compSize     int64
+	decompOffset int64
+	decompSize   int64
+}
+
+// seekableZstdReader provides random access to the decompressed content of a seekable zstd
+// stream. The most recently used frame is cached, so sequential reads inflate each frame once.
+type seekableZstdReader struct {
+	r      io.ReaderAt
+	frames []seekableFrame
+	size   int64
+	dec    *zstd.Decoder
+
+	mu       sync.Mutex
+	cacheIdx int
+	cache    []byte
+}
+
+// newSeekableZstdReader parses the seek table at the end of the size-byte stream in r.
+func newSeekableZstdReader(r io.ReaderAt, size int64) (*seekableZstdReader, error) {
+	if size < seekableFooterLen+8 {
+		return nil, fmt.Errorf("seekable zstd stream too short")
+	}
+	footer := make([]byte, seekableFooterLen)
+	if _, err := r.ReadAt(footer, size-seekableFooterLen); err != nil {
+		return nil, fmt.Errorf("read zstd seek table footer: %w", err)
+	}
+	if binary.LittleEndian.Uint32(footer[5:]) != seekableFooterMagic {
+		return nil, fmt.Errorf("zstd seek table not found")
+	}
+	numFrames := int64(binary.LittleEndian.Uint32(footer[0:]))
+	entryLen := int64(seekableEntryLen)
+	if footer[4]&seekableChecksumFlag != 0 {
+		entryLen += 4
+	}
+	tableLen := numFrames*entryLen + seekableFooterLen
+	tableStart := size - tableLen - 8
+	if tableStart < 0 {
+		return nil, fmt.Errorf("invalid zstd seek table size (%d frames)", numFrames)
+	}
+
+	table := make([]byte, tableLen+8)
+	if _, err := r.ReadAt(table, tableStart); err != nil {
+		return nil, fmt.Errorf("read zstd seek table: %w", err)
+	}
+	if binary.LittleEndian.Uint32(table[0:]) != seekableSkippableMagic ||
+		int64(binary.LittleEndian.Uint32(table[4:])) != tableLen {
+		return nil, fmt.Errorf("invalid zstd seek table header")
+	}
+
+	frames := make([]seekableFrame, 0, numFrames)
+	var compOffset, decompOffset int64
+	for i := int64(0); i < numFrames; i++ {
+		entry := table[8+i*entryLen:]
+		f := seekableFrame{
+			compOffset:   compOffset,
+			compSize:     int64(binary.LittleEndian.Uint32(entry[0:])),
+			decompOffset: decompOffset,
+			decompSize:   int64(binary.LittleEndian.Uint32(entry[4:])),
+		}
+		frames = append(frames, f)
+		compOffset += f.compSize
+		decompOffset += f.decompSize
+	}
+	if compOffset != tableStart {
+		return nil, fmt.Errorf("zstd seek table does not match stream size")
+	}
+
+	dec, err := zstd.NewReader(nil, zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		return nil, fmt.Errorf("create zstd reader: %w", err)
+	}
+	return &seekableZstdReader{r: r, frames: frames, size: decompOffset, dec: dec, cacheIdx: -1}, nil
+}
+
+// Size returns the total decompressed size.
+func (z *seekableZstdReader) Size() int64 {
+	return z.size
+}
+
+func (z *seekableZstdReader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, fmt.Errorf("negative offset")
+	}
+	z.mu.Lock()
+	defer z.mu.Unlock()
+
+	n := 0
+	for n < len(p) {
+		if off >= z.size {
+			return n, io.EOF
+		}
+		idx := sort.Search(len(z.frames), func(i int) bool {
+			return z.frames[i].decompOffset+z.frames[i].decompSize > off
+		})
+		data, err := z.frame(idx)
+		if err != nil {
+			return n, err
+		}
+		copied := copy(p[n:], data[off-z.frames[idx].decompOffset:])
+		n += copied
+		off += int64(copied)
+	}
+	return n, nil
+}
+
+// frame returns the decompressed content of frame idx. z.mu must be held.
+func (z *seekableZstdReader) frame(idx int) ([]byte, error) {
+	if idx == z.cacheIdx {
+		return z.cache, nil
+	}
+	f := z.frames[idx]
+	compressed := make([]byte, f.compSize)
+	if _, err := z.r.ReadAt(compressed, f.compOffset); err != nil {
+		return nil, fmt.Errorf("read zstd frame %d: %w", idx, err)
+	}
+	z.cacheIdx = -1
+	data, err := z.dec.DecodeAll(compressed, z.cache[:0])
+	if err != nil {
+		return nil, fmt.Errorf("decompress zstd frame %d: %w", idx, err)
+	}
+	if int64(len(data)) != f.decompSize {
+		return nil, fmt.Errorf("zstd frame %d: expected %d bytes, got %d", idx, f.decompSize, len(data))
+	}
+	z.cacheIdx, z.cache = idx, data
+	return data, nil
+}
+
+// Close releases the decoder.
+func (z *seekableZstdReader) Close() error {
+	z.dec.Close()
+	return nil
+}